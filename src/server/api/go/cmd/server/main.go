@@ -27,6 +27,7 @@ import (
 	"github.com/memodb-io/Luminox/internal/infra/cache"
 	dbpkg "github.com/memodb-io/Luminox/internal/infra/db"
 	"github.com/memodb-io/Luminox/internal/modules/handler"
+	"github.com/memodb-io/Luminox/internal/modules/service"
 	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
 	"github.com/memodb-io/Luminox/internal/router"
 	"github.com/memodb-io/Luminox/internal/telemetry"
@@ -88,6 +89,7 @@ func main() {
 	sessionHandler := do.MustInvoke[*handler.SessionHandler](inj)
 	diskHandler := do.MustInvoke[*handler.DiskHandler](inj)
 	artifactHandler := do.MustInvoke[*handler.ArtifactHandler](inj)
+	shareHandler := do.MustInvoke[*handler.ShareHandler](inj)
 	taskHandler := do.MustInvoke[*handler.TaskHandler](inj)
 	toolHandler := do.MustInvoke[*handler.ToolHandler](inj)
 	agentSkillsHandler := do.MustInvoke[*handler.AgentSkillsHandler](inj)
@@ -102,6 +104,7 @@ func main() {
 		SessionHandler:     sessionHandler,
 		DiskHandler:        diskHandler,
 		ArtifactHandler:    artifactHandler,
+		ShareHandler:       shareHandler,
 		TaskHandler:        taskHandler,
 		ToolHandler:        toolHandler,
 		AgentSkillsHandler: agentSkillsHandler,
@@ -126,6 +129,11 @@ func main() {
 		}
 	}()
 
+	// prune direct uploads that were never finalized
+	sweepCtx, stopSweep := context.WithCancel(context.Background())
+	defer stopSweep()
+	go bootstrap.SweepExpiredUploads(sweepCtx, do.MustInvoke[service.ArtifactService](inj), log, bootstrap.UploadSweepInterval)
+
 	// graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,83 @@
+package bootstrap
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// backfillSessionsBatchSize is the number of sessions looked up per query
+const backfillSessionsBatchSize = 100
+
+// BackfillMessageSeq numbers the messages stored before messages had a seq by
+// (created_at, id) within their session, after the messages that already have
+// one, and moves each session counter past its messages. Each session is
+// numbered in its own transaction, and only sessions that still hold seq 0
+// messages are touched, so it is cheap to run on every start.
+func BackfillMessageSeq(ctx context.Context, db *gorm.DB, log *zap.Logger) error {
+	db = db.WithContext(ctx)
+	backfilled := 0
+	lastID := uuid.Nil.String()
+	for {
+		var sessionIDs []string
+		if err := db.Raw(`
+			SELECT id FROM sessions
+			WHERE id > ? AND id IN (SELECT DISTINCT session_id FROM messages WHERE seq = 0)
+			ORDER BY id LIMIT ?`, lastID, backfillSessionsBatchSize).
+			Scan(&sessionIDs).Error; err != nil {
+			return err
+		}
+
+		for _, sessionID := range sessionIDs {
+			if err := backfillSessionMessageSeq(db, sessionID); err != nil {
+				return err
+			}
+		}
+		backfilled += len(sessionIDs)
+
+		if len(sessionIDs) < backfillSessionsBatchSize {
+			break
+		}
+		lastID = sessionIDs[len(sessionIDs)-1]
+	}
+
+	if backfilled > 0 {
+		log.Sugar().Infow("backfilled message seq", "sessions", backfilled)
+	}
+	return nil
+}
+
+// backfillSessionMessageSeq numbers the seq 0 messages of one session after
+// its highest seq
+func backfillSessionMessageSeq(db *gorm.DB, sessionID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Lock the session first, so that no message is appended while it is numbered
+		var lastSeq []int64
+		if err := tx.Raw(`
+			SELECT GREATEST(last_message_seq, (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE session_id = sessions.id))
+			FROM sessions WHERE id = ? FOR UPDATE`, sessionID).
+			Scan(&lastSeq).Error; err != nil {
+			return err
+		}
+		if len(lastSeq) == 0 {
+			// The session was deleted meanwhile
+			return nil
+		}
+
+		if err := tx.Exec(`
+			UPDATE messages SET seq = numbered.seq
+			FROM (
+				SELECT id, ? + ROW_NUMBER() OVER (ORDER BY created_at, id) AS seq
+				FROM messages WHERE session_id = ? AND seq = 0
+			) AS numbered
+			WHERE messages.id = numbered.id`, lastSeq[0], sessionID).Error; err != nil {
+			return err
+		}
+
+		return tx.Exec(`
+			UPDATE sessions SET last_message_seq = GREATEST(last_message_seq, (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE session_id = ?))
+			WHERE id = ?`, sessionID, sessionID).Error
+	})
+}
@@ -55,9 +55,17 @@ func BuildContainer() *do.Injector {
 				&model.Session{},
 				&model.Task{},
 				&model.Message{},
+				&model.Checkpoint{},
+				&model.SessionTools{},
 				&model.Block{},
 				&model.Disk{},
 				&model.Artifact{},
+				&model.ArtifactVersion{},
+				&model.Directory{},
+				&model.ArtifactUpload{},
+				&model.DiskSnapshot{},
+				&model.DiskSnapshotEntry{},
+				&model.DiskShare{},
 				&model.AssetReference{},
 				&model.ToolReference{},
 				&model.ToolSOP{},
@@ -65,6 +73,10 @@ func BuildContainer() *do.Injector {
 				&model.Metric{},
 				&model.AgentSkills{},
 			)
+
+			if err := BackfillMessageSeq(context.Background(), d, log); err != nil {
+				return nil, err
+			}
 		}
 
 		// ensure default project exists
@@ -179,6 +191,9 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[repo.AssetReferenceRepo](i),
 		), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (repo.ShareRepo, error) {
+		return repo.NewShareRepo(do.MustInvoke[*gorm.DB](i)), nil
+	})
 	do.Provide(inj, func(i *do.Injector) (repo.TaskRepo, error) {
 		return repo.NewTaskRepo(do.MustInvoke[*gorm.DB](i)), nil
 	})
@@ -210,18 +225,32 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[*mq.Publisher](i),
 			do.MustInvoke[*config.Config](i),
 			do.MustInvoke[*redis.Client](i),
+			do.MustInvoke[service.DiskService](i),
+			do.MustInvoke[service.ArtifactService](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.BlockService, error) {
 		return service.NewBlockService(do.MustInvoke[repo.BlockRepo](i)), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.DiskService, error) {
-		return service.NewDiskService(do.MustInvoke[repo.DiskRepo](i)), nil
+		return service.NewDiskService(
+			do.MustInvoke[repo.DiskRepo](i),
+			do.MustInvoke[*redis.Client](i),
+		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.ArtifactService, error) {
 		return service.NewArtifactService(
 			do.MustInvoke[repo.ArtifactRepo](i),
 			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[*redis.Client](i),
+		), nil
+	})
+	do.Provide(inj, func(i *do.Injector) (service.ShareService, error) {
+		return service.NewShareService(
+			do.MustInvoke[repo.ShareRepo](i),
+			do.MustInvoke[repo.ArtifactRepo](i),
+			do.MustInvoke[*blob.S3Deps](i),
+			do.MustInvoke[*config.Config](i),
 		), nil
 	})
 	do.Provide(inj, func(i *do.Injector) (service.TaskService, error) {
@@ -273,6 +302,9 @@ func BuildContainer() *do.Injector {
 			do.MustInvoke[*config.Config](i),
 		), nil
 	})
+	do.Provide(inj, func(i *do.Injector) (*handler.ShareHandler, error) {
+		return handler.NewShareHandler(do.MustInvoke[service.ShareService](i)), nil
+	})
 	do.Provide(inj, func(i *do.Injector) (*handler.TaskHandler, error) {
 		return handler.NewTaskHandler(do.MustInvoke[service.TaskService](i)), nil
 	})
@@ -0,0 +1,39 @@
+package bootstrap
+
+import (
+	"context"
+	"time"
+
+	"github.com/memodb-io/Luminox/internal/modules/service"
+	"go.uber.org/zap"
+)
+
+const (
+	// UploadSweepInterval is how often expired direct uploads are pruned
+	UploadSweepInterval = 10 * time.Minute
+	// uploadSweepGrace delays pruning past the expiry, so that a finalize started
+	// right before an upload expired is not cut short
+	uploadSweepGrace = time.Hour
+)
+
+// SweepExpiredUploads prunes the expired direct uploads every interval, until
+// ctx is done. Concurrent sweepers of several instances are harmless.
+func SweepExpiredUploads(ctx context.Context, svc service.ArtifactService, log *zap.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := svc.PruneExpiredUploads(ctx, time.Now().Add(-uploadSweepGrace))
+		if err != nil && ctx.Err() == nil {
+			log.Sugar().Warnw("failed to prune expired uploads", "pruned", n, "err", err)
+		} else if n > 0 {
+			log.Sugar().Infow("pruned expired uploads", "pruned", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -83,7 +83,8 @@ type TelemetryCfg struct {
 }
 
 type ArtifactCfg struct {
-	MaxUploadSizeBytes int64 // Maximum file upload size in bytes
+	MaxUploadSizeBytes       int64 // Maximum file upload size in bytes
+	MaxDirectUploadSizeBytes int64 // Maximum size in bytes of files uploaded directly to storage with presigned URLs
 }
 
 type Config struct {
@@ -125,8 +126,9 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("core.baseURL", "http://127.0.0.1:8019")
 	v.SetDefault("telemetry.otlpEndpoint", "http://127.0.0.1:4317")
 	v.SetDefault("telemetry.enabled", true)
-	v.SetDefault("telemetry.sampleRatio", 1.0)            // Default 100% sampling
-	v.SetDefault("artifact.maxUploadSizeBytes", 16777216) // Default 16MB (16 * 1024 * 1024 bytes)
+	v.SetDefault("telemetry.sampleRatio", 1.0)                    // Default 100% sampling
+	v.SetDefault("artifact.maxUploadSizeBytes", 16777216)         // Default 16MB (16 * 1024 * 1024 bytes)
+	v.SetDefault("artifact.maxDirectUploadSizeBytes", 5368709120) // Default 5GB, the largest object S3 can copy in one request
 }
 
 func Load() (*Config, error) {
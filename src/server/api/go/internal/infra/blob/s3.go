@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	stdmime "mime"
 	"mime/multipart"
 	"net/url"
 	"path/filepath"
@@ -163,6 +164,138 @@ func (s *S3Deps) PresignGet(ctx context.Context, key string, expire time.Duratio
 	return ps.URL, nil
 }
 
+// PresignDownload is like PresignGet, but the response asks browsers to save
+// the object under filename instead of its content-addressed key
+func (s *S3Deps) PresignDownload(ctx context.Context, key string, filename string, expire time.Duration) (string, error) {
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+	disposition := stdmime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	ps, err := s.Presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     &s.Bucket,
+		Key:                        &key,
+		ResponseContentDisposition: &disposition,
+	}, func(po *s3.PresignOptions) {
+		po.Expires = expire
+	})
+	if err != nil {
+		return "", err
+	}
+	return ps.URL, nil
+}
+
+var (
+	// ErrMissingParts is returned when a multipart upload is completed before all its parts were uploaded
+	ErrMissingParts = errors.New("multipart upload is missing parts")
+	// ErrObjectNotFound is returned when an object does not exist
+	ErrObjectNotFound = errors.New("object not found")
+)
+
+// CreateMultipartUpload starts a multipart upload for key and returns its upload ID
+func (s *S3Deps) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	params := &s3.CreateMultipartUploadInput{
+		Bucket:      &s.Bucket,
+		Key:         &key,
+		ContentType: &contentType,
+	}
+	if s.SSE != nil {
+		params.ServerSideEncryption = *s.SSE
+	}
+	out, err := s.Client.CreateMultipartUpload(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("create multipart upload: %w", err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// Generate a pre-signed PUT URL for one part of a multipart upload
+func (s *S3Deps) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expire time.Duration) (string, error) {
+	ps, err := s.Presigner.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:     &s.Bucket,
+		Key:        &key,
+		UploadId:   &uploadID,
+		PartNumber: aws.Int32(partNumber),
+	}, func(po *s3.PresignOptions) {
+		po.Expires = expire
+	})
+	if err != nil {
+		return "", err
+	}
+	return ps.URL, nil
+}
+
+// CompleteMultipartUpload assembles the parts of a multipart upload into one object.
+// The parts are listed from S3, so clients don't have to report their ETags.
+func (s *S3Deps) CompleteMultipartUpload(ctx context.Context, key, uploadID string, partCount int32) error {
+	var parts []s3types.CompletedPart
+	var marker *string
+	for {
+		out, err := s.Client.ListParts(ctx, &s3.ListPartsInput{
+			Bucket:           &s.Bucket,
+			Key:              &key,
+			UploadId:         &uploadID,
+			PartNumberMarker: marker,
+		})
+		if err != nil {
+			return fmt.Errorf("list multipart upload parts: %w", err)
+		}
+		for _, p := range out.Parts {
+			parts = append(parts, s3types.CompletedPart{ETag: p.ETag, PartNumber: p.PartNumber})
+		}
+		if !aws.ToBool(out.IsTruncated) {
+			break
+		}
+		marker = out.NextPartNumberMarker
+	}
+
+	if int32(len(parts)) != partCount {
+		return fmt.Errorf("%w: %d of %d uploaded", ErrMissingParts, len(parts), partCount)
+	}
+
+	_, err := s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.Bucket,
+		Key:             &key,
+		UploadId:        &uploadID,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		return fmt.Errorf("complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// ObjectExists reports whether an object is stored at key
+func (s *S3Deps) ObjectExists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: &s.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("head object: %w", err)
+	}
+	return true, nil
+}
+
+// AbortMultipartUpload discards a multipart upload and its uploaded parts
+func (s *S3Deps) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   &s.Bucket,
+		Key:      &key,
+		UploadId: &uploadID,
+	})
+	if err != nil {
+		return fmt.Errorf("abort multipart upload: %w", err)
+	}
+	return nil
+}
+
 // Add helper function to clean ETag
 func cleanETag(etag string) string {
 	if etag == "" {
@@ -172,19 +305,9 @@ func cleanETag(etag string) string {
 	return strings.Trim(etag, `"`)
 }
 
-// uploadWithDedup performs content-addressed deduplicated upload.
-// It searches for existing objects under keyPrefix that contain the given sumHex in the key.
-// If found, returns its metadata; otherwise uploads the new content using date + sumHex + ext as key.
-func (u *S3Deps) uploadWithDedup(
-	ctx context.Context,
-	keyPrefix string,
-	sumHex string,
-	contentType string,
-	ext string,
-	size int64,
-	body io.Reader,
-	metadata map[string]string,
-) (*model.Asset, error) {
+// findBySHA256 searches for an existing object under keyPrefix that contains
+// sumHex in its key and returns its metadata, or nil when there is none
+func (u *S3Deps) findBySHA256(ctx context.Context, keyPrefix string, sumHex string, contentType string) *model.Asset {
 	// Check for existing object with pagination support
 	listInput := &s3.ListObjectsV2Input{
 		Bucket: &u.Bucket,
@@ -196,7 +319,7 @@ func (u *S3Deps) uploadWithDedup(
 		listInput.ContinuationToken = continuationToken
 		result, err := u.Client.ListObjectsV2(ctx, listInput)
 		if err != nil {
-			break
+			return nil
 		}
 
 		if result.Contents != nil {
@@ -213,7 +336,7 @@ func (u *S3Deps) uploadWithDedup(
 							SHA256: sumHex,
 							MIME:   contentType,
 							SizeB:  aws.ToInt64(headResult.ContentLength),
-						}, nil
+						}
 					}
 				}
 			}
@@ -221,14 +344,37 @@ func (u *S3Deps) uploadWithDedup(
 
 		// Check if there are more pages
 		if !aws.ToBool(result.IsTruncated) {
-			break
+			return nil
 		}
 		continuationToken = result.NextContinuationToken
 	}
+}
 
-	// No existing file found, upload new file with date prefix
+// contentKey returns the content-addressed key for new objects under keyPrefix
+func contentKey(keyPrefix string, sumHex string, ext string) string {
 	datePrefix := time.Now().UTC().Format("2006/01/02")
-	key := fmt.Sprintf("%s/%s/%s%s", keyPrefix, datePrefix, sumHex, ext)
+	return fmt.Sprintf("%s/%s/%s%s", keyPrefix, datePrefix, sumHex, ext)
+}
+
+// uploadWithDedup performs content-addressed deduplicated upload.
+// It searches for existing objects under keyPrefix that contain the given sumHex in the key.
+// If found, returns its metadata; otherwise uploads the new content using date + sumHex + ext as key.
+func (u *S3Deps) uploadWithDedup(
+	ctx context.Context,
+	keyPrefix string,
+	sumHex string,
+	contentType string,
+	ext string,
+	size int64,
+	body io.Reader,
+	metadata map[string]string,
+) (*model.Asset, error) {
+	if existing := u.findBySHA256(ctx, keyPrefix, sumHex, contentType); existing != nil {
+		return existing, nil
+	}
+
+	// No existing file found, upload new file with date prefix
+	key := contentKey(keyPrefix, sumHex, ext)
 
 	input := &s3.PutObjectInput{
 		Bucket:      aws.String(u.Bucket),
@@ -271,17 +417,22 @@ func (u *S3Deps) UploadFormFile(ctx context.Context, keyPrefix string, fh *multi
 	if _, err := io.Copy(&buf, file); err != nil {
 		return nil, err
 	}
-	fileContent := buf.Bytes()
 
+	return u.UploadBytes(ctx, keyPrefix, fh.Filename, buf.Bytes())
+}
+
+// UploadBytes uploads in-memory file content to S3 with the same deduplication
+// and MIME detection as UploadFormFile
+func (u *S3Deps) UploadBytes(ctx context.Context, keyPrefix string, filename string, fileContent []byte) (*model.Asset, error) {
 	// Calculate SHA256 of the file content
 	h := sha256.New()
 	h.Write(fileContent)
 	sumHex := hex.EncodeToString(h.Sum(nil))
 
-	ext := strings.ToLower(filepath.Ext(fh.Filename))
+	ext := strings.ToLower(filepath.Ext(filename))
 
 	// Detect MIME type from file content, with extension-based refinement for text files
-	contentType := mime.DetectMimeType(fileContent, fh.Filename)
+	contentType := mime.DetectMimeType(fileContent, filename)
 
 	return u.uploadWithDedup(
 		ctx,
@@ -293,7 +444,7 @@ func (u *S3Deps) UploadFormFile(ctx context.Context, keyPrefix string, fh *multi
 		bytes.NewReader(fileContent),
 		map[string]string{
 			"sha256": sumHex,
-			"name":   fh.Filename,
+			"name":   filename,
 		},
 	)
 }
@@ -416,6 +567,113 @@ func (u *S3Deps) DownloadFile(ctx context.Context, key string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DownloadFileRange downloads length bytes starting at offset with a ranged GET,
+// so only the requested window of the object is transferred
+func (u *S3Deps) DownloadFileRange(ctx context.Context, key string, offset, length int64) ([]byte, error) {
+	if key == "" {
+		return nil, errors.New("key is empty")
+	}
+	if offset < 0 || length <= 0 {
+		return nil, fmt.Errorf("invalid byte range: offset %d, length %d", offset, length)
+	}
+
+	rng := fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+		Range:  &rng,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get object range from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(result.Body); err != nil {
+		return nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// HashObject streams an object and returns its SHA256, its size and up to
+// headSize leading bytes, without holding the whole object in memory
+func (u *S3Deps) HashObject(ctx context.Context, key string, headSize int) (sumHex string, size int64, head []byte, err error) {
+	if key == "" {
+		return "", 0, nil, errors.New("key is empty")
+	}
+
+	result, err := u.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &u.Bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return "", 0, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+		}
+		return "", 0, nil, fmt.Errorf("get object from S3: %w", err)
+	}
+	defer result.Body.Close()
+
+	h := sha256.New()
+	head = make([]byte, headSize)
+	n, err := io.ReadFull(result.Body, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", 0, nil, fmt.Errorf("read response body: %w", err)
+	}
+	head = head[:n]
+	h.Write(head)
+
+	rest, err := io.Copy(h, result.Body)
+	if err != nil {
+		return "", 0, nil, fmt.Errorf("read response body: %w", err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), int64(n) + rest, head, nil
+}
+
+// PromoteObject copies an object uploaded to srcKey to its content-addressed
+// key under keyPrefix, like UploadFormFile would have stored it. When an object
+// with the same content already exists it is reused. srcKey is left in place
+// for the caller to delete once the content is referenced.
+func (u *S3Deps) PromoteObject(ctx context.Context, srcKey, keyPrefix, sumHex, contentType, ext string, size int64) (*model.Asset, error) {
+	asset := u.findBySHA256(ctx, keyPrefix, sumHex, contentType)
+	if asset == nil {
+		key := contentKey(keyPrefix, sumHex, ext)
+		input := &s3.CopyObjectInput{
+			Bucket:            aws.String(u.Bucket),
+			Key:               aws.String(key),
+			CopySource:        aws.String((&url.URL{Path: u.Bucket + "/" + srcKey}).EscapedPath()),
+			ContentType:       aws.String(contentType),
+			MetadataDirective: s3types.MetadataDirectiveReplace,
+			Metadata: map[string]string{
+				"sha256": sumHex,
+			},
+		}
+		if u.SSE != nil {
+			input.ServerSideEncryption = *u.SSE
+		}
+
+		out, err := u.Client.CopyObject(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("copy object in S3: %w", err)
+		}
+
+		asset = &model.Asset{
+			Bucket: u.Bucket,
+			S3Key:  key,
+			SHA256: sumHex,
+			MIME:   contentType,
+			SizeB:  size,
+		}
+		if out.CopyObjectResult != nil {
+			asset.ETag = cleanETag(aws.ToString(out.CopyObjectResult.ETag))
+		}
+	}
+	return asset, nil
+}
+
 // DeleteObject deletes an object from S3
 func (u *S3Deps) DeleteObject(ctx context.Context, key string) error {
 	if key == "" {
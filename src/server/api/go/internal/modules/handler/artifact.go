@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -26,14 +27,53 @@ func NewArtifactHandler(s service.ArtifactService, cfg *config.Config) *Artifact
 	return &ArtifactHandler{svc: s, config: cfg}
 }
 
+// artifactLockHeader carries the lock_id of the caller's lock on the path it writes
+const artifactLockHeader = "X-Lock-Id"
+
+// writeCondition reads the If-Match and lock headers of a write. Quotes and
+// a weak validator prefix around the If-Match value are ignored.
+func writeCondition(c *gin.Context) service.WriteCondition {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	ifMatch = strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+	return service.WriteCondition{IfMatch: ifMatch, LockID: c.GetHeader(artifactLockHeader)}
+}
+
+// writeConditionErr responds to errors of a rejected write condition and
+// reports whether err was one
+func writeConditionErr(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrPreconditionFailed):
+		c.JSON(http.StatusPreconditionFailed, serializer.Err(http.StatusPreconditionFailed, "artifact does not match If-Match", err))
+	case errors.Is(err, service.ErrArtifactLocked):
+		c.JSON(http.StatusLocked, serializer.Err(http.StatusLocked, "artifact is locked", err))
+	default:
+		return false
+	}
+	return true
+}
+
+// setETag exposes the content hash of an artifact for use with If-Match
+func setETag(c *gin.Context, artifact *model.Artifact) {
+	if sum := artifact.AssetMeta.Data().SHA256; sum != "" {
+		c.Header("ETag", `"`+sum+`"`)
+	}
+}
+
 type CreateArtifactReq struct {
 	FilePath string `form:"file_path" json:"file_path"` // Optional, defaults to "/"
 	Meta     string `form:"meta" json:"meta"`
 }
 
 type GrepArtifactsReq struct {
-	Query string `form:"query" json:"query" binding:"required" example:"TODO.*"`
-	Limit *int   `form:"limit" json:"limit" binding:"omitempty,min=0,max=200" example:"20"`
+	Query             string `form:"query" json:"query" binding:"required" example:"TODO.*"`
+	Limit             *int   `form:"limit" json:"limit" binding:"omitempty,min=0,max=200" example:"20"`
+	OutputMode        string `form:"output_mode,default=files_with_matches" json:"output_mode" binding:"oneof=files_with_matches content" example:"content"`
+	CaseInsensitive   bool   `form:"case_insensitive" json:"case_insensitive" example:"false"`
+	FixedString       bool   `form:"fixed_string" json:"fixed_string" example:"false"`
+	Glob              string `form:"glob" json:"glob" example:"**/*.py"`
+	BeforeContext     int    `form:"before_context" json:"before_context" binding:"min=0,max=20" example:"2"`
+	AfterContext      int    `form:"after_context" json:"after_context" binding:"min=0,max=20" example:"2"`
+	MaxMatchesPerFile int    `form:"max_matches_per_file,default=20" json:"max_matches_per_file" binding:"min=1,max=1000" example:"20"`
 }
 
 type GlobArtifactsReq struct {
@@ -44,7 +84,7 @@ type GlobArtifactsReq struct {
 // UpsertArtifact godoc
 //
 //	@Summary		Upsert artifact
-//	@Description	Upload a file and create or update an artifact record under a disk. File size must not exceed the configured maximum upload size limit (default: 16MB).
+//	@Description	Upload a file and create or update an artifact record under a disk. File size must not exceed the configured maximum upload size limit (default: 16MB). Send If-Match with the ETag (or sha256) of the content you last read to only overwrite that content, and X-Lock-Id if you hold the path's lock.
 //	@Tags			artifact
 //	@Accept			multipart/form-data
 //	@Produce		json
@@ -52,9 +92,13 @@ type GlobArtifactsReq struct {
 //	@Param			file_path	formData	string	false	"File path in the disk storage (optional, defaults to '/')"
 //	@Param			file		formData	file	true	"File to upload (size must not exceed configured limit)"
 //	@Param			meta		formData	string	false	"Custom metadata as JSON string (optional, system metadata will be stored under '__artifact_info__' key)"
+//	@Param			If-Match	header		string	false	"Only overwrite an artifact whose content has this ETag or sha256; '*' requires an existing artifact"
+//	@Param			X-Lock-Id	header		string	false	"Lock ID of the caller's lock on the path"
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Artifact}
+//	@Failure		412	{object}	serializer.Response	"Artifact does not match If-Match"
 //	@Failure		413	{object}	serializer.Response	"File size exceeds maximum allowed size"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
 //	@Router			/disk/{disk_id}/artifact [post]
 //	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Upload a file to disk\nwith open('report.pdf', 'rb') as f:\n    artifact = client.disks.upload_artifact(\n        disk_id='disk-uuid',\n        file=f,\n        file_path='/documents/',\n        meta={'category': 'reports', 'year': 2024}\n    )\nprint(f\"Uploaded artifact: {artifact.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\nimport fs from 'fs';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Upload a file to disk\nconst fileBuffer = fs.readFileSync('report.pdf');\nconst artifact = await client.disks.uploadArtifact('disk-uuid', {\n  file: fileBuffer,\n  filePath: '/documents/',\n  meta: { category: 'reports', year: 2024 }\n});\nconsole.log(`Uploaded artifact: ${artifact.id}`);\n","label":"JavaScript"}]
 func (h *ArtifactHandler) UpsertArtifact(c *gin.Context) {
@@ -127,15 +171,184 @@ func (h *ArtifactHandler) UpsertArtifact(c *gin.Context) {
 		Filename:   actualFilename,
 		FileHeader: file,
 		UserMeta:   userMeta,
+		Condition:  writeCondition(c),
 	})
 	if err != nil {
+		if writeConditionErr(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
+	setETag(c, artifactRecord)
 	c.JSON(http.StatusCreated, serializer.Response{Data: artifactRecord})
 }
 
+type CreateUploadURLReq struct {
+	FilePath    string                 `json:"file_path" binding:"required" example:"/datasets/train.parquet"` // File path including filename
+	Size        int64                  `json:"size" binding:"required,min=1" example:"524288000"`              // File size in bytes
+	ContentType string                 `json:"content_type" example:"application/octet-stream"`
+	Meta        map[string]interface{} `json:"meta"`
+	Expire      int                    `json:"expire" binding:"omitempty,min=60,max=604800" example:"3600"` // Expire time in seconds for the upload URLs
+}
+
+// CreateUploadURL godoc
+//
+//	@Summary		Create direct upload URL
+//	@Description	Start an upload that goes straight to storage instead of through the API, for files larger than the regular upload limit. For files up to 64MB the plan has method PUT and a single presigned URL; send the file with the returned headers. Larger files get method MULTIPART with one presigned URL per part of part_size bytes. Call finalize with the upload_id and the file's sha256 once the upload is done.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.CreateUploadURLReq	true	"CreateUploadURL payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.UploadPlan}
+//	@Failure		413	{object}	serializer.Response	"File size exceeds maximum allowed size"
+//	@Router			/disk/{disk_id}/artifact/upload_url [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Upload a large file directly to storage\nartifact = client.disks.upload_large_artifact(\n    disk_id='disk-uuid',\n    file_path='/datasets/train.parquet',\n    local_path='train.parquet'\n)\nprint(f\"Uploaded artifact: {artifact.filename}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Upload a large file directly to storage\nconst artifact = await client.disks.uploadLargeArtifact('disk-uuid', {\n  filePath: '/datasets/train.parquet',\n  localPath: 'train.parquet'\n});\nconsole.log(`Uploaded artifact: ${artifact.filename}`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) CreateUploadURL(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := CreateUploadURLReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	maxSize := h.config.Artifact.MaxDirectUploadSizeBytes
+	if req.Size > maxSize {
+		maxSizeMB := float64(maxSize) / (1024 * 1024)
+		c.JSON(http.StatusRequestEntityTooLarge, serializer.ParamErr("", fmt.Errorf("file size exceeds maximum allowed size of %.2fMB", maxSizeMB)))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("file_path must include a filename", nil))
+		return
+	}
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	// Validate that user meta doesn't contain system reserved keys
+	for _, reservedKey := range (model.Artifact{}).GetReservedKeys() {
+		if _, exists := req.Meta[reservedKey]; exists {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("reserved key '%s' is not allowed in user meta", reservedKey)))
+			return
+		}
+	}
+
+	contentType := req.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	expire := req.Expire
+	if expire == 0 {
+		expire = 3600
+	}
+
+	plan, err := h.svc.CreateUpload(c.Request.Context(), service.CreateUploadInput{
+		ProjectID:   project.ID,
+		DiskID:      diskID,
+		Path:        filePath,
+		Filename:    filename,
+		SizeB:       req.Size,
+		ContentType: contentType,
+		UserMeta:    req.Meta,
+		Expire:      time.Duration(expire) * time.Second,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: plan})
+}
+
+type FinalizeUploadReq struct {
+	UploadID string `json:"upload_id" binding:"required,uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	SHA256   string `json:"sha256" binding:"required,len=64,hexadecimal" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"` // SHA256 of the uploaded file, hex encoded
+}
+
+// FinalizeUpload godoc
+//
+//	@Summary		Finalize direct upload
+//	@Description	Finish an upload started with upload_url. The uploaded content is checked against the given sha256 and the declared size, then stored as an artifact at the requested path, keeping any existing artifact there as a previous version. An upload whose content does not match is discarded.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.FinalizeUploadReq	true	"FinalizeUpload payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Artifact}
+//	@Failure		404	{object}	serializer.Response	"Upload not found"
+//	@Failure		409	{object}	serializer.Response	"Upload is incomplete or being finalized"
+//	@Failure		410	{object}	serializer.Response	"Upload expired"
+//	@Router			/disk/{disk_id}/artifact/finalize [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Finalize an upload after sending the file to the presigned URL\nartifact = client.disks.finalize_upload(\n    disk_id='disk-uuid',\n    upload_id='upload-uuid',\n    sha256='9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08'\n)\nprint(f\"Uploaded artifact: {artifact.filename}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Finalize an upload after sending the file to the presigned URL\nconst artifact = await client.disks.finalizeUpload('disk-uuid', {\n  uploadId: 'upload-uuid',\n  sha256: '9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08'\n});\nconsole.log(`Uploaded artifact: ${artifact.filename}`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) FinalizeUpload(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := FinalizeUploadReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	artifact, err := h.svc.FinalizeUpload(c.Request.Context(), service.FinalizeUploadInput{
+		ProjectID: project.ID,
+		DiskID:    diskID,
+		UploadID:  uuid.MustParse(req.UploadID),
+		SHA256:    req.SHA256,
+		Condition: writeCondition(c),
+	})
+	if err != nil {
+		if writeConditionErr(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrUploadNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "upload not found", err))
+		case errors.Is(err, service.ErrUploadExpired):
+			c.JSON(http.StatusGone, serializer.Err(http.StatusGone, "upload expired", err))
+		case errors.Is(err, service.ErrUploadIncomplete):
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "upload is incomplete", err))
+		case errors.Is(err, service.ErrUploadClaimed):
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "upload is being finalized", err))
+		case errors.Is(err, service.ErrUploadChecksumMismatch):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("uploaded content does not match sha256 and size", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: artifact})
+}
+
 type DeleteArtifactReq struct {
 	FilePath string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
 }
@@ -149,8 +362,12 @@ type DeleteArtifactReq struct {
 //	@Produce		json
 //	@Param			disk_id		path	string	true	"Disk ID"						Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
 //	@Param			file_path	query	string	true	"File path including filename"	example(/documents/report.pdf)
+//	@Param			If-Match	header	string	false	"Only delete the artifact if its content has this ETag or sha256"
+//	@Param			X-Lock-Id	header	string	false	"Lock ID of the caller's lock on the path"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{}
+//	@Failure		412	{object}	serializer.Response	"Artifact does not match If-Match"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
 //	@Router			/disk/{disk_id}/artifact [delete]
 //	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Delete an artifact\nclient.disks.delete_artifact(\n    disk_id='disk-uuid',\n    file_path='/documents/report.pdf'\n)\nprint('Artifact deleted successfully')\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Delete an artifact\nawait client.disks.deleteArtifact('disk-uuid', {\n  filePath: '/documents/report.pdf'\n});\nconsole.log('Artifact deleted successfully');\n","label":"JavaScript"}]
 func (h *ArtifactHandler) DeleteArtifact(c *gin.Context) {
@@ -181,7 +398,10 @@ func (h *ArtifactHandler) DeleteArtifact(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.DeleteByPath(c.Request.Context(), project.ID, diskID, filePath, filename); err != nil {
+	if err := h.svc.DeleteByPath(c.Request.Context(), project.ID, diskID, filePath, filename, writeCondition(c)); err != nil {
+		if writeConditionErr(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
@@ -190,22 +410,32 @@ func (h *ArtifactHandler) DeleteArtifact(c *gin.Context) {
 }
 
 type GetArtifactReq struct {
-	FilePath      string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
-	WithPublicURL bool   `form:"with_public_url,default=true" json:"with_public_url" example:"true"`
-	WithContent   bool   `form:"with_content,default=true" json:"with_content" example:"true"`
-	Expire        int    `form:"expire,default=3600" json:"expire" example:"3600"` // Expire time in seconds for presigned URL
+	FilePath        string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
+	WithPublicURL   bool   `form:"with_public_url,default=true" json:"with_public_url" example:"true"`
+	WithContent     bool   `form:"with_content,default=true" json:"with_content" example:"true"`
+	Expire          int    `form:"expire,default=3600" json:"expire" example:"3600"` // Expire time in seconds for presigned URL
+	LineOffset      int    `form:"line_offset" json:"line_offset" binding:"min=0" example:"0"`
+	LineLimit       int    `form:"line_limit" json:"line_limit" binding:"min=0" example:"200"` // 0 returns all lines
+	WithLineNumbers bool   `form:"with_line_numbers" json:"with_line_numbers" example:"false"`
+	ByteOffset      int64  `form:"byte_offset" json:"byte_offset" binding:"min=0" example:"0"`
+	ByteLimit       int64  `form:"byte_limit" json:"byte_limit" binding:"omitempty,min=1,max=4194304" example:"65536"` // Enables byte-range mode
+	Version         int    `form:"version" json:"version" binding:"min=0" example:"2"`                                 // 0 reads the current version
 }
 
 type GetArtifactResp struct {
-	Artifact  *model.Artifact         `json:"artifact"`
-	PublicURL *string                 `json:"public_url,omitempty"`
-	Content   *fileparser.FileContent `json:"content,omitempty"`
+	Artifact   *model.Artifact         `json:"artifact"`
+	PublicURL  *string                 `json:"public_url,omitempty"`
+	Content    *fileparser.FileContent `json:"content,omitempty"`
+	TotalLines *int                    `json:"total_lines,omitempty"`
+	Bytes      *service.FileRange      `json:"bytes,omitempty"`
 }
 
 // GetArtifact godoc
 //
 //	@Summary		Get artifact
 //	@Description	Get artifact information by path and filename. Optionally include a presigned URL for downloading and parsed file content.
+//	@Description	Text content can be read in pages with line_offset and line_limit; total_lines reports the number of lines in the whole file.
+//	@Description	Setting byte_limit switches to byte-range mode: the raw bytes from byte_offset are returned base64 encoded in bytes.data instead of content, which also works for binary files.
 //	@Tags			artifact
 //	@Accept			json
 //	@Produce		json
@@ -214,6 +444,12 @@ type GetArtifactResp struct {
 //	@Param			with_public_url	query	boolean	false	"Whether to return public URL, default is true"				example(true)
 //	@Param			with_content	query	boolean	false	"Whether to return parsed file content, default is true"	example(true)
 //	@Param			expire			query	int		false	"Expire time in seconds for presigned URL (default: 3600)"	example(3600)
+//	@Param			line_offset		query	int		false	"Number of lines to skip before the returned content (default: 0)"	example(0)
+//	@Param			line_limit		query	int		false	"Maximum number of lines to return, 0 for all (default: 0)"	example(200)
+//	@Param			with_line_numbers	query	boolean	false	"Prefix each returned line with its 1-based line number and a tab"	example(false)
+//	@Param			byte_offset		query	int		false	"Byte offset to read from in byte-range mode (default: 0)"	example(0)
+//	@Param			byte_limit		query	int		false	"Number of bytes to read; enables byte-range mode (max 4MiB)"	example(65536)
+//	@Param			version			query	int		false	"Version to read, defaults to the current version"	example(2)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=handler.GetArtifactResp}
 //	@Router			/disk/{disk_id}/artifact [get]
@@ -225,6 +461,11 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 		return
 	}
 
+	if req.ByteOffset > 0 && req.ByteLimit == 0 {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("byte_offset requires byte_limit")))
+		return
+	}
+
 	diskID, err := uuid.Parse(c.Param("disk_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
@@ -245,6 +486,22 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
+	if req.Version == 0 {
+		setETag(c, artifact)
+	}
+
+	// Swap in the content of a previous version if requested
+	if req.Version > 0 {
+		artifact, err = h.svc.GetVersion(c.Request.Context(), artifact, req.Version)
+		if err != nil {
+			if errors.Is(err, service.ErrArtifactVersionNotFound) {
+				c.JSON(http.StatusNotFound, serializer.DBErr("", err))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+	}
 
 	resp := GetArtifactResp{Artifact: artifact}
 
@@ -258,13 +515,23 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 		resp.PublicURL = &url
 	}
 
-	// Parse file content if requested
-	if req.WithContent {
+	if req.ByteLimit > 0 {
+		// Byte-range mode reads the raw object and replaces parsed content
+		rng, err := h.svc.GetFileRange(c.Request.Context(), artifact, req.ByteOffset, req.ByteLimit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+		resp.Bytes = rng
+	} else if req.WithContent {
+		// Parse file content if requested
 		content, err := h.svc.GetFileContent(c.Request.Context(), artifact)
 		// Only set content if parsing succeeded
 		// Unsupported file types (images, binaries, etc.) will not have content
 		if err == nil && content != nil {
-			resp.Content = content
+			raw, totalLines := fileparser.SliceLines(content.Raw, req.LineOffset, req.LineLimit, req.WithLineNumbers)
+			resp.Content = &fileparser.FileContent{Type: content.Type, Raw: raw}
+			resp.TotalLines = &totalLines
 		}
 		// Don't return error for unsupported file types - just don't include content
 	}
@@ -272,30 +539,30 @@ func (h *ArtifactHandler) GetArtifact(c *gin.Context) {
 	c.JSON(http.StatusOK, serializer.Response{Data: resp})
 }
 
-type UpdateArtifactReq struct {
+type ListArtifactVersionsReq struct {
 	FilePath string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
-	Meta     string `form:"meta" json:"meta" binding:"required"`           // Custom metadata as JSON string
 }
 
-type UpdateArtifactResp struct {
-	Artifact *model.Artifact `json:"artifact"`
+type ListArtifactVersionsResp struct {
+	Artifact *model.Artifact          `json:"artifact"`
+	Versions []*model.ArtifactVersion `json:"versions"`
 }
 
-// UpdateArtifact godoc
+// ListArtifactVersions godoc
 //
-//	@Summary		Update artifact meta
-//	@Description	Update an artifact's metadata (user-defined metadata only)
+//	@Summary		List artifact versions
+//	@Description	List all versions of an artifact, newest first. The first entry is the current version; every overwrite of the artifact keeps the previous content as an earlier version.
 //	@Tags			artifact
 //	@Accept			json
 //	@Produce		json
-//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
-//	@Param			request	body	handler.UpdateArtifactReq	true	"Update artifact request"
+//	@Param			disk_id		path	string	true	"Disk ID"						Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			file_path	query	string	true	"File path including filename"	example(/documents/report.md)
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response{data=handler.UpdateArtifactResp}
-//	@Router			/disk/{disk_id}/artifact [put]
-//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Update artifact metadata\nartifact = client.disks.update_artifact(\n    disk_id='disk-uuid',\n    file_path='/documents/report.pdf',\n    meta={'category': 'updated', 'reviewed': True, 'version': 2}\n)\nprint(f\"Updated artifact: {artifact.artifact.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Update artifact metadata\nconst artifact = await client.disks.updateArtifact('disk-uuid', {\n  filePath: '/documents/report.pdf',\n  meta: { category: 'updated', reviewed: true, version: 2 }\n});\nconsole.log(`Updated artifact: ${artifact.artifact.id}`);\n","label":"JavaScript"}]
-func (h *ArtifactHandler) UpdateArtifact(c *gin.Context) {
-	req := UpdateArtifactReq{}
+//	@Success		200	{object}	serializer.Response{data=handler.ListArtifactVersionsResp}
+//	@Router			/disk/{disk_id}/artifact/versions [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List versions of an artifact\nresult = client.disks.list_artifact_versions(\n    disk_id='disk-uuid',\n    file_path='/documents/report.md'\n)\nfor version in result.versions:\n    print(version.version, version.created_at)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List versions of an artifact\nconst result = await client.disks.listArtifactVersions('disk-uuid', {\n  filePath: '/documents/report.md'\n});\nfor (const version of result.versions) {\n  console.log(version.version, version.created_at);\n}\n","label":"JavaScript"}]
+func (h *ArtifactHandler) ListArtifactVersions(c *gin.Context) {
+	req := ListArtifactVersionsReq{}
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
@@ -316,161 +583,914 @@ func (h *ArtifactHandler) UpdateArtifact(c *gin.Context) {
 		return
 	}
 
-	// Parse user meta from JSON string
-	var userMeta map[string]interface{}
-	if err := sonic.Unmarshal([]byte(req.Meta), &userMeta); err != nil {
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid meta JSON format", err))
+	artifact, err := h.svc.GetByPath(c.Request.Context(), diskID, filePath, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
-	// Validate that user meta doesn't contain system reserved keys
-	reservedKeys := model.Artifact{}.GetReservedKeys()
-	for _, reservedKey := range reservedKeys {
-		if _, exists := userMeta[reservedKey]; exists {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("reserved key '%s' is not allowed in user meta", reservedKey)))
-			return
-		}
-	}
-
-	// Update artifact meta
-	artifactRecord, err := h.svc.UpdateArtifactMetaByPath(c.Request.Context(), diskID, filePath, filename, userMeta)
+	versions, err := h.svc.ListVersions(c.Request.Context(), artifact)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, serializer.Response{
-		Data: UpdateArtifactResp{Artifact: artifactRecord},
-	})
+	c.JSON(http.StatusOK, serializer.Response{Data: ListArtifactVersionsResp{
+		Artifact: artifact,
+		Versions: versions,
+	}})
 }
 
-type ListArtifactsReq struct {
-	Path string `form:"path" json:"path"` // Optional path filter
+type DiffArtifactVersionsReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
+	From     int    `form:"from" json:"from" binding:"required,min=1" example:"1"`
+	To       int    `form:"to" json:"to" binding:"min=0" example:"2"` // 0 compares against the current version
 }
 
-type ListArtifactsResp struct {
-	Artifacts   []*model.Artifact `json:"artifacts"`
-	Directories []string          `json:"directories"`
+type DiffArtifactVersionsResp struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"`
 }
 
-// ListArtifacts godoc
+// DiffArtifactVersions godoc
 //
-//	@Summary		List artifacts
-//	@Description	List artifacts in a specific path or all artifacts in a disk
+//	@Summary		Diff artifact versions
+//	@Description	Get a unified diff between the text content of two versions of an artifact. The diff is empty when the versions have the same content. Only text-based files can be compared.
 //	@Tags			artifact
 //	@Accept			json
 //	@Produce		json
-//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
-//	@Param			path	query	string	false	"Path filter (optional, defaults to root '/')"
+//	@Param			disk_id		path	string	true	"Disk ID"										Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			file_path	query	string	true	"File path including filename"					example(/documents/report.md)
+//	@Param			from		query	int		true	"Version to diff from"							example(1)
+//	@Param			to			query	int		false	"Version to diff to, defaults to the current version"	example(2)
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response{data=handler.ListArtifactsResp}
-//	@Router			/disk/{disk_id}/artifact/ls [get]
-//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List artifacts in a path\nresult = client.disks.list_artifacts(\n    disk_id='disk-uuid',\n    path='/documents/'\n)\nprint(f\"Found {len(result.artifacts)} artifacts\")\nfor artifact in result.artifacts:\n    print(f\"  - {artifact.path}{artifact.filename}\")\nprint(f\"Subdirectories: {', '.join(result.directories)}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List artifacts in a path\nconst result = await client.disks.listArtifacts('disk-uuid', {\n  path: '/documents/'\n});\nconsole.log(`Found ${result.artifacts.length} artifacts`);\nfor (const artifact of result.artifacts) {\n  console.log(`  - ${artifact.path}${artifact.filename}`);\n}\nconsole.log(`Subdirectories: ${result.directories.join(', ')}`);\n","label":"JavaScript"}]
-func (h *ArtifactHandler) ListArtifacts(c *gin.Context) {
+//	@Success		200	{object}	serializer.Response{data=handler.DiffArtifactVersionsResp}
+//	@Router			/disk/{disk_id}/artifact/diff [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Diff version 1 against the current version\nresult = client.disks.diff_artifact_versions(\n    disk_id='disk-uuid',\n    file_path='/documents/report.md',\n    from_version=1\n)\nprint(result.diff)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Diff version 1 against the current version\nconst result = await client.disks.diffArtifactVersions('disk-uuid', {\n  filePath: '/documents/report.md',\n  from: 1\n});\nconsole.log(result.diff);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) DiffArtifactVersions(c *gin.Context) {
+	req := DiffArtifactVersionsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
 	diskID, err := uuid.Parse(c.Param("disk_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
 
-	pathQuery := c.Query("path")
-
-	// Set default path to root directory if not provided
-	if pathQuery == "" {
-		pathQuery = "/"
-	} else {
-		// Validate that path does not contain filename
-		if path, _ := path.SplitFilePath(pathQuery); path != pathQuery {
-			c.JSON(http.StatusBadRequest, serializer.ParamErr("both ends of the path must be '/'", errors.New("both ends of the path must be '/'")))
-			return
-		}
-	}
+	// Parse FilePath to extract path and filename
+	filePath, filename := path.SplitFilePath(req.FilePath)
 
 	// Validate the path parameter
-	if err := path.ValidatePath(pathQuery); err != nil {
+	if err := path.ValidatePath(filePath); err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
 		return
 	}
 
-	artifacts, err := h.svc.ListByPath(c.Request.Context(), diskID, pathQuery)
+	artifact, err := h.svc.GetByPath(c.Request.Context(), diskID, filePath, filename)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
-	// Get all paths to extract directory names
-	allPaths, err := h.svc.GetAllPaths(c.Request.Context(), diskID)
+	to := req.To
+	if to == 0 {
+		to = artifact.Version
+	}
+
+	d, err := h.svc.DiffVersions(c.Request.Context(), artifact, req.From, to)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		switch {
+		case errors.Is(err, service.ErrArtifactVersionNotFound):
+			c.JSON(http.StatusNotFound, serializer.DBErr("", err))
+		case errors.Is(err, service.ErrUnsupportedFileType):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
 		return
 	}
 
-	// Extract direct subdirectories
-	directories := path.GetDirectoriesFromPaths(pathQuery, allPaths)
+	c.JSON(http.StatusOK, serializer.Response{Data: DiffArtifactVersionsResp{
+		From: req.From,
+		To:   to,
+		Diff: d,
+	}})
+}
 
-	c.JSON(http.StatusOK, serializer.Response{
-		Data: ListArtifactsResp{
-			Artifacts:   artifacts,
-			Directories: directories,
-		},
-	})
+type RestoreArtifactVersionReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
+	Version  int    `form:"version" json:"version" binding:"required,min=1" example:"1"`
 }
 
-// GrepArtifacts godoc
+type RestoreArtifactVersionResp struct {
+	Artifact *model.Artifact `json:"artifact"`
+}
+
+// RestoreArtifactVersion godoc
 //
-//	@Summary		Search artifact content with regex
-//	@Description	Search through text-based artifact content using regex patterns
+//	@Summary		Restore artifact version
+//	@Description	Restore the content and metadata of a previous version of an artifact. The restored content becomes a new version, so the current content is kept and the restore can be undone. With If-Match the restore only replaces content with that ETag or sha256.
 //	@Tags			artifact
 //	@Accept			json
 //	@Produce		json
-//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)
-//	@Param			query	query	string	true	"Regex pattern to search for"
-//	@Param			limit	query	int		false	"Maximum number of results (default 100, max 1000)"
+//	@Param			disk_id		path	string								true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload		body	handler.RestoreArtifactVersionReq	true	"RestoreArtifactVersion payload"
+//	@Param			If-Match	header	string								false	"Only restore over content with this ETag or sha256"
+//	@Param			X-Lock-Id	header	string								false	"Lock ID of the caller's lock on the path"
 //	@Security		BearerAuth
-//	@Success		200	{object}	serializer.Response{data=[]model.Artifact}
-//	@Router			/disk/{disk_id}/artifact/grep [get]
-func (h *ArtifactHandler) GrepArtifacts(c *gin.Context) {
+//	@Success		200	{object}	serializer.Response{data=handler.RestoreArtifactVersionResp}
+//	@Failure		412	{object}	serializer.Response	"Artifact does not match If-Match"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact/restore [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Undo an overwrite by restoring version 1\nresult = client.disks.restore_artifact_version(\n    disk_id='disk-uuid',\n    file_path='/documents/report.md',\n    version=1\n)\nprint(f\"Now at version {result.artifact.version}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Undo an overwrite by restoring version 1\nconst result = await client.disks.restoreArtifactVersion('disk-uuid', {\n  filePath: '/documents/report.md',\n  version: 1\n});\nconsole.log(`Now at version ${result.artifact.version}`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) RestoreArtifactVersion(c *gin.Context) {
 	project, ok := c.MustGet("project").(*model.Project)
 	if !ok {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
 		return
 	}
 
-	diskID, err := uuid.Parse(c.Param("disk_id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid disk_id", err))
+	req := RestoreArtifactVersionReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
 
-	req := GrepArtifactsReq{}
-	if err := c.ShouldBindQuery(&req); err != nil {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
 
-	limit := 100
-	if req.Limit != nil {
-		limit = *req.Limit
+	// Parse FilePath to extract path and filename
+	filePath, filename := path.SplitFilePath(req.FilePath)
+
+	// Validate the path parameter
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
 	}
 
-	artifacts, err := h.svc.GrepArtifacts(c.Request.Context(), project.ID, diskID, req.Query, limit)
+	artifact, err := h.svc.GetByPath(c.Request.Context(), diskID, filePath, filename)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, serializer.Response{Data: artifacts})
+	restored, err := h.svc.RestoreVersion(c.Request.Context(), project.ID, artifact, req.Version, writeCondition(c))
+	if err != nil {
+		if writeConditionErr(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrArtifactVersionNotFound):
+			c.JSON(http.StatusNotFound, serializer.DBErr("", err))
+		case errors.Is(err, service.ErrInvalidVersion):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: RestoreArtifactVersionResp{Artifact: restored}})
 }
 
-// GlobArtifacts godoc
-//
-//	@Summary		Search artifact paths with glob patterns
-//	@Description	Search through artifact file paths using glob patterns (*, ?, etc.)
-//	@Tags			artifact
-//	@Accept			json
-//	@Produce		json
-//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)
-//	@Param			query	query	string	true	"Glob pattern (e.g., '**/*.py', '*.txt')"*/
+type TransferArtifactsReq struct {
+	Src string `json:"src" binding:"required" example:"/documents/report.md"` // File path, or directory path ending with '/'
+	Dst string `json:"dst" binding:"required" example:"/archive/"`            // File path, or directory path ending with '/'
+}
+
+type TransferArtifactsResp struct {
+	Count    int64           `json:"count"`
+	Artifact *model.Artifact `json:"artifact,omitempty"` // Set when a single artifact was moved or copied
+}
+
+// validateDirPath checks that p is a valid directory path with a leading and a trailing slash
+func validateDirPath(p string) error {
+	if dir, _ := path.SplitFilePath(p); dir != p {
+		return errors.New("both ends of the directory path must be '/'")
+	}
+	return path.ValidatePath(p)
+}
+
+// MoveArtifacts godoc
+//
+//	@Summary		Move artifacts
+//	@Description	Move or rename an artifact, or move a whole directory. A src ending with '/' moves every artifact and directory under it to the dst directory, which must also end with '/'. Otherwise src is a single artifact; a dst ending with '/' keeps its filename. Artifacts keep their version history. The move is atomic and fails with 409 if any destination artifact already exists, and with 423 if a moved artifact or its destination is locked by another holder. If-Match only applies to a single artifact src.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string							true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload		body	handler.TransferArtifactsReq	true	"MoveArtifacts payload"
+//	@Param			If-Match	header	string							false	"Only move a src artifact whose content has this ETag or sha256"
+//	@Param			X-Lock-Id	header	string							false	"Lock ID of the caller's lock on the moved paths"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.TransferArtifactsResp}
+//	@Failure		412	{object}	serializer.Response	"Artifact does not match If-Match"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact/mv [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Rename a file\nclient.disks.move_artifacts(\n    disk_id='disk-uuid',\n    src='/notes/draft.md',\n    dst='/notes/final.md'\n)\n\n# Move a directory\nresult = client.disks.move_artifacts(\n    disk_id='disk-uuid',\n    src='/notes/',\n    dst='/archive/notes/'\n)\nprint(f\"Moved {result.count} artifacts\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Rename a file\nawait client.disks.moveArtifacts('disk-uuid', {\n  src: '/notes/draft.md',\n  dst: '/notes/final.md'\n});\n\n// Move a directory\nconst result = await client.disks.moveArtifacts('disk-uuid', {\n  src: '/notes/',\n  dst: '/archive/notes/'\n});\nconsole.log(`Moved ${result.count} artifacts`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) MoveArtifacts(c *gin.Context) {
+	h.transferArtifacts(c, false)
+}
+
+// CopyArtifacts godoc
+//
+//	@Summary		Copy artifacts
+//	@Description	Copy an artifact, or a whole directory. A src ending with '/' copies every artifact and directory under it to the dst directory, which must also end with '/'. Otherwise src is a single artifact; a dst ending with '/' keeps its filename. Copies share the stored file with their source instead of uploading it again, and start without version history. The copy is atomic and fails with 409 if any destination artifact already exists, and with 423 if a destination path is locked by another holder.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string							true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload		body	handler.TransferArtifactsReq	true	"CopyArtifacts payload"
+//	@Param			X-Lock-Id	header	string							false	"Lock ID of the caller's lock on the destination paths"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.TransferArtifactsResp}
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact/cp [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Copy a directory\nresult = client.disks.copy_artifacts(\n    disk_id='disk-uuid',\n    src='/templates/',\n    dst='/projects/new/'\n)\nprint(f\"Copied {result.count} artifacts\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Copy a directory\nconst result = await client.disks.copyArtifacts('disk-uuid', {\n  src: '/templates/',\n  dst: '/projects/new/'\n});\nconsole.log(`Copied ${result.count} artifacts`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) CopyArtifacts(c *gin.Context) {
+	h.transferArtifacts(c, true)
+}
+
+func (h *ArtifactHandler) transferArtifacts(c *gin.Context, copyMode bool) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := TransferArtifactsReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	cond := writeCondition(c)
+	resp := TransferArtifactsResp{}
+
+	if strings.HasSuffix(req.Src, "/") {
+		if err := validateDirPath(req.Src); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid src", err))
+			return
+		}
+		if err := validateDirPath(req.Dst); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid dst", err))
+			return
+		}
+
+		if copyMode {
+			resp.Count, err = h.svc.CopyDirectory(ctx, project.ID, diskID, req.Src, req.Dst, cond.LockID)
+		} else {
+			resp.Count, err = h.svc.MoveDirectory(ctx, diskID, req.Src, req.Dst, cond.LockID)
+		}
+	} else {
+		srcPath, srcFilename := path.SplitFilePath(req.Src)
+		if err := path.ValidatePath(srcPath); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid src", err))
+			return
+		}
+		dstPath, dstFilename := path.SplitFilePath(req.Dst)
+		if err := path.ValidatePath(dstPath); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid dst", err))
+			return
+		}
+		// A directory destination keeps the source filename
+		if dstFilename == "" {
+			dstFilename = srcFilename
+		}
+
+		if copyMode {
+			resp.Artifact, err = h.svc.CopyArtifact(ctx, project.ID, diskID, srcPath, srcFilename, dstPath, dstFilename, cond.LockID)
+		} else {
+			resp.Artifact, err = h.svc.MoveArtifact(ctx, diskID, srcPath, srcFilename, dstPath, dstFilename, cond)
+		}
+		if err == nil {
+			resp.Count = 1
+		}
+	}
+
+	if err != nil {
+		h.pathOperationErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+// pathOperationErr writes the response for a failed move, copy or directory operation
+func (h *ArtifactHandler) pathOperationErr(c *gin.Context, err error) {
+	if writeConditionErr(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidPathOperation):
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+	case errors.Is(err, service.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, serializer.DBErr("", err))
+	case errors.Is(err, service.ErrArtifactExists), errors.Is(err, service.ErrDirectoryNotEmpty):
+		c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "path conflict", err))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
+
+type MakeDirectoryReq struct {
+	Path string `json:"path" binding:"required" example:"/projects/new/"` // Directory path with a leading and a trailing '/'
+}
+
+// MakeDirectory godoc
+//
+//	@Summary		Create directory
+//	@Description	Create an empty directory so it shows up in ls before any artifact is uploaded to it. Parent directories are implied. Creating an existing directory succeeds.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.MakeDirectoryReq	true	"MakeDirectory payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{}
+//	@Router			/disk/{disk_id}/artifact/mkdir [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Create an empty directory\nclient.disks.make_directory(disk_id='disk-uuid', path='/projects/new/')\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Create an empty directory\nawait client.disks.makeDirectory('disk-uuid', { path: '/projects/new/' });\n","label":"JavaScript"}]
+func (h *ArtifactHandler) MakeDirectory(c *gin.Context) {
+	req := MakeDirectoryReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := validateDirPath(req.Path); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	if err := h.svc.MakeDirectory(c.Request.Context(), diskID, req.Path); err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{})
+}
+
+type RemoveDirectoryReq struct {
+	Path      string `form:"path" json:"path" binding:"required" example:"/projects/old/"` // Directory path with a leading and a trailing '/'
+	Recursive bool   `form:"recursive" json:"recursive" example:"true"`
+}
+
+type RemoveDirectoryResp struct {
+	Count int64 `json:"count"`
+}
+
+// RemoveDirectory godoc
+//
+//	@Summary		Remove directory
+//	@Description	Remove a directory. With recursive, every artifact and directory under the path is deleted in one transaction, including artifact version history. Without recursive, only an empty directory can be removed; others fail with 409. A recursive delete fails with 423 if an artifact under the path is locked by another holder.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"									Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			path		query	string	true	"Directory path ending with '/'"			example(/projects/old/)
+//	@Param			recursive	query	boolean	false	"Delete the directory and all its contents"	example(true)
+//	@Param			X-Lock-Id	header	string	false	"Lock ID of the caller's lock on the deleted paths"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.RemoveDirectoryResp}
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact/dir [delete]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# rm -r /projects/old/\nresult = client.disks.remove_directory(\n    disk_id='disk-uuid',\n    path='/projects/old/',\n    recursive=True\n)\nprint(f\"Deleted {result.count} artifacts\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// rm -r /projects/old/\nconst result = await client.disks.removeDirectory('disk-uuid', {\n  path: '/projects/old/',\n  recursive: true\n});\nconsole.log(`Deleted ${result.count} artifacts`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) RemoveDirectory(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := RemoveDirectoryReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := validateDirPath(req.Path); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	count, err := h.svc.RemoveDirectory(c.Request.Context(), project.ID, diskID, req.Path, req.Recursive, c.GetHeader(artifactLockHeader))
+	if err != nil {
+		h.pathOperationErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: RemoveDirectoryResp{Count: count}})
+}
+
+type UpdateArtifactReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
+	Meta     string `form:"meta" json:"meta" binding:"required"`           // Custom metadata as JSON string
+}
+
+type UpdateArtifactResp struct {
+	Artifact *model.Artifact `json:"artifact"`
+}
+
+// UpdateArtifact godoc
+//
+//	@Summary		Update artifact meta
+//	@Description	Update an artifact's metadata (user-defined metadata only)
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string						true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			request		body	handler.UpdateArtifactReq	true	"Update artifact request"
+//	@Param			If-Match	header	string						false	"Only update an artifact whose content has this ETag or sha256"
+//	@Param			X-Lock-Id	header	string						false	"Lock ID of the caller's lock on the path"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.UpdateArtifactResp}
+//	@Failure		412	{object}	serializer.Response	"Artifact does not match If-Match"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact [put]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Update artifact metadata\nartifact = client.disks.update_artifact(\n    disk_id='disk-uuid',\n    file_path='/documents/report.pdf',\n    meta={'category': 'updated', 'reviewed': True, 'version': 2}\n)\nprint(f\"Updated artifact: {artifact.artifact.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Update artifact metadata\nconst artifact = await client.disks.updateArtifact('disk-uuid', {\n  filePath: '/documents/report.pdf',\n  meta: { category: 'updated', reviewed: true, version: 2 }\n});\nconsole.log(`Updated artifact: ${artifact.artifact.id}`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) UpdateArtifact(c *gin.Context) {
+	req := UpdateArtifactReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	// Parse FilePath to extract path and filename
+	filePath, filename := path.SplitFilePath(req.FilePath)
+
+	// Validate the path parameter
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	// Parse user meta from JSON string
+	var userMeta map[string]interface{}
+	if err := sonic.Unmarshal([]byte(req.Meta), &userMeta); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid meta JSON format", err))
+		return
+	}
+
+	// Validate that user meta doesn't contain system reserved keys
+	reservedKeys := model.Artifact{}.GetReservedKeys()
+	for _, reservedKey := range reservedKeys {
+		if _, exists := userMeta[reservedKey]; exists {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", fmt.Errorf("reserved key '%s' is not allowed in user meta", reservedKey)))
+			return
+		}
+	}
+
+	// Update artifact meta
+	artifactRecord, err := h.svc.UpdateArtifactMetaByPath(c.Request.Context(), diskID, filePath, filename, userMeta, writeCondition(c))
+	if err != nil {
+		if writeConditionErr(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{
+		Data: UpdateArtifactResp{Artifact: artifactRecord},
+	})
+}
+
+type EditArtifactOperation struct {
+	Op      string `json:"op" binding:"required,oneof=str_replace insert_at_line append delete_lines apply_unified_diff" example:"str_replace"`
+	OldStr  string `json:"old_str" example:"status: draft"`      // For str_replace; must occur exactly once
+	NewStr  string `json:"new_str" example:"status: final"`      // For str_replace
+	Line    int    `json:"line" binding:"min=0" example:"3"`     // For insert_at_line (insert after this line, 0 for the top) and delete_lines (first line)
+	EndLine int    `json:"end_line" binding:"min=0" example:"5"` // For delete_lines (last line, defaults to line)
+	Text    string `json:"text"`                                 // For insert_at_line and append
+	Diff    string `json:"diff"`                                 // For apply_unified_diff
+}
+
+type EditArtifactReq struct {
+	FilePath   string                  `json:"file_path" binding:"required" example:"/notes/todo.md"` // File path including filename
+	Operations []EditArtifactOperation `json:"operations" binding:"required,min=1,max=100,dive"`
+}
+
+type EditArtifactResp struct {
+	Artifact *model.Artifact `json:"artifact"`
+}
+
+// EditArtifact godoc
+//
+//	@Summary		Edit text artifact
+//	@Description	Edit a text artifact in place instead of uploading it again. Operations are applied in order: str_replace (old_str must match exactly once), insert_at_line, append, delete_lines and apply_unified_diff. Line numbers are 1-based. Either every operation applies and the result is stored as a new version, or the artifact is unchanged and 400 is returned. Edits are reapplied if another writer changes the file meanwhile; 409 is returned if it keeps changing. With If-Match the edit is only applied to content with that ETag or sha256, and 412 is returned otherwise.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string					true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload		body	handler.EditArtifactReq	true	"EditArtifact payload"
+//	@Param			If-Match	header	string					false	"Only edit content with this ETag or sha256"
+//	@Param			X-Lock-Id	header	string					false	"Lock ID of the caller's lock on the path"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.EditArtifactResp}
+//	@Failure		412	{object}	serializer.Response	"Artifact does not match If-Match"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact [patch]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Replace one line and append a note without re-uploading the file\nresult = client.disks.edit_artifact(\n    disk_id='disk-uuid',\n    file_path='/notes/todo.md',\n    operations=[\n        {'op': 'str_replace', 'old_str': '- [ ] ship', 'new_str': '- [x] ship'},\n        {'op': 'append', 'text': '- [ ] write changelog\\n'}\n    ]\n)\nprint(f\"Now at version {result.artifact.version}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Replace one line and append a note without re-uploading the file\nconst result = await client.disks.editArtifact('disk-uuid', {\n  filePath: '/notes/todo.md',\n  operations: [\n    { op: 'str_replace', oldStr: '- [ ] ship', newStr: '- [x] ship' },\n    { op: 'append', text: '- [ ] write changelog\\n' }\n  ]\n});\nconsole.log(`Now at version ${result.artifact.version}`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) EditArtifact(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := EditArtifactReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	// Parse FilePath to extract path and filename
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("file_path must include a filename", nil))
+		return
+	}
+
+	// Validate the path parameter
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	edits := make([]service.TextEdit, 0, len(req.Operations))
+	for _, op := range req.Operations {
+		edits = append(edits, service.TextEdit{
+			Op:      op.Op,
+			OldStr:  op.OldStr,
+			NewStr:  op.NewStr,
+			Line:    op.Line,
+			EndLine: op.EndLine,
+			Text:    op.Text,
+			Diff:    op.Diff,
+		})
+	}
+
+	artifact, err := h.svc.EditText(c.Request.Context(), service.EditTextInput{
+		ProjectID: project.ID,
+		DiskID:    diskID,
+		Path:      filePath,
+		Filename:  filename,
+		Edits:     edits,
+		Condition: writeCondition(c),
+	})
+	if err != nil {
+		if writeConditionErr(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrPathNotFound):
+			c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "artifact not found", err))
+		case errors.Is(err, service.ErrInvalidEdit):
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("edit cannot be applied", err))
+		case errors.Is(err, service.ErrEditConflict):
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "artifact changed concurrently", err))
+		default:
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		}
+		return
+	}
+
+	setETag(c, artifact)
+	c.JSON(http.StatusOK, serializer.Response{Data: EditArtifactResp{Artifact: artifact}})
+}
+
+// defaultArtifactLockTTL is how long a lock lasts when no ttl is given
+const defaultArtifactLockTTL = time.Minute
+
+type LockArtifactReq struct {
+	FilePath string `json:"file_path" binding:"required" example:"/notes/todo.md"`  // File path including filename
+	TTL      int    `json:"ttl" binding:"omitempty,min=1,max=3600" example:"60"`    // Lock duration in seconds, defaults to 60
+	LockID   string `json:"lock_id" example:"3f1c9a52-7b7e-4d8f-9a51-0c2f9d7e8b11"` // Renews this lock instead of taking a new one
+}
+
+// LockArtifact godoc
+//
+//	@Summary		Lock artifact
+//	@Description	Take an advisory lease lock on an artifact path, which does not have to exist yet. While the lock is held, writes to the path (upserts, edits, deletes, meta updates, version restores, moves and copies onto it, recursive directory deletes and snapshot restores) fail with 423 unless they send the returned lock_id in the X-Lock-Id header. The lock expires after ttl seconds; send lock_id to renew it before then. Taking a lock that another holder has fails with 423.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string					true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.LockArtifactReq	true	"LockArtifact payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.ArtifactLock}
+//	@Failure		409	{object}	serializer.Response	"The lock to renew has expired or is held by someone else"
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/artifact/lock [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Hold the file while editing it\nlock = client.disks.lock_artifact(\n    disk_id='disk-uuid',\n    file_path='/notes/todo.md',\n    ttl=60\n)\ntry:\n    client.disks.edit_artifact(\n        disk_id='disk-uuid',\n        file_path='/notes/todo.md',\n        operations=[{'op': 'append', 'text': '- [ ] review\\n'}],\n        lock_id=lock.lock_id\n    )\nfinally:\n    client.disks.unlock_artifact(disk_id='disk-uuid', file_path='/notes/todo.md', lock_id=lock.lock_id)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Hold the file while editing it\nconst lock = await client.disks.lockArtifact('disk-uuid', {\n  filePath: '/notes/todo.md',\n  ttl: 60\n});\ntry {\n  await client.disks.editArtifact('disk-uuid', {\n    filePath: '/notes/todo.md',\n    operations: [{ op: 'append', text: '- [ ] review\\n' }],\n    lockId: lock.lockId\n  });\n} finally {\n  await client.disks.unlockArtifact('disk-uuid', { filePath: '/notes/todo.md', lockId: lock.lockId });\n}\n","label":"JavaScript"}]
+func (h *ArtifactHandler) LockArtifact(c *gin.Context) {
+	req := LockArtifactReq{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if filename == "" {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("file_path must include a filename", nil))
+		return
+	}
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	ttl := defaultArtifactLockTTL
+	if req.TTL > 0 {
+		ttl = time.Duration(req.TTL) * time.Second
+	}
+
+	lock, err := h.svc.AcquireLock(c.Request.Context(), diskID, filePath, filename, req.LockID, ttl)
+	if err != nil {
+		lockErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: lock})
+}
+
+type UnlockArtifactReq struct {
+	FilePath string `form:"file_path" json:"file_path" binding:"required"` // File path including filename
+	LockID   string `form:"lock_id" json:"lock_id" binding:"required"`
+}
+
+// UnlockArtifact godoc
+//
+//	@Summary		Unlock artifact
+//	@Description	Release a lock taken with LockArtifact before it expires
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"						Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			file_path	query	string	true	"File path including filename"	example(/notes/todo.md)
+//	@Param			lock_id		query	string	true	"Lock ID returned by LockArtifact"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Failure		409	{object}	serializer.Response	"The lock has expired or is held by someone else"
+//	@Router			/disk/{disk_id}/artifact/lock [delete]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Release a lock early\nclient.disks.unlock_artifact(\n    disk_id='disk-uuid',\n    file_path='/notes/todo.md',\n    lock_id='lock-id'\n)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Release a lock early\nawait client.disks.unlockArtifact('disk-uuid', {\n  filePath: '/notes/todo.md',\n  lockId: 'lock-id'\n});\n","label":"JavaScript"}]
+func (h *ArtifactHandler) UnlockArtifact(c *gin.Context) {
+	req := UnlockArtifactReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	filePath, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(filePath); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	if err := h.svc.ReleaseLock(c.Request.Context(), diskID, filePath, filename, req.LockID); err != nil {
+		lockErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+func lockErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrArtifactLocked):
+		c.JSON(http.StatusLocked, serializer.Err(http.StatusLocked, "artifact is locked", err))
+	case errors.Is(err, service.ErrLockNotHeld):
+		c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "lock is not held", err))
+	case errors.Is(err, service.ErrLocksUnavailable):
+		c.JSON(http.StatusServiceUnavailable, serializer.Err(http.StatusServiceUnavailable, "locks are unavailable", err))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
+
+type ListArtifactsReq struct {
+	Path string `form:"path" json:"path"` // Optional path filter
+}
+
+type ListArtifactsResp struct {
+	Artifacts   []*model.Artifact `json:"artifacts"`
+	Directories []string          `json:"directories"`
+}
+
+// ListArtifacts godoc
+//
+//	@Summary		List artifacts
+//	@Description	List artifacts in a specific path or all artifacts in a disk
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			path	query	string	false	"Path filter (optional, defaults to root '/')"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.ListArtifactsResp}
+//	@Router			/disk/{disk_id}/artifact/ls [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List artifacts in a path\nresult = client.disks.list_artifacts(\n    disk_id='disk-uuid',\n    path='/documents/'\n)\nprint(f\"Found {len(result.artifacts)} artifacts\")\nfor artifact in result.artifacts:\n    print(f\"  - {artifact.path}{artifact.filename}\")\nprint(f\"Subdirectories: {', '.join(result.directories)}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List artifacts in a path\nconst result = await client.disks.listArtifacts('disk-uuid', {\n  path: '/documents/'\n});\nconsole.log(`Found ${result.artifacts.length} artifacts`);\nfor (const artifact of result.artifacts) {\n  console.log(`  - ${artifact.path}${artifact.filename}`);\n}\nconsole.log(`Subdirectories: ${result.directories.join(', ')}`);\n","label":"JavaScript"}]
+func (h *ArtifactHandler) ListArtifacts(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	pathQuery := c.Query("path")
+
+	// Set default path to root directory if not provided
+	if pathQuery == "" {
+		pathQuery = "/"
+	} else {
+		// Validate that path does not contain filename
+		if path, _ := path.SplitFilePath(pathQuery); path != pathQuery {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("both ends of the path must be '/'", errors.New("both ends of the path must be '/'")))
+			return
+		}
+	}
+
+	// Validate the path parameter
+	if err := path.ValidatePath(pathQuery); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	artifacts, err := h.svc.ListByPath(c.Request.Context(), diskID, pathQuery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	// Get all paths to extract directory names
+	allPaths, err := h.svc.GetAllPaths(c.Request.Context(), diskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	// Extract direct subdirectories
+	directories := path.GetDirectoriesFromPaths(pathQuery, allPaths)
+
+	c.JSON(http.StatusOK, serializer.Response{
+		Data: ListArtifactsResp{
+			Artifacts:   artifacts,
+			Directories: directories,
+		},
+	})
+}
+
+// GrepArtifacts godoc
+//
+//	@Summary		Search artifact content with regex
+//	@Description	Search through text-based artifact content using regex patterns (Go RE2 syntax), matched line by line. By default the matching artifacts are returned. With output_mode=content the matching lines of each file are returned instead, with their line numbers and optional context lines.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id					path	string	true	"Disk ID"	Format(uuid)
+//	@Param			query					query	string	true	"Regex pattern to search for"
+//	@Param			limit					query	int		false	"Maximum number of matching files (default 100, max 1000)"
+//	@Param			output_mode				query	string	false	"files_with_matches (default) returns artifacts, content returns matching lines"	Enums(files_with_matches, content)
+//	@Param			case_insensitive		query	bool	false	"Ignore case when matching"
+//	@Param			fixed_string			query	bool	false	"Treat query as a literal string instead of a regex"
+//	@Param			glob					query	string	false	"Only search artifacts whose path matches this glob pattern, with the same syntax as the glob endpoint"
+//	@Param			before_context			query	int		false	"Lines of context before each match, content mode only (max 20)"
+//	@Param			after_context			query	int		false	"Lines of context after each match, content mode only (max 20)"
+//	@Param			max_matches_per_file	query	int		false	"Maximum matches returned per file, content mode only (default 20)"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Artifact}
+//	@Success		200	{object}	serializer.Response{data=[]service.GrepFileResult}
+//	@Router			/disk/{disk_id}/artifact/grep [get]
+func (h *ArtifactHandler) GrepArtifacts(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid disk_id", err))
+		return
+	}
+
+	req := GrepArtifactsReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	limit := 100
+	if req.Limit != nil {
+		limit = *req.Limit
+	}
+
+	in := service.GrepInput{
+		Pattern:           req.Query,
+		CaseInsensitive:   req.CaseInsensitive,
+		FixedString:       req.FixedString,
+		Glob:              req.Glob,
+		Limit:             limit,
+		BeforeContext:     req.BeforeContext,
+		AfterContext:      req.AfterContext,
+		MaxMatchesPerFile: req.MaxMatchesPerFile,
+	}
+
+	if req.OutputMode == "content" {
+		results, err := h.svc.GrepLines(c.Request.Context(), project.ID, diskID, in)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidGrepPattern) {
+				c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid query", err))
+				return
+			}
+			if errors.Is(err, service.ErrInvalidGlobPattern) {
+				c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid glob", err))
+				return
+			}
+			c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+			return
+		}
+
+		c.JSON(http.StatusOK, serializer.Response{Data: results})
+		return
+	}
+
+	artifacts, err := h.svc.GrepArtifacts(c.Request.Context(), project.ID, diskID, in)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidGrepPattern) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid query", err))
+			return
+		}
+		if errors.Is(err, service.ErrInvalidGlobPattern) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid glob", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: artifacts})
+}
+
+// GlobArtifacts godoc
+//
+//	@Summary		Search artifact paths with glob patterns
+//	@Description	Search through artifact file paths using glob patterns. Patterns are matched against the full path from the disk root: * and ? stay within one path segment, ** as a whole segment matches any number of directories, and [abc], [!abc], {a,b} and backslash escapes are supported.
+//	@Tags			artifact
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)
+//	@Param			query	query	string	true	"Glob pattern (e.g., '**/*.py', 'src/*.{ts,tsx}')"
 //	@Param			limit	query	int		false	"Maximum number of results (default 100, max 1000)"
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=[]model.Artifact}
@@ -501,6 +1521,10 @@ func (h *ArtifactHandler) GlobArtifacts(c *gin.Context) {
 
 	artifacts, err := h.svc.GlobArtifacts(c.Request.Context(), project.ID, diskID, req.Query, limit)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidGlobPattern) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid query", err))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
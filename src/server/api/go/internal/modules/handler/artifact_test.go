@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -68,8 +69,8 @@ func (m *MockArtifactService) GetByDiskID(ctx context.Context, diskID uuid.UUID)
 	return args.Get(0).([]*model.Artifact), args.Error(1)
 }
 
-func (m *MockArtifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error {
-	args := m.Called(ctx, projectID, diskID, path, filename)
+func (m *MockArtifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, cond service.WriteCondition) error {
+	args := m.Called(ctx, projectID, diskID, path, filename, cond)
 	return args.Error(0)
 }
 
@@ -83,8 +84,8 @@ func (m *MockArtifactService) UpdateArtifactByPath(ctx context.Context, diskID u
 	return args.Get(0).(*model.Artifact), args.Error(1)
 }
 
-func (m *MockArtifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}) (*model.Artifact, error) {
-	args := m.Called(ctx, diskID, path, filename, userMeta)
+func (m *MockArtifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}, cond service.WriteCondition) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, path, filename, userMeta, cond)
 	return args.Get(0).(*model.Artifact), args.Error(1)
 }
 
@@ -96,14 +97,72 @@ func (m *MockArtifactService) GetFileContent(ctx context.Context, artifact *mode
 	return args.Get(0).(*fileparser.FileContent), args.Error(1)
 }
 
-func (m *MockArtifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
-	args := m.Called(ctx, projectID, diskID, pattern, limit)
+func (m *MockArtifactService) GetFileRange(ctx context.Context, artifact *model.Artifact, offset int64, limit int64) (*service.FileRange, error) {
+	args := m.Called(ctx, artifact, offset, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.FileRange), args.Error(1)
+}
+
+func (m *MockArtifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in service.GrepInput) ([]*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, in)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*model.Artifact), args.Error(1)
 }
 
+func (m *MockArtifactService) CreateUpload(ctx context.Context, in service.CreateUploadInput) (*service.UploadPlan, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.UploadPlan), args.Error(1)
+}
+
+func (m *MockArtifactService) FinalizeUpload(ctx context.Context, in service.FinalizeUploadInput) (*model.Artifact, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) PruneExpiredUploads(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockArtifactService) EditText(ctx context.Context, in service.EditTextInput) (*model.Artifact, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) AcquireLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string, ttl time.Duration) (*service.ArtifactLock, error) {
+	args := m.Called(ctx, diskID, path, filename, lockID, ttl)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.ArtifactLock), args.Error(1)
+}
+
+func (m *MockArtifactService) ReleaseLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string) error {
+	args := m.Called(ctx, diskID, path, filename, lockID)
+	return args.Error(0)
+}
+
+func (m *MockArtifactService) GrepLines(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in service.GrepInput) ([]*service.GrepFileResult, error) {
+	args := m.Called(ctx, projectID, diskID, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*service.GrepFileResult), args.Error(1)
+}
+
 func (m *MockArtifactService) GlobArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
 	args := m.Called(ctx, projectID, diskID, pattern, limit)
 	if args.Get(0) == nil {
@@ -112,6 +171,71 @@ func (m *MockArtifactService) GlobArtifacts(ctx context.Context, projectID uuid.
 	return args.Get(0).([]*model.Artifact), args.Error(1)
 }
 
+func (m *MockArtifactService) ListVersions(ctx context.Context, artifact *model.Artifact) ([]*model.ArtifactVersion, error) {
+	args := m.Called(ctx, artifact)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.ArtifactVersion), args.Error(1)
+}
+
+func (m *MockArtifactService) GetVersion(ctx context.Context, artifact *model.Artifact, version int) (*model.Artifact, error) {
+	args := m.Called(ctx, artifact, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) DiffVersions(ctx context.Context, artifact *model.Artifact, from int, to int) (string, error) {
+	args := m.Called(ctx, artifact, from, to)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockArtifactService) RestoreVersion(ctx context.Context, projectID uuid.UUID, artifact *model.Artifact, version int, cond service.WriteCondition) (*model.Artifact, error) {
+	args := m.Called(ctx, projectID, artifact, version, cond)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, cond service.WriteCondition) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, srcPath, srcFilename, dstPath, dstFilename, cond)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	args := m.Called(ctx, diskID, srcDir, dstDir, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactService) CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, lockID string) (*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, srcPath, srcFilename, dstPath, dstFilename, lockID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactService) CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, srcDir, dstDir, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactService) RemoveDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool, lockID string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, dir, recursive, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactService) MakeDirectory(ctx context.Context, diskID uuid.UUID, dir string) error {
+	args := m.Called(ctx, diskID, dir)
+	return args.Error(0)
+}
+
 // createTestConfig creates a test config with default artifact settings
 func createTestConfig(maxUploadSizeBytes int64) *config.Config {
 	return &config.Config{
@@ -322,7 +446,7 @@ func TestArtifactHandler_DeleteArtifact(t *testing.T) {
 			filePath: "/test/test.txt",
 			mockSetup: func(m *MockArtifactService, diskIDStr string, filePath string, projectID uuid.UUID) {
 				diskID := uuid.MustParse(diskIDStr)
-				m.On("DeleteByPath", mock.Anything, projectID, diskID, "/test/", "test.txt").Return(nil)
+				m.On("DeleteByPath", mock.Anything, projectID, diskID, "/test/", "test.txt", service.WriteCondition{}).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -409,7 +533,7 @@ func TestArtifactHandler_UpdateArtifact(t *testing.T) {
 					"description": "Updated report",
 					"version":     "2.0",
 				}
-				m.On("UpdateArtifactMetaByPath", mock.Anything, diskID, "/test/", "report.pdf", expectedMeta).Return(expectedFile, nil)
+				m.On("UpdateArtifactMetaByPath", mock.Anything, diskID, "/test/", "report.pdf", expectedMeta, service.WriteCondition{}).Return(expectedFile, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -662,6 +786,117 @@ func TestArtifactHandler_GetArtifact(t *testing.T) {
 	}
 }
 
+func TestArtifactHandler_GetArtifact_Ranges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	diskID := uuid.New()
+	textFile := &model.Artifact{
+		ID:        uuid.New(),
+		DiskID:    diskID,
+		Path:      "/src/",
+		Filename:  "main.py",
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "test-key", MIME: "text/x-python", SizeB: 24}),
+	}
+	binaryFile := &model.Artifact{
+		ID:        uuid.New(),
+		DiskID:    diskID,
+		Path:      "/img/",
+		Filename:  "logo.png",
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "test-key", MIME: "image/png", SizeB: 2048}),
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+		checkResp      func(*testing.T, GetArtifactResp)
+	}{
+		{
+			name:  "line page with numbers",
+			query: "file_path=/src/main.py&with_public_url=false&line_offset=1&line_limit=2&with_line_numbers=true",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("GetByPath", mock.Anything, diskID, "/src/", "main.py").Return(textFile, nil)
+				m.On("GetFileContent", mock.Anything, textFile).Return(&fileparser.FileContent{Type: "code", Raw: "a = 1\nb = 2\nc = 3\nd = 4\n"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp GetArtifactResp) {
+				if assert.NotNil(t, resp.Content) && assert.NotNil(t, resp.TotalLines) {
+					assert.Equal(t, "     2\tb = 2\n     3\tc = 3\n", resp.Content.Raw)
+					assert.Equal(t, 4, *resp.TotalLines)
+				}
+				assert.Nil(t, resp.Bytes)
+			},
+		},
+		{
+			name:  "byte range of binary file",
+			query: "file_path=/img/logo.png&with_public_url=false&byte_offset=1024&byte_limit=4",
+			mockSetup: func(m *MockArtifactService) {
+				m.On("GetByPath", mock.Anything, diskID, "/img/", "logo.png").Return(binaryFile, nil)
+				m.On("GetFileRange", mock.Anything, binaryFile, int64(1024), int64(4)).Return(&service.FileRange{
+					Offset:    1024,
+					Length:    4,
+					TotalSize: 2048,
+					Data:      []byte{0x89, 'P', 'N', 'G'},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResp: func(t *testing.T, resp GetArtifactResp) {
+				if assert.NotNil(t, resp.Bytes) {
+					assert.Equal(t, []byte{0x89, 'P', 'N', 'G'}, resp.Bytes.Data)
+					assert.Equal(t, int64(2048), resp.Bytes.TotalSize)
+				}
+				assert.Nil(t, resp.Content)
+			},
+		},
+		{
+			name:           "byte offset without byte limit",
+			query:          "file_path=/img/logo.png&byte_offset=10",
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative line offset",
+			query:          "file_path=/src/main.py&line_offset=-1",
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "byte limit too large",
+			query:          "file_path=/img/logo.png&byte_limit=100000000",
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, createDefaultTestConfig())
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/disk/%s/artifact?%s", diskID, tt.query), nil)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "disk_id", Value: diskID.String()}}
+
+			handler.GetArtifact(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.checkResp != nil {
+				var response struct {
+					Data GetArtifactResp `json:"data"`
+				}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				tt.checkResp(t, response.Data)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestArtifactHandler_GrepArtifacts(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -678,7 +913,7 @@ func TestArtifactHandler_GrepArtifacts(t *testing.T) {
 			query:  "TODO",
 			limit:  "10",
 			setupMock: func(svc *MockArtifactService) {
-				svc.On("GrepArtifacts", mock.Anything, mock.Anything, mock.Anything, "TODO", 10).
+				svc.On("GrepArtifacts", mock.Anything, mock.Anything, mock.Anything, service.GrepInput{Pattern: "TODO", Limit: 10, MaxMatchesPerFile: 20}).
 					Return([]*model.Artifact{
 						{
 							ID:       uuid.New(),
@@ -698,7 +933,7 @@ func TestArtifactHandler_GrepArtifacts(t *testing.T) {
 			query:  "NOTFOUND",
 			limit:  "50",
 			setupMock: func(svc *MockArtifactService) {
-				svc.On("GrepArtifacts", mock.Anything, mock.Anything, mock.Anything, "NOTFOUND", 50).
+				svc.On("GrepArtifacts", mock.Anything, mock.Anything, mock.Anything, service.GrepInput{Pattern: "NOTFOUND", Limit: 50, MaxMatchesPerFile: 20}).
 					Return([]*model.Artifact{}, nil)
 			},
 			expectedStatus: http.StatusOK,
@@ -706,6 +941,20 @@ func TestArtifactHandler_GrepArtifacts(t *testing.T) {
 				assert.Contains(t, body, "data")
 			},
 		},
+		{
+			name:   "invalid pattern",
+			diskID: "123e4567-e89b-12d3-a456-426614174000",
+			query:  "(unclosed",
+			limit:  "10",
+			setupMock: func(svc *MockArtifactService) {
+				svc.On("GrepArtifacts", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("%w: missing closing )", service.ErrInvalidGrepPattern))
+			},
+			expectedStatus: http.StatusBadRequest,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, "invalid query")
+			},
+		},
 		{
 			name:           "invalid disk ID",
 			diskID:         "invalid-uuid",
@@ -752,6 +1001,94 @@ func TestArtifactHandler_GrepArtifacts(t *testing.T) {
 	}
 }
 
+func TestArtifactHandler_GrepArtifacts_ContentMode(t *testing.T) {
+	diskID := "123e4567-e89b-12d3-a456-426614174000"
+
+	tests := []struct {
+		name           string
+		query          string
+		setupMock      func(*MockArtifactService)
+		expectedStatus int
+		checkBody      func(*testing.T, string)
+	}{
+		{
+			name:  "matching lines with context",
+			query: "query=todo&output_mode=content&case_insensitive=true&fixed_string=true&glob=**/*.py&before_context=1&after_context=2&max_matches_per_file=5",
+			setupMock: func(svc *MockArtifactService) {
+				svc.On("GrepLines", mock.Anything, mock.Anything, mock.Anything, service.GrepInput{
+					Pattern:           "todo",
+					CaseInsensitive:   true,
+					FixedString:       true,
+					Glob:              "**/*.py",
+					Limit:             100,
+					BeforeContext:     1,
+					AfterContext:      2,
+					MaxMatchesPerFile: 5,
+				}).Return([]*service.GrepFileResult{
+					{
+						Path:     "/src/",
+						Filename: "main.py",
+						Matches: []service.GrepMatch{
+							{LineNumber: 3, Line: "# TODO: fix", Before: []string{"import os"}},
+						},
+					},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body string) {
+				assert.Contains(t, body, `"line_number":3`)
+				assert.Contains(t, body, `"line":"# TODO: fix"`)
+				assert.Contains(t, body, `"before":["import os"]`)
+			},
+		},
+		{
+			name:  "invalid pattern",
+			query: "query=(unclosed&output_mode=content",
+			setupMock: func(svc *MockArtifactService) {
+				svc.On("GrepLines", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("%w: missing closing )", service.ErrInvalidGrepPattern))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown output mode",
+			query:          "query=TODO&output_mode=count",
+			setupMock:      func(svc *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "context too large",
+			query:          "query=TODO&output_mode=content&after_context=100",
+			setupMock:      func(svc *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSvc := new(MockArtifactService)
+			tt.setupMock(mockSvc)
+
+			handler := NewArtifactHandler(mockSvc, createTestConfig(10*1024*1024))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set("project", &model.Project{ID: uuid.New()})
+
+			c.Request = httptest.NewRequest("GET", "/disk/"+diskID+"/artifact/grep?"+tt.query, nil)
+			c.Params = gin.Params{{Key: "disk_id", Value: diskID}}
+
+			handler.GrepArtifacts(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.checkBody != nil {
+				tt.checkBody(t, w.Body.String())
+			}
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
+
 func TestArtifactHandler_GlobArtifacts(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -799,6 +1136,17 @@ func TestArtifactHandler_GlobArtifacts(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:   "malformed pattern",
+			diskID: "123e4567-e89b-12d3-a456-426614174000",
+			query:  "%5Babc",
+			limit:  "10",
+			setupMock: func(svc *MockArtifactService) {
+				svc.On("GlobArtifacts", mock.Anything, mock.Anything, mock.Anything, "[abc", 10).
+					Return(nil, fmt.Errorf("%w: missing ']'", service.ErrInvalidGlobPattern))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "invalid disk ID",
 			diskID:         "not-a-uuid",
@@ -836,3 +1184,810 @@ func TestArtifactHandler_GlobArtifacts(t *testing.T) {
 		})
 	}
 }
+
+func TestArtifactHandler_ArtifactVersions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	diskID := uuid.New()
+	projectID := uuid.New()
+	newArtifact := func() *model.Artifact {
+		return &model.Artifact{
+			ID:        uuid.New(),
+			DiskID:    diskID,
+			Path:      "/docs/",
+			Filename:  "notes.md",
+			AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "key-3", MIME: "text/markdown"}),
+			Version:   3,
+		}
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		call           func(*ArtifactHandler, *gin.Context)
+		mockSetup      func(*MockArtifactService, *model.Artifact)
+		expectedStatus int
+	}{
+		{
+			name:   "list versions",
+			method: http.MethodGet,
+			url:    "/versions?file_path=/docs/notes.md",
+			call:   (*ArtifactHandler).ListArtifactVersions,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("ListVersions", mock.Anything, a).Return([]*model.ArtifactVersion{{Version: 3}, {Version: 2}, {Version: 1}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "list versions without file path",
+			method:         http.MethodGet,
+			url:            "/versions",
+			call:           (*ArtifactHandler).ListArtifactVersions,
+			mockSetup:      func(m *MockArtifactService, a *model.Artifact) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "get previous version",
+			method: http.MethodGet,
+			url:    "?file_path=/docs/notes.md&with_public_url=false&with_content=false&version=1",
+			call:   (*ArtifactHandler).GetArtifact,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				old := *a
+				old.Version = 1
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("GetVersion", mock.Anything, a, 1).Return(&old, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "get missing version",
+			method: http.MethodGet,
+			url:    "?file_path=/docs/notes.md&version=7",
+			call:   (*ArtifactHandler).GetArtifact,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("GetVersion", mock.Anything, a, 7).Return(nil, fmt.Errorf("%w: version 7", service.ErrArtifactVersionNotFound))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "diff against current version by default",
+			method: http.MethodGet,
+			url:    "/diff?file_path=/docs/notes.md&from=1",
+			call:   (*ArtifactHandler).DiffArtifactVersions,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("DiffVersions", mock.Anything, a, 1, 3).Return("--- /docs/notes.md@v1\n+++ /docs/notes.md@v3\n", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "diff without from",
+			method:         http.MethodGet,
+			url:            "/diff?file_path=/docs/notes.md",
+			call:           (*ArtifactHandler).DiffArtifactVersions,
+			mockSetup:      func(m *MockArtifactService, a *model.Artifact) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "diff of binary file",
+			method: http.MethodGet,
+			url:    "/diff?file_path=/docs/notes.md&from=1&to=2",
+			call:   (*ArtifactHandler).DiffArtifactVersions,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("DiffVersions", mock.Anything, a, 1, 2).Return("", fmt.Errorf("version 1: %w", service.ErrUnsupportedFileType))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "diff with unreadable content",
+			method: http.MethodGet,
+			url:    "/diff?file_path=/docs/notes.md&from=1&to=2",
+			call:   (*ArtifactHandler).DiffArtifactVersions,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("DiffVersions", mock.Anything, a, 1, 2).Return("", errors.New("version 1: failed to download file content: timeout"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:   "restore version",
+			method: http.MethodPost,
+			url:    "/restore",
+			body:   `{"file_path": "/docs/notes.md", "version": 1}`,
+			call:   (*ArtifactHandler).RestoreArtifactVersion,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				restored := *a
+				restored.Version = 4
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("RestoreVersion", mock.Anything, projectID, a, 1, service.WriteCondition{}).Return(&restored, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "restore missing version",
+			method: http.MethodPost,
+			url:    "/restore",
+			body:   `{"file_path": "/docs/notes.md", "version": 9}`,
+			call:   (*ArtifactHandler).RestoreArtifactVersion,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("RestoreVersion", mock.Anything, projectID, a, 9, service.WriteCondition{}).Return(nil, fmt.Errorf("%w: version 9", service.ErrArtifactVersionNotFound))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "restore locked artifact",
+			method: http.MethodPost,
+			url:    "/restore",
+			body:   `{"file_path": "/docs/notes.md", "version": 1}`,
+			call:   (*ArtifactHandler).RestoreArtifactVersion,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("RestoreVersion", mock.Anything, projectID, a, 1, service.WriteCondition{}).Return(nil, service.ErrArtifactLocked)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:   "restore current version",
+			method: http.MethodPost,
+			url:    "/restore",
+			body:   `{"file_path": "/docs/notes.md", "version": 3}`,
+			call:   (*ArtifactHandler).RestoreArtifactVersion,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("RestoreVersion", mock.Anything, projectID, a, 3, service.WriteCondition{}).Return(nil, fmt.Errorf("%w: version 3 is already the current version", service.ErrInvalidVersion))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "restore fails to save",
+			method: http.MethodPost,
+			url:    "/restore",
+			body:   `{"file_path": "/docs/notes.md", "version": 1}`,
+			call:   (*ArtifactHandler).RestoreArtifactVersion,
+			mockSetup: func(m *MockArtifactService, a *model.Artifact) {
+				m.On("GetByPath", mock.Anything, diskID, "/docs/", "notes.md").Return(a, nil)
+				m.On("RestoreVersion", mock.Anything, projectID, a, 1, service.WriteCondition{}).Return(nil, errors.New("restore artifact version: connection reset"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "restore without version",
+			method:         http.MethodPost,
+			url:            "/restore",
+			body:           `{"file_path": "/docs/notes.md"}`,
+			call:           (*ArtifactHandler).RestoreArtifactVersion,
+			mockSetup:      func(m *MockArtifactService, a *model.Artifact) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService, newArtifact())
+
+			handler := NewArtifactHandler(mockService, createDefaultTestConfig())
+
+			req := httptest.NewRequest(tt.method, fmt.Sprintf("/disk/%s/artifact%s", diskID, tt.url), bytes.NewReader([]byte(tt.body)))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "disk_id", Value: diskID.String()}}
+			c.Set("project", &model.Project{ID: projectID})
+
+			tt.call(handler, c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_PathOperations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	diskID := uuid.New()
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		call           func(*ArtifactHandler, *gin.Context)
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name:   "rename artifact",
+			method: http.MethodPost,
+			url:    "/mv",
+			body:   `{"src": "/notes/draft.md", "dst": "/notes/final.md"}`,
+			call:   (*ArtifactHandler).MoveArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveArtifact", mock.Anything, diskID, "/notes/", "draft.md", "/notes/", "final.md", service.WriteCondition{}).
+					Return(&model.Artifact{DiskID: diskID, Path: "/notes/", Filename: "final.md"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "move artifact into directory keeps filename",
+			method: http.MethodPost,
+			url:    "/mv",
+			body:   `{"src": "/notes/draft.md", "dst": "/archive/"}`,
+			call:   (*ArtifactHandler).MoveArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveArtifact", mock.Anything, diskID, "/notes/", "draft.md", "/archive/", "draft.md", service.WriteCondition{}).
+					Return(&model.Artifact{DiskID: diskID, Path: "/archive/", Filename: "draft.md"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "move directory",
+			method: http.MethodPost,
+			url:    "/mv",
+			body:   `{"src": "/notes/", "dst": "/archive/notes/"}`,
+			call:   (*ArtifactHandler).MoveArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDirectory", mock.Anything, diskID, "/notes/", "/archive/notes/", "").Return(int64(4), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "move directory to file path",
+			method:         http.MethodPost,
+			url:            "/mv",
+			body:           `{"src": "/notes/", "dst": "/archive/notes.md"}`,
+			call:           (*ArtifactHandler).MoveArtifacts,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "move into itself",
+			method: http.MethodPost,
+			url:    "/mv",
+			body:   `{"src": "/notes/", "dst": "/notes/old/"}`,
+			call:   (*ArtifactHandler).MoveArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDirectory", mock.Anything, diskID, "/notes/", "/notes/old/", "").Return(int64(0), service.ErrInvalidPathOperation)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "copy over existing artifacts",
+			method: http.MethodPost,
+			url:    "/cp",
+			body:   `{"src": "/templates/", "dst": "/projects/new/"}`,
+			call:   (*ArtifactHandler).CopyArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("CopyDirectory", mock.Anything, projectID, diskID, "/templates/", "/projects/new/", "").Return(int64(0), service.ErrArtifactExists)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "copy missing artifact",
+			method: http.MethodPost,
+			url:    "/cp",
+			body:   `{"src": "/missing.md", "dst": "/copy.md"}`,
+			call:   (*ArtifactHandler).CopyArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("CopyArtifact", mock.Anything, projectID, diskID, "/", "missing.md", "/", "copy.md", "").Return(nil, service.ErrPathNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "move locked directory",
+			method: http.MethodPost,
+			url:    "/mv",
+			body:   `{"src": "/notes/", "dst": "/archive/notes/"}`,
+			call:   (*ArtifactHandler).MoveArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveDirectory", mock.Anything, diskID, "/notes/", "/archive/notes/", "").Return(int64(0), service.ErrArtifactLocked)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:   "move stale artifact",
+			method: http.MethodPost,
+			url:    "/mv",
+			body:   `{"src": "/notes/draft.md", "dst": "/archive/"}`,
+			call:   (*ArtifactHandler).MoveArtifacts,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MoveArtifact", mock.Anything, diskID, "/notes/", "draft.md", "/archive/", "draft.md", service.WriteCondition{}).Return(nil, service.ErrPreconditionFailed)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "make directory",
+			method: http.MethodPost,
+			url:    "/mkdir",
+			body:   `{"path": "/projects/new/"}`,
+			call:   (*ArtifactHandler).MakeDirectory,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("MakeDirectory", mock.Anything, diskID, "/projects/new/").Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "make directory without trailing slash",
+			method:         http.MethodPost,
+			url:            "/mkdir",
+			body:           `{"path": "/projects/new"}`,
+			call:           (*ArtifactHandler).MakeDirectory,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "remove directory recursively",
+			method: http.MethodDelete,
+			url:    "/dir?path=/projects/old/&recursive=true",
+			call:   (*ArtifactHandler).RemoveDirectory,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("RemoveDirectory", mock.Anything, projectID, diskID, "/projects/old/", true, "").Return(int64(12), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "remove non-empty directory without recursive",
+			method: http.MethodDelete,
+			url:    "/dir?path=/projects/old/",
+			call:   (*ArtifactHandler).RemoveDirectory,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("RemoveDirectory", mock.Anything, projectID, diskID, "/projects/old/", false, "").Return(int64(0), service.ErrDirectoryNotEmpty)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:   "remove directory with a locked artifact",
+			method: http.MethodDelete,
+			url:    "/dir?path=/projects/old/&recursive=true",
+			call:   (*ArtifactHandler).RemoveDirectory,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("RemoveDirectory", mock.Anything, projectID, diskID, "/projects/old/", true, "").Return(int64(0), service.ErrArtifactLocked)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			handler := NewArtifactHandler(mockService, createDefaultTestConfig())
+
+			req := httptest.NewRequest(tt.method, fmt.Sprintf("/disk/%s/artifact%s", diskID, tt.url), bytes.NewReader([]byte(tt.body)))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "disk_id", Value: diskID.String()}}
+			c.Set("project", &model.Project{ID: projectID})
+
+			tt.call(handler, c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_DirectUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	diskID := uuid.New()
+	projectID := uuid.New()
+	uploadID := uuid.New()
+	sha := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	finalizeIn := service.FinalizeUploadInput{ProjectID: projectID, DiskID: diskID, UploadID: uploadID, SHA256: sha}
+	finalizeBody := fmt.Sprintf(`{"upload_id": "%s", "sha256": "%s"}`, uploadID, sha)
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		call           func(*ArtifactHandler, *gin.Context)
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "create upload url",
+			url:  "/upload_url",
+			body: `{"file_path": "/datasets/train.csv", "size": 524288000, "meta": {"split": "train"}}`,
+			call: (*ArtifactHandler).CreateUploadURL,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("CreateUpload", mock.Anything, service.CreateUploadInput{
+					ProjectID:   projectID,
+					DiskID:      diskID,
+					Path:        "/datasets/",
+					Filename:    "train.csv",
+					SizeB:       524288000,
+					ContentType: "application/octet-stream",
+					UserMeta:    map[string]interface{}{"split": "train"},
+					Expire:      time.Hour,
+				}).Return(&service.UploadPlan{UploadID: uploadID, Method: "MULTIPART"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "file larger than direct upload limit",
+			url:            "/upload_url",
+			body:           `{"file_path": "/datasets/huge.bin", "size": 2147483648}`,
+			call:           (*ArtifactHandler).CreateUploadURL,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "file path without filename",
+			url:            "/upload_url",
+			body:           `{"file_path": "/datasets/", "size": 1024}`,
+			call:           (*ArtifactHandler).CreateUploadURL,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "reserved meta key",
+			url:            "/upload_url",
+			body:           `{"file_path": "/a.bin", "size": 1024, "meta": {"__artifact_info__": {}}}`,
+			call:           (*ArtifactHandler).CreateUploadURL,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "finalize upload",
+			url:  "/finalize",
+			body: finalizeBody,
+			call: (*ArtifactHandler).FinalizeUpload,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, finalizeIn).
+					Return(&model.Artifact{DiskID: diskID, Path: "/datasets/", Filename: "train.csv"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "finalize with malformed sha256",
+			url:            "/finalize",
+			body:           fmt.Sprintf(`{"upload_id": "%s", "sha256": "abc"}`, uploadID),
+			call:           (*ArtifactHandler).FinalizeUpload,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "finalize unknown upload",
+			url:  "/finalize",
+			body: finalizeBody,
+			call: (*ArtifactHandler).FinalizeUpload,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, finalizeIn).Return(nil, service.ErrUploadNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "finalize expired upload",
+			url:  "/finalize",
+			body: finalizeBody,
+			call: (*ArtifactHandler).FinalizeUpload,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, finalizeIn).Return(nil, service.ErrUploadExpired)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name: "finalize before all parts are uploaded",
+			url:  "/finalize",
+			body: finalizeBody,
+			call: (*ArtifactHandler).FinalizeUpload,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, finalizeIn).
+					Return(nil, fmt.Errorf("%w: 3 of 8 uploaded", service.ErrUploadIncomplete))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "finalize with checksum mismatch",
+			url:  "/finalize",
+			body: finalizeBody,
+			call: (*ArtifactHandler).FinalizeUpload,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("FinalizeUpload", mock.Anything, finalizeIn).Return(nil, service.ErrUploadChecksumMismatch)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+
+			cfg := createDefaultTestConfig()
+			cfg.Artifact.MaxDirectUploadSizeBytes = 1 << 30
+			handler := NewArtifactHandler(mockService, cfg)
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/disk/%s/artifact%s", diskID, tt.url), bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "disk_id", Value: diskID.String()}}
+			c.Set("project", &model.Project{ID: projectID})
+
+			tt.call(handler, c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_EditArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	diskID := uuid.New()
+	projectID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name: "edit in place",
+			body: `{"file_path": "/notes/todo.md", "operations": [
+				{"op": "str_replace", "old_str": "- [ ] ship", "new_str": "- [x] ship"},
+				{"op": "delete_lines", "line": 3, "end_line": 4}
+			]}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("EditText", mock.Anything, service.EditTextInput{
+					ProjectID: projectID,
+					DiskID:    diskID,
+					Path:      "/notes/",
+					Filename:  "todo.md",
+					Edits: []service.TextEdit{
+						{Op: service.EditStrReplace, OldStr: "- [ ] ship", NewStr: "- [x] ship"},
+						{Op: service.EditDeleteLines, Line: 3, EndLine: 4},
+					},
+				}).Return(&model.Artifact{DiskID: diskID, Path: "/notes/", Filename: "todo.md", Version: 2}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unknown operation",
+			body:           `{"file_path": "/notes/todo.md", "operations": [{"op": "truncate"}]}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "no operations",
+			body:           `{"file_path": "/notes/todo.md", "operations": []}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "directory path",
+			body:           `{"file_path": "/notes/", "operations": [{"op": "append", "text": "x"}]}`,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "missing artifact",
+			body: `{"file_path": "/notes/todo.md", "operations": [{"op": "append", "text": "x"}]}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("EditText", mock.Anything, mock.Anything).Return(nil, service.ErrPathNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "ambiguous str_replace",
+			body: `{"file_path": "/notes/todo.md", "operations": [{"op": "str_replace", "old_str": "x", "new_str": "y"}]}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("EditText", mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("%w: operation 1 (str_replace): old_str matches 2 times", service.ErrInvalidEdit))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "concurrent writers",
+			body: `{"file_path": "/notes/todo.md", "operations": [{"op": "append", "text": "x"}]}`,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("EditText", mock.Anything, mock.Anything).Return(nil, service.ErrEditConflict)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+			handler := NewArtifactHandler(mockService, createDefaultTestConfig())
+
+			req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/disk/%s/artifact", diskID), bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "disk_id", Value: diskID.String()}}
+			c.Set("project", &model.Project{ID: projectID})
+
+			handler.EditArtifact(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestArtifactHandler_WriteConditions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	diskID := uuid.New()
+	projectID := uuid.New()
+	sha := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		headers        map[string]string
+		call           func(*ArtifactHandler, *gin.Context)
+		mockSetup      func(*MockArtifactService)
+		expectedStatus int
+	}{
+		{
+			name:    "delete with if-match",
+			method:  http.MethodDelete,
+			url:     "?file_path=/notes/todo.md",
+			headers: map[string]string{"If-Match": `"` + sha + `"`},
+			call:    (*ArtifactHandler).DeleteArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("DeleteByPath", mock.Anything, projectID, diskID, "/notes/", "todo.md", service.WriteCondition{IfMatch: sha}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:    "delete with stale if-match",
+			method:  http.MethodDelete,
+			url:     "?file_path=/notes/todo.md",
+			headers: map[string]string{"If-Match": `W/"old"`},
+			call:    (*ArtifactHandler).DeleteArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("DeleteByPath", mock.Anything, projectID, diskID, "/notes/", "todo.md", service.WriteCondition{IfMatch: "old"}).
+					Return(service.ErrPreconditionFailed)
+			},
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:   "edit of a locked artifact",
+			method: http.MethodPatch,
+			body:   `{"file_path": "/notes/todo.md", "operations": [{"op": "append", "text": "x"}]}`,
+			call:   (*ArtifactHandler).EditArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("EditText", mock.Anything, mock.Anything).Return(nil, service.ErrArtifactLocked)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:    "edit by the lock holder",
+			method:  http.MethodPatch,
+			body:    `{"file_path": "/notes/todo.md", "operations": [{"op": "append", "text": "x"}]}`,
+			headers: map[string]string{artifactLockHeader: "lock-1"},
+			call:    (*ArtifactHandler).EditArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("EditText", mock.Anything, mock.MatchedBy(func(in service.EditTextInput) bool {
+					return in.Condition == service.WriteCondition{LockID: "lock-1"}
+				})).Return(&model.Artifact{Path: "/notes/", Filename: "todo.md"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "lock with default ttl",
+			method: http.MethodPost,
+			url:    "/lock",
+			body:   `{"file_path": "/notes/todo.md"}`,
+			call:   (*ArtifactHandler).LockArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("AcquireLock", mock.Anything, diskID, "/notes/", "todo.md", "", time.Minute).
+					Return(&service.ArtifactLock{LockID: "lock-1", FilePath: "/notes/todo.md"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "lock held by someone else",
+			method: http.MethodPost,
+			url:    "/lock",
+			body:   `{"file_path": "/notes/todo.md", "ttl": 30}`,
+			call:   (*ArtifactHandler).LockArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("AcquireLock", mock.Anything, diskID, "/notes/", "todo.md", "", 30*time.Second).Return(nil, service.ErrArtifactLocked)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+		{
+			name:   "renew an expired lock",
+			method: http.MethodPost,
+			url:    "/lock",
+			body:   `{"file_path": "/notes/todo.md", "lock_id": "lock-1"}`,
+			call:   (*ArtifactHandler).LockArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("AcquireLock", mock.Anything, diskID, "/notes/", "todo.md", "lock-1", time.Minute).Return(nil, service.ErrLockNotHeld)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "lock ttl too long",
+			method:         http.MethodPost,
+			url:            "/lock",
+			body:           `{"file_path": "/notes/todo.md", "ttl": 86400}`,
+			call:           (*ArtifactHandler).LockArtifact,
+			mockSetup:      func(m *MockArtifactService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "lock without redis",
+			method: http.MethodPost,
+			url:    "/lock",
+			body:   `{"file_path": "/notes/todo.md"}`,
+			call:   (*ArtifactHandler).LockArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("AcquireLock", mock.Anything, diskID, "/notes/", "todo.md", "", time.Minute).Return(nil, service.ErrLocksUnavailable)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:   "unlock",
+			method: http.MethodDelete,
+			url:    "/lock?file_path=/notes/todo.md&lock_id=lock-1",
+			call:   (*ArtifactHandler).UnlockArtifact,
+			mockSetup: func(m *MockArtifactService) {
+				m.On("ReleaseLock", mock.Anything, diskID, "/notes/", "todo.md", "lock-1").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockArtifactService)
+			tt.mockSetup(mockService)
+			handler := NewArtifactHandler(mockService, createDefaultTestConfig())
+
+			req := httptest.NewRequest(tt.method, fmt.Sprintf("/disk/%s/artifact%s", diskID, tt.url), bytes.NewReader([]byte(tt.body)))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "disk_id", Value: diskID.String()}}
+			c.Set("project", &model.Project{ID: projectID})
+
+			tt.call(handler, c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
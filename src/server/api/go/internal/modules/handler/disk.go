@@ -151,3 +151,224 @@ func (h *DiskHandler) DeleteDisk(c *gin.Context) {
 
 	c.JSON(http.StatusOK, serializer.Response{})
 }
+
+// diskSnapshotErr writes the response for errors of snapshot operations
+func diskSnapshotErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrDiskNotFound), errors.Is(err, service.ErrSnapshotNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "", err))
+	case errors.Is(err, service.ErrArtifactLocked):
+		c.JSON(http.StatusLocked, serializer.Err(http.StatusLocked, "artifact is locked", err))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
+
+// CreateDiskSnapshot godoc
+//
+//	@Summary		Create disk snapshot
+//	@Description	Record an immutable point-in-time manifest of all artifacts and directories of a disk. Snapshots share content with the disk, so they are cheap to take; the content stays stored until the snapshot is deleted.
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.DiskSnapshot}
+//	@Router			/disk/{disk_id}/snapshot [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Snapshot a workspace disk\nsnapshot = client.disks.create_snapshot(disk_id='disk-uuid')\nprint(f\"Snapshot {snapshot.id} with {snapshot.artifact_count} artifacts\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Snapshot a workspace disk\nconst snapshot = await client.disks.createSnapshot('disk-uuid');\nconsole.log(`Snapshot ${snapshot.id} with ${snapshot.artifact_count} artifacts`);\n","label":"JavaScript"}]
+func (h *DiskHandler) CreateDiskSnapshot(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	snapshot, err := h.svc.CreateSnapshot(c.Request.Context(), project.ID, diskID)
+	if err != nil {
+		diskSnapshotErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: snapshot})
+}
+
+// ListDiskSnapshots godoc
+//
+//	@Summary		List disk snapshots
+//	@Description	List the snapshots of a disk, newest first
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.DiskSnapshot}
+//	@Router			/disk/{disk_id}/snapshot [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List snapshots of a disk\nsnapshots = client.disks.list_snapshots(disk_id='disk-uuid')\nfor snapshot in snapshots:\n    print(f\"{snapshot.id}: {snapshot.created_at}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List snapshots of a disk\nconst snapshots = await client.disks.listSnapshots('disk-uuid');\nfor (const snapshot of snapshots) {\n  console.log(`${snapshot.id}: ${snapshot.created_at}`);\n}\n","label":"JavaScript"}]
+func (h *DiskHandler) ListDiskSnapshots(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	snapshots, err := h.svc.ListSnapshots(c.Request.Context(), project.ID, diskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: snapshots})
+}
+
+// DeleteDiskSnapshot godoc
+//
+//	@Summary		Delete disk snapshot
+//	@Description	Delete a snapshot and release the content only it still references
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"		Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			snapshot_id	path	string	true	"Snapshot ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Router			/disk/{disk_id}/snapshot/{snapshot_id} [delete]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Delete a snapshot\nclient.disks.delete_snapshot(disk_id='disk-uuid', snapshot_id='snapshot-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Delete a snapshot\nawait client.disks.deleteSnapshot('disk-uuid', 'snapshot-uuid');\n","label":"JavaScript"}]
+func (h *DiskHandler) DeleteDiskSnapshot(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	snapshotID, err := uuid.Parse(c.Param("snapshot_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	if err := h.svc.DeleteSnapshot(c.Request.Context(), project.ID, diskID, snapshotID); err != nil {
+		diskSnapshotErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+type CloneDiskReq struct {
+	Snapshot string `form:"snapshot" json:"snapshot" binding:"omitempty,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+// CloneDisk godoc
+//
+//	@Summary		Clone disk
+//	@Description	Create a new disk with the same artifacts and directories as a snapshot of the disk, or as the disk itself when no snapshot is given. The clone shares content with its source, so no data is copied. Version history is not cloned.
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"								Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			snapshot	query	string	false	"Snapshot ID to clone instead of the live disk"	Format(uuid)
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.Disk}
+//	@Router			/disk/{disk_id}/clone [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Give an agent run its own scratch copy of a workspace\nscratch = client.disks.clone(disk_id='disk-uuid', snapshot='snapshot-uuid')\nprint(f\"Scratch disk: {scratch.id}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Give an agent run its own scratch copy of a workspace\nconst scratch = await client.disks.clone('disk-uuid', { snapshot: 'snapshot-uuid' });\nconsole.log(`Scratch disk: ${scratch.id}`);\n","label":"JavaScript"}]
+func (h *DiskHandler) CloneDisk(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := CloneDiskReq{}
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	var snapshotID *uuid.UUID
+	if req.Snapshot != "" {
+		id := uuid.MustParse(req.Snapshot)
+		snapshotID = &id
+	}
+
+	disk, err := h.svc.Clone(c.Request.Context(), project.ID, diskID, snapshotID)
+	if err != nil {
+		diskSnapshotErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: disk})
+}
+
+type RestoreDiskSnapshotReq struct {
+	SnapshotID string `form:"snapshot_id" json:"snapshot_id" binding:"required,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+}
+
+type RestoreDiskSnapshotResp struct {
+	Count int64 `json:"count"`
+}
+
+// RestoreDiskSnapshot godoc
+//
+//	@Summary		Restore disk snapshot
+//	@Description	Roll a disk back to one of its snapshots. All current artifacts and directories are replaced by the snapshot contents in one transaction, and the version history of the replaced artifacts is dropped. The snapshot itself is kept and can be restored again. The restore fails with 423 if a current artifact or a snapshot path is locked by another holder.
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string							true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload		body	handler.RestoreDiskSnapshotReq	true	"RestoreDiskSnapshot payload"
+//	@Param			X-Lock-Id	header	string							false	"Lock ID of the caller's lock on the restored paths"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.RestoreDiskSnapshotResp}
+//	@Failure		423	{object}	serializer.Response	"Artifact is locked by another holder"
+//	@Router			/disk/{disk_id}/restore [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Reset a scratch disk between agent runs\nresult = client.disks.restore(disk_id='disk-uuid', snapshot_id='snapshot-uuid')\nprint(f\"Restored {result.count} artifacts\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Reset a scratch disk between agent runs\nconst result = await client.disks.restore('disk-uuid', { snapshotId: 'snapshot-uuid' });\nconsole.log(`Restored ${result.count} artifacts`);\n","label":"JavaScript"}]
+func (h *DiskHandler) RestoreDiskSnapshot(c *gin.Context) {
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	req := RestoreDiskSnapshotReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	count, err := h.svc.RestoreSnapshot(c.Request.Context(), project.ID, diskID, uuid.MustParse(req.SnapshotID), c.GetHeader(artifactLockHeader))
+	if err != nil {
+		diskSnapshotErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: RestoreDiskSnapshotResp{Count: count}})
+}
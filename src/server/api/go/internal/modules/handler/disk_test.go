@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -43,6 +44,40 @@ func (m *MockDiskService) List(ctx context.Context, in service.ListDisksInput) (
 	return args.Get(0).(*service.ListDisksOutput), args.Error(1)
 }
 
+func (m *MockDiskService) CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.DiskSnapshot), args.Error(1)
+}
+
+func (m *MockDiskService) ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.DiskSnapshot), args.Error(1)
+}
+
+func (m *MockDiskService) DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	return args.Error(0)
+}
+
+func (m *MockDiskService) Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Disk), args.Error(1)
+}
+
+func (m *MockDiskService) RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID, lockID string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 func setupDiskRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -273,3 +308,148 @@ func TestDiskHandler_DeleteDisk(t *testing.T) {
 		})
 	}
 }
+
+func TestDiskHandler_Snapshots(t *testing.T) {
+	projectID := uuid.New()
+	diskID := uuid.New()
+	snapshotID := uuid.New()
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		setup          func(*MockDiskService)
+		expectedStatus int
+	}{
+		{
+			name:   "create snapshot",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/snapshot",
+			setup: func(svc *MockDiskService) {
+				svc.On("CreateSnapshot", mock.Anything, projectID, diskID).Return(&model.DiskSnapshot{ID: snapshotID, DiskID: diskID, ArtifactCount: 2}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "create snapshot of missing disk",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/snapshot",
+			setup: func(svc *MockDiskService) {
+				svc.On("CreateSnapshot", mock.Anything, projectID, diskID).Return(nil, service.ErrDiskNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "list snapshots",
+			method: "GET",
+			url:    "/disk/" + diskID.String() + "/snapshot",
+			setup: func(svc *MockDiskService) {
+				svc.On("ListSnapshots", mock.Anything, projectID, diskID).Return([]*model.DiskSnapshot{{ID: snapshotID}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "delete missing snapshot",
+			method: "DELETE",
+			url:    "/disk/" + diskID.String() + "/snapshot/" + snapshotID.String(),
+			setup: func(svc *MockDiskService) {
+				svc.On("DeleteSnapshot", mock.Anything, projectID, diskID, snapshotID).Return(service.ErrSnapshotNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "clone live disk",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/clone",
+			setup: func(svc *MockDiskService) {
+				svc.On("Clone", mock.Anything, projectID, diskID, (*uuid.UUID)(nil)).Return(&model.Disk{ID: uuid.New(), ProjectID: projectID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:   "clone snapshot",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/clone?snapshot=" + snapshotID.String(),
+			setup: func(svc *MockDiskService) {
+				svc.On("Clone", mock.Anything, projectID, diskID, &snapshotID).Return(&model.Disk{ID: uuid.New(), ProjectID: projectID}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "clone with invalid snapshot id",
+			method:         "POST",
+			url:            "/disk/" + diskID.String() + "/clone?snapshot=nope",
+			setup:          func(svc *MockDiskService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "restore snapshot",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/restore",
+			body:   `{"snapshot_id":"` + snapshotID.String() + `"}`,
+			setup: func(svc *MockDiskService) {
+				svc.On("RestoreSnapshot", mock.Anything, projectID, diskID, snapshotID, "").Return(int64(4), nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "restore without snapshot id",
+			method:         "POST",
+			url:            "/disk/" + diskID.String() + "/restore",
+			body:           `{}`,
+			setup:          func(svc *MockDiskService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:   "restore missing snapshot",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/restore",
+			body:   `{"snapshot_id":"` + snapshotID.String() + `"}`,
+			setup: func(svc *MockDiskService) {
+				svc.On("RestoreSnapshot", mock.Anything, projectID, diskID, snapshotID, "").Return(int64(0), service.ErrSnapshotNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:   "restore over locked artifacts",
+			method: "POST",
+			url:    "/disk/" + diskID.String() + "/restore",
+			body:   `{"snapshot_id":"` + snapshotID.String() + `"}`,
+			setup: func(svc *MockDiskService) {
+				svc.On("RestoreSnapshot", mock.Anything, projectID, diskID, snapshotID, "").Return(int64(0), service.ErrArtifactLocked)
+			},
+			expectedStatus: http.StatusLocked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockDiskService{}
+			tt.setup(mockService)
+			handler := NewDiskHandler(mockService, &MockUserService{})
+
+			router := setupDiskRouter()
+			withProject := func(h gin.HandlerFunc) gin.HandlerFunc {
+				return func(c *gin.Context) {
+					c.Set("project", &model.Project{ID: projectID})
+					h(c)
+				}
+			}
+			router.POST("/disk/:disk_id/snapshot", withProject(handler.CreateDiskSnapshot))
+			router.GET("/disk/:disk_id/snapshot", withProject(handler.ListDiskSnapshots))
+			router.DELETE("/disk/:disk_id/snapshot/:snapshot_id", withProject(handler.DeleteDiskSnapshot))
+			router.POST("/disk/:disk_id/clone", withProject(handler.CloneDisk))
+			router.POST("/disk/:disk_id/restore", withProject(handler.RestoreDiskSnapshot))
+
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -41,27 +41,34 @@ type CreateSessionReq struct {
 	SpaceID             string                 `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
 	DisableTaskTracking *bool                  `form:"disable_task_tracking" json:"disable_task_tracking" example:"false"`
 	Configs             map[string]interface{} `form:"configs" json:"configs"`
+	// ParentSessionID, ParentMessageID and ParentToolCallID link a sub-agent
+	// session to the session, message and tool call that spawned it
+	ParentSessionID  string `form:"parent_session_id" json:"parent_session_id" binding:"omitempty,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ParentMessageID  string `form:"parent_message_id" json:"parent_message_id" binding:"omitempty,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174001"`
+	ParentToolCallID string `form:"parent_tool_call_id" json:"parent_tool_call_id" example:"call_abc123"`
 }
 
 type GetSessionsReq struct {
-	User         string `form:"user" json:"user" example:"alice@luminox.io"`
-	SpaceID      string `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
-	NotConnected bool   `form:"not_connected,default=false" json:"not_connected" example:"false"`
-	Limit        int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
-	Cursor       string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
-	TimeDesc     bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+	User            string `form:"user" json:"user" example:"alice@luminox.io"`
+	SpaceID         string `form:"space_id" json:"space_id" format:"uuid" example:"123e4567-e89b-12d3-a456-42661417"`
+	NotConnected    bool   `form:"not_connected,default=false" json:"not_connected" example:"false"`
+	ParentSessionID string `form:"parent_session_id" json:"parent_session_id" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Limit           int    `form:"limit,default=20" json:"limit" binding:"required,min=1,max=200" example:"20"`
+	Cursor          string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	TimeDesc        bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
 }
 
 // GetSessions godoc
 //
 //	@Summary		Get sessions
-//	@Description	Get all sessions under a project, optionally filtered by space_id or user
+//	@Description	Get all sessions under a project, optionally filtered by space_id, user or parent_session_id
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
 //	@Param			user			query	string	false	"User identifier to filter sessions"							example(alice@luminox.io)
 //	@Param			space_id		query	string	false	"Space ID to filter sessions"									format(uuid)
 //	@Param			not_connected	query	boolean	false	"Filter sessions not connected to any space (default false)"	example(false)
+//	@Param			parent_session_id	query	string	false	"Only return sub-agent sessions spawned by this session"	format(uuid)
 //	@Param			limit			query	integer	false	"Limit of sessions to return, default 20. Max 200."
 //	@Param			cursor			query	string	false	"Cursor for pagination. Use the cursor from the previous response to get the next page."
 //	@Param			time_desc		query	string	false	"Order by created_at descending if true, ascending if false (default false)"	example(false)
@@ -93,14 +100,25 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 		spaceID = &parsed
 	}
 
+	var parentSessionID *uuid.UUID
+	if req.ParentSessionID != "" {
+		parsed, err := uuid.Parse(req.ParentSessionID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid parent_session_id", err))
+			return
+		}
+		parentSessionID = &parsed
+	}
+
 	out, err := h.svc.List(c.Request.Context(), service.ListSessionsInput{
-		ProjectID:    project.ID,
-		User:         req.User,
-		SpaceID:      spaceID,
-		NotConnected: req.NotConnected,
-		Limit:        req.Limit,
-		Cursor:       req.Cursor,
-		TimeDesc:     req.TimeDesc,
+		ProjectID:       project.ID,
+		User:            req.User,
+		SpaceID:         spaceID,
+		NotConnected:    req.NotConnected,
+		ParentSessionID: parentSessionID,
+		Limit:           req.Limit,
+		Cursor:          req.Cursor,
+		TimeDesc:        req.TimeDesc,
 	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
@@ -113,7 +131,7 @@ func (h *SessionHandler) GetSessions(c *gin.Context) {
 // CreateSession godoc
 //
 //	@Summary		Create session
-//	@Description	Create a new session under a space. Optionally associate with a user identifier.
+//	@Description	Create a new session under a space. Optionally associate with a user identifier. Sub-agent sessions can be linked to the session that spawned them with parent_session_id, and to the message and tool call that spawned them with parent_message_id and parent_tool_call_id.
 //	@Tags			session
 //	@Accept			json
 //	@Produce		json
@@ -135,6 +153,11 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 		return
 	}
 
+	if err := service.ValidateConfigs(req.Configs); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid configs", err))
+		return
+	}
+
 	session := model.Session{
 		ProjectID:           project.ID,
 		DisableTaskTracking: false, // Default value
@@ -162,7 +185,29 @@ func (h *SessionHandler) CreateSession(c *gin.Context) {
 	if req.DisableTaskTracking != nil {
 		session.DisableTaskTracking = *req.DisableTaskTracking
 	}
+	if req.ParentSessionID != "" {
+		parentSessionID, err := uuid.Parse(req.ParentSessionID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		session.ParentSessionID = &parentSessionID
+	}
+	if req.ParentMessageID != "" {
+		parentMessageID, err := uuid.Parse(req.ParentMessageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+		session.ParentMessageID = &parentMessageID
+	}
+	session.ParentToolCallID = req.ParentToolCallID
+
 	if err := h.svc.Create(c.Request.Context(), &session); err != nil {
+		if errors.Is(err, service.ErrInvalidParent) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
 		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
 		return
 	}
@@ -232,6 +277,10 @@ func (h *SessionHandler) UpdateConfigs(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
+	if err := service.ValidateConfigs(req.Configs); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid configs", err))
+		return
+	}
 	if err := h.svc.UpdateByID(c.Request.Context(), &model.Session{
 		ID:      sessionID,
 		Configs: datatypes.JSONMap(req.Configs),
@@ -317,14 +366,22 @@ func (h *SessionHandler) ConnectToSpace(c *gin.Context) {
 }
 
 type StoreMessageReq struct {
-	Blob   interface{} `form:"blob" json:"blob" binding:"required"`
-	Format string      `form:"format" json:"format" binding:"omitempty,oneof=luminox openai anthropic gemini" example:"openai" enums:"luminox,openai,anthropic,gemini"`
+	Blob      interface{} `form:"blob" json:"blob" binding:"required"`
+	Format    string      `form:"format" json:"format" binding:"omitempty,oneof=luminox openai anthropic gemini" example:"openai" enums:"luminox,openai,anthropic,gemini"`
+	Protected bool        `form:"protected" json:"protected" example:"false"`
+	// OffloadToolResultsAboveTokens moves tool results longer than this many tokens to the session disk
+	OffloadToolResultsAboveTokens int `form:"offload_tool_results_above_tokens" json:"offload_tool_results_above_tokens" binding:"omitempty,min=0" example:"2000"`
+	// ExpectedLastMessageID and ExpectedLastSeq reject the store with 409 if another writer appended first
+	ExpectedLastMessageID string `form:"expected_last_message_id" json:"expected_last_message_id" binding:"omitempty,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	ExpectedLastSeq       *int64 `form:"expected_last_seq" json:"expected_last_seq" binding:"omitempty,min=0" example:"41"`
+	// AgentName attributes the message to an agent, overriding the name carried by the blob
+	AgentName string `form:"agent_name" json:"agent_name" binding:"omitempty,max=256" example:"critic"`
 }
 
 // StoreMessage godoc
 //
 //	@Summary		Store message to session
-//	@Description	Supports JSON and multipart/form-data. In multipart mode: the payload is a JSON string placed in a form field. The format parameter indicates the format of the input message (default: openai, same as GET). The blob field should be a complete message object: for openai, use OpenAI ChatCompletionMessageParam format (with role and content); for anthropic, use Anthropic MessageParam format (with role and content); for luminox (internal), use {role, parts} format.
+//	@Description	Supports JSON and multipart/form-data. In multipart mode: the payload is a JSON string placed in a form field. The format parameter indicates the format of the input message (default: openai, same as GET). The blob field should be a complete message object: for openai, use OpenAI ChatCompletionMessageParam format (with role and content); for anthropic, use Anthropic MessageParam format (with role and content); for luminox (internal), use {role, parts} format. Set protected to true to keep the message from being dropped or edited by edit strategies. Set offload_tool_results_above_tokens to move tool results above that many tokens into an artifact on a disk bound to the session (see the session's disk_id); the tool-result text is replaced with a reference (disk ID, file path and preview) and the full content can be read through the artifact endpoints. Set expected_last_message_id and/or expected_last_seq to append only if the session's latest message is still the one you read (use the nil UUID or 0 for an empty session); otherwise nothing is stored and 409 is returned. In multi-agent sessions the message is attributed to agent_name; when it is omitted, the OpenAI name field or the luminox meta.agent_name is used. When the project, space or session config tool_call_validation is annotate or reject, tool-call arguments are validated against the session's tool definitions (or the project's tool reference schemas) and tool results must answer a tool call already stored in the session; annotate records problems in the part meta under validation_errors, reject returns 400.
 //	@Tags			session
 //	@Accept			json
 //	@Accept			multipart/form-data
@@ -339,6 +396,7 @@ type StoreMessageReq struct {
 //	@Param			file		formData	file					false	"When uploading files, the field name must correspond to parts[*].file_field."
 //	@Security		BearerAuth
 //	@Success		201	{object}	serializer.Response{data=model.Message}
+//	@Failure		409	{object}	serializer.Response	"Another writer appended after the expected last message"
 //	@Router			/session/{session_id}/messages [post]
 //	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\nfrom luminox.messages import build_luminox_message\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Store a message in Luminox format\nmessage = build_luminox_message(role='user', parts=['Hello!'])\nclient.sessions.store_message(\n    session_id='session-uuid',\n    blob=message,\n    format='luminox'\n)\n\n# Store a message in OpenAI format\nopenai_message = {'role': 'user', 'content': 'Hello from OpenAI format!'}\nclient.sessions.store_message(\n    session_id='session-uuid',\n    blob=openai_message,\n    format='openai'\n)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient, MessagePart } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Store a message in Luminox format\nawait client.sessions.storeMessage(\n  'session-uuid',\n  {\n    role: 'user',\n    parts: [MessagePart.textPart('Hello!')]\n  },\n  { format: 'luminox' }\n);\n\n// Store a message in OpenAI format\nawait client.sessions.storeMessage(\n  'session-uuid',\n  {\n    role: 'user',\n    content: 'Hello from OpenAI format!'\n  },\n  { format: 'openai' }\n);\n","label":"JavaScript"}]
 func (h *SessionHandler) StoreMessage(c *gin.Context) {
@@ -454,6 +512,21 @@ func (h *SessionHandler) StoreMessage(c *gin.Context) {
 		return
 	}
 
+	// Protected messages are never dropped or edited by edit strategies
+	if req.Protected {
+		if normalizedMeta == nil {
+			normalizedMeta = make(map[string]interface{})
+		}
+		normalizedMeta[model.MessageProtectedKey] = true
+	}
+
+	// The agent name is a column of the message, not message metadata
+	agentName, _ := normalizedMeta[model.MessageAgentNameKey].(string)
+	delete(normalizedMeta, model.MessageAgentNameKey)
+	if req.AgentName != "" {
+		agentName = req.AgentName
+	}
+
 	// Validate that we have at least one part
 	if len(normalizedParts) == 0 {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("message must contain at least one part")))
@@ -485,6 +558,20 @@ func (h *SessionHandler) StoreMessage(c *gin.Context) {
 		return
 	}
 
+	var expectedLastMessageID *uuid.UUID
+	if req.ExpectedLastMessageID != "" {
+		id, err := uuid.Parse(req.ExpectedLastMessageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid expected_last_message_id", err))
+			return
+		}
+		expectedLastMessageID = &id
+	}
+	if req.ExpectedLastSeq != nil && *req.ExpectedLastSeq < 0 {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("expected_last_seq must be >= 0")))
+		return
+	}
+
 	out, err := h.svc.StoreMessage(c.Request.Context(), service.StoreMessageInput{
 		ProjectID:   project.ID,
 		SessionID:   sessionID,
@@ -493,8 +580,21 @@ func (h *SessionHandler) StoreMessage(c *gin.Context) {
 		Format:      format,
 		MessageMeta: normalizedMeta,
 		Files:       fileMap,
+
+		OffloadToolResultsAboveTokens: req.OffloadToolResultsAboveTokens,
+		ExpectedLastMessageID:         expectedLastMessageID,
+		ExpectedLastSeq:               req.ExpectedLastSeq,
+		AgentName:                     agentName,
 	})
 	if err != nil {
+		if errors.Is(err, service.ErrAppendConflict) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "append conflict", err))
+			return
+		}
+		if errors.Is(err, service.ErrInvalidToolCall) {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid tool call", err))
+			return
+		}
 		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
 		return
 	}
@@ -503,13 +603,25 @@ func (h *SessionHandler) StoreMessage(c *gin.Context) {
 }
 
 type GetMessagesReq struct {
-	Limit                         *int   `form:"limit" json:"limit" binding:"omitempty,min=0,max=200" example:"20"`
-	Cursor                        string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
-	WithAssetPublicURL            bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
-	Format                        string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=luminox openai anthropic gemini" example:"openai" enums:"luminox,openai,anthropic,gemini"`
-	TimeDesc                      bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
-	EditStrategies                string `form:"edit_strategies" json:"edit_strategies" example:"[{\"type\":\"remove_tool_result\",\"params\":{\"keep_recent_n_tool_results\":3}}]"`
-	PinEditingStrategiesAtMessage string `form:"pin_editing_strategies_at_message" json:"pin_editing_strategies_at_message" example:""`
+	Limit                            *int   `form:"limit" json:"limit" binding:"omitempty,min=0,max=200" example:"20"`
+	Cursor                           string `form:"cursor" json:"cursor" example:"cHJvdGVjdGVkIHZlcnNpb24gdG8gYmUgZXhjbHVkZWQgaW4gcGFyc2luZyB0aGUgY3Vyc29y"`
+	WithAssetPublicURL               bool   `form:"with_asset_public_url,default=true" json:"with_asset_public_url" example:"true"`
+	Format                           string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=luminox openai anthropic gemini" example:"openai" enums:"luminox,openai,anthropic,gemini"`
+	TimeDesc                         bool   `form:"time_desc,default=false" json:"time_desc" example:"false"`
+	EditStrategies                   string `form:"edit_strategies" json:"edit_strategies" example:"[{\"type\":\"remove_tool_result\",\"params\":{\"keep_recent_n_tool_results\":3}}]"`
+	PinEditingStrategiesAtMessage    string `form:"pin_editing_strategies_at_message" json:"pin_editing_strategies_at_message" example:""`
+	PinEditingStrategiesAtCheckpoint string `form:"pin_editing_strategies_at_checkpoint" json:"pin_editing_strategies_at_checkpoint" example:""`
+	UntilMessage                     string `form:"until_message" json:"until_message" binding:"omitempty,uuid" example:""`
+	UntilCheckpoint                  string `form:"until_checkpoint" json:"until_checkpoint" example:"plan approved"`
+	EditStrategiesOrder              string `form:"edit_strategies_order" json:"edit_strategies_order" binding:"omitempty,oneof=priority as_given" example:"priority" enums:"priority,as_given"`
+	Explain                          bool   `form:"explain,default=false" json:"explain" example:"false"`
+	AutoCacheControl                 bool   `form:"auto_cache_control,default=false" json:"auto_cache_control" example:"false"`
+	CacheGrowthTokens                int    `form:"cache_growth_tokens" json:"cache_growth_tokens" binding:"omitempty,min=1" example:"4096"`
+
+	// AgentNames keeps only the messages of these agents; AsAgent renders the
+	// other agents' turns as named user messages
+	AgentNames []string `form:"agent_name" json:"agent_name" example:"critic"`
+	AsAgent    string   `form:"as_agent" json:"as_agent" example:"critic"`
 }
 
 // GetMessages godoc
@@ -525,8 +637,17 @@ type GetMessagesReq struct {
 //	@Param			with_asset_public_url				query	string	false	"Whether to return asset public url, default is true"																																																																							example(true)
 //	@Param			format								query	string	false	"Format to convert messages to: luminox (original), openai (default), anthropic, gemini."																																																														enums(luminox,openai,anthropic,gemini)
 //	@Param			time_desc							query	string	false	"Order by created_at descending if true, ascending if false (default false)"																																																																	example(false)
-//	@Param			edit_strategies						query	string	false	"JSON array of edit strategies to apply before format conversion"																																																																				example([{"type":"remove_tool_result","params":{"keep_recent_n_tool_results":3}}])
+//	@Param			edit_strategies						query	string	false	"JSON array of edit strategies to apply before format conversion. If omitted, the edit_strategies defined in the session, space or project configs are used (in that order of precedence). Pass [] to disable default strategies."																																																																				example([{"type":"remove_tool_result","params":{"keep_recent_n_tool_results":3}}])
 //	@Param			pin_editing_strategies_at_message	query	string	false	"Message ID to pin editing strategies at. When provided, strategies are only applied to messages up to and including this message ID, keeping subsequent messages unchanged. This helps maintain prompt cache stability by preserving a stable prefix. The response will include edit_at_message_id indicating where strategies were applied."	example()
+//	@Param			pin_editing_strategies_at_checkpoint	query	string	false	"Name of a session checkpoint to pin editing strategies at. Same as pin_editing_strategies_at_message with the checkpoint's message ID; the two cannot be combined."
+//	@Param			until_message						query	string	false	"Message ID to stop at. Messages after it are not returned. Cannot be combined with until_checkpoint, nor with time_desc when limit is set."	format(uuid)
+//	@Param			until_checkpoint					query	string	false	"Name of a session checkpoint to stop at. Same as until_message with the checkpoint's message ID."
+//	@Param			edit_strategies_order				query	string	false	"Order in which edit strategies are applied: priority (default) sorts them by their registered priority, with token_limit last; as_given applies them exactly in the order given"	enums(priority,as_given)
+//	@Param			explain								query	string	false	"When true and edit_strategies is provided, the response includes edit_explain with a per-strategy report of tokens before/after, removed message IDs and modified parts (default false)"	example(false)
+//	@Param			auto_cache_control					query	string	false	"Anthropic format only. When true, up to four cache_control breakpoints are placed automatically (replacing any stored ones) around a deterministic pin that is remembered per session. The pin also pins edit strategies unless pin_editing_strategies_at_message is set. The response includes cache_pin_message_id and cache_breakpoint_ids (default false)"	example(false)
+//	@Param			cache_growth_tokens					query	integer	false	"With auto_cache_control, the number of tokens the conversation may grow past the pin before the pin moves forward (default 4096)"	example(4096)
+//	@Param			agent_name							query	[]string	false	"Only return messages attributed to these agents (repeat the parameter for several agents)"	collectionFormat(multi)
+//	@Param			as_agent							query	string	false	"Render the conversation as seen by this agent: other agents' turns become user messages prefixed with their name, and their tool calls and results become text"	example(critic)
 //	@Security		BearerAuth
 //	@Success		200	{object}	serializer.Response{data=service.GetMessagesOutput}
 //	@Router			/session/{session_id}/messages [get]
@@ -559,15 +680,29 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 		}
 	}
 
+	if req.AutoCacheControl && req.Format != string(model.FormatAnthropic) {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("auto_cache_control requires format=anthropic")))
+		return
+	}
+
 	out, err := h.svc.GetMessages(c.Request.Context(), service.GetMessagesInput{
-		SessionID:                     sessionID,
-		Limit:                         limit,
-		Cursor:                        req.Cursor,
-		WithAssetPublicURL:            req.WithAssetPublicURL,
-		AssetExpire:                   time.Hour * 24,
-		TimeDesc:                      req.TimeDesc,
-		EditStrategies:                editStrategies,
-		PinEditingStrategiesAtMessage: req.PinEditingStrategiesAtMessage,
+		SessionID:                        sessionID,
+		Limit:                            limit,
+		Cursor:                           req.Cursor,
+		WithAssetPublicURL:               req.WithAssetPublicURL,
+		AssetExpire:                      time.Hour * 24,
+		TimeDesc:                         req.TimeDesc,
+		EditStrategies:                   editStrategies,
+		PinEditingStrategiesAtMessage:    req.PinEditingStrategiesAtMessage,
+		PinEditingStrategiesAtCheckpoint: req.PinEditingStrategiesAtCheckpoint,
+		UntilMessageID:                   req.UntilMessage,
+		UntilCheckpoint:                  req.UntilCheckpoint,
+		EditStrategiesOrder:              editor.StrategyOrder(req.EditStrategiesOrder),
+		Explain:                          req.Explain,
+		UseDefaultEditStrategies:         req.EditStrategies == "",
+		AutoCacheControl:                 req.AutoCacheControl,
+		CacheGrowthTokens:                req.CacheGrowthTokens,
+		AgentNames:                       req.AgentNames,
 	})
 	if err != nil {
 		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
@@ -586,6 +721,10 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
+	if req.AsAgent != "" {
+		out.Items = converter.RenderAgentView(out.Items, req.AsAgent)
+	}
+
 	// Calculate token count for the returned messages
 	thisTimeTokens, err := tokenizer.CountMessagePartsTokens(c.Request.Context(), out.Items)
 	if err != nil {
@@ -607,9 +746,712 @@ func (h *SessionHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
+	if out.EditExplain != nil {
+		convertedOut["edit_explain"] = out.EditExplain
+	}
+	if req.AutoCacheControl {
+		convertedOut["cache_pin_message_id"] = out.CachePinMessageID
+		convertedOut["cache_breakpoint_ids"] = out.CacheBreakpointIDs
+	}
+
 	c.JSON(http.StatusOK, serializer.Response{Data: convertedOut})
 }
 
+type EditPreviewReq struct {
+	EditStrategies                string `form:"edit_strategies" json:"edit_strategies" example:"[{\"type\":\"remove_tool_result\",\"params\":{\"keep_recent_n_tool_results\":3}}]"`
+	Candidates                    string `form:"candidates" json:"candidates" example:"[[{\"type\":\"token_limit\",\"params\":{\"limit_tokens\":20000}}],[{\"type\":\"middle_out\",\"params\":{\"token_reduce_to\":20000}}]]"`
+	PinEditingStrategiesAtMessage string `form:"pin_editing_strategies_at_message" json:"pin_editing_strategies_at_message" example:""`
+	EditStrategiesOrder           string `form:"edit_strategies_order" json:"edit_strategies_order" binding:"omitempty,oneof=priority as_given" example:"priority" enums:"priority,as_given"`
+}
+
+type EditPreviewCandidate struct {
+	EditStrategies  []editor.StrategyConfig     `json:"edit_strategies"`
+	TokensBefore    int                         `json:"tokens_before"`
+	TokensAfter     int                         `json:"tokens_after"`
+	TokensSaved     int                         `json:"tokens_saved"`
+	MessagesAfter   int                         `json:"messages_after"`
+	EditAtMessageID string                      `json:"edit_at_message_id,omitempty"`
+	Steps           []editor.StrategyStepReport `json:"steps"`
+}
+
+type EditPreviewResp struct {
+	TotalMessages int                    `json:"total_messages"`
+	TotalTokens   int                    `json:"total_tokens"`
+	Candidates    []EditPreviewCandidate `json:"candidates"`
+}
+
+// GetEditPreview godoc
+//
+//	@Summary		Preview edit strategies
+//	@Description	Dry-run edit strategies against all messages of a session without returning the messages. Each strategy is applied in its sorted order and reported with the tokens before and after, the removed message IDs and the modified parts. Pass several strategy sets in candidates to compare them side by side.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id							path	string	true	"Session ID"	format(uuid)
+//	@Param			edit_strategies						query	string	false	"JSON array of edit strategies to preview"																example([{"type":"remove_tool_result","params":{"keep_recent_n_tool_results":3}}])
+//	@Param			candidates							query	string	false	"JSON array of edit strategy arrays to compare side by side. Evaluated after edit_strategies if both are provided."	example([[{"type":"token_limit","params":{"limit_tokens":20000}}]])
+//	@Param			pin_editing_strategies_at_message	query	string	false	"Message ID to pin editing strategies at, same as in GET /session/{session_id}/messages"	example()
+//	@Param			edit_strategies_order				query	string	false	"Order in which edit strategies are applied, same as in GET /session/{session_id}/messages"	enums(priority,as_given)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.EditPreviewResp}
+//	@Router			/session/{session_id}/messages/edit_preview [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Compare two strategy sets\npreview = client.sessions.edit_preview(\n    session_id='session-uuid',\n    candidates=[\n        [{'type': 'remove_tool_result', 'params': {'keep_recent_n_tool_results': 3}}],\n        [{'type': 'token_limit', 'params': {'limit_tokens': 20000}}],\n    ]\n)\nfor candidate in preview.candidates:\n    print(candidate.tokens_saved)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Compare two strategy sets\nconst preview = await client.sessions.editPreview('session-uuid', {\n  candidates: [\n    [{ type: 'remove_tool_result', params: { keep_recent_n_tool_results: 3 } }],\n    [{ type: 'token_limit', params: { limit_tokens: 20000 } }],\n  ]\n});\nfor (const candidate of preview.candidates) {\n  console.log(candidate.tokens_saved);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetEditPreview(c *gin.Context) {
+	req := EditPreviewReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	var candidates [][]editor.StrategyConfig
+	if req.EditStrategies != "" {
+		var editStrategies []editor.StrategyConfig
+		if err := sonic.Unmarshal([]byte(req.EditStrategies), &editStrategies); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid edit_strategies JSON", err))
+			return
+		}
+		candidates = append(candidates, editStrategies)
+	}
+	if req.Candidates != "" {
+		var extra [][]editor.StrategyConfig
+		if err := sonic.Unmarshal([]byte(req.Candidates), &extra); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid candidates JSON", err))
+			return
+		}
+		candidates = append(candidates, extra...)
+	}
+	if len(candidates) == 0 {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("edit_strategies or candidates is required")))
+		return
+	}
+
+	messages, err := h.svc.GetAllMessages(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to get messages", err))
+		return
+	}
+
+	totalTokens, err := tokenizer.CountMessagePartsTokens(c.Request.Context(), messages)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.Err(http.StatusInternalServerError, "failed to count tokens", err))
+		return
+	}
+
+	resp := EditPreviewResp{
+		TotalMessages: len(messages),
+		TotalTokens:   totalTokens,
+		Candidates:    make([]EditPreviewCandidate, 0, len(candidates)),
+	}
+	for i, configs := range candidates {
+		result, err := editor.ExplainStrategiesWithOptions(c.Request.Context(), messages, configs, editor.ApplyOptions{
+			PinAtMessageID: req.PinEditingStrategiesAtMessage,
+			Order:          editor.StrategyOrder(req.EditStrategiesOrder),
+		})
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr(fmt.Sprintf("candidates[%d]", i), err))
+			return
+		}
+		resp.Candidates = append(resp.Candidates, EditPreviewCandidate{
+			EditStrategies:  configs,
+			TokensBefore:    result.TokensBefore,
+			TokensAfter:     result.TokensAfter,
+			TokensSaved:     result.TokensBefore - result.TokensAfter,
+			MessagesAfter:   len(result.Messages),
+			EditAtMessageID: result.EditAtMessageID,
+			Steps:           result.Steps,
+		})
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+// ListEditStrategies godoc
+//
+//	@Summary		List edit strategies
+//	@Description	List the registered edit strategies with their parameter schemas, in their default execution order. Strategies with a lower priority are applied first unless edit_strategies_order=as_given is used.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]editor.StrategyDefinition}
+//	@Router			/edit_strategies [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List available edit strategies\nstrategies = client.sessions.list_edit_strategies()\nfor strategy in strategies:\n    print(strategy.type, [p.name for p in strategy.params])\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List available edit strategies\nconst strategies = await client.sessions.listEditStrategies();\nfor (const strategy of strategies) {\n  console.log(strategy.type, strategy.params.map((p) => p.name));\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) ListEditStrategies(c *gin.Context) {
+	c.JSON(http.StatusOK, serializer.Response{Data: editor.ListStrategies()})
+}
+
+type SetMessageProtectedReq struct {
+	Protected bool `form:"protected" json:"protected" example:"true"`
+}
+
+// SetMessageProtected godoc
+//
+//	@Summary		Protect message
+//	@Description	Flag or unflag a message as protected. Protected messages, and the tool-calls or tool-results paired with them, are never dropped by the token_limit and middle_out edit strategies, and their tool results are never replaced by remove_tool_result.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string							true	"Session ID"	format(uuid)
+//	@Param			message_id	path	string							true	"Message ID"	format(uuid)
+//	@Param			payload		body	handler.SetMessageProtectedReq	true	"SetMessageProtected payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Router			/session/{session_id}/messages/{message_id}/protected [put]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Protect the task brief from edit strategies\nclient.sessions.set_message_protected(\n    session_id='session-uuid',\n    message_id='message-uuid',\n    protected=True\n)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Protect the task brief from edit strategies\nawait client.sessions.setMessageProtected('session-uuid', 'message-uuid', {\n  protected: true\n});\n","label":"JavaScript"}]
+func (h *SessionHandler) SetMessageProtected(c *gin.Context) {
+	req := SetMessageProtectedReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.SetMessageProtected(c.Request.Context(), sessionID, messageID, req.Protected); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+// GetSessionChildren godoc
+//
+//	@Summary		Get child sessions
+//	@Description	Get the sub-agent sessions spawned directly by a session, oldest first. Each child carries the parent_message_id and parent_tool_call_id of the tool call that spawned it.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Session}
+//	@Router			/session/{session_id}/children [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Find the sub-agent sessions spawned by a session\nchildren = client.sessions.get_children(session_id='session-uuid')\nfor child in children:\n    print(child.id, child.parent_tool_call_id)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Find the sub-agent sessions spawned by a session\nconst children = await client.sessions.getChildren('session-uuid');\nfor (const child of children) {\n  console.log(child.id, child.parent_tool_call_id);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) GetSessionChildren(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	children, err := h.svc.ListChildren(c.Request.Context(), project.ID, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: children})
+}
+
+type GetSessionTreeReq struct {
+	MaxDepth int `form:"max_depth,default=5" json:"max_depth" binding:"min=0,max=20" example:"5"`
+}
+
+// GetSessionTree godoc
+//
+//	@Summary		Get session tree
+//	@Description	Get a session and its sub-agent sessions as a tree, down to max_depth levels. Nodes whose children were cut off by max_depth are marked truncated.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			max_depth	query	integer	false	"Number of descendant levels to return, default 5. Max 20."	example(5)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.SessionTreeNode}
+//	@Router			/session/{session_id}/tree [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Walk the sub-agent sessions of an orchestrator session\ntree = client.sessions.get_tree(session_id='session-uuid', max_depth=3)\n\ndef walk(node, indent=0):\n    print(' ' * indent + str(node.session.id))\n    for child in node.children:\n        walk(child, indent + 2)\n\nwalk(tree)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Walk the sub-agent sessions of an orchestrator session\nconst tree = await client.sessions.getTree('session-uuid', { maxDepth: 3 });\n\nconst walk = (node, indent = 0) => {\n  console.log(' '.repeat(indent) + node.session.id);\n  node.children.forEach((child) => walk(child, indent + 2));\n};\nwalk(tree);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetSessionTree(c *gin.Context) {
+	req := GetSessionTreeReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	tree, err := h.svc.GetTree(c.Request.Context(), project.ID, sessionID, req.MaxDepth)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: tree})
+}
+
+type SetCheckpointReq struct {
+	Name        string `form:"name" json:"name" binding:"required,max=256" example:"plan approved"`
+	MessageID   string `form:"message_id" json:"message_id" binding:"required,uuid" format:"uuid" example:"123e4567-e89b-12d3-a456-426614174000"`
+	Description string `form:"description" json:"description" example:"User approved the migration plan"`
+}
+
+// SetCheckpoint godoc
+//
+//	@Summary		Set checkpoint
+//	@Description	Create a named checkpoint pointing at a message of the session. Setting an existing name moves the checkpoint to the new message. Checkpoints can be used by get messages through until_checkpoint and pin_editing_strategies_at_checkpoint.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string						true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.SetCheckpointReq	true	"SetCheckpoint payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=model.Checkpoint}
+//	@Router			/session/{session_id}/checkpoints [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Bookmark the message where the plan was approved\ncheckpoint = client.sessions.set_checkpoint(\n    session_id='session-uuid',\n    name='plan approved',\n    message_id='message-uuid',\n    description='User approved the migration plan'\n)\nprint(checkpoint.name, checkpoint.message_id)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Bookmark the message where the plan was approved\nconst checkpoint = await client.sessions.setCheckpoint('session-uuid', {\n  name: 'plan approved',\n  messageId: 'message-uuid',\n  description: 'User approved the migration plan'\n});\nconsole.log(checkpoint.name, checkpoint.message_id);\n","label":"JavaScript"}]
+func (h *SessionHandler) SetCheckpoint(c *gin.Context) {
+	req := SetCheckpointReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	messageID, err := uuid.Parse(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	cp, err := h.svc.SetCheckpoint(c.Request.Context(), service.SetCheckpointInput{
+		SessionID:   sessionID,
+		Name:        req.Name,
+		MessageID:   messageID,
+		Description: req.Description,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: cp})
+}
+
+// ListCheckpoints godoc
+//
+//	@Summary		List checkpoints
+//	@Description	List the named checkpoints of a session, oldest first
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.Checkpoint}
+//	@Router			/session/{session_id}/checkpoints [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List checkpoints of a session\ncheckpoints = client.sessions.list_checkpoints(session_id='session-uuid')\nfor cp in checkpoints:\n    print(cp.name, cp.message_id)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List checkpoints of a session\nconst checkpoints = await client.sessions.listCheckpoints('session-uuid');\nfor (const cp of checkpoints) {\n  console.log(cp.name, cp.message_id);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) ListCheckpoints(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	checkpoints, err := h.svc.ListCheckpoints(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: checkpoints})
+}
+
+// DeleteCheckpoint godoc
+//
+//	@Summary		Delete checkpoint
+//	@Description	Delete a named checkpoint of a session. The message it points at is kept.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			name		path	string	true	"Checkpoint name"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Router			/session/{session_id}/checkpoints/{name} [delete]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Delete a checkpoint\nclient.sessions.delete_checkpoint(session_id='session-uuid', name='plan approved')\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Delete a checkpoint\nawait client.sessions.deleteCheckpoint('session-uuid', 'plan approved');\n","label":"JavaScript"}]
+func (h *SessionHandler) DeleteCheckpoint(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.DeleteCheckpoint(c.Request.Context(), sessionID, c.Param("name")); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+type SetToolsReq struct {
+	Format string      `form:"format" json:"format" binding:"omitempty,oneof=openai anthropic gemini" example:"openai" enums:"openai,anthropic,gemini"`
+	Tools  interface{} `form:"tools" json:"tools" binding:"required"`
+}
+
+// SetTools godoc
+//
+//	@Summary		Set tool definitions
+//	@Description	Store the tools array given to the model in this session as a new version. tools is a provider tools array in the given format (default: openai): OpenAI function tools, Anthropic custom tools, or Gemini tools with functionDeclarations. Tools are stored provider-neutral and can be rendered in any format by get request.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string				true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.SetToolsReq	true	"SetTools payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=model.SessionTools}
+//	@Router			/session/{session_id}/tools [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Store the tools given to the model\ntools = client.sessions.set_tools(\n    session_id='session-uuid',\n    format='openai',\n    tools=[{\n        'type': 'function',\n        'function': {\n            'name': 'get_weather',\n            'description': 'Get the weather of a city',\n            'parameters': {'type': 'object', 'properties': {'city': {'type': 'string'}}, 'required': ['city']}\n        }\n    }]\n)\nprint(tools.version)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Store the tools given to the model\nconst tools = await client.sessions.setTools('session-uuid', {\n  format: 'openai',\n  tools: [{\n    type: 'function',\n    function: {\n      name: 'get_weather',\n      description: 'Get the weather of a city',\n      parameters: { type: 'object', properties: { city: { type: 'string' } }, required: ['city'] }\n    }\n  }]\n});\nconsole.log(tools.version);\n","label":"JavaScript"}]
+func (h *SessionHandler) SetTools(c *gin.Context) {
+	req := SetToolsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	format := model.FormatOpenAI
+	if req.Format != "" {
+		format = model.MessageFormat(req.Format)
+	}
+
+	toolsJSON, err := sonic.Marshal(req.Tools)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid tools", err))
+		return
+	}
+	defs, err := normalizer.NormalizeTools(format, toolsJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("failed to normalize tools", err))
+		return
+	}
+
+	tools, err := h.svc.SetTools(c.Request.Context(), service.SetToolsInput{
+		SessionID:    sessionID,
+		SourceFormat: format,
+		Tools:        defs,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: tools})
+}
+
+type GetToolsReq struct {
+	Version int    `form:"version" json:"version" binding:"omitempty,min=1" example:"2"`
+	Format  string `form:"format" json:"format" binding:"omitempty,oneof=openai anthropic gemini" example:"anthropic" enums:"openai,anthropic,gemini"`
+}
+
+type GetToolsResp struct {
+	model.SessionTools
+	// RenderedTools is the tools array in the requested provider format
+	RenderedTools []map[string]any `json:"rendered_tools,omitempty"`
+}
+
+// GetTools godoc
+//
+//	@Summary		Get tool definitions
+//	@Description	Get a version of the session's tool definitions (default: the latest). With format, the response also includes rendered_tools, the tools array ready to send to that provider.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Param			version		query	integer	false	"Tools version, default is the latest"	example(2)
+//	@Param			format		query	string	false	"Render the tools in this provider format"	enums(openai,anthropic,gemini)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=handler.GetToolsResp}
+//	@Router			/session/{session_id}/tools [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Get the latest tools rendered for Anthropic\ntools = client.sessions.get_tools(session_id='session-uuid', format='anthropic')\nprint(tools.version, tools.rendered_tools)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Get the latest tools rendered for Anthropic\nconst tools = await client.sessions.getTools('session-uuid', { format: 'anthropic' });\nconsole.log(tools.version, tools.rendered_tools);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetTools(c *gin.Context) {
+	req := GetToolsReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	tools, err := h.svc.GetTools(c.Request.Context(), sessionID, req.Version)
+	if err != nil {
+		if errors.Is(err, service.ErrToolsNotFound) {
+			c.JSON(http.StatusNotFound, serializer.DBErr("", err))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	resp := GetToolsResp{SessionTools: *tools}
+	if req.Format != "" {
+		resp.RenderedTools, err = converter.ConvertTools(tools.Tools.Data(), model.MessageFormat(req.Format))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: resp})
+}
+
+// ListTools godoc
+//
+//	@Summary		List tool definition versions
+//	@Description	List every version of the session's tool definitions, oldest first
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.SessionTools}
+//	@Router			/session/{session_id}/tools/versions [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List tool definition versions\nfor tools in client.sessions.list_tools(session_id='session-uuid'):\n    print(tools.version, len(tools.tools))\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List tool definition versions\nconst versions = await client.sessions.listTools('session-uuid');\nfor (const tools of versions) {\n  console.log(tools.version, tools.tools.length);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) ListTools(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	tools, err := h.svc.ListTools(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: tools})
+}
+
+type GetRequestReq struct {
+	Format                           string `form:"format,default=openai" json:"format" binding:"omitempty,oneof=openai anthropic gemini" example:"anthropic" enums:"openai,anthropic,gemini"`
+	ToolsVersion                     int    `form:"tools_version" json:"tools_version" binding:"omitempty,min=1" example:"2"`
+	Model                            string `form:"model" json:"model" example:"claude-sonnet-4-5"`
+	MaxTokens                        int    `form:"max_tokens" json:"max_tokens" binding:"omitempty,min=1" example:"4096"`
+	EditStrategies                   string `form:"edit_strategies" json:"edit_strategies" example:"[{\"type\":\"token_limit\",\"params\":{\"limit_tokens\":20000}}]"`
+	PinEditingStrategiesAtMessage    string `form:"pin_editing_strategies_at_message" json:"pin_editing_strategies_at_message" example:""`
+	PinEditingStrategiesAtCheckpoint string `form:"pin_editing_strategies_at_checkpoint" json:"pin_editing_strategies_at_checkpoint" example:""`
+	UntilMessage                     string `form:"until_message" json:"until_message" binding:"omitempty,uuid" example:""`
+	UntilCheckpoint                  string `form:"until_checkpoint" json:"until_checkpoint" example:"plan approved"`
+}
+
+// GetRequest godoc
+//
+//	@Summary		Get provider request body
+//	@Description	Assemble the session's system prompt (the system_prompt key of the session, space or project configs), tool definitions (the latest version unless tools_version is set) and edited messages into a request body ready to send to the provider: OpenAI Chat Completions, Anthropic Messages or Gemini generateContent. Edit strategies default to the configured ones, as in get messages. model and max_tokens are copied into the body when set (Gemini takes the model in the URL, so it is not included).
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id							path	string	true	"Session ID"	format(uuid)
+//	@Param			format								query	string	false	"Provider format of the request body (default openai)"	enums(openai,anthropic,gemini)
+//	@Param			tools_version						query	integer	false	"Tool definitions version, default is the latest"	example(2)
+//	@Param			model								query	string	false	"Model to put in the body"	example(claude-sonnet-4-5)
+//	@Param			max_tokens							query	integer	false	"Maximum output tokens to put in the body"	example(4096)
+//	@Param			edit_strategies						query	string	false	"Edit strategies to apply to the messages, as in get messages"
+//	@Param			pin_editing_strategies_at_message	query	string	false	"Pin the edit strategies at this message, as in get messages"
+//	@Param			pin_editing_strategies_at_checkpoint	query	string	false	"Pin the edit strategies at this checkpoint, as in get messages"
+//	@Param			until_message						query	string	false	"Only include messages up to this message"	format(uuid)
+//	@Param			until_checkpoint					query	string	false	"Only include messages up to this checkpoint"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=object}
+//	@Router			/session/{session_id}/request [get]
+//	@x-code-samples	[{"lang":"python","source":"import anthropic\nfrom luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Replay the session against Anthropic\nbody = client.sessions.get_request(\n    session_id='session-uuid',\n    format='anthropic',\n    model='claude-sonnet-4-5',\n    max_tokens=4096\n)\nresponse = anthropic.Anthropic().messages.create(**body)\n","label":"Python"},{"lang":"javascript","source":"import Anthropic from '@anthropic-ai/sdk';\nimport { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Replay the session against Anthropic\nconst body = await client.sessions.getRequest('session-uuid', {\n  format: 'anthropic',\n  model: 'claude-sonnet-4-5',\n  maxTokens: 4096\n});\nconst response = await new Anthropic().messages.create(body);\n","label":"JavaScript"}]
+func (h *SessionHandler) GetRequest(c *gin.Context) {
+	req := GetRequestReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	var editStrategies []editor.StrategyConfig
+	if req.EditStrategies != "" {
+		if err := sonic.Unmarshal([]byte(req.EditStrategies), &editStrategies); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid edit_strategies JSON", err))
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	out, err := h.svc.GetMessages(ctx, service.GetMessagesInput{
+		SessionID:                        sessionID,
+		WithAssetPublicURL:               true,
+		AssetExpire:                      time.Hour * 24,
+		EditStrategies:                   editStrategies,
+		PinEditingStrategiesAtMessage:    req.PinEditingStrategiesAtMessage,
+		PinEditingStrategiesAtCheckpoint: req.PinEditingStrategiesAtCheckpoint,
+		UntilMessageID:                   req.UntilMessage,
+		UntilCheckpoint:                  req.UntilCheckpoint,
+		UseDefaultEditStrategies:         req.EditStrategies == "",
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	var tools []model.ToolDefinition
+	toolSet, err := h.svc.GetTools(ctx, sessionID, req.ToolsVersion)
+	switch {
+	case err == nil:
+		tools = toolSet.Tools.Data()
+	case errors.Is(err, service.ErrToolsNotFound) && req.ToolsVersion == 0:
+		// A session without tool definitions produces a request without tools
+	default:
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	systemPrompt, err := h.svc.GetSystemPrompt(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	body, err := converter.BuildRequestBody(converter.BuildRequestInput{
+		Messages:     out.Items,
+		Format:       model.MessageFormat(req.Format),
+		PublicURLs:   out.PublicURLs,
+		SystemPrompt: systemPrompt,
+		Tools:        tools,
+		Model:        req.Model,
+		MaxTokens:    req.MaxTokens,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("failed to build request", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: body})
+}
+
+// CheckIntegrity godoc
+//
+//	@Summary		Check session integrity
+//	@Description	Check that every tool call of the session is answered by a tool result and every tool result answers an earlier tool call. Reports orphan tool calls, orphan tool results, tool calls reusing an earlier call ID, and Gemini function calls still waiting for their function response. Sessions with such issues are rejected by providers such as Anthropic; fix them with the POST variant.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string	true	"Session ID"	format(uuid)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.IntegrityReport}
+//	@Router			/session/{session_id}/integrity [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Check tool call / result pairing\nreport = client.sessions.check_integrity(session_id='session-uuid')\nfor issue in report.issues:\n    print(issue.kind, issue.tool_call_id)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Check tool call / result pairing\nconst report = await client.sessions.checkIntegrity('session-uuid');\nfor (const issue of report.issues) {\n  console.log(issue.kind, issue.tool_call_id);\n}\n","label":"JavaScript"}]
+func (h *SessionHandler) CheckIntegrity(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	report, err := h.svc.CheckIntegrity(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: report})
+}
+
+type RepairIntegrityReq struct {
+	OrphanToolCalls string `form:"orphan_tool_calls" json:"orphan_tool_calls" binding:"omitempty,oneof=cancel drop" example:"cancel" enums:"cancel,drop"`
+}
+
+// RepairIntegrity godoc
+//
+//	@Summary		Repair session integrity
+//	@Description	Fix the issues reported by the GET variant. Tool calls reusing an earlier call ID and orphan tool results are removed, and pending Gemini call info is cleared. Orphan tool calls are answered with a synthetic error result saying the call was cancelled (orphan_tool_calls=cancel, default) or removed (orphan_tool_calls=drop). Synthetic results are placed at the start of the next user message, or in a new user message right after the call. Messages left empty are deleted. Returns 409 when a message is appended while the repair runs.
+//	@Tags			session
+//	@Accept			json
+//	@Produce		json
+//	@Param			session_id	path	string						true	"Session ID"	format(uuid)
+//	@Param			payload		body	handler.RepairIntegrityReq	false	"RepairIntegrity payload"
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=service.RepairIntegrityOutput}
+//	@Failure		409	{object}	serializer.Response	"A message was appended during the repair"
+//	@Router			/session/{session_id}/integrity [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Cancel tool calls left unanswered by a crashed agent\nresult = client.sessions.repair_integrity(\n    session_id='session-uuid',\n    orphan_tool_calls='cancel'\n)\nprint(len(result.fixed), result.inserted_messages)\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Cancel tool calls left unanswered by a crashed agent\nconst result = await client.sessions.repairIntegrity('session-uuid', {\n  orphanToolCalls: 'cancel'\n});\nconsole.log(result.fixed.length, result.inserted_messages);\n","label":"JavaScript"}]
+func (h *SessionHandler) RepairIntegrity(c *gin.Context) {
+	req := RepairIntegrityReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("session_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	out, err := h.svc.RepairIntegrity(c.Request.Context(), service.RepairIntegrityInput{
+		ProjectID:       project.ID,
+		SessionID:       sessionID,
+		OrphanToolCalls: req.OrphanToolCalls,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrAppendConflict) {
+			c.JSON(http.StatusConflict, serializer.Err(http.StatusConflict, "append conflict", err))
+			return
+		}
+		c.JSON(http.StatusBadRequest, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: out})
+}
+
 // SessionFlush godoc
 //
 //	@Summary		Flush session
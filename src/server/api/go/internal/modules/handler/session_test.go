@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
@@ -15,6 +16,7 @@ import (
 	"github.com/memodb-io/Luminox/internal/infra/httpclient"
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/modules/service"
+	"github.com/memodb-io/Luminox/internal/pkg/editor"
 	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -91,6 +93,93 @@ func (m *MockSessionService) GetSessionObservingStatus(ctx context.Context, sess
 	return args.Get(0).(*model.MessageObservingStatus), args.Error(1)
 }
 
+func (m *MockSessionService) SetMessageProtected(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, protected bool) error {
+	args := m.Called(ctx, sessionID, messageID, protected)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) ListChildren(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) ([]model.Session, error) {
+	args := m.Called(ctx, projectID, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Session), args.Error(1)
+}
+
+func (m *MockSessionService) GetTree(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, maxDepth int) (*service.SessionTreeNode, error) {
+	args := m.Called(ctx, projectID, sessionID, maxDepth)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SessionTreeNode), args.Error(1)
+}
+
+func (m *MockSessionService) SetCheckpoint(ctx context.Context, in service.SetCheckpointInput) (*model.Checkpoint, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Checkpoint), args.Error(1)
+}
+
+func (m *MockSessionService) ListCheckpoints(ctx context.Context, sessionID uuid.UUID) ([]model.Checkpoint, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Checkpoint), args.Error(1)
+}
+
+func (m *MockSessionService) DeleteCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) error {
+	args := m.Called(ctx, sessionID, name)
+	return args.Error(0)
+}
+
+func (m *MockSessionService) SetTools(ctx context.Context, in service.SetToolsInput) (*model.SessionTools, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SessionTools), args.Error(1)
+}
+
+func (m *MockSessionService) GetTools(ctx context.Context, sessionID uuid.UUID, version int) (*model.SessionTools, error) {
+	args := m.Called(ctx, sessionID, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SessionTools), args.Error(1)
+}
+
+func (m *MockSessionService) ListTools(ctx context.Context, sessionID uuid.UUID) ([]model.SessionTools, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SessionTools), args.Error(1)
+}
+
+func (m *MockSessionService) GetSystemPrompt(ctx context.Context, sessionID uuid.UUID) (string, error) {
+	args := m.Called(ctx, sessionID)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSessionService) CheckIntegrity(ctx context.Context, sessionID uuid.UUID) (*service.IntegrityReport, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.IntegrityReport), args.Error(1)
+}
+
+func (m *MockSessionService) RepairIntegrity(ctx context.Context, in service.RepairIntegrityInput) (*service.RepairIntegrityOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.RepairIntegrityOutput), args.Error(1)
+}
+
 func setupSessionRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	return gin.New()
@@ -229,6 +318,8 @@ func TestSessionHandler_GetSessions(t *testing.T) {
 
 func TestSessionHandler_CreateSession(t *testing.T) {
 	projectID := uuid.New()
+	parentSessionID := uuid.New()
+	parentMessageID := uuid.New()
 
 	tests := []struct {
 		name           string
@@ -279,6 +370,43 @@ func TestSessionHandler_CreateSession(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  true,
 		},
+		{
+			name: "sub-agent session",
+			requestBody: CreateSessionReq{
+				ParentSessionID:  parentSessionID.String(),
+				ParentMessageID:  parentMessageID.String(),
+				ParentToolCallID: "call_research",
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("Create", mock.Anything, mock.MatchedBy(func(s *model.Session) bool {
+					return s.ParentSessionID != nil && *s.ParentSessionID == parentSessionID &&
+						s.ParentMessageID != nil && *s.ParentMessageID == parentMessageID &&
+						s.ParentToolCallID == "call_research"
+				})).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+			expectedError:  false,
+		},
+		{
+			name: "invalid parent session ID",
+			requestBody: CreateSessionReq{
+				ParentSessionID: "invalid-uuid",
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name: "unknown parent",
+			requestBody: CreateSessionReq{
+				ParentSessionID: parentSessionID.String(),
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("Create", mock.Anything, mock.Anything).Return(fmt.Errorf("%w: parent session not found", service.ErrInvalidParent))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
 		{
 			name: "service layer error",
 			requestBody: CreateSessionReq{
@@ -319,6 +447,107 @@ func TestSessionHandler_CreateSession(t *testing.T) {
 	}
 }
 
+func TestSessionHandler_GetSessionChildren(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	mockService := &MockSessionService{}
+	mockService.On("ListChildren", mock.Anything, projectID, sessionID).Return([]model.Session{
+		{ID: uuid.New(), ProjectID: projectID, ParentSessionID: &sessionID, ParentMessageID: &messageID, ParentToolCallID: "call_research"},
+	}, nil)
+
+	handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+	router := setupSessionRouter()
+	router.GET("/session/:session_id/children", func(c *gin.Context) {
+		c.Set("project", &model.Project{ID: projectID})
+		handler.GetSessionChildren(c)
+	})
+
+	req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/children", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data []model.Session `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "call_research", resp.Data[0].ParentToolCallID)
+	mockService.AssertExpectations(t)
+}
+
+func TestSessionHandler_GetSessionTree(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:        "default depth",
+			queryParams: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetTree", mock.Anything, projectID, sessionID, 5).Return(&service.SessionTreeNode{
+					Session:  model.Session{ID: sessionID, ProjectID: projectID},
+					Children: []*service.SessionTreeNode{},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "custom depth",
+			queryParams: "?max_depth=2",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetTree", mock.Anything, projectID, sessionID, 2).Return(&service.SessionTreeNode{
+					Session:  model.Session{ID: sessionID, ProjectID: projectID},
+					Children: []*service.SessionTreeNode{},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "depth too large",
+			queryParams:    "?max_depth=100",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "session not found",
+			queryParams: "",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetTree", mock.Anything, projectID, sessionID, 5).Return(nil, errors.New("session not found"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/tree", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.GetSessionTree(c)
+			})
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/tree"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
 func TestSessionHandler_DeleteSession(t *testing.T) {
 	projectID := uuid.New()
 	sessionID := uuid.New()
@@ -423,6 +652,45 @@ func TestSessionHandler_UpdateConfigs(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:           "valid default edit strategies",
+			sessionIDParam: sessionID.String(),
+			requestBody: UpdateSessionConfigsReq{
+				Configs: map[string]interface{}{
+					"edit_strategies": []interface{}{
+						map[string]interface{}{"type": "token_limit", "params": map[string]interface{}{"limit_tokens": 1000}},
+					},
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("UpdateByID", mock.Anything, mock.MatchedBy(func(s *model.Session) bool {
+					return s.ID == sessionID
+				})).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid tool call validation mode",
+			sessionIDParam: sessionID.String(),
+			requestBody: UpdateSessionConfigsReq{
+				Configs: map[string]interface{}{"tool_call_validation": "strict"},
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid default edit strategies",
+			sessionIDParam: sessionID.String(),
+			requestBody: UpdateSessionConfigsReq{
+				Configs: map[string]interface{}{
+					"edit_strategies": []interface{}{
+						map[string]interface{}{"type": "token_limit", "params": map[string]interface{}{}},
+					},
+				},
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -586,6 +854,7 @@ func TestSessionHandler_ConnectToSpace(t *testing.T) {
 func TestSessionHandler_StoreMessage(t *testing.T) {
 	projectID := uuid.New()
 	sessionID := uuid.New()
+	lastMessageID := uuid.New()
 
 	tests := []struct {
 		name           string
@@ -1852,72 +2121,321 @@ func TestSessionHandler_StoreMessage(t *testing.T) {
 			},
 			expectedStatus: http.StatusBadRequest,
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			mockService := &MockSessionService{}
-			tt.setup(mockService)
-
-			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
-			router := setupSessionRouter()
-			router.POST("/session/:session_id/messages", func(c *gin.Context) {
-				project := &model.Project{ID: projectID}
-				c.Set("project", project)
-				handler.StoreMessage(c)
-			})
-
-			body, _ := sonic.Marshal(tt.requestBody)
-			req := httptest.NewRequest("POST", "/session/"+tt.sessionIDParam+"/messages", bytes.NewBuffer(body))
-			req.Header.Set("Content-Type", "application/json")
-			w := httptest.NewRecorder()
-
-			router.ServeHTTP(w, req)
-
-			assert.Equal(t, tt.expectedStatus, w.Code)
-			mockService.AssertExpectations(t)
-		})
-	}
-}
-
-func TestSessionHandler_GetMessages(t *testing.T) {
-	sessionID := uuid.New()
-
-	tests := []struct {
-		name           string
-		sessionIDParam string
-		queryParams    string
-		setup          func(*MockSessionService)
-		expectedStatus int
-	}{
 		{
-			name:           "successful message retrieval",
+			name:           "openai format - protected message",
 			sessionIDParam: sessionID.String(),
-			queryParams:    "?limit=20",
+			requestBody: map[string]interface{}{
+				"format":    "openai",
+				"protected": true,
+				"blob": map[string]interface{}{
+					"role":    "user",
+					"content": "Task brief: migrate the billing module",
+				},
+			},
 			setup: func(svc *MockSessionService) {
-				expectedOutput := &service.GetMessagesOutput{
-					Items: []model.Message{
-						{
-							ID:        uuid.New(),
-							SessionID: sessionID,
-							Role:      "user",
-						},
-					},
-					HasMore: false,
+				expectedMessage := &model.Message{
+					ID:        uuid.New(),
+					SessionID: sessionID,
+					Role:      "user",
 				}
-				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
-					return in.SessionID == sessionID && in.Limit == 20
-				})).Return(expectedOutput, nil)
+				svc.On("StoreMessage", mock.Anything, mock.MatchedBy(func(in service.StoreMessageInput) bool {
+					return in.SessionID == sessionID && in.MessageMeta[model.MessageProtectedKey] == true
+				})).Return(expectedMessage, nil)
 			},
-			expectedStatus: http.StatusOK,
+			expectedStatus: http.StatusCreated,
 		},
 		{
-			name:           "invalid session ID",
-			sessionIDParam: "invalid-uuid",
-			queryParams:    "?limit=20",
-			setup:          func(svc *MockSessionService) {},
-			expectedStatus: http.StatusBadRequest,
-		},
+			name:           "openai format - offload large tool results",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format":                            "openai",
+				"offload_tool_results_above_tokens": 2000,
+				"blob": map[string]interface{}{
+					"role":         "tool",
+					"tool_call_id": "call_1",
+					"content":      "search results",
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				expectedMessage := &model.Message{
+					ID:        uuid.New(),
+					SessionID: sessionID,
+					Role:      "user",
+				}
+				svc.On("StoreMessage", mock.Anything, mock.MatchedBy(func(in service.StoreMessageInput) bool {
+					return in.SessionID == sessionID && in.OffloadToolResultsAboveTokens == 2000
+				})).Return(expectedMessage, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "negative offload threshold",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format":                            "openai",
+				"offload_tool_results_above_tokens": -1,
+				"blob": map[string]interface{}{
+					"role":    "user",
+					"content": "hello",
+				},
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "append with expected last message",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format":                   "openai",
+				"expected_last_message_id": lastMessageID.String(),
+				"expected_last_seq":        7,
+				"blob": map[string]interface{}{
+					"role":    "user",
+					"content": "hello",
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("StoreMessage", mock.Anything, mock.MatchedBy(func(in service.StoreMessageInput) bool {
+					return in.ExpectedLastMessageID != nil && *in.ExpectedLastMessageID == lastMessageID &&
+						in.ExpectedLastSeq != nil && *in.ExpectedLastSeq == 7
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, Role: "user", Seq: 8}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "append conflict",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format":                   "openai",
+				"expected_last_message_id": lastMessageID.String(),
+				"blob": map[string]interface{}{
+					"role":    "user",
+					"content": "hello",
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("StoreMessage", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: last message is %s (seq 8)", service.ErrAppendConflict, uuid.New()))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "invalid tool call rejected",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format": "openai",
+				"blob": map[string]interface{}{
+					"role": "assistant",
+					"tool_calls": []map[string]interface{}{{
+						"id":       "call_1",
+						"type":     "function",
+						"function": map[string]interface{}{"name": "get_weather", "arguments": `{"city": 42}`},
+					}},
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("StoreMessage", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("%w: parts[0]: $.city: expected string, got number", service.ErrInvalidToolCall))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "agent name from openai name",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format": "openai",
+				"blob": map[string]interface{}{
+					"role":    "assistant",
+					"name":    "proponent",
+					"content": "Tabs are better",
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("StoreMessage", mock.Anything, mock.MatchedBy(func(in service.StoreMessageInput) bool {
+					_, inMeta := in.MessageMeta[model.MessageAgentNameKey]
+					return in.AgentName == "proponent" && in.MessageMeta["name"] == "proponent" && !inMeta
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", AgentName: "proponent"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "agent name field overrides blob",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format":     "luminox",
+				"agent_name": "opponent",
+				"blob": map[string]interface{}{
+					"role":  "assistant",
+					"meta":  map[string]interface{}{"agent_name": "proponent"},
+					"parts": []map[string]interface{}{{"type": "text", "text": "Spaces are better"}},
+				},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("StoreMessage", mock.Anything, mock.MatchedBy(func(in service.StoreMessageInput) bool {
+					return in.AgentName == "opponent"
+				})).Return(&model.Message{ID: uuid.New(), SessionID: sessionID, Role: "assistant", AgentName: "opponent"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "invalid expected last message id",
+			sessionIDParam: sessionID.String(),
+			requestBody: map[string]interface{}{
+				"format":                   "openai",
+				"expected_last_message_id": "not-a-uuid",
+				"blob": map[string]interface{}{
+					"role":    "user",
+					"content": "hello",
+				},
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/messages", func(c *gin.Context) {
+				project := &model.Project{ID: projectID}
+				c.Set("project", project)
+				handler.StoreMessage(c)
+			})
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/session/"+tt.sessionIDParam+"/messages", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetMessages(t *testing.T) {
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		sessionIDParam string
+		queryParams    string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "successful message retrieval",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?limit=20",
+			setup: func(svc *MockSessionService) {
+				expectedOutput := &service.GetMessagesOutput{
+					Items: []model.Message{
+						{
+							ID:        uuid.New(),
+							SessionID: sessionID,
+							Role:      "user",
+						},
+					},
+					HasMore: false,
+				}
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.SessionID == sessionID && in.Limit == 20
+				})).Return(expectedOutput, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "auto cache control in anthropic format",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?format=anthropic&auto_cache_control=true&cache_growth_tokens=2048",
+			setup: func(svc *MockSessionService) {
+				messageID := uuid.New()
+				expectedOutput := &service.GetMessagesOutput{
+					Items: []model.Message{
+						{
+							ID:        messageID,
+							SessionID: sessionID,
+							Role:      "user",
+						},
+					},
+					CacheBreakpointIDs: []string{messageID.String()},
+				}
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.SessionID == sessionID && in.AutoCacheControl && in.CacheGrowthTokens == 2048
+				})).Return(expectedOutput, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "edit strategies applied as given",
+			sessionIDParam: sessionID.String(),
+			queryParams:    `?edit_strategies_order=as_given&edit_strategies=[{"type":"token_limit","params":{"limit_tokens":100}},{"type":"remove_tool_result"}]`,
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.EditStrategiesOrder == editor.OrderAsGiven && len(in.EditStrategies) == 2
+				})).Return(&service.GetMessagesOutput{Items: []model.Message{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter by agent and render as agent",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?agent_name=pro&agent_name=con&as_agent=pro",
+			setup: func(svc *MockSessionService) {
+				expectedOutput := &service.GetMessagesOutput{
+					Items: []model.Message{
+						{ID: uuid.New(), SessionID: sessionID, Role: "assistant", AgentName: "pro"},
+					},
+				}
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return len(in.AgentNames) == 2 && in.AgentNames[0] == "pro" && in.AgentNames[1] == "con"
+				})).Return(expectedOutput, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "until checkpoint and pin at checkpoint",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?until_checkpoint=phase%202%20start&pin_editing_strategies_at_checkpoint=plan%20approved",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.UntilCheckpoint == "phase 2 start" && in.PinEditingStrategiesAtCheckpoint == "plan approved"
+				})).Return(&service.GetMessagesOutput{Items: []model.Message{}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid until message",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?until_message=not-a-uuid",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid edit strategies order",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?edit_strategies_order=random",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "auto cache control requires anthropic format",
+			sessionIDParam: sessionID.String(),
+			queryParams:    "?format=openai&auto_cache_control=true",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid session ID",
+			sessionIDParam: "invalid-uuid",
+			queryParams:    "?limit=20",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 		{
 			name:           "limit=0 retrieves all messages",
 			sessionIDParam: sessionID.String(),
@@ -3706,3 +4224,684 @@ func TestSessionHandler_GetSessionObservingStatus_ServiceError(t *testing.T) {
 	assert.Contains(t, response["error"].(string), "database connection failed")
 	mockService.AssertExpectations(t)
 }
+
+func TestSessionHandler_GetEditPreview(t *testing.T) {
+	sessionID := uuid.New()
+
+	testLogger, _ := zap.NewDevelopment()
+	_ = tokenizer.Init(testLogger)
+
+	messages := []model.Message{
+		{
+			ID:        uuid.New(),
+			SessionID: sessionID,
+			Role:      "assistant",
+			Parts: []model.Part{
+				{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "search", "arguments": `{"q":"weather"}`}},
+			},
+		},
+		{
+			ID:        uuid.New(),
+			SessionID: sessionID,
+			Role:      "user",
+			Parts: []model.Part{
+				{Type: "tool-result", Text: "It is sunny and warm in San Francisco today.", Meta: map[string]interface{}{"tool_call_id": "call_1"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		query              string
+		setup              func(*MockSessionService)
+		expectedStatus     int
+		expectedCandidates int
+	}{
+		{
+			name:  "single strategy set",
+			query: `?edit_strategies=[{"type":"remove_tool_result","params":{"keep_recent_n_tool_results":0}}]`,
+			setup: func(svc *MockSessionService) {
+				svc.On("GetAllMessages", mock.Anything, sessionID).Return(messages, nil)
+			},
+			expectedStatus:     http.StatusOK,
+			expectedCandidates: 1,
+		},
+		{
+			name:  "compare candidates",
+			query: `?edit_strategies=[{"type":"remove_tool_result","params":{"keep_recent_n_tool_results":0}}]&candidates=[[{"type":"token_limit","params":{"limit_tokens":1}}],[]]`,
+			setup: func(svc *MockSessionService) {
+				svc.On("GetAllMessages", mock.Anything, sessionID).Return(messages, nil)
+			},
+			expectedStatus:     http.StatusOK,
+			expectedCandidates: 3,
+		},
+		{
+			name:           "missing strategies",
+			query:          "",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid candidates JSON",
+			query:          "?candidates=not-json",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:  "unknown strategy type",
+			query: `?edit_strategies=[{"type":"nope","params":{}}]`,
+			setup: func(svc *MockSessionService) {
+				svc.On("GetAllMessages", mock.Anything, sessionID).Return(messages, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/messages/edit_preview", handler.GetEditPreview)
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/messages/edit_preview"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response struct {
+					Data EditPreviewResp `json:"data"`
+				}
+				require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, len(messages), response.Data.TotalMessages)
+				require.Len(t, response.Data.Candidates, tt.expectedCandidates)
+
+				first := response.Data.Candidates[0]
+				require.Len(t, first.Steps, 1)
+				assert.Equal(t, "remove_tool_result", first.Steps[0].Type)
+				assert.Greater(t, first.TokensSaved, 0)
+				require.Len(t, first.Steps[0].ModifiedParts, 1)
+				assert.Equal(t, messages[1].ID.String(), first.Steps[0].ModifiedParts[0].MessageID)
+
+				// The original messages must not be modified by the preview
+				assert.Equal(t, "It is sunny and warm in San Francisco today.", messages[1].Parts[0].Text)
+			}
+		})
+	}
+}
+
+func TestSessionHandler_SetMessageProtected(t *testing.T) {
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	tests := []struct {
+		name           string
+		messageIDParam string
+		requestBody    SetMessageProtectedReq
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:           "protect message",
+			messageIDParam: messageID.String(),
+			requestBody:    SetMessageProtectedReq{Protected: true},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetMessageProtected", mock.Anything, sessionID, messageID, true).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unprotect message",
+			messageIDParam: messageID.String(),
+			requestBody:    SetMessageProtectedReq{Protected: false},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetMessageProtected", mock.Anything, sessionID, messageID, false).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid message ID",
+			messageIDParam: "invalid-uuid",
+			requestBody:    SetMessageProtectedReq{Protected: true},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "message not found",
+			messageIDParam: messageID.String(),
+			requestBody:    SetMessageProtectedReq{Protected: true},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetMessageProtected", mock.Anything, sessionID, messageID, true).Return(errors.New("message not found"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.PUT("/session/:session_id/messages/:message_id/protected", handler.SetMessageProtected)
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("PUT", "/session/"+sessionID.String()+"/messages/"+tt.messageIDParam+"/protected", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_SetCheckpoint(t *testing.T) {
+	sessionID := uuid.New()
+	messageID := uuid.New()
+
+	tests := []struct {
+		name           string
+		requestBody    interface{}
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:        "set checkpoint",
+			requestBody: SetCheckpointReq{Name: "plan approved", MessageID: messageID.String(), Description: "User approved the plan"},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetCheckpoint", mock.Anything, service.SetCheckpointInput{
+					SessionID:   sessionID,
+					Name:        "plan approved",
+					MessageID:   messageID,
+					Description: "User approved the plan",
+				}).Return(&model.Checkpoint{ID: uuid.New(), SessionID: sessionID, Name: "plan approved", MessageID: messageID}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing name",
+			requestBody:    SetCheckpointReq{MessageID: messageID.String()},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid message ID",
+			requestBody:    SetCheckpointReq{Name: "plan approved", MessageID: "invalid-uuid"},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "message not found",
+			requestBody: SetCheckpointReq{Name: "plan approved", MessageID: messageID.String()},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetCheckpoint", mock.Anything, mock.Anything).Return(nil, errors.New("message not found"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/checkpoints", handler.SetCheckpoint)
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/checkpoints", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_ListCheckpoints(t *testing.T) {
+	sessionID := uuid.New()
+	checkpoints := []model.Checkpoint{
+		{ID: uuid.New(), SessionID: sessionID, Name: "plan approved", MessageID: uuid.New()},
+		{ID: uuid.New(), SessionID: sessionID, Name: "phase 2 start", MessageID: uuid.New()},
+	}
+
+	mockService := &MockSessionService{}
+	mockService.On("ListCheckpoints", mock.Anything, sessionID).Return(checkpoints, nil)
+
+	handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+	router := setupSessionRouter()
+	router.GET("/session/:session_id/checkpoints", handler.ListCheckpoints)
+
+	req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/checkpoints", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data []model.Checkpoint `json:"data"`
+	}
+	assert.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.Data, 2)
+	assert.Equal(t, "plan approved", resp.Data[0].Name)
+	mockService.AssertExpectations(t)
+}
+
+func TestSessionHandler_DeleteCheckpoint(t *testing.T) {
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		checkpoint     string
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:       "delete checkpoint",
+			checkpoint: "plan%20approved",
+			setup: func(svc *MockSessionService) {
+				svc.On("DeleteCheckpoint", mock.Anything, sessionID, "plan approved").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:       "checkpoint not found",
+			checkpoint: "missing",
+			setup: func(svc *MockSessionService) {
+				svc.On("DeleteCheckpoint", mock.Anything, sessionID, "missing").Return(errors.New("checkpoint not found"))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.DELETE("/session/:session_id/checkpoints/:name", handler.DeleteCheckpoint)
+
+			req := httptest.NewRequest("DELETE", "/session/"+sessionID.String()+"/checkpoints/"+tt.checkpoint, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_ListEditStrategies(t *testing.T) {
+	handler := NewSessionHandler(&MockSessionService{}, &MockUserService{}, getMockSessionCoreClient())
+	router := setupSessionRouter()
+	router.GET("/edit_strategies", handler.ListEditStrategies)
+
+	req := httptest.NewRequest("GET", "/edit_strategies", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data []editor.StrategyDefinition `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	types := make([]string, 0, len(resp.Data))
+	for _, def := range resp.Data {
+		types = append(types, def.Type)
+	}
+	assert.Contains(t, types, "token_limit")
+	assert.Contains(t, types, "conditional")
+}
+
+func TestSessionHandler_SetTools(t *testing.T) {
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name: "openai tools by default",
+			requestBody: map[string]interface{}{
+				"tools": []map[string]interface{}{{
+					"type": "function",
+					"function": map[string]interface{}{
+						"name":       "get_weather",
+						"parameters": map[string]interface{}{"type": "object"},
+					},
+				}},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetTools", mock.Anything, mock.MatchedBy(func(in service.SetToolsInput) bool {
+					return in.SessionID == sessionID && in.SourceFormat == model.FormatOpenAI &&
+						len(in.Tools) == 1 && in.Tools[0].Name == "get_weather"
+				})).Return(&model.SessionTools{SessionID: sessionID, Version: 1}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "anthropic tools",
+			requestBody: map[string]interface{}{
+				"format": "anthropic",
+				"tools": []map[string]interface{}{{
+					"name":         "get_weather",
+					"input_schema": map[string]interface{}{"type": "object"},
+				}},
+			},
+			setup: func(svc *MockSessionService) {
+				svc.On("SetTools", mock.Anything, mock.MatchedBy(func(in service.SetToolsInput) bool {
+					return in.SourceFormat == model.FormatAnthropic && in.Tools[0].Parameters["type"] == "object"
+				})).Return(&model.SessionTools{SessionID: sessionID, Version: 2}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "unsupported tool type",
+			requestBody: map[string]interface{}{
+				"format": "anthropic",
+				"tools":  []map[string]interface{}{{"type": "web_search_20250305", "name": "web_search"}},
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "luminox format rejected",
+			requestBody: map[string]interface{}{
+				"format": "luminox",
+				"tools":  []map[string]interface{}{},
+			},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing tools",
+			requestBody:    map[string]interface{}{"format": "openai"},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/tools", handler.SetTools)
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/tools", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_GetTools(t *testing.T) {
+	sessionID := uuid.New()
+	tools := &model.SessionTools{
+		SessionID:    sessionID,
+		Version:      2,
+		SourceFormat: model.FormatOpenAI,
+		Tools:        datatypes.NewJSONType([]model.ToolDefinition{{Name: "get_weather"}}),
+	}
+
+	t.Run("latest rendered for anthropic", func(t *testing.T) {
+		mockService := &MockSessionService{}
+		mockService.On("GetTools", mock.Anything, sessionID, 0).Return(tools, nil)
+
+		handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+		router := setupSessionRouter()
+		router.GET("/session/:session_id/tools", handler.GetTools)
+
+		req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/tools?format=anthropic", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data struct {
+				Version       int                      `json:"version"`
+				RenderedTools []map[string]interface{} `json:"rendered_tools"`
+			} `json:"data"`
+		}
+		require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, 2, resp.Data.Version)
+		require.Len(t, resp.Data.RenderedTools, 1)
+		assert.Equal(t, "get_weather", resp.Data.RenderedTools[0]["name"])
+		assert.NotNil(t, resp.Data.RenderedTools[0]["input_schema"])
+	})
+
+	t.Run("version not found", func(t *testing.T) {
+		mockService := &MockSessionService{}
+		mockService.On("GetTools", mock.Anything, sessionID, 5).Return(nil, fmt.Errorf("%w: version 5", service.ErrToolsNotFound))
+
+		handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+		router := setupSessionRouter()
+		router.GET("/session/:session_id/tools", handler.GetTools)
+
+		req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/tools?version=5", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestSessionHandler_GetRequest(t *testing.T) {
+	sessionID := uuid.New()
+	messages := &service.GetMessagesOutput{
+		Items: []model.Message{
+			{ID: uuid.New(), SessionID: sessionID, Role: "user", Parts: []model.Part{{Type: "text", Text: "Weather in Paris?"}}},
+		},
+	}
+	tools := &model.SessionTools{
+		SessionID: sessionID,
+		Version:   1,
+		Tools:     datatypes.NewJSONType([]model.ToolDefinition{{Name: "get_weather", Parameters: map[string]any{"type": "object"}}}),
+	}
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		setup          func(*MockSessionService)
+		expectedStatus int
+		check          func(*testing.T, map[string]interface{})
+	}{
+		{
+			name:        "anthropic body",
+			queryParams: "?format=anthropic&model=claude-sonnet-4-5&max_tokens=1024",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.MatchedBy(func(in service.GetMessagesInput) bool {
+					return in.SessionID == sessionID && in.UseDefaultEditStrategies
+				})).Return(messages, nil)
+				svc.On("GetTools", mock.Anything, sessionID, 0).Return(tools, nil)
+				svc.On("GetSystemPrompt", mock.Anything, sessionID).Return("You are a weather bot.", nil)
+			},
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]interface{}) {
+				assert.Equal(t, "You are a weather bot.", body["system"])
+				assert.Equal(t, "claude-sonnet-4-5", body["model"])
+				assert.EqualValues(t, 1024, body["max_tokens"])
+				assert.Len(t, body["messages"], 1)
+				assert.Len(t, body["tools"], 1)
+			},
+		},
+		{
+			name:        "session without tools",
+			queryParams: "?format=openai",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.Anything).Return(messages, nil)
+				svc.On("GetTools", mock.Anything, sessionID, 0).Return(nil, service.ErrToolsNotFound)
+				svc.On("GetSystemPrompt", mock.Anything, sessionID).Return("", nil)
+			},
+			expectedStatus: http.StatusOK,
+			check: func(t *testing.T, body map[string]interface{}) {
+				assert.NotContains(t, body, "tools")
+				assert.Len(t, body["messages"], 1)
+			},
+		},
+		{
+			name:        "unknown tools version",
+			queryParams: "?format=gemini&tools_version=9",
+			setup: func(svc *MockSessionService) {
+				svc.On("GetMessages", mock.Anything, mock.Anything).Return(messages, nil)
+				svc.On("GetTools", mock.Anything, sessionID, 9).Return(nil, fmt.Errorf("%w: version 9", service.ErrToolsNotFound))
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "luminox format rejected",
+			queryParams:    "?format=luminox",
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.GET("/session/:session_id/request", handler.GetRequest)
+
+			req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/request"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.check != nil {
+				var resp struct {
+					Data map[string]interface{} `json:"data"`
+				}
+				require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+				tt.check(t, resp.Data)
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionHandler_CheckIntegrity(t *testing.T) {
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	partIndex := 0
+
+	mockService := &MockSessionService{}
+	mockService.On("CheckIntegrity", mock.Anything, sessionID).Return(&service.IntegrityReport{
+		Issues: []service.IntegrityIssue{{Kind: service.IntegrityOrphanToolCall, MessageID: messageID, PartIndex: &partIndex, ToolCallID: "call_1"}},
+	}, nil)
+
+	handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+	router := setupSessionRouter()
+	router.GET("/session/:session_id/integrity", handler.CheckIntegrity)
+
+	req := httptest.NewRequest("GET", "/session/"+sessionID.String()+"/integrity", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data service.IntegrityReport `json:"data"`
+	}
+	require.NoError(t, sonic.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Data.Healthy)
+	require.Len(t, resp.Data.Issues, 1)
+	assert.Equal(t, "orphan_tool_call", resp.Data.Issues[0].Kind)
+	assert.Equal(t, messageID, resp.Data.Issues[0].MessageID)
+	mockService.AssertExpectations(t)
+}
+
+func TestSessionHandler_RepairIntegrity(t *testing.T) {
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name           string
+		requestBody    map[string]interface{}
+		setup          func(*MockSessionService)
+		expectedStatus int
+	}{
+		{
+			name:        "cancel by default",
+			requestBody: map[string]interface{}{},
+			setup: func(svc *MockSessionService) {
+				svc.On("RepairIntegrity", mock.Anything, service.RepairIntegrityInput{ProjectID: projectID, SessionID: sessionID}).
+					Return(&service.RepairIntegrityOutput{InsertedMessages: []uuid.UUID{uuid.New()}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "drop orphan tool calls",
+			requestBody: map[string]interface{}{"orphan_tool_calls": "drop"},
+			setup: func(svc *MockSessionService) {
+				svc.On("RepairIntegrity", mock.Anything, service.RepairIntegrityInput{ProjectID: projectID, SessionID: sessionID, OrphanToolCalls: "drop"}).
+					Return(&service.RepairIntegrityOutput{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid strategy",
+			requestBody:    map[string]interface{}{"orphan_tool_calls": "ignore"},
+			setup:          func(svc *MockSessionService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "appended during repair",
+			requestBody: map[string]interface{}{},
+			setup: func(svc *MockSessionService) {
+				svc.On("RepairIntegrity", mock.Anything, mock.Anything).
+					Return(nil, fmt.Errorf("%w: messages were appended during the repair", service.ErrAppendConflict))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockSessionService{}
+			tt.setup(mockService)
+
+			handler := NewSessionHandler(mockService, &MockUserService{}, getMockSessionCoreClient())
+			router := setupSessionRouter()
+			router.POST("/session/:session_id/integrity", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.RepairIntegrity(c)
+			})
+
+			body, _ := sonic.Marshal(tt.requestBody)
+			req := httptest.NewRequest("POST", "/session/"+sessionID.String()+"/integrity", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
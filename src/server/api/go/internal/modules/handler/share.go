@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/modules/serializer"
+	"github.com/memodb-io/Luminox/internal/modules/service"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/path"
+)
+
+// sharePasswordHeader carries the password of a protected share. It is only
+// accepted as a header, so that it does not end up in URLs and access logs.
+const sharePasswordHeader = "X-Share-Password"
+
+type ShareHandler struct {
+	svc service.ShareService
+}
+
+func NewShareHandler(s service.ShareService) *ShareHandler {
+	return &ShareHandler{svc: s}
+}
+
+type CreateShareReq struct {
+	FilePath     string `json:"file_path" binding:"required" example:"/reports/q3.pdf"`            // File path, or directory path ending with '/'
+	ExpiresIn    int    `json:"expires_in" binding:"omitempty,min=60,max=2592000" example:"86400"` // Lifetime in seconds, default 86400 (1 day), max 30 days
+	Password     string `json:"password" binding:"omitempty,max=128" example:"hunter2"`            // Optional password required to open the share
+	MaxDownloads *int   `json:"max_downloads" binding:"omitempty,min=1" example:"10"`              // Optional limit on the number of downloads
+}
+
+// CreateShare godoc
+//
+//	@Summary		Create share link
+//	@Description	Create a public, read-only share of one artifact or of everything under a directory. The returned token is shown only once; anyone with it can list and download the shared files through /public/share/{token} without a project key until the share expires, runs out of downloads or is revoked.
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string					true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			payload	body	handler.CreateShareReq	true	"CreateShare payload"
+//	@Security		BearerAuth
+//	@Success		201	{object}	serializer.Response{data=service.CreateShareOutput}
+//	@Router			/disk/{disk_id}/share [post]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Share a report for one week, at most 5 downloads\nresult = client.disks.create_share(\n    disk_id='disk-uuid',\n    file_path='/reports/q3.pdf',\n    expires_in=7 * 24 * 3600,\n    max_downloads=5\n)\nprint(f\"https://api.luminox.io/api/v1/public/share/{result.token}/download\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Share a report for one week, at most 5 downloads\nconst result = await client.disks.createShare('disk-uuid', {\n  filePath: '/reports/q3.pdf',\n  expiresIn: 7 * 24 * 3600,\n  maxDownloads: 5\n});\nconsole.log(`https://api.luminox.io/api/v1/public/share/${result.token}/download`);\n","label":"JavaScript"}]
+func (h *ShareHandler) CreateShare(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	req := CreateShareReq{}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	dir, filename := path.SplitFilePath(req.FilePath)
+	if err := path.ValidatePath(dir); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+		return
+	}
+
+	ttl := 24 * time.Hour
+	if req.ExpiresIn > 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+	}
+
+	out, err := h.svc.Create(c.Request.Context(), service.CreateShareInput{
+		ProjectID:    project.ID,
+		DiskID:       diskID,
+		Path:         dir,
+		Filename:     filename,
+		Password:     req.Password,
+		MaxDownloads: req.MaxDownloads,
+		TTL:          ttl,
+	})
+	if err != nil {
+		shareErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, serializer.Response{Data: out})
+}
+
+// ListShares godoc
+//
+//	@Summary		List share links
+//	@Description	List the active shares of a disk, newest first. Expired shares and shares that used up their downloads are left out.
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id	path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{data=[]model.DiskShare}
+//	@Router			/disk/{disk_id}/share [get]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# List active shares\nfor share in client.disks.list_shares(disk_id='disk-uuid'):\n    print(f\"{share.path}{share.filename} expires {share.expires_at}\")\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// List active shares\nconst shares = await client.disks.listShares('disk-uuid');\nfor (const share of shares) {\n  console.log(`${share.path}${share.filename} expires ${share.expires_at}`);\n}\n","label":"JavaScript"}]
+func (h *ShareHandler) ListShares(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	shares, err := h.svc.List(c.Request.Context(), project.ID, diskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: shares})
+}
+
+// RevokeShare godoc
+//
+//	@Summary		Revoke share link
+//	@Description	Revoke a share. Its token stops working immediately; download URLs handed out before stay valid for at most five minutes.
+//	@Tags			disk
+//	@Accept			json
+//	@Produce		json
+//	@Param			disk_id		path	string	true	"Disk ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Param			share_id	path	string	true	"Share ID"	Format(uuid)	Example(123e4567-e89b-12d3-a456-426614174000)
+//	@Security		BearerAuth
+//	@Success		200	{object}	serializer.Response{}
+//	@Router			/disk/{disk_id}/share/{share_id} [delete]
+//	@x-code-samples	[{"lang":"python","source":"from luminox import LuminoxClient\n\nclient = LuminoxClient(api_key='sk_project_token')\n\n# Revoke a share\nclient.disks.revoke_share(disk_id='disk-uuid', share_id='share-uuid')\n","label":"Python"},{"lang":"javascript","source":"import { LuminoxClient } from '@luminox/luminox';\n\nconst client = new LuminoxClient({ apiKey: 'sk_project_token' });\n\n// Revoke a share\nawait client.disks.revokeShare('disk-uuid', 'share-uuid');\n","label":"JavaScript"}]
+func (h *ShareHandler) RevokeShare(c *gin.Context) {
+	project, ok := c.MustGet("project").(*model.Project)
+	if !ok {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", errors.New("project not found")))
+		return
+	}
+
+	diskID, err := uuid.Parse(c.Param("disk_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+	shareID, err := uuid.Parse(c.Param("share_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
+		return
+	}
+
+	if err := h.svc.Revoke(c.Request.Context(), project.ID, diskID, shareID); err != nil {
+		shareErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{})
+}
+
+// GetSharedFiles godoc
+//
+//	@Summary		List shared files
+//	@Description	Public endpoint, no project key needed. List the files and subdirectories of a directory within a share, or the single file of a file share. Password protected shares need the password in the X-Share-Password header.
+//	@Tags			share
+//	@Produce		json
+//	@Param			token				path	string	true	"Share token"
+//	@Param			path				query	string	false	"Directory within the share, ending with '/'. Defaults to the shared directory."	example(/reports/2024/)
+//	@Param			X-Share-Password	header	string	false	"Share password"
+//	@Success		200	{object}	serializer.Response{data=service.SharedListing}
+//	@Router			/public/share/{token} [get]
+//	@x-code-samples	[{"lang":"python","source":"import requests\n\n# No project key needed\nresp = requests.get(\n    'https://api.luminox.io/api/v1/public/share/shr_token',\n    params={'path': '/reports/'},\n    headers={'X-Share-Password': 'hunter2'}\n)\nfor f in resp.json()['data']['files']:\n    print(f\"{f['path']}{f['filename']} ({f['size_b']} bytes)\")\n","label":"Python"},{"lang":"javascript","source":"// No project key needed\nconst resp = await fetch('https://api.luminox.io/api/v1/public/share/shr_token?path=/reports/', {\n  headers: { 'X-Share-Password': 'hunter2' }\n});\nconst { data } = await resp.json();\nfor (const f of data.files) {\n  console.log(`${f.path}${f.filename} (${f.size_b} bytes)`);\n}\n","label":"JavaScript"}]
+func (h *ShareHandler) GetSharedFiles(c *gin.Context) {
+	dir := c.Query("path")
+	if dir != "" {
+		if err := validateDirPath(dir); err != nil {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid path", err))
+			return
+		}
+	}
+
+	share, err := h.svc.Open(c.Request.Context(), c.Param("token"), sharePassword(c))
+	if err != nil {
+		shareErr(c, err)
+		return
+	}
+
+	listing, err := h.svc.ListFiles(c.Request.Context(), share, dir)
+	if err != nil {
+		shareErr(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, serializer.Response{Data: listing})
+}
+
+// DownloadSharedFile godoc
+//
+//	@Summary		Download shared file
+//	@Description	Public endpoint, no project key needed. Count one download of a shared file and redirect to a short-lived URL of its content. file_path may be omitted for file shares. Password protected shares need the password in the X-Share-Password header.
+//	@Tags			share
+//	@Param			token				path	string	true	"Share token"
+//	@Param			file_path			query	string	false	"File path within the share"	example(/reports/2024/q3.pdf)
+//	@Param			X-Share-Password	header	string	false	"Share password"
+//	@Success		302
+//	@Router			/public/share/{token}/download [get]
+//	@x-code-samples	[{"lang":"python","source":"import requests\n\n# Follows the redirect to the file content\nresp = requests.get(\n    'https://api.luminox.io/api/v1/public/share/shr_token/download',\n    params={'file_path': '/reports/q3.pdf'}\n)\nwith open('q3.pdf', 'wb') as f:\n    f.write(resp.content)\n","label":"Python"},{"lang":"javascript","source":"// Follows the redirect to the file content\nconst resp = await fetch('https://api.luminox.io/api/v1/public/share/shr_token/download?file_path=/reports/q3.pdf');\nconst blob = await resp.blob();\n","label":"JavaScript"}]
+func (h *ShareHandler) DownloadSharedFile(c *gin.Context) {
+	var dir, filename string
+	if filePath := c.Query("file_path"); filePath != "" {
+		dir, filename = path.SplitFilePath(filePath)
+		if err := path.ValidatePath(dir); err != nil || filename == "" {
+			c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid file_path", errors.New("file_path must be a file path")))
+			return
+		}
+	}
+
+	share, err := h.svc.Open(c.Request.Context(), c.Param("token"), sharePassword(c))
+	if err != nil {
+		shareErr(c, err)
+		return
+	}
+
+	url, err := h.svc.Download(c.Request.Context(), share, dir, filename)
+	if err != nil {
+		shareErr(c, err)
+		return
+	}
+
+	c.Redirect(http.StatusFound, url)
+}
+
+func sharePassword(c *gin.Context) string {
+	return c.GetHeader(sharePasswordHeader)
+}
+
+// shareErr writes the response for errors of share operations
+func shareErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrShareNotFound), errors.Is(err, service.ErrDiskNotFound), errors.Is(err, service.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, serializer.Err(http.StatusNotFound, "", err))
+	case errors.Is(err, service.ErrShareExpired):
+		c.JSON(http.StatusGone, serializer.Err(http.StatusGone, "", err))
+	case errors.Is(err, service.ErrSharePassword):
+		c.JSON(http.StatusUnauthorized, serializer.Err(http.StatusUnauthorized, "", err))
+	default:
+		c.JSON(http.StatusInternalServerError, serializer.DBErr("", err))
+	}
+}
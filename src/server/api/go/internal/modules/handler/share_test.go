@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/modules/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// MockShareService is a mock implementation of ShareService
+type MockShareService struct {
+	mock.Mock
+}
+
+func (m *MockShareService) Create(ctx context.Context, in service.CreateShareInput) (*service.CreateShareOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.CreateShareOutput), args.Error(1)
+}
+
+func (m *MockShareService) List(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskShare, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.DiskShare), args.Error(1)
+}
+
+func (m *MockShareService) Revoke(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, shareID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID, shareID)
+	return args.Error(0)
+}
+
+func (m *MockShareService) Open(ctx context.Context, token string, password string) (*model.DiskShare, error) {
+	args := m.Called(ctx, token, password)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.DiskShare), args.Error(1)
+}
+
+func (m *MockShareService) ListFiles(ctx context.Context, share *model.DiskShare, dir string) (*service.SharedListing, error) {
+	args := m.Called(ctx, share, dir)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*service.SharedListing), args.Error(1)
+}
+
+func (m *MockShareService) Download(ctx context.Context, share *model.DiskShare, dir string, filename string) (string, error) {
+	args := m.Called(ctx, share, dir, filename)
+	return args.String(0), args.Error(1)
+}
+
+func TestShareHandler_CreateShare(t *testing.T) {
+	projectID := uuid.New()
+	diskID := uuid.New()
+
+	tests := []struct {
+		name           string
+		body           string
+		setup          func(*MockShareService)
+		expectedStatus int
+	}{
+		{
+			name: "directory share with defaults",
+			body: `{"file_path":"/reports/"}`,
+			setup: func(svc *MockShareService) {
+				svc.On("Create", mock.Anything, service.CreateShareInput{
+					ProjectID: projectID,
+					DiskID:    diskID,
+					Path:      "/reports/",
+					TTL:       24 * time.Hour,
+				}).Return(&service.CreateShareOutput{Share: &model.DiskShare{}, Token: "shr_abc"}, nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "missing file",
+			body: `{"file_path":"/reports/q3.pdf","expires_in":3600}`,
+			setup: func(svc *MockShareService) {
+				svc.On("Create", mock.Anything, mock.MatchedBy(func(in service.CreateShareInput) bool {
+					return in.Filename == "q3.pdf" && in.TTL == time.Hour
+				})).Return(nil, service.ErrPathNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "expiry too long",
+			body:           `{"file_path":"/reports/","expires_in":99999999}`,
+			setup:          func(svc *MockShareService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "zero download limit",
+			body:           `{"file_path":"/reports/","max_downloads":0}`,
+			setup:          func(svc *MockShareService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockShareService{}
+			tt.setup(mockService)
+			handler := NewShareHandler(mockService)
+
+			router := setupDiskRouter()
+			router.POST("/disk/:disk_id/share", func(c *gin.Context) {
+				c.Set("project", &model.Project{ID: projectID})
+				handler.CreateShare(c)
+			})
+
+			req := httptest.NewRequest("POST", "/disk/"+diskID.String()+"/share", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestShareHandler_Public(t *testing.T) {
+	share := &model.DiskShare{ID: uuid.New(), Path: "/reports/"}
+
+	tests := []struct {
+		name           string
+		url            string
+		password       string
+		setup          func(*MockShareService)
+		expectedStatus int
+	}{
+		{
+			name: "list files",
+			url:  "/share/shr_abc?path=/reports/2024/",
+			setup: func(svc *MockShareService) {
+				svc.On("Open", mock.Anything, "shr_abc", "").Return(share, nil)
+				svc.On("ListFiles", mock.Anything, share, "/reports/2024/").Return(&service.SharedListing{Path: "/reports/2024/"}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:     "password from header",
+			url:      "/share/shr_abc",
+			password: "hunter2",
+			setup: func(svc *MockShareService) {
+				svc.On("Open", mock.Anything, "shr_abc", "hunter2").Return(nil, service.ErrSharePassword)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "expired share",
+			url:  "/share/shr_abc",
+			setup: func(svc *MockShareService) {
+				svc.On("Open", mock.Anything, "shr_abc", "").Return(nil, service.ErrShareExpired)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name:           "list with a file path",
+			url:            "/share/shr_abc?path=/reports/q3.pdf",
+			setup:          func(svc *MockShareService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "password query parameter is ignored",
+			url:  "/share/shr_abc?password=hunter2",
+			setup: func(svc *MockShareService) {
+				svc.On("Open", mock.Anything, "shr_abc", "").Return(nil, service.ErrSharePassword)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:     "download redirects",
+			url:      "/share/shr_abc/download?file_path=/reports/q3.pdf",
+			password: "hunter2",
+			setup: func(svc *MockShareService) {
+				svc.On("Open", mock.Anything, "shr_abc", "hunter2").Return(share, nil)
+				svc.On("Download", mock.Anything, share, "/reports/", "q3.pdf").Return("https://s3.example.com/abc.pdf", nil)
+			},
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name: "download unknown token",
+			url:  "/share/shr_nope/download",
+			setup: func(svc *MockShareService) {
+				svc.On("Open", mock.Anything, "shr_nope", "").Return(nil, service.ErrShareNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := &MockShareService{}
+			tt.setup(mockService)
+			handler := NewShareHandler(mockService)
+
+			// No project in the context: these routes are public
+			router := setupDiskRouter()
+			router.GET("/share/:token", handler.GetSharedFiles)
+			router.GET("/share/:token/download", handler.DownloadSharedFile)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.password != "" {
+				req.Header.Set(sharePasswordHeader, tt.password)
+			}
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusFound {
+				assert.Equal(t, "https://s3.example.com/abc.pdf", w.Header().Get("Location"))
+			}
+			mockService.AssertExpectations(t)
+		})
+	}
+}
@@ -107,6 +107,11 @@ func (h *SpaceHandler) CreateSpace(c *gin.Context) {
 		return
 	}
 
+	if err := service.ValidateConfigs(req.Configs); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid configs", err))
+		return
+	}
+
 	space := model.Space{
 		ProjectID: project.ID,
 		Configs:   datatypes.JSONMap(req.Configs),
@@ -192,6 +197,10 @@ func (h *SpaceHandler) UpdateConfigs(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, serializer.ParamErr("", err))
 		return
 	}
+	if err := service.ValidateConfigs(req.Configs); err != nil {
+		c.JSON(http.StatusBadRequest, serializer.ParamErr("invalid configs", err))
+		return
+	}
 	if err := h.svc.UpdateByID(c.Request.Context(), &model.Space{
 		ID:      spaceID,
 		Configs: datatypes.JSONMap(req.Configs),
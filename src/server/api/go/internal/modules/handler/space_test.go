@@ -370,6 +370,17 @@ func TestSpaceHandler_UpdateConfigs(t *testing.T) {
 			},
 			expectedStatus: http.StatusInternalServerError,
 		},
+		{
+			name:         "invalid default edit strategies",
+			spaceIDParam: spaceID.String(),
+			requestBody: UpdateSpaceConfigsReq{Configs: map[string]interface{}{
+				"edit_strategies": []interface{}{
+					map[string]interface{}{"type": "unknown_strategy"},
+				},
+			}},
+			setup:          func(svc *MockSpaceService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -39,6 +39,9 @@ type Artifact struct {
 	Meta      datatypes.JSONMap         `gorm:"type:jsonb" swaggertype:"object" json:"meta"`
 	AssetMeta datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
 
+	// Version is the current content version, starting at 1 and incremented on every overwrite
+	Version int `gorm:"not null;default:1" json:"version"`
+
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
 
@@ -52,3 +55,136 @@ func (Artifact) TableName() string { return "artifacts" }
 func (Artifact) GetReservedKeys() []string {
 	return []string{ArtifactInfoKey}
 }
+
+// ArtifactVersion keeps a previous content version of an artifact. Each version
+// holds a reference on its asset, so overwritten contents stay in S3 until the
+// artifact is deleted.
+type ArtifactVersion struct {
+	ID         uuid.UUID                 `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
+	ArtifactID uuid.UUID                 `gorm:"type:uuid;not null;uniqueIndex:idx_artifact_version,priority:1" json:"-"`
+	Version    int                       `gorm:"not null;uniqueIndex:idx_artifact_version,priority:2" json:"version"`
+	Meta       datatypes.JSONMap         `gorm:"type:jsonb" swaggertype:"object" json:"meta"`
+	AssetMeta  datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
+
+	// CreatedAt is the artifact's UpdatedAt at the time this version was superseded
+	CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// ArtifactVersion <-> Artifact
+	Artifact *Artifact `gorm:"foreignKey:ArtifactID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (ArtifactVersion) TableName() string { return "artifact_versions" }
+
+// Directory is an explicitly created directory of a disk. Directories that hold
+// artifacts exist implicitly through the artifact paths; rows are only needed
+// to keep empty directories. Path has a leading and a trailing slash.
+type Directory struct {
+	ID     uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
+	DiskID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_disk_directory_path,priority:1" json:"disk_id"`
+	Path   string    `gorm:"type:text;not null;uniqueIndex:idx_disk_directory_path,priority:2" json:"path"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// Directory <-> Disk
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (Directory) TableName() string { return "disk_directories" }
+
+// ArtifactUpload is a direct-to-storage upload that was started with a presigned
+// URL and becomes an artifact once it is finalized
+type ArtifactUpload struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	DiskID    uuid.UUID `gorm:"type:uuid;not null;index" json:"disk_id"`
+	Path      string    `gorm:"type:text;not null" json:"path"`
+	Filename  string    `gorm:"type:text;not null" json:"filename"`
+
+	// S3Key is the staging key the client uploads to
+	S3Key string `gorm:"type:text;not null" json:"-"`
+	// MultipartUploadID is the S3 multipart upload ID, empty for single PUT uploads
+	MultipartUploadID string `gorm:"type:text" json:"-"`
+	PartCount         int32  `gorm:"not null;default:0" json:"-"`
+
+	SizeB       int64             `gorm:"not null" json:"size_b"`
+	ContentType string            `gorm:"type:text;not null" json:"content_type"`
+	UserMeta    datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"meta"`
+
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	// ClaimedUntil is set while a finalize works on the upload. An expired
+	// claim, left behind by a finalize that never finished, can be taken over.
+	ClaimedUntil *time.Time `json:"-"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// ArtifactUpload <-> Disk
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (ArtifactUpload) TableName() string { return "artifact_uploads" }
+
+// DiskSnapshot is an immutable point-in-time manifest of a disk. Every entry
+// holds a reference on its asset, so a snapshot can still be cloned or restored
+// after the live artifacts were overwritten or deleted.
+type DiskSnapshot struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	DiskID    uuid.UUID `gorm:"type:uuid;not null;index" json:"disk_id"`
+
+	ArtifactCount int `gorm:"not null;default:0" json:"artifact_count"`
+	// Directories are the explicitly created directories of the disk
+	Directories datatypes.JSONSlice[string] `gorm:"type:jsonb" swaggertype:"array,string" json:"directories"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// DiskSnapshot <-> Disk
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (DiskSnapshot) TableName() string { return "disk_snapshots" }
+
+// DiskSnapshotEntry is one artifact recorded in a disk snapshot
+type DiskSnapshotEntry struct {
+	ID         uuid.UUID                 `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"-"`
+	SnapshotID uuid.UUID                 `gorm:"type:uuid;not null;uniqueIndex:idx_snapshot_path_filename" json:"-"`
+	Path       string                    `gorm:"type:text;not null;uniqueIndex:idx_snapshot_path_filename" json:"path"`
+	Filename   string                    `gorm:"type:text;not null;uniqueIndex:idx_snapshot_path_filename" json:"filename"`
+	Meta       datatypes.JSONMap         `gorm:"type:jsonb" swaggertype:"object" json:"meta"`
+	AssetMeta  datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
+
+	// DiskSnapshotEntry <-> DiskSnapshot
+	Snapshot *DiskSnapshot `gorm:"foreignKey:SnapshotID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (DiskSnapshotEntry) TableName() string { return "disk_snapshot_entries" }
+
+// DiskShare is a public, read-only link to one artifact or to everything under
+// a directory of a disk. Only the HMAC of the share token is stored.
+type DiskShare struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	ProjectID uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	DiskID    uuid.UUID `gorm:"type:uuid;not null;index" json:"disk_id"`
+	TokenHMAC string    `gorm:"type:char(64);not null;uniqueIndex" json:"-"`
+
+	// Path is the shared directory, or the directory of the shared artifact
+	Path string `gorm:"type:text;not null" json:"path"`
+	// Filename is set when a single artifact is shared
+	Filename string `gorm:"type:text;not null;default:''" json:"filename"`
+
+	PasswordHashPHC string `gorm:"type:text" json:"-"`
+	HasPassword     bool   `gorm:"not null;default:false" json:"has_password"`
+
+	// MaxDownloads is nil for shares without a download limit
+	MaxDownloads  *int `json:"max_downloads"`
+	DownloadCount int  `gorm:"not null;default:0" json:"download_count"`
+
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// DiskShare <-> Disk
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (DiskShare) TableName() string { return "disk_shares" }
+
+// IsFile reports whether the share is scoped to a single artifact
+func (s *DiskShare) IsFile() bool { return s.Filename != "" }
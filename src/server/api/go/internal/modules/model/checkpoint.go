@@ -0,0 +1,28 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Checkpoint is a named pointer to a message of a session, such as
+// "plan approved" or "phase 2 start"
+type Checkpoint struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SessionID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:uq_checkpoint_session_id_name,priority:1" json:"session_id"`
+	Name        string    `gorm:"type:text;not null;uniqueIndex:uq_checkpoint_session_id_name,priority:2" json:"name"`
+	MessageID   uuid.UUID `gorm:"type:uuid;not null;index" json:"message_id"`
+	Description string    `gorm:"type:text;not null;default:''" json:"description"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	// Checkpoint <-> Session
+	Session *Session `gorm:"foreignKey:SessionID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+
+	// Checkpoint <-> Message
+	Message *Message `gorm:"foreignKey:MessageID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (Checkpoint) TableName() string { return "session_checkpoints" }
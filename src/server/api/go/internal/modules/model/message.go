@@ -25,20 +25,47 @@ const (
 	GeminiCallInfoKey = "__gemini_call_info__"
 )
 
+// MessageAgentNameKey is the message-level metadata key a luminox-format message
+// uses to name the agent that produced it; normalizers report the agent name under
+// this key and it is stored in Message.AgentName.
+const MessageAgentNameKey = "agent_name"
+
+// PartValidationErrorsKey holds, in the metadata of a tool-call or tool-result
+// part, the problems found by tool call validation in annotate mode
+const PartValidationErrorsKey = "validation_errors"
+
+// MessageProtectedKey marks a message as protected in its metadata.
+// Protected messages are never dropped or edited by edit strategies.
+const MessageProtectedKey = "protected"
+
 type Message struct {
 	ID        uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	SessionID uuid.UUID  `gorm:"type:uuid;not null;index;index:idx_session_created,priority:1" json:"session_id"`
+	SessionID uuid.UUID  `gorm:"type:uuid;not null;index;index:idx_session_created,priority:1;index:idx_session_seq,priority:1;index:idx_session_agent,priority:1" json:"session_id"`
 	ParentID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
 	Parent    *Message   `gorm:"foreignKey:ParentID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 	Children  []Message  `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 
+	// Seq is the insertion order of the message in its session, assigned
+	// atomically on store. Messages stored before seq existed are numbered in
+	// (created_at, id) order on migration.
+	Seq int64 `gorm:"not null;default:0;index:idx_session_seq,priority:2" json:"seq"`
+
 	Role string `gorm:"type:text;not null;check:role IN ('user','assistant')" json:"role"`
 
+	// AgentName identifies which participant produced the message when several
+	// agents share a session; empty when the message is not attributed.
+	AgentName string `gorm:"type:text;not null;default:'';index:idx_session_agent,priority:2" json:"agent_name,omitempty"`
+
 	Meta datatypes.JSONType[map[string]any] `gorm:"type:jsonb;not null;default:'{}'" swaggertype:"object" json:"meta"`
 
 	PartsAssetMeta datatypes.JSONType[Asset] `gorm:"type:jsonb;not null" swaggertype:"-" json:"-"`
 	Parts          []Part                    `gorm:"-" swaggertype:"array,object" json:"parts"`
 
+	// ToolCallIDs lists the ids of the tool-call parts of the message, so that
+	// tool results can be matched to their call without loading parts. It is
+	// NULL for messages stored before it was recorded, until they are indexed.
+	ToolCallIDs datatypes.JSONSlice[string] `gorm:"type:jsonb" swaggertype:"-" json:"-"`
+
 	TaskID *uuid.UUID `gorm:"type:uuid;index" json:"task_id"`
 
 	SessionTaskProcessStatus string `gorm:"type:text;not null;default:'pending';check:session_task_process_status IN ('success','failed','running','pending')" json:"session_task_process_status"`
@@ -55,11 +82,29 @@ type Message struct {
 
 func (Message) TableName() string { return "messages" }
 
+// Before reports whether m was stored before other in the same session,
+// ordering by (seq, created_at, id)
+func (m Message) Before(other Message) bool {
+	if m.Seq != other.Seq {
+		return m.Seq < other.Seq
+	}
+	if !m.CreatedAt.Equal(other.CreatedAt) {
+		return m.CreatedAt.Before(other.CreatedAt)
+	}
+	return m.ID.String() < other.ID.String()
+}
+
 // GetReservedKeys returns a list of reserved metadata keys for Message
 func (Message) GetReservedKeys() []string {
 	return []string{GeminiCallInfoKey}
 }
 
+// IsProtected reports whether the message is flagged as protected in its metadata
+func (m Message) IsProtected() bool {
+	protected, ok := m.Meta.Data()[MessageProtectedKey].(bool)
+	return ok && protected
+}
+
 type Part struct {
 	// "text" | "image" | "audio" | "video" | "file" | "tool-call" | "tool-result" | "data"
 	Type string `json:"type"`
@@ -14,6 +14,18 @@ type Session struct {
 	DisableTaskTracking bool              `gorm:"not null;default:false" json:"disable_task_tracking"`
 	SpaceID             *uuid.UUID        `gorm:"type:uuid;index" json:"space_id"`
 	Configs             datatypes.JSONMap `gorm:"type:jsonb" swaggertype:"object" json:"configs"`
+	DiskID              *uuid.UUID        `gorm:"type:uuid;index" json:"disk_id"`
+
+	// ParentSessionID, ParentMessageID and ParentToolCallID link a sub-agent
+	// session to the session, message and tool call that spawned it. They are
+	// only set at creation. ParentMessageID has no foreign key: messages
+	// already reference sessions and the cycle would break AutoMigrate.
+	ParentSessionID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_session_id"`
+	ParentMessageID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_message_id"`
+	ParentToolCallID string     `gorm:"type:text;not null;default:''" json:"parent_tool_call_id,omitempty"`
+
+	// LastMessageSeq is the seq of the latest message stored in the session
+	LastMessageSeq int64 `gorm:"not null;default:0" json:"-"`
 
 	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"autoUpdateTime;not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
@@ -27,6 +39,12 @@ type Session struct {
 	// Session <-> Space
 	Space *Space `gorm:"foreignKey:SpaceID;references:ID;constraint:OnDelete:SET NULL,OnUpdate:CASCADE;" json:"-"`
 
+	// Session <-> Parent session (sub-agents). Children outlive their parent.
+	ParentSession *Session `gorm:"foreignKey:ParentSessionID;references:ID;constraint:OnDelete:SET NULL,OnUpdate:CASCADE;" json:"-"`
+
+	// Session <-> Disk (holds offloaded tool results)
+	Disk *Disk `gorm:"foreignKey:DiskID;references:ID;constraint:OnDelete:SET NULL,OnUpdate:CASCADE;" json:"-"`
+
 	// Session <-> Message
 	Messages []Message `gorm:"constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
 
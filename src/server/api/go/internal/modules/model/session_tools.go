@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+)
+
+// ToolDefinition is a function tool offered to the model, independent of the
+// provider format it was declared in
+type ToolDefinition struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Parameters is the JSON Schema of the tool arguments
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// SessionTools is one version of the tool definitions given to the model in a
+// session. Every update stores a new version; the highest version is current.
+type SessionTools struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:uq_session_tools_session_id_version,priority:1" json:"session_id"`
+	Version   int       `gorm:"not null;uniqueIndex:uq_session_tools_session_id_version,priority:2" json:"version"`
+
+	// SourceFormat is the provider format the tools were declared in
+	SourceFormat MessageFormat                        `gorm:"type:text;not null" json:"source_format"`
+	Tools        datatypes.JSONType[[]ToolDefinition] `gorm:"type:jsonb;not null" swaggertype:"array,object" json:"tools"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	// SessionTools <-> Session
+	Session *Session `gorm:"foreignKey:SessionID;references:ID;constraint:OnDelete:CASCADE,OnUpdate:CASCADE;" json:"-"`
+}
+
+func (SessionTools) TableName() string { return "session_tools" }
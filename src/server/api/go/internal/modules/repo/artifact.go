@@ -2,26 +2,59 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/glob"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ArtifactRepo interface {
 	Create(ctx context.Context, projectID uuid.UUID, a *model.Artifact) error
-	DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error
-	Update(ctx context.Context, a *model.Artifact) error
+	DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, baseSHA256 string) error
+	Update(ctx context.Context, a *model.Artifact, baseSHA256 string) error
 	GetByPath(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.Artifact, error)
 	ListByPath(ctx context.Context, diskID uuid.UUID, path string) ([]*model.Artifact, error)
 	GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]string, error)
 	ExistsByPathAndFilename(ctx context.Context, diskID uuid.UUID, path string, filename string, excludeID *uuid.UUID) (bool, error)
-	GrepArtifacts(ctx context.Context, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error)
+	GrepArtifacts(ctx context.Context, diskID uuid.UUID, q GrepQuery, limit int) ([]*model.Artifact, error)
 	GlobArtifacts(ctx context.Context, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error)
+	ReplaceContent(ctx context.Context, projectID uuid.UUID, a *model.Artifact, asset model.Asset, meta datatypes.JSONMap, baseSHA256 string) error
+	ListVersions(ctx context.Context, artifactID uuid.UUID) ([]*model.ArtifactVersion, error)
+	GetVersion(ctx context.Context, artifactID uuid.UUID, version int) (*model.ArtifactVersion, error)
+	MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, baseSHA256 string) (*model.Artifact, error)
+	MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string) (int64, error)
+	CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string) (*model.Artifact, error)
+	CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string) (int64, error)
+	DeleteDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool) (int64, error)
+	CreateDirectory(ctx context.Context, diskID uuid.UUID, dir string) error
+	ListFilePaths(ctx context.Context, diskID uuid.UUID, dir string) ([]string, error)
+	CreateUpload(ctx context.Context, u *model.ArtifactUpload) error
+	GetUpload(ctx context.Context, diskID uuid.UUID, uploadID uuid.UUID) (*model.ArtifactUpload, error)
+	ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*model.ArtifactUpload, error)
+	ClaimUpload(ctx context.Context, uploadID uuid.UUID, until time.Time) error
+	ReleaseUpload(ctx context.Context, uploadID uuid.UUID) error
+	DeleteUpload(ctx context.Context, uploadID uuid.UUID) error
 }
 
+// ErrArtifactExists is returned when a move or copy would overwrite an existing artifact
+var ErrArtifactExists = errors.New("artifact already exists")
+
+// ErrDirectoryNotEmpty is returned when a non-recursive delete targets a directory with contents
+var ErrDirectoryNotEmpty = errors.New("directory is not empty")
+
+// ErrUploadClaimed is returned when claiming an upload that another finalize is working on
+var ErrUploadClaimed = errors.New("upload is being finalized")
+
+// ErrContentChanged is returned when an artifact's content no longer matches the content a write was based on
+var ErrContentChanged = errors.New("artifact content has changed")
+
 type artifactRepo struct {
 	db                 *gorm.DB
 	assetReferenceRepo AssetReferenceRepo
@@ -49,7 +82,10 @@ func (r *artifactRepo) Create(ctx context.Context, projectID uuid.UUID, a *model
 	})
 }
 
-func (r *artifactRepo) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error {
+// DeleteByPath deletes an artifact and its versions. A non-empty baseSHA256
+// must match the artifact's current content, otherwise ErrContentChanged is
+// returned.
+func (r *artifactRepo) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, baseSHA256 string) error {
 	var a model.Artifact
 	err := r.db.WithContext(ctx).Where("disk_id = ? AND path = ? AND filename = ?", diskID, path, filename).First(&a).Error
 	if err != nil {
@@ -59,25 +95,59 @@ func (r *artifactRepo) DeleteByPath(ctx context.Context, projectID uuid.UUID, di
 		return err
 	}
 
-	// Save asset meta before deletion for reference decrement
-	asset := a.AssetMeta.Data()
+	// Save asset meta of the artifact and its previous versions before deletion for reference decrement
+	var versions []model.ArtifactVersion
+	if err := r.db.WithContext(ctx).Where("artifact_id = ?", a.ID).Find(&versions).Error; err != nil {
+		return fmt.Errorf("query artifact versions: %w", err)
+	}
+	assets := make([]model.Asset, 0, len(versions)+1)
+	assets = append(assets, a.AssetMeta.Data())
+	for _, v := range versions {
+		assets = append(assets, v.AssetMeta.Data())
+	}
 
-	// Use transaction to ensure atomicity: delete artifact and decrement reference
+	// Use transaction to ensure atomicity: delete artifact (versions are deleted by CASCADE) and decrement references
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if err := tx.Delete(&a).Error; err != nil {
-			return err
+		query := tx.Where("id = ?", a.ID)
+		if baseSHA256 != "" {
+			// Checked in the delete itself so a concurrent overwrite is not lost
+			query = query.Where("asset_meta->>'sha256' = ?", baseSHA256)
+		}
+		res := query.Delete(&model.Artifact{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			if baseSHA256 != "" {
+				return ErrContentChanged
+			}
+			// Deleted concurrently, which also released its references
+			return nil
 		}
 
-		if err := r.assetReferenceRepo.DecrementAssetRef(ctx, projectID, asset); err != nil {
-			return fmt.Errorf("decrement asset reference: %w", err)
+		if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, assets); err != nil {
+			return fmt.Errorf("decrement asset references: %w", err)
 		}
 
 		return nil
 	})
 }
 
-func (r *artifactRepo) Update(ctx context.Context, a *model.Artifact) error {
-	return r.db.WithContext(ctx).Where("id = ? AND disk_id = ?", a.ID, a.DiskID).Updates(a).Error
+// Update saves the fields of a. A non-empty baseSHA256 must match the
+// artifact's current content, otherwise ErrContentChanged is returned.
+func (r *artifactRepo) Update(ctx context.Context, a *model.Artifact, baseSHA256 string) error {
+	query := r.db.WithContext(ctx).Where("id = ? AND disk_id = ?", a.ID, a.DiskID)
+	if baseSHA256 == "" {
+		return query.Updates(a).Error
+	}
+	res := query.Where("asset_meta->>'sha256' = ?", baseSHA256).Updates(a)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrContentChanged
+	}
+	return nil
 }
 
 func (r *artifactRepo) GetByPath(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.Artifact, error) {
@@ -115,7 +185,17 @@ func (r *artifactRepo) GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]str
 	if err != nil {
 		return nil, err
 	}
-	return paths, nil
+
+	// Explicitly created directories may be empty, so they are listed separately
+	var dirs []string
+	err = r.db.WithContext(ctx).
+		Model(&model.Directory{}).
+		Where("disk_id = ?", diskID).
+		Pluck("path", &dirs).Error
+	if err != nil {
+		return nil, err
+	}
+	return append(paths, dirs...), nil
 }
 
 func (r *artifactRepo) ExistsByPathAndFilename(ctx context.Context, diskID uuid.UUID, path string, filename string, excludeID *uuid.UUID) (bool, error) {
@@ -137,20 +217,50 @@ func (r *artifactRepo) ExistsByPathAndFilename(ctx context.Context, diskID uuid.
 	return count > 0, nil
 }
 
-func (r *artifactRepo) GrepArtifacts(ctx context.Context, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
+// GrepQuery describes the candidates of a content search over the text
+// artifacts of a disk. The pattern itself is matched by the caller, as the
+// regular expression dialects of Go and PostgreSQL differ.
+type GrepQuery struct {
+	// Literal, when set, restricts the search to content containing it
+	Literal string
+	// CaseInsensitive matches Literal ignoring ASCII case
+	CaseInsensitive bool
+	// Regexp, when set, restricts the search to content matching this
+	// PostgreSQL regular expression
+	Regexp string
+	// Glob restricts the search to artifacts whose path matches the glob pattern
+	Glob string
+	// Offset skips that many candidates, in path order
+	Offset int
+}
+
+func (r *artifactRepo) GrepArtifacts(ctx context.Context, diskID uuid.UUID, q GrepQuery, limit int) ([]*model.Artifact, error) {
 	var artifacts []*model.Artifact
 
-	// Use regex pattern matching on text content
 	// Filter by text-searchable mime types and ensure content is not null
 	// This matches the index condition for optimal performance
 	query := r.db.WithContext(ctx).
 		Where("disk_id = ?", diskID).
 		Where("(asset_meta->>'content') IS NOT NULL").
-		Where("((asset_meta->>'mime') LIKE 'text/%' OR (asset_meta->>'mime') = 'application/json' OR (asset_meta->>'mime') LIKE 'application/x-%')").
-		Where("(asset_meta->>'content') ~ ?", pattern).
-		Limit(limit)
+		Where("((asset_meta->>'mime') LIKE 'text/%' OR (asset_meta->>'mime') = 'application/json' OR (asset_meta->>'mime') LIKE 'application/x-%')")
+	if q.Literal != "" {
+		if q.CaseInsensitive {
+			query = query.Where("strpos(lower(asset_meta->>'content'), ?) > 0", strings.ToLower(q.Literal))
+		} else {
+			query = query.Where("strpos(asset_meta->>'content', ?) > 0", q.Literal)
+		}
+	}
+	if q.Regexp != "" {
+		query = query.Where("(asset_meta->>'content') ~ ?", q.Regexp)
+	}
+	if q.Glob != "" {
+		var err error
+		if query, err = whereGlob(query, q.Glob); err != nil {
+			return nil, err
+		}
+	}
 
-	err := query.Find(&artifacts).Error
+	err := query.Order("path, filename").Offset(q.Offset).Limit(limit).Find(&artifacts).Error
 	if err != nil {
 		return nil, err
 	}
@@ -161,30 +271,529 @@ func (r *artifactRepo) GrepArtifacts(ctx context.Context, diskID uuid.UUID, patt
 func (r *artifactRepo) GlobArtifacts(ctx context.Context, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
 	var artifacts []*model.Artifact
 
-	// Convert glob pattern to PostgreSQL LIKE pattern
-	// Replace ** with % (recursive directory matching)
-	// Replace * with % (any characters)
-	// Replace ? with _ (single character)
-	// Note: ** must be replaced before * to avoid double replacement
-	sqlPattern := strings.ReplaceAll(pattern, "**", "%")
-	sqlPattern = strings.ReplaceAll(sqlPattern, "*", "%")
-	sqlPattern = strings.ReplaceAll(sqlPattern, "?", "_")
-
-	// Escape special LIKE characters that aren't glob patterns
-	// PostgreSQL LIKE uses % and _ as wildcards, \ as escape
-	// We need to escape any literal % or _ that aren't from our replacements
-	// But since we're doing full replacement, we don't need to escape
-
-	// Match against combined path/filename
-	query := r.db.WithContext(ctx).
-		Where("disk_id = ?", diskID).
-		Where("(path || '/' || filename) LIKE ?", sqlPattern).
-		Limit(limit)
+	query, err := whereGlob(r.db.WithContext(ctx).Where("disk_id = ?", diskID), pattern)
+	if err != nil {
+		return nil, err
+	}
 
-	err := query.Find(&artifacts).Error
+	err = query.Order("path, filename").Limit(limit).Find(&artifacts).Error
 	if err != nil {
 		return nil, err
 	}
 
 	return artifacts, nil
 }
+
+// whereGlob restricts query to artifacts whose full path (path followed by
+// filename) matches the glob pattern. Patterns are relative to the disk root.
+func whereGlob(query *gorm.DB, pattern string) (*gorm.DB, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "/" + pattern
+	}
+	expr, err := glob.ToRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	// Narrow the scan to the pattern's static directory before applying the regex
+	dir, exact := glob.Base(pattern)
+	if exact {
+		query = query.Where("path = ?", dir)
+	} else if dir != "/" {
+		query = query.Where("path LIKE ?", likePrefix(dir))
+	}
+
+	return query.Where("(path || filename) ~ ?", expr), nil
+}
+
+// ReplaceContent archives the artifact's current content as a version and
+// replaces it with asset and meta, incrementing the version number. The
+// artifact row is locked so concurrent overwrites get distinct versions.
+// A non-empty baseSHA256 must match the current content, otherwise
+// ErrContentChanged is returned. On success a is reloaded with the new content.
+func (r *artifactRepo) ReplaceContent(ctx context.Context, projectID uuid.UUID, a *model.Artifact, asset model.Asset, meta datatypes.JSONMap, baseSHA256 string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current model.Artifact
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", a.ID).First(&current).Error; err != nil {
+			return err
+		}
+		if baseSHA256 != "" && current.AssetMeta.Data().SHA256 != baseSHA256 {
+			return ErrContentChanged
+		}
+
+		version := model.ArtifactVersion{
+			ArtifactID: current.ID,
+			Version:    current.Version,
+			Meta:       current.Meta,
+			AssetMeta:  current.AssetMeta,
+			CreatedAt:  current.UpdatedAt,
+		}
+		if err := tx.Create(&version).Error; err != nil {
+			return fmt.Errorf("archive artifact version: %w", err)
+		}
+
+		if err := tx.Model(&model.Artifact{}).Where("id = ?", current.ID).Updates(map[string]interface{}{
+			"meta":       meta,
+			"asset_meta": datatypes.NewJSONType(asset),
+			"version":    current.Version + 1,
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return fmt.Errorf("update artifact content: %w", err)
+		}
+
+		// The archived version keeps its reference, so only the new asset is counted
+		if err := r.assetReferenceRepo.IncrementAssetRef(ctx, projectID, asset); err != nil {
+			return fmt.Errorf("increment asset reference: %w", err)
+		}
+
+		return tx.Where("id = ?", current.ID).First(a).Error
+	})
+}
+
+func (r *artifactRepo) ListVersions(ctx context.Context, artifactID uuid.UUID) ([]*model.ArtifactVersion, error) {
+	var versions []*model.ArtifactVersion
+	err := r.db.WithContext(ctx).
+		Where("artifact_id = ?", artifactID).
+		Order("version DESC").
+		Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (r *artifactRepo) GetVersion(ctx context.Context, artifactID uuid.UUID, version int) (*model.ArtifactVersion, error) {
+	var v model.ArtifactVersion
+	err := r.db.WithContext(ctx).Where("artifact_id = ? AND version = ?", artifactID, version).First(&v).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// likePrefix returns a LIKE pattern matching every string that starts with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
+
+// withArtifactInfo returns a copy of meta whose artifact info points at path and filename
+func withArtifactInfo(meta datatypes.JSONMap, path string, filename string) datatypes.JSONMap {
+	out := make(datatypes.JSONMap, len(meta))
+	for k, v := range meta {
+		out[k] = v
+	}
+	if info, ok := meta[model.ArtifactInfoKey].(map[string]interface{}); ok {
+		newInfo := make(map[string]interface{}, len(info))
+		for k, v := range info {
+			newInfo[k] = v
+		}
+		newInfo["path"] = path
+		newInfo["filename"] = filename
+		out[model.ArtifactInfoKey] = newInfo
+	}
+	return out
+}
+
+// countTransferConflicts counts artifacts under srcDir whose destination under
+// dstDir is already taken. With excludeSrc, taken destinations inside srcDir
+// are ignored because those artifacts are moved away as well.
+func countTransferConflicts(tx *gorm.DB, diskID uuid.UUID, srcDir string, dstDir string, excludeSrc bool) (int64, error) {
+	query := `SELECT count(*) FROM artifacts a
+		JOIN artifacts b ON b.disk_id = a.disk_id AND b.filename = a.filename
+			AND b.path = ?::text || substring(a.path from char_length(?::text) + 1)
+		WHERE a.disk_id = ? AND a.path LIKE ?`
+	args := []interface{}{dstDir, srcDir, diskID, likePrefix(srcDir)}
+	if excludeSrc {
+		query += " AND b.path NOT LIKE ?"
+		args = append(args, likePrefix(srcDir))
+	}
+
+	var count int64
+	if err := tx.Raw(query, args...).Scan(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// MoveArtifact moves an artifact to a new path. A non-empty baseSHA256 must
+// match the artifact's current content, otherwise ErrContentChanged is
+// returned.
+func (r *artifactRepo) MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, baseSHA256 string) (*model.Artifact, error) {
+	var a model.Artifact
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("disk_id = ? AND path = ? AND filename = ?", diskID, srcPath, srcFilename).
+			First(&a).Error; err != nil {
+			return err
+		}
+		// Checked under the row lock so a concurrent overwrite is not moved
+		if baseSHA256 != "" && a.AssetMeta.Data().SHA256 != baseSHA256 {
+			return ErrContentChanged
+		}
+
+		var count int64
+		if err := tx.Model(&model.Artifact{}).
+			Where("disk_id = ? AND path = ? AND filename = ?", diskID, dstPath, dstFilename).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s%s", ErrArtifactExists, dstPath, dstFilename)
+		}
+
+		if err := tx.Model(&model.Artifact{}).Where("id = ?", a.ID).Updates(map[string]interface{}{
+			"path":       dstPath,
+			"filename":   dstFilename,
+			"meta":       withArtifactInfo(a.Meta, dstPath, dstFilename),
+			"updated_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id = ?", a.ID).First(&a).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// MoveDirectory moves every artifact and explicit directory under srcDir to
+// dstDir and returns the number of moved artifacts. Paths are first moved to a
+// temporary prefix that no valid path can start with, so the unique index on
+// (disk_id, path, filename) never sees a half-moved tree.
+func (r *artifactRepo) MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string) (int64, error) {
+	var moved int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := tx.Model(&model.Artifact{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(srcDir)).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		var dirCount int64
+		if err := tx.Model(&model.Directory{}).
+			Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(srcDir)).
+			Count(&dirCount).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 && dirCount == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		conflicts, err := countTransferConflicts(tx, diskID, srcDir, dstDir, true)
+		if err != nil {
+			return fmt.Errorf("check move conflicts: %w", err)
+		}
+		if conflicts > 0 {
+			return fmt.Errorf("%w: %d artifacts under %s", ErrArtifactExists, conflicts, dstDir)
+		}
+
+		// Valid paths start with '/', so the temporary prefix cannot collide
+		tmp := "mv-" + uuid.NewString() + "/"
+
+		res := tx.Exec(`UPDATE artifacts SET path = ?::text || substring(path from char_length(?::text) + 1)
+			WHERE disk_id = ? AND path LIKE ?`, tmp, srcDir, diskID, likePrefix(srcDir))
+		if res.Error != nil {
+			return fmt.Errorf("move artifacts: %w", res.Error)
+		}
+		moved = res.RowsAffected
+
+		infoPath := "{" + model.ArtifactInfoKey + ",path}"
+		if err := tx.Exec(`UPDATE artifacts SET
+				path = ?::text || substring(path from char_length(?::text) + 1),
+				meta = jsonb_set(meta, ?::text[], to_jsonb(?::text || substring(path from char_length(?::text) + 1))),
+				updated_at = ?
+			WHERE disk_id = ? AND path LIKE ?`,
+			dstDir, tmp, infoPath, dstDir, tmp, time.Now(), diskID, likePrefix(tmp)).Error; err != nil {
+			return fmt.Errorf("move artifacts: %w", err)
+		}
+
+		// Explicit directories that already exist at the destination are merged
+		if err := tx.Exec(`DELETE FROM disk_directories WHERE disk_id = ? AND path NOT LIKE ? AND path IN (
+				SELECT ?::text || substring(path from char_length(?::text) + 1) FROM disk_directories
+				WHERE disk_id = ? AND path LIKE ?)`,
+			diskID, likePrefix(srcDir), dstDir, srcDir, diskID, likePrefix(srcDir)).Error; err != nil {
+			return fmt.Errorf("merge directories: %w", err)
+		}
+		if err := tx.Exec(`UPDATE disk_directories SET path = ?::text || substring(path from char_length(?::text) + 1)
+			WHERE disk_id = ? AND path LIKE ?`, tmp, srcDir, diskID, likePrefix(srcDir)).Error; err != nil {
+			return fmt.Errorf("move directories: %w", err)
+		}
+		if err := tx.Exec(`UPDATE disk_directories SET path = ?::text || substring(path from char_length(?::text) + 1)
+			WHERE disk_id = ? AND path LIKE ?`, dstDir, tmp, diskID, likePrefix(tmp)).Error; err != nil {
+			return fmt.Errorf("move directories: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// CopyArtifact copies the current content of an artifact to a new path. The
+// copy shares the asset with the source through its reference count.
+func (r *artifactRepo) CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string) (*model.Artifact, error) {
+	var copied model.Artifact
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var src model.Artifact
+		if err := tx.Where("disk_id = ? AND path = ? AND filename = ?", diskID, srcPath, srcFilename).First(&src).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&model.Artifact{}).
+			Where("disk_id = ? AND path = ? AND filename = ?", diskID, dstPath, dstFilename).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s%s", ErrArtifactExists, dstPath, dstFilename)
+		}
+
+		copied = model.Artifact{
+			DiskID:    diskID,
+			Path:      dstPath,
+			Filename:  dstFilename,
+			Meta:      withArtifactInfo(src.Meta, dstPath, dstFilename),
+			AssetMeta: src.AssetMeta,
+			Version:   1,
+		}
+		if err := tx.Create(&copied).Error; err != nil {
+			return err
+		}
+
+		if err := r.assetReferenceRepo.IncrementAssetRef(ctx, projectID, src.AssetMeta.Data()); err != nil {
+			return fmt.Errorf("increment asset reference: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// CopyDirectory copies every artifact and explicit directory under srcDir to
+// dstDir and returns the number of copied artifacts. Only current contents are
+// copied; the copies share assets with the sources through reference counts.
+func (r *artifactRepo) CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string) (int64, error) {
+	var copied int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var artifacts []model.Artifact
+		if err := tx.Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(srcDir)).Find(&artifacts).Error; err != nil {
+			return err
+		}
+		var dirs []model.Directory
+		if err := tx.Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(srcDir)).Find(&dirs).Error; err != nil {
+			return err
+		}
+		if len(artifacts) == 0 && len(dirs) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		conflicts, err := countTransferConflicts(tx, diskID, srcDir, dstDir, false)
+		if err != nil {
+			return fmt.Errorf("check copy conflicts: %w", err)
+		}
+		if conflicts > 0 {
+			return fmt.Errorf("%w: %d artifacts under %s", ErrArtifactExists, conflicts, dstDir)
+		}
+
+		if len(artifacts) > 0 {
+			copies := make([]model.Artifact, 0, len(artifacts))
+			assets := make([]model.Asset, 0, len(artifacts))
+			for _, a := range artifacts {
+				newPath := dstDir + strings.TrimPrefix(a.Path, srcDir)
+				copies = append(copies, model.Artifact{
+					DiskID:    diskID,
+					Path:      newPath,
+					Filename:  a.Filename,
+					Meta:      withArtifactInfo(a.Meta, newPath, a.Filename),
+					AssetMeta: a.AssetMeta,
+					Version:   1,
+				})
+				assets = append(assets, a.AssetMeta.Data())
+			}
+			if err := tx.Create(&copies).Error; err != nil {
+				return err
+			}
+			if err := r.assetReferenceRepo.BatchIncrementAssetRefs(ctx, projectID, assets); err != nil {
+				return fmt.Errorf("increment asset references: %w", err)
+			}
+			copied = int64(len(copies))
+		}
+
+		if len(dirs) > 0 {
+			newDirs := make([]model.Directory, 0, len(dirs))
+			for _, d := range dirs {
+				newDirs = append(newDirs, model.Directory{DiskID: diskID, Path: dstDir + strings.TrimPrefix(d.Path, srcDir)})
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newDirs).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
+
+// DeleteDirectory deletes a directory and returns the number of deleted
+// artifacts. Without recursive, only an empty explicit directory can be deleted.
+func (r *artifactRepo) DeleteDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool) (int64, error) {
+	var deleted int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var artifacts []model.Artifact
+		if err := tx.Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(dir)).Find(&artifacts).Error; err != nil {
+			return err
+		}
+		var dirs []model.Directory
+		if err := tx.Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(dir)).Find(&dirs).Error; err != nil {
+			return err
+		}
+		if len(artifacts) == 0 && len(dirs) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if !recursive && (len(artifacts) > 0 || len(dirs) > 1 || dirs[0].Path != dir) {
+			return fmt.Errorf("%w: %s", ErrDirectoryNotEmpty, dir)
+		}
+
+		if len(dirs) > 0 {
+			if err := tx.Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(dir)).Delete(&model.Directory{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(artifacts) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, 0, len(artifacts))
+		assets := make([]model.Asset, 0, len(artifacts))
+		for _, a := range artifacts {
+			ids = append(ids, a.ID)
+			assets = append(assets, a.AssetMeta.Data())
+		}
+
+		// Previous versions hold references too and are deleted by CASCADE
+		var versions []model.ArtifactVersion
+		if err := tx.Where("artifact_id IN ?", ids).Find(&versions).Error; err != nil {
+			return fmt.Errorf("query artifact versions: %w", err)
+		}
+		for _, v := range versions {
+			assets = append(assets, v.AssetMeta.Data())
+		}
+
+		if err := tx.Where("id IN ?", ids).Delete(&model.Artifact{}).Error; err != nil {
+			return err
+		}
+		if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, assets); err != nil {
+			return fmt.Errorf("decrement asset references: %w", err)
+		}
+		deleted = int64(len(artifacts))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// CreateDirectory creates an explicit, possibly empty directory. Creating an
+// existing directory is not an error.
+func (r *artifactRepo) CreateDirectory(ctx context.Context, diskID uuid.UUID, dir string) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.Directory{DiskID: diskID, Path: dir}).Error
+}
+
+// ListFilePaths returns the full paths of the artifacts in dir and its
+// subdirectories
+func (r *artifactRepo) ListFilePaths(ctx context.Context, diskID uuid.UUID, dir string) ([]string, error) {
+	var paths []string
+	err := r.db.WithContext(ctx).
+		Model(&model.Artifact{}).
+		Where("disk_id = ? AND path LIKE ?", diskID, likePrefix(dir)).
+		Order("path, filename").
+		Pluck("path || filename", &paths).Error
+	if err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+func (r *artifactRepo) CreateUpload(ctx context.Context, u *model.ArtifactUpload) error {
+	return r.db.WithContext(ctx).Create(u).Error
+}
+
+func (r *artifactRepo) GetUpload(ctx context.Context, diskID uuid.UUID, uploadID uuid.UUID) (*model.ArtifactUpload, error) {
+	var u model.ArtifactUpload
+	err := r.db.WithContext(ctx).Where("id = ? AND disk_id = ?", uploadID, diskID).First(&u).Error
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListExpiredUploads returns up to limit pending uploads that expired before
+// the given time, oldest first. Uploads a finalize is working on are skipped.
+func (r *artifactRepo) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*model.ArtifactUpload, error) {
+	var uploads []*model.ArtifactUpload
+	err := r.db.WithContext(ctx).
+		Where("expires_at < ? AND (claimed_until IS NULL OR claimed_until < ?)", before, time.Now()).
+		Order("expires_at").Limit(limit).Find(&uploads).Error
+	if err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// ClaimUpload marks a pending upload as being finalized until the given time,
+// so only one of concurrent finalizers proceeds. It returns ErrUploadClaimed
+// while another claim is still valid and gorm.ErrRecordNotFound when the
+// upload is gone.
+func (r *artifactRepo) ClaimUpload(ctx context.Context, uploadID uuid.UUID, until time.Time) error {
+	db := r.db.WithContext(ctx)
+	res := db.Model(&model.ArtifactUpload{}).
+		Where("id = ? AND (claimed_until IS NULL OR claimed_until < ?)", uploadID, time.Now()).
+		Update("claimed_until", until)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&model.ArtifactUpload{}).Where("id = ?", uploadID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return ErrUploadClaimed
+}
+
+// ReleaseUpload drops the claim on a pending upload so its finalize can be retried
+func (r *artifactRepo) ReleaseUpload(ctx context.Context, uploadID uuid.UUID) error {
+	return r.db.WithContext(ctx).Model(&model.ArtifactUpload{}).
+		Where("id = ?", uploadID).
+		Update("claimed_until", gorm.Expr("NULL")).Error
+}
+
+// DeleteUpload removes a pending upload. It returns gorm.ErrRecordNotFound when
+// the upload is already gone.
+func (r *artifactRepo) DeleteUpload(ctx context.Context, uploadID uuid.UUID) error {
+	res := r.db.WithContext(ctx).Where("id = ?", uploadID).Delete(&model.ArtifactUpload{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
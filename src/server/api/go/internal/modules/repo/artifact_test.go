@@ -0,0 +1,301 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// countingAssetRefs records reference changes instead of touching asset_references and S3
+type countingAssetRefs struct {
+	refs map[string]int
+}
+
+func (c *countingAssetRefs) IncrementAssetRef(ctx context.Context, projectID uuid.UUID, asset model.Asset) error {
+	c.refs[asset.SHA256]++
+	return nil
+}
+
+func (c *countingAssetRefs) DecrementAssetRef(ctx context.Context, projectID uuid.UUID, asset model.Asset) error {
+	c.refs[asset.SHA256]--
+	return nil
+}
+
+func (c *countingAssetRefs) BatchIncrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error {
+	for _, a := range assets {
+		c.refs[a.SHA256]++
+	}
+	return nil
+}
+
+func (c *countingAssetRefs) BatchDecrementAssetRefs(ctx context.Context, projectID uuid.UUID, assets []model.Asset) error {
+	for _, a := range assets {
+		c.refs[a.SHA256]--
+	}
+	return nil
+}
+
+func TestLikePrefix(t *testing.T) {
+	assert.Equal(t, "/docs/%", likePrefix("/docs/"))
+	assert.Equal(t, `/100\%\_done\\/%`, likePrefix(`/100%_done\/`))
+}
+
+func TestWithArtifactInfo(t *testing.T) {
+	meta := datatypes.JSONMap{
+		model.ArtifactInfoKey: map[string]interface{}{"path": "/a/", "filename": "x.txt", "mime": "text/plain"},
+		"owner":               "agent",
+	}
+
+	out := withArtifactInfo(meta, "/b/", "y.txt")
+
+	info := out[model.ArtifactInfoKey].(map[string]interface{})
+	assert.Equal(t, "/b/", info["path"])
+	assert.Equal(t, "y.txt", info["filename"])
+	assert.Equal(t, "text/plain", info["mime"])
+	assert.Equal(t, "agent", out["owner"])
+	// The source meta is left untouched
+	assert.Equal(t, "/a/", meta[model.ArtifactInfoKey].(map[string]interface{})["path"])
+}
+
+func setupArtifactTestDB(t *testing.T) *gorm.DB {
+	// Skip if no test database is configured
+	dsn := "host=localhost user=luminox password=helloworld dbname=luminox port=15432 sslmode=disable"
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Skip("Test database not available, skipping integration tests")
+		return nil
+	}
+
+	err = db.AutoMigrate(
+		&model.Project{},
+		&model.Disk{},
+		&model.Artifact{},
+		&model.ArtifactVersion{},
+		&model.Directory{},
+		&model.DiskSnapshot{},
+		&model.DiskSnapshotEntry{},
+	)
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestArtifactRepo_DirectoryOperations(t *testing.T) {
+	db := setupArtifactTestDB(t)
+	ctx := context.Background()
+
+	project := &model.Project{ID: uuid.New(), SecretKeyHMAC: uuid.NewString(), SecretKeyHashPHC: uuid.NewString()}
+	require.NoError(t, db.Create(project).Error)
+	defer db.Exec("DELETE FROM projects WHERE id = ?", project.ID)
+
+	disk := &model.Disk{ProjectID: project.ID}
+	require.NoError(t, db.Create(disk).Error)
+
+	refs := &countingAssetRefs{refs: map[string]int{}}
+	r := NewArtifactRepo(db, refs)
+
+	create := func(p, filename, sha string) {
+		require.NoError(t, r.Create(ctx, project.ID, &model.Artifact{
+			DiskID:   disk.ID,
+			Path:     p,
+			Filename: filename,
+			Meta: datatypes.JSONMap{
+				model.ArtifactInfoKey: map[string]interface{}{"path": p, "filename": filename},
+			},
+			AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/" + sha, SHA256: sha}),
+			Version:   1,
+		}))
+	}
+	create("/src/", "a.txt", "sha-a")
+	create("/src/sub/", "b.txt", "sha-b")
+	create("/src_other/", "c.txt", "sha-c")
+	require.NoError(t, r.CreateDirectory(ctx, disk.ID, "/src/empty/"))
+
+	t.Run("list file paths does not include prefix siblings", func(t *testing.T) {
+		paths, err := r.ListFilePaths(ctx, disk.ID, "/src/")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/src/a.txt", "/src/sub/b.txt"}, paths)
+	})
+
+	t.Run("copy directory shares assets", func(t *testing.T) {
+		n, err := r.CopyDirectory(ctx, project.ID, disk.ID, "/src/", "/copy/")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Equal(t, 2, refs.refs["sha-a"])
+		assert.Equal(t, 2, refs.refs["sha-b"])
+
+		copied, err := r.GetByPath(ctx, disk.ID, "/copy/sub/", "b.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "/copy/sub/", copied.Meta[model.ArtifactInfoKey].(map[string]interface{})["path"])
+
+		paths, err := r.GetAllPaths(ctx, disk.ID)
+		require.NoError(t, err)
+		assert.Contains(t, paths, "/copy/empty/")
+	})
+
+	t.Run("copy onto existing artifacts conflicts", func(t *testing.T) {
+		_, err := r.CopyDirectory(ctx, project.ID, disk.ID, "/src/", "/copy/")
+		assert.ErrorIs(t, err, ErrArtifactExists)
+	})
+
+	t.Run("move directory does not touch prefix siblings", func(t *testing.T) {
+		n, err := r.MoveDirectory(ctx, disk.ID, "/src/", "/dst/")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+
+		moved, err := r.GetByPath(ctx, disk.ID, "/dst/sub/", "b.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "/dst/sub/", moved.Meta[model.ArtifactInfoKey].(map[string]interface{})["path"])
+
+		_, err = r.GetByPath(ctx, disk.ID, "/src_other/", "c.txt")
+		assert.NoError(t, err)
+
+		paths, err := r.GetAllPaths(ctx, disk.ID)
+		require.NoError(t, err)
+		assert.Contains(t, paths, "/dst/empty/")
+		assert.NotContains(t, paths, "/src/empty/")
+	})
+
+	t.Run("move missing directory", func(t *testing.T) {
+		_, err := r.MoveDirectory(ctx, disk.ID, "/src/", "/elsewhere/")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("move with stale content", func(t *testing.T) {
+		_, err := r.MoveArtifact(ctx, disk.ID, "/dst/", "a.txt", "/dst/", "renamed.txt", "sha-old")
+		assert.ErrorIs(t, err, ErrContentChanged)
+	})
+
+	t.Run("rename single artifact", func(t *testing.T) {
+		a, err := r.MoveArtifact(ctx, disk.ID, "/dst/", "a.txt", "/dst/", "renamed.txt", "sha-a")
+		require.NoError(t, err)
+		assert.Equal(t, "renamed.txt", a.Filename)
+		assert.Equal(t, "renamed.txt", a.Meta[model.ArtifactInfoKey].(map[string]interface{})["filename"])
+	})
+
+	t.Run("non-recursive delete of non-empty directory", func(t *testing.T) {
+		_, err := r.DeleteDirectory(ctx, project.ID, disk.ID, "/dst/", false)
+		assert.ErrorIs(t, err, ErrDirectoryNotEmpty)
+	})
+
+	t.Run("non-recursive delete of empty directory", func(t *testing.T) {
+		n, err := r.DeleteDirectory(ctx, project.ID, disk.ID, "/dst/empty/", false)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+
+	t.Run("recursive delete releases assets", func(t *testing.T) {
+		n, err := r.DeleteDirectory(ctx, project.ID, disk.ID, "/copy/", true)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), n)
+		assert.Equal(t, 1, refs.refs["sha-a"])
+		assert.Equal(t, 1, refs.refs["sha-b"])
+
+		artifacts, err := r.ListByPath(ctx, disk.ID, "/copy/sub/")
+		require.NoError(t, err)
+		assert.Empty(t, artifacts)
+	})
+}
+
+func TestArtifactRepo_GlobArtifacts(t *testing.T) {
+	db := setupArtifactTestDB(t)
+	ctx := context.Background()
+
+	project := &model.Project{ID: uuid.New(), SecretKeyHMAC: uuid.NewString(), SecretKeyHashPHC: uuid.NewString()}
+	require.NoError(t, db.Create(project).Error)
+	defer db.Exec("DELETE FROM projects WHERE id = ?", project.ID)
+
+	disk := &model.Disk{ProjectID: project.ID}
+	require.NoError(t, db.Create(disk).Error)
+
+	r := NewArtifactRepo(db, &countingAssetRefs{refs: map[string]int{}})
+	for _, p := range []string{"/main.py", "/src/app.py", "/src/lib/util.py", "/src/lib/util.go", "/docs/100%_done.md", "/docs/100x_done.md"} {
+		i := strings.LastIndex(p, "/")
+		require.NoError(t, r.Create(ctx, project.ID, &model.Artifact{
+			DiskID:    disk.ID,
+			Path:      p[:i+1],
+			Filename:  p[i+1:],
+			AssetMeta: datatypes.NewJSONType(model.Asset{SHA256: p}),
+			Version:   1,
+		}))
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.py", []string{"/main.py"}},
+		{"**/*.py", []string{"/main.py", "/src/app.py", "/src/lib/util.py"}},
+		{"src/*.py", []string{"/src/app.py"}},
+		{"/src/**/*.{py,go}", []string{"/src/app.py", "/src/lib/util.go", "/src/lib/util.py"}},
+		{"docs/100%_done.md", []string{"/docs/100%_done.md"}},
+		{"src/lib/util.[!p]*", []string{"/src/lib/util.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			artifacts, err := r.GlobArtifacts(ctx, disk.ID, tt.pattern, 100)
+			require.NoError(t, err)
+
+			var got []string
+			for _, a := range artifacts {
+				got = append(got, a.Path+a.Filename)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestArtifactRepo_GrepArtifactsRegexp(t *testing.T) {
+	db := setupArtifactTestDB(t)
+	ctx := context.Background()
+
+	project := &model.Project{ID: uuid.New(), SecretKeyHMAC: uuid.NewString(), SecretKeyHashPHC: uuid.NewString()}
+	require.NoError(t, db.Create(project).Error)
+	defer db.Exec("DELETE FROM projects WHERE id = ?", project.ID)
+
+	disk := &model.Disk{ProjectID: project.ID}
+	require.NoError(t, db.Create(disk).Error)
+
+	r := NewArtifactRepo(db, &countingAssetRefs{refs: map[string]int{}})
+	for filename, content := range map[string]string{"a.txt": "id 2024-01\n", "b.txt": "no digits\n", "c.txt": "KELVIN\n"} {
+		require.NoError(t, r.Create(ctx, project.ID, &model.Artifact{
+			DiskID:    disk.ID,
+			Path:      "/",
+			Filename:  filename,
+			AssetMeta: datatypes.NewJSONType(model.Asset{SHA256: filename, MIME: "text/plain", Content: content}),
+			Version:   1,
+		}))
+	}
+
+	tests := []struct {
+		regexp string
+		want   []string
+	}{
+		{`(?:[0-9])+\u002d(?:[0-9])+`, []string{"a.txt"}},
+		{`[Kk\u212a]elvin`, nil},
+		{`[Kk\u212a][Ee][Ll]`, []string{"c.txt"}},
+		{`[\u0001-\u0060b-\ud7ff\ue000-\U0010ffff]`, []string{"a.txt", "b.txt", "c.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.regexp, func(t *testing.T) {
+			artifacts, err := r.GrepArtifacts(ctx, disk.ID, GrepQuery{Regexp: tt.regexp}, 100)
+			require.NoError(t, err)
+
+			var got []string
+			for _, a := range artifacts {
+				got = append(got, a.Filename)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
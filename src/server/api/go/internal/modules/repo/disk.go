@@ -2,11 +2,13 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Luminox/internal/modules/model"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -14,8 +16,20 @@ type DiskRepo interface {
 	Create(ctx context.Context, d *model.Disk) error
 	Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) error
 	ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]*model.Disk, error)
+	CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error)
+	ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error)
+	DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error
+	Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error)
+	RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) (int64, error)
+	RestorePaths(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) ([]string, error)
 }
 
+// ErrSnapshotNotFound is returned when cloning from a snapshot that does not belong to the disk
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// snapshotBatchSize bounds the rows per INSERT when copying whole disks
+const snapshotBatchSize = 500
+
 type diskRepo struct {
 	db                 *gorm.DB
 	assetReferenceRepo AssetReferenceRepo
@@ -38,18 +52,18 @@ func (r *diskRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.
 			return err
 		}
 
-		// Query all artifacts before deletion to collect asset meta for reference decrement
-		// Artifacts will be automatically deleted by CASCADE when disk is deleted
-		var artifacts []model.Artifact
-		if err := tx.Where("disk_id = ?", diskID).Find(&artifacts).Error; err != nil {
-			return fmt.Errorf("query artifacts: %w", err)
+		// Collect the assets of all artifacts, versions and snapshots for reference decrement
+		// They will be automatically deleted by CASCADE when disk is deleted
+		assets, err := diskAssets(tx, diskID)
+		if err != nil {
+			return err
 		}
-
-		// Collect asset meta from all artifacts for batch decrement
-		assets := make([]model.Asset, 0, len(artifacts))
-		for _, artifact := range artifacts {
-			asset := artifact.AssetMeta.Data()
-			if asset.SHA256 != "" {
+		var entries []model.DiskSnapshotEntry
+		if err := tx.Where("snapshot_id IN (?)", tx.Model(&model.DiskSnapshot{}).Select("id").Where("disk_id = ?", diskID)).Find(&entries).Error; err != nil {
+			return fmt.Errorf("query snapshot entries: %w", err)
+		}
+		for _, entry := range entries {
+			if asset := entry.AssetMeta.Data(); asset.SHA256 != "" {
 				assets = append(assets, asset)
 			}
 		}
@@ -104,3 +118,309 @@ func (r *diskRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, user
 	var disks []*model.Disk
 	return disks, q.Order(orderBy).Limit(limit).Find(&disks).Error
 }
+
+// diskAssets returns the assets referenced by the live artifacts of a disk and
+// their previous versions
+func diskAssets(tx *gorm.DB, diskID uuid.UUID) ([]model.Asset, error) {
+	var artifacts []model.Artifact
+	if err := tx.Where("disk_id = ?", diskID).Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("query artifacts: %w", err)
+	}
+
+	// Previous artifact versions hold references too
+	var versions []model.ArtifactVersion
+	if err := tx.Where("artifact_id IN (?)", tx.Model(&model.Artifact{}).Select("id").Where("disk_id = ?", diskID)).Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("query artifact versions: %w", err)
+	}
+
+	assets := make([]model.Asset, 0, len(artifacts)+len(versions))
+	for _, artifact := range artifacts {
+		if asset := artifact.AssetMeta.Data(); asset.SHA256 != "" {
+			assets = append(assets, asset)
+		}
+	}
+	for _, version := range versions {
+		if asset := version.AssetMeta.Data(); asset.SHA256 != "" {
+			assets = append(assets, asset)
+		}
+	}
+	return assets, nil
+}
+
+// CreateSnapshot records the current artifacts and directories of a disk
+func (r *diskRepo) CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error) {
+	var snapshot *model.DiskSnapshot
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var disk model.Disk
+		if err := tx.Where("id = ? AND project_id = ?", diskID, projectID).First(&disk).Error; err != nil {
+			return err
+		}
+
+		artifacts, dirs, err := liveContents(tx, diskID)
+		if err != nil {
+			return err
+		}
+
+		snapshot = &model.DiskSnapshot{
+			ProjectID:     projectID,
+			DiskID:        diskID,
+			ArtifactCount: len(artifacts),
+			Directories:   datatypes.NewJSONSlice(dirs),
+		}
+		if err := tx.Create(snapshot).Error; err != nil {
+			return fmt.Errorf("create snapshot: %w", err)
+		}
+		if len(artifacts) == 0 {
+			return nil
+		}
+
+		entries := make([]model.DiskSnapshotEntry, 0, len(artifacts))
+		assets := make([]model.Asset, 0, len(artifacts))
+		for _, a := range artifacts {
+			entries = append(entries, model.DiskSnapshotEntry{
+				SnapshotID: snapshot.ID,
+				Path:       a.Path,
+				Filename:   a.Filename,
+				Meta:       a.Meta,
+				AssetMeta:  a.AssetMeta,
+			})
+			assets = append(assets, a.AssetMeta.Data())
+		}
+		if err := tx.CreateInBatches(&entries, snapshotBatchSize).Error; err != nil {
+			return fmt.Errorf("create snapshot entries: %w", err)
+		}
+		if err := r.assetReferenceRepo.BatchIncrementAssetRefs(ctx, projectID, assets); err != nil {
+			return fmt.Errorf("increment asset references: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func (r *diskRepo) ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error) {
+	var snapshots []*model.DiskSnapshot
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND disk_id = ?", projectID, diskID).
+		Order("created_at DESC, id DESC").
+		Find(&snapshots).Error
+	return snapshots, err
+}
+
+// DeleteSnapshot deletes a snapshot and releases the assets it references
+func (r *diskRepo) DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var snapshot model.DiskSnapshot
+		if err := tx.Where("id = ? AND disk_id = ? AND project_id = ?", snapshotID, diskID, projectID).First(&snapshot).Error; err != nil {
+			return err
+		}
+
+		artifacts, err := snapshotContents(tx, &snapshot)
+		if err != nil {
+			return err
+		}
+
+		// Entries are deleted by CASCADE
+		if err := tx.Delete(&snapshot).Error; err != nil {
+			return fmt.Errorf("delete snapshot: %w", err)
+		}
+
+		if len(artifacts) > 0 {
+			if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, artifactAssets(artifacts)); err != nil {
+				return fmt.Errorf("decrement asset references: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Clone creates a new disk with the artifacts and directories of a snapshot, or
+// of the live disk when snapshotID is nil. The clone shares the assets of its
+// source, so no content is copied.
+func (r *diskRepo) Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error) {
+	var clone *model.Disk
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var disk model.Disk
+		if err := tx.Where("id = ? AND project_id = ?", diskID, projectID).First(&disk).Error; err != nil {
+			return err
+		}
+
+		var artifacts []model.Artifact
+		var dirs []string
+		if snapshotID != nil {
+			var snapshot model.DiskSnapshot
+			if err := tx.Where("id = ? AND disk_id = ?", *snapshotID, diskID).First(&snapshot).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrSnapshotNotFound
+				}
+				return err
+			}
+			var err error
+			if artifacts, err = snapshotContents(tx, &snapshot); err != nil {
+				return err
+			}
+			dirs = snapshot.Directories
+		} else {
+			var err error
+			if artifacts, dirs, err = liveContents(tx, diskID); err != nil {
+				return err
+			}
+		}
+
+		clone = &model.Disk{ProjectID: projectID, UserID: disk.UserID}
+		if err := tx.Create(clone).Error; err != nil {
+			return fmt.Errorf("create disk: %w", err)
+		}
+		return r.fillDisk(ctx, tx, projectID, clone.ID, artifacts, dirs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// RestoreSnapshot replaces the artifacts and directories of a disk with the
+// contents of one of its snapshots and returns the number of restored
+// artifacts. Version history of the replaced artifacts is dropped.
+func (r *diskRepo) RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) (int64, error) {
+	var restored int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var snapshot model.DiskSnapshot
+		if err := tx.Where("id = ? AND disk_id = ? AND project_id = ?", snapshotID, diskID, projectID).First(&snapshot).Error; err != nil {
+			return err
+		}
+		artifacts, err := snapshotContents(tx, &snapshot)
+		if err != nil {
+			return err
+		}
+
+		released, err := diskAssets(tx, diskID)
+		if err != nil {
+			return err
+		}
+		// Artifact versions are deleted by CASCADE
+		if err := tx.Where("disk_id = ?", diskID).Delete(&model.Artifact{}).Error; err != nil {
+			return fmt.Errorf("delete artifacts: %w", err)
+		}
+		if err := tx.Where("disk_id = ?", diskID).Delete(&model.Directory{}).Error; err != nil {
+			return fmt.Errorf("delete directories: %w", err)
+		}
+
+		// Take the new references before releasing the old ones, so assets
+		// shared by both sides never drop to zero
+		if err := r.fillDisk(ctx, tx, projectID, diskID, artifacts, snapshot.Directories); err != nil {
+			return err
+		}
+		if len(released) > 0 {
+			if err := r.assetReferenceRepo.BatchDecrementAssetRefs(ctx, projectID, released); err != nil {
+				return fmt.Errorf("decrement asset references: %w", err)
+			}
+		}
+
+		restored = int64(len(artifacts))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return restored, nil
+}
+
+// RestorePaths returns the full paths a restore of the snapshot would delete
+// or write: those of the current artifacts of the disk and of the snapshot's
+// entries. Paths may appear twice.
+func (r *diskRepo) RestorePaths(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) ([]string, error) {
+	db := r.db.WithContext(ctx)
+	var snapshot model.DiskSnapshot
+	if err := db.Where("id = ? AND disk_id = ? AND project_id = ?", snapshotID, diskID, projectID).First(&snapshot).Error; err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if err := db.Model(&model.Artifact{}).Where("disk_id = ?", diskID).Pluck("path || filename", &paths).Error; err != nil {
+		return nil, fmt.Errorf("query artifact paths: %w", err)
+	}
+	var entries []string
+	if err := db.Model(&model.DiskSnapshotEntry{}).Where("snapshot_id = ?", snapshot.ID).Pluck("path || filename", &entries).Error; err != nil {
+		return nil, fmt.Errorf("query snapshot entry paths: %w", err)
+	}
+	return append(paths, entries...), nil
+}
+
+// fillDisk inserts copies of artifacts and directories into a disk and takes a
+// reference on every asset
+func (r *diskRepo) fillDisk(ctx context.Context, tx *gorm.DB, projectID uuid.UUID, diskID uuid.UUID, artifacts []model.Artifact, dirs []string) error {
+	if len(artifacts) > 0 {
+		copies := make([]model.Artifact, 0, len(artifacts))
+		for _, a := range artifacts {
+			copies = append(copies, model.Artifact{
+				DiskID:    diskID,
+				Path:      a.Path,
+				Filename:  a.Filename,
+				Meta:      a.Meta,
+				AssetMeta: a.AssetMeta,
+				Version:   1,
+			})
+		}
+		if err := tx.CreateInBatches(&copies, snapshotBatchSize).Error; err != nil {
+			return fmt.Errorf("create artifacts: %w", err)
+		}
+		if err := r.assetReferenceRepo.BatchIncrementAssetRefs(ctx, projectID, artifactAssets(artifacts)); err != nil {
+			return fmt.Errorf("increment asset references: %w", err)
+		}
+	}
+
+	if len(dirs) > 0 {
+		newDirs := make([]model.Directory, 0, len(dirs))
+		for _, d := range dirs {
+			newDirs = append(newDirs, model.Directory{DiskID: diskID, Path: d})
+		}
+		if err := tx.CreateInBatches(&newDirs, snapshotBatchSize).Error; err != nil {
+			return fmt.Errorf("create directories: %w", err)
+		}
+	}
+	return nil
+}
+
+// liveContents returns the current artifacts and explicit directory paths of a disk
+func liveContents(tx *gorm.DB, diskID uuid.UUID) ([]model.Artifact, []string, error) {
+	var artifacts []model.Artifact
+	if err := tx.Where("disk_id = ?", diskID).Order("path, filename").Find(&artifacts).Error; err != nil {
+		return nil, nil, fmt.Errorf("query artifacts: %w", err)
+	}
+	var dirs []string
+	if err := tx.Model(&model.Directory{}).Where("disk_id = ?", diskID).Order("path").Pluck("path", &dirs).Error; err != nil {
+		return nil, nil, fmt.Errorf("query directories: %w", err)
+	}
+	return artifacts, dirs, nil
+}
+
+// snapshotContents returns the entries of a snapshot as artifacts without a disk
+func snapshotContents(tx *gorm.DB, snapshot *model.DiskSnapshot) ([]model.Artifact, error) {
+	var entries []model.DiskSnapshotEntry
+	if err := tx.Where("snapshot_id = ?", snapshot.ID).Order("path, filename").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("query snapshot entries: %w", err)
+	}
+	artifacts := make([]model.Artifact, 0, len(entries))
+	for _, e := range entries {
+		artifacts = append(artifacts, model.Artifact{
+			Path:      e.Path,
+			Filename:  e.Filename,
+			Meta:      e.Meta,
+			AssetMeta: e.AssetMeta,
+		})
+	}
+	return artifacts, nil
+}
+
+func artifactAssets(artifacts []model.Artifact) []model.Asset {
+	assets := make([]model.Asset, 0, len(artifacts))
+	for _, a := range artifacts {
+		if asset := a.AssetMeta.Data(); asset.SHA256 != "" {
+			assets = append(assets, asset)
+		}
+	}
+	return assets
+}
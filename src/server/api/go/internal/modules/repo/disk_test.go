@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func TestDiskRepo_Snapshots(t *testing.T) {
+	db := setupArtifactTestDB(t)
+	ctx := context.Background()
+
+	project := &model.Project{ID: uuid.New(), SecretKeyHMAC: uuid.NewString(), SecretKeyHashPHC: uuid.NewString()}
+	require.NoError(t, db.Create(project).Error)
+	defer db.Exec("DELETE FROM projects WHERE id = ?", project.ID)
+
+	disk := &model.Disk{ProjectID: project.ID}
+	require.NoError(t, db.Create(disk).Error)
+
+	refs := &countingAssetRefs{refs: map[string]int{}}
+	artifacts := NewArtifactRepo(db, refs)
+	r := NewDiskRepo(db, refs)
+
+	create := func(p, filename, sha string) {
+		require.NoError(t, artifacts.Create(ctx, project.ID, &model.Artifact{
+			DiskID:    disk.ID,
+			Path:      p,
+			Filename:  filename,
+			AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/" + sha, SHA256: sha}),
+			Version:   1,
+		}))
+	}
+	create("/", "a.txt", "sha-a")
+	create("/src/", "b.txt", "sha-b")
+	require.NoError(t, artifacts.CreateDirectory(ctx, disk.ID, "/empty/"))
+
+	snapshot, err := r.CreateSnapshot(ctx, project.ID, disk.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, snapshot.ArtifactCount)
+	assert.Equal(t, []string{"/empty/"}, []string(snapshot.Directories))
+	assert.Equal(t, 2, refs.refs["sha-a"])
+
+	// Change the disk after the snapshot
+	_, err = artifacts.DeleteDirectory(ctx, project.ID, disk.ID, "/src/", true)
+	require.NoError(t, err)
+	create("/", "c.txt", "sha-c")
+	assert.Equal(t, 1, refs.refs["sha-b"])
+
+	t.Run("clone snapshot", func(t *testing.T) {
+		clone, err := r.Clone(ctx, project.ID, disk.ID, &snapshot.ID)
+		require.NoError(t, err)
+		assert.NotEqual(t, disk.ID, clone.ID)
+
+		_, err = artifacts.GetByPath(ctx, clone.ID, "/src/", "b.txt")
+		assert.NoError(t, err)
+		_, err = artifacts.GetByPath(ctx, clone.ID, "/", "c.txt")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		assert.Equal(t, 2, refs.refs["sha-b"])
+
+		require.NoError(t, r.Delete(ctx, project.ID, clone.ID))
+		assert.Equal(t, 1, refs.refs["sha-b"])
+	})
+
+	t.Run("clone from another disk's snapshot", func(t *testing.T) {
+		_, err := r.Clone(ctx, project.ID, uuid.New(), &snapshot.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("restore paths", func(t *testing.T) {
+		paths, err := r.RestorePaths(ctx, project.ID, disk.ID, snapshot.ID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"/a.txt", "/c.txt", "/a.txt", "/src/b.txt"}, paths)
+
+		_, err = r.RestorePaths(ctx, project.ID, disk.ID, uuid.New())
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("restore snapshot", func(t *testing.T) {
+		count, err := r.RestoreSnapshot(ctx, project.ID, disk.ID, snapshot.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+
+		_, err = artifacts.GetByPath(ctx, disk.ID, "/src/", "b.txt")
+		assert.NoError(t, err)
+		_, err = artifacts.GetByPath(ctx, disk.ID, "/", "c.txt")
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+		assert.Equal(t, 0, refs.refs["sha-c"])
+		assert.Equal(t, 2, refs.refs["sha-a"])
+		assert.Equal(t, 2, refs.refs["sha-b"])
+	})
+
+	t.Run("delete disk releases snapshots", func(t *testing.T) {
+		require.NoError(t, r.Delete(ctx, project.ID, disk.ID))
+		assert.Equal(t, 0, refs.refs["sha-a"])
+		assert.Equal(t, 0, refs.refs["sha-b"])
+	})
+}
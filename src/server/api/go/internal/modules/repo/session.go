@@ -2,7 +2,7 @@ package repo
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -15,18 +15,51 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+// ErrAppendConflict is returned when an AppendPrecondition no longer holds
+// because another writer appended to the session in the meantime
+var ErrAppendConflict = errors.New("session has new messages since the expected last message")
+
+// AppendPrecondition guards a message append against concurrent writers.
+// Nil fields are not checked.
+type AppendPrecondition struct {
+	// LastMessageID is the expected latest message; uuid.Nil expects an empty session
+	LastMessageID *uuid.UUID
+	// LastSeq is the expected seq of the latest message; 0 expects an empty session
+	LastSeq *int64
+	// GeminiCallIDs are the pending Gemini calls answered by the message. They
+	// must still be pending and are consumed along with the insert.
+	GeminiCallIDs []string
+}
+
 type SessionRepo interface {
 	Create(ctx context.Context, s *model.Session) error
 	Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error
 	Update(ctx context.Context, s *model.Session) error
 	Get(ctx context.Context, s *model.Session) (*model.Session, error)
+	GetWithSpaceAndProject(ctx context.Context, sessionID uuid.UUID) (*model.Session, error)
 	GetDisableTaskTracking(ctx context.Context, sessionID uuid.UUID) (bool, error)
-	ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error)
-	CreateMessageWithAssets(ctx context.Context, msg *model.Message) error
-	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error)
-	ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
+	ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, spaceID *uuid.UUID, notConnected bool, parentSessionID *uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error)
+	CreateMessageWithAssets(ctx context.Context, msg *model.Message, cond AppendPrecondition) error
+	ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, agentNames []string, afterSeq int64, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error)
+	ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID, agentNames []string) ([]model.Message, error)
 	GetObservingStatus(ctx context.Context, sessionID string) (*model.MessageObservingStatus, error)
-	PopGeminiCallIDAndName(ctx context.Context, sessionID uuid.UUID) (string, string, error)
+	ResolveGeminiCalls(ctx context.Context, sessionID uuid.UUID, responses []GeminiFunctionResponse) ([]string, error)
+	SetMessageProtected(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, protected bool) error
+	BindDisk(ctx context.Context, sessionID uuid.UUID, diskID uuid.UUID) (uuid.UUID, error)
+	GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error)
+	ListChildren(ctx context.Context, projectID uuid.UUID, parentSessionIDs []uuid.UUID) ([]model.Session, error)
+	UpsertCheckpoint(ctx context.Context, cp *model.Checkpoint) error
+	GetCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) (*model.Checkpoint, error)
+	ListCheckpoints(ctx context.Context, sessionID uuid.UUID) ([]model.Checkpoint, error)
+	DeleteCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) error
+	CreateTools(ctx context.Context, tools *model.SessionTools) error
+	FindToolCallIDs(ctx context.Context, sessionID uuid.UUID, ids []string) ([]string, error)
+	ListMessagesWithoutToolCallIDs(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
+	SetToolCallIDs(ctx context.Context, messageID uuid.UUID, ids []string) error
+	RepairMessages(ctx context.Context, sessionID uuid.UUID, lastSeq int64, repair MessageRepair) error
+	ListToolReferences(ctx context.Context, projectID uuid.UUID, names []string) ([]model.ToolReference, error)
+	GetTools(ctx context.Context, sessionID uuid.UUID, version int) (*model.SessionTools, error)
+	ListTools(ctx context.Context, sessionID uuid.UUID) ([]model.SessionTools, error)
 }
 
 type sessionRepo struct {
@@ -117,6 +150,43 @@ func (r *sessionRepo) Get(ctx context.Context, s *model.Session) (*model.Session
 	return s, r.db.WithContext(ctx).Where(&model.Session{ID: s.ID}).First(s).Error
 }
 
+// BindDisk binds a disk to a session that has none yet and returns the disk
+// actually bound to the session, which differs from diskID when a concurrent
+// request bound another disk first
+func (r *sessionRepo) BindDisk(ctx context.Context, sessionID uuid.UUID, diskID uuid.UUID) (uuid.UUID, error) {
+	res := r.db.WithContext(ctx).Model(&model.Session{}).
+		Where("id = ? AND disk_id IS NULL", sessionID).
+		Update("disk_id", diskID)
+	if res.Error != nil {
+		return uuid.Nil, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return diskID, nil
+	}
+
+	var session model.Session
+	if err := r.db.WithContext(ctx).Select("disk_id").Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return uuid.Nil, err
+	}
+	if session.DiskID == nil {
+		return uuid.Nil, fmt.Errorf("bind disk to session %s", sessionID)
+	}
+	return *session.DiskID, nil
+}
+
+// GetWithSpaceAndProject loads a session together with its space (if any) and project
+func (r *sessionRepo) GetWithSpaceAndProject(ctx context.Context, sessionID uuid.UUID) (*model.Session, error) {
+	var session model.Session
+	if err := r.db.WithContext(ctx).
+		Preload("Space").
+		Preload("Project").
+		Where(&model.Session{ID: sessionID}).
+		First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
 func (r *sessionRepo) GetDisableTaskTracking(ctx context.Context, sessionID uuid.UUID) (bool, error) {
 	var result struct {
 		DisableTaskTracking bool
@@ -128,7 +198,7 @@ func (r *sessionRepo) GetDisableTaskTracking(ctx context.Context, sessionID uuid
 	return result.DisableTaskTracking, err
 }
 
-func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
+func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, spaceID *uuid.UUID, notConnected bool, parentSessionID *uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
 	q := r.db.WithContext(ctx).Where("sessions.project_id = ?", projectID)
 
 	// Filter by user identifier if provided
@@ -143,6 +213,10 @@ func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, u
 		q = q.Where("sessions.space_id = ?", spaceID)
 	}
 
+	if parentSessionID != nil {
+		q = q.Where("sessions.parent_session_id = ?", parentSessionID)
+	}
+
 	// Apply cursor-based pagination filter if cursor is provided
 	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
 		// Determine comparison operator based on sort direction
@@ -166,14 +240,41 @@ func (r *sessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, u
 	return sessions, q.Order(orderBy).Limit(limit).Find(&sessions).Error
 }
 
-func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message) error {
+// CreateMessageWithAssets stores a message with the next seq of its session.
+// Bumping the session counter locks the session row, so concurrent stores to
+// the same session are serialized and get strictly increasing seqs. If cond
+// does not hold once the lock is taken, nothing is stored and an error
+// wrapping ErrAppendConflict is returned.
+func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message, cond AppendPrecondition) error {
 	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var seq int64
+		res := tx.Raw("UPDATE sessions SET last_message_seq = last_message_seq + 1 WHERE id = ? RETURNING last_message_seq", msg.SessionID).Scan(&seq)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		msg.Seq = seq
+
 		// First get the message parent id in session
 		parent := model.Message{}
-		if err := tx.Where(&model.Message{SessionID: msg.SessionID}).Order("created_at desc").Limit(1).Find(&parent).Error; err == nil {
+		if err := tx.Where(&model.Message{SessionID: msg.SessionID}).Order("seq DESC, created_at DESC, id DESC").Limit(1).Find(&parent).Error; err == nil {
 			if parent.ID != uuid.Nil {
 				msg.ParentID = &parent.ID
 			}
+		} else if cond.LastMessageID != nil {
+			return err
+		}
+
+		if (cond.LastSeq != nil && *cond.LastSeq != seq-1) || (cond.LastMessageID != nil && *cond.LastMessageID != parent.ID) {
+			return fmt.Errorf("%w: last message is %s (seq %d)", ErrAppendConflict, parent.ID, seq-1)
+		}
+
+		if len(cond.GeminiCallIDs) > 0 {
+			if err := consumeGeminiCalls(tx, msg.SessionID, cond.GeminiCallIDs); err != nil {
+				return err
+			}
 		}
 
 		// Create message
@@ -185,35 +286,152 @@ func (r *sessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Me
 	})
 }
 
-func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
+// MessageRepair lists the message changes of a session repair
+type MessageRepair struct {
+	// Update rewrites the parts asset, tool call ids and meta of existing messages
+	Update []model.Message
+	// Insert adds messages with the given CreatedAt and ParentID; each takes the
+	// seq right after ParentID, and the message that followed ParentID is
+	// re-linked to the inserted message
+	Insert []model.Message
+	// Delete removes messages; their children and checkpoints move to their parent
+	Delete []uuid.UUID
+}
+
+// RepairMessages applies a repair in one transaction, provided no message was
+// appended to the session after lastSeq. Otherwise an error wrapping
+// ErrAppendConflict is returned and nothing is changed.
+func (r *sessionRepo) RepairMessages(ctx context.Context, sessionID uuid.UUID, lastSeq int64, repair MessageRepair) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locks the session row, so appends wait until the repair commits
+		res := tx.Exec("UPDATE sessions SET last_message_seq = last_message_seq WHERE id = ? AND last_message_seq = ?", sessionID, lastSeq)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return fmt.Errorf("%w: messages were appended during the repair", ErrAppendConflict)
+		}
+
+		for _, msg := range repair.Update {
+			if err := tx.Model(&model.Message{}).
+				Where("id = ? AND session_id = ?", msg.ID, sessionID).
+				Updates(map[string]interface{}{
+					"parts_asset_meta": msg.PartsAssetMeta,
+					"tool_call_ids":    msg.ToolCallIDs,
+					"meta":             msg.Meta,
+				}).Error; err != nil {
+				return fmt.Errorf("update message %s: %w", msg.ID, err)
+			}
+		}
+
+		for _, id := range repair.Delete {
+			// Read the parent from the table, earlier deletes may have changed it
+			var msg model.Message
+			if err := tx.Select("id", "parent_id").Where("id = ? AND session_id = ?", id, sessionID).First(&msg).Error; err != nil {
+				return fmt.Errorf("get message %s: %w", id, err)
+			}
+			if err := tx.Model(&model.Message{}).Where("parent_id = ?", id).Update("parent_id", msg.ParentID).Error; err != nil {
+				return fmt.Errorf("re-link children of message %s: %w", id, err)
+			}
+			if msg.ParentID != nil {
+				if err := tx.Model(&model.Checkpoint{}).Where("message_id = ?", id).Update("message_id", *msg.ParentID).Error; err != nil {
+					return fmt.Errorf("move checkpoints of message %s: %w", id, err)
+				}
+			}
+			if err := tx.Delete(&model.Message{}, "id = ?", id).Error; err != nil {
+				return fmt.Errorf("delete message %s: %w", id, err)
+			}
+		}
+
+		// Inserted messages draw new seqs from the session counter: the messages
+		// after the parent move up by one, so the counter moves up by one too
+		last := lastSeq
+		for i := range repair.Insert {
+			msg := &repair.Insert[i]
+			msg.SessionID = sessionID
+			last++
+			msg.Seq = last
+			if msg.ParentID != nil {
+				var parent model.Message
+				if err := tx.Select("seq").Where("id = ? AND session_id = ?", *msg.ParentID, sessionID).First(&parent).Error; err != nil {
+					return fmt.Errorf("get message %s: %w", *msg.ParentID, err)
+				}
+				if err := tx.Model(&model.Message{}).
+					Where("session_id = ? AND seq > ?", sessionID, parent.Seq).
+					Update("seq", gorm.Expr("seq + 1")).Error; err != nil {
+					return fmt.Errorf("shift messages after %s: %w", *msg.ParentID, err)
+				}
+				msg.Seq = parent.Seq + 1
+			}
+			if err := tx.Create(msg).Error; err != nil {
+				return fmt.Errorf("insert message: %w", err)
+			}
+			if msg.ParentID != nil {
+				if err := tx.Model(&model.Message{}).
+					Where("session_id = ? AND parent_id = ? AND id <> ?", sessionID, *msg.ParentID, msg.ID).
+					Update("parent_id", msg.ID).Error; err != nil {
+					return fmt.Errorf("re-link message after %s: %w", msg.ID, err)
+				}
+			}
+		}
+		if last != lastSeq {
+			if err := tx.Model(&model.Session{}).Where("id = ?", sessionID).Update("last_message_seq", last).Error; err != nil {
+				return fmt.Errorf("update last message seq: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// ListBySessionWithCursor lists the messages of a session after the cursor
+// (afterSeq, afterCreatedAt, afterID), in seq order. A negative afterSeq marks
+// a cursor issued before messages had a seq, paged in (created_at, id) order.
+func (r *sessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, agentNames []string, afterSeq int64, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
 	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
+	if len(agentNames) > 0 {
+		q = q.Where("agent_name IN ?", agentNames)
+	}
+
+	// Cursors issued before messages had a seq page by (created_at, id)
+	legacy := afterID != uuid.Nil && afterSeq < 0
 
 	// Apply cursor-based pagination filter if cursor is provided
-	if !afterCreatedAt.IsZero() && afterID != uuid.Nil {
+	if afterID != uuid.Nil {
 		// Determine comparison operator based on sort direction
 		comparisonOp := ">"
 		if timeDesc {
 			comparisonOp = "<"
 		}
-		q = q.Where(
-			"(created_at "+comparisonOp+" ?) OR (created_at = ? AND id "+comparisonOp+" ?)",
-			afterCreatedAt, afterCreatedAt, afterID,
-		)
+		if legacy {
+			q = q.Where("(created_at, id) "+comparisonOp+" (?, ?)", afterCreatedAt, afterID)
+		} else {
+			q = q.Where("(seq, created_at, id) "+comparisonOp+" (?, ?, ?)", afterSeq, afterCreatedAt, afterID)
+		}
 	}
 
 	// Apply ordering based on sort direction
-	orderBy := "created_at ASC, id ASC"
+	direction := "ASC"
 	if timeDesc {
-		orderBy = "created_at DESC, id DESC"
+		direction = "DESC"
+	}
+	orderBy := fmt.Sprintf("seq %[1]s, created_at %[1]s, id %[1]s", direction)
+	if legacy {
+		orderBy = fmt.Sprintf("created_at %[1]s, id %[1]s", direction)
 	}
 
 	var items []model.Message
 	return items, q.Order(orderBy).Limit(limit).Find(&items).Error
 }
 
-func (r *sessionRepo) ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
+func (r *sessionRepo) ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID, agentNames []string) ([]model.Message, error) {
+	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
+	if len(agentNames) > 0 {
+		q = q.Where("agent_name IN ?", agentNames)
+	}
+
 	var messages []model.Message
-	err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).Find(&messages).Error
+	err := q.Order("seq ASC, created_at ASC, id ASC").Find(&messages).Error
 	return messages, err
 }
 
@@ -270,123 +488,371 @@ func (r *sessionRepo) GetObservingStatus(
 	return status, nil
 }
 
-// PopGeminiCallIDAndName pops the first call {id, name} pair from the earliest message in the session that has call info.
-// Uses row-level locking to ensure thread safety. Returns the popped ID, name, or an error if none available.
-// This method is used to match FunctionResponse with FunctionCall by name first, then handle ID validation/assignment.
-func (r *sessionRepo) PopGeminiCallIDAndName(ctx context.Context, sessionID uuid.UUID) (string, string, error) {
-	var poppedID string
-	var poppedName string
+// GeminiFunctionResponse identifies the function call a Gemini FunctionResponse
+// answers: by name, and by id when the response carries one
+type GeminiFunctionResponse struct {
+	Name string
+	ID   string
+}
+
+var (
+	// ErrGeminiCallNotFound is returned when no pending function call matches a response
+	ErrGeminiCallNotFound = errors.New("no pending Gemini function call matches the response")
+	// ErrGeminiCallAmbiguous is returned when a response without id could answer
+	// several pending calls of the same name
+	ErrGeminiCallAmbiguous = errors.New("ambiguous Gemini function response")
+)
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Find the earliest message with call IDs, using row-level locking
-		var msg model.Message
-		keyPath := fmt.Sprintf("meta->>'%s'", model.GeminiCallInfoKey)
-		arrayPath := fmt.Sprintf("meta->'%s'", model.GeminiCallInfoKey)
-
-		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-			Where("session_id = ?", sessionID).
-			Where(keyPath + " IS NOT NULL").
-			Where(fmt.Sprintf("jsonb_array_length(%s) > 0", arrayPath)).
-			Order("created_at ASC, id ASC").
-			Limit(1).
-			First(&msg).Error
-
-		if err != nil {
-			if err == gorm.ErrRecordNotFound {
-				return fmt.Errorf("no available Gemini call info in session")
+// pendingGeminiCall is an entry of the call info of a message
+type pendingGeminiCall struct {
+	msg  int
+	ID   string
+	Name string
+}
+
+// ResolveGeminiCalls matches the function responses of one message with the
+// pending Gemini call info of the session and returns the call id answered by
+// each response. Nothing is consumed here: the calls are consumed when the
+// answering message is stored, see AppendPrecondition.GeminiCallIDs.
+//
+// A response with an id answers the pending call of that id. Responses without
+// id are matched by name over every pending call, so parallel calls can be
+// answered in any order or batched in one message. Several pending calls of the
+// same name can only be answered without ids when the message answers all of
+// them; they are then matched in call order.
+func (r *sessionRepo) ResolveGeminiCalls(ctx context.Context, sessionID uuid.UUID, responses []GeminiFunctionResponse) ([]string, error) {
+	_, pending, err := pendingGeminiCalls(r.db.WithContext(ctx), sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, err := matchGeminiCalls(pending, responses)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(matched))
+	for i, k := range matched {
+		ids[i] = pending[k].ID
+	}
+	return ids, nil
+}
+
+// pendingGeminiCalls returns the messages of a session holding pending call
+// info, locked for update, along with their calls in call order
+func pendingGeminiCalls(tx *gorm.DB, sessionID uuid.UUID) ([]model.Message, []pendingGeminiCall, error) {
+	var msgs []model.Message
+	arrayPath := fmt.Sprintf("meta->'%s'", model.GeminiCallInfoKey)
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("session_id = ?", sessionID).
+		Where(fmt.Sprintf("jsonb_typeof(%s) = 'array' AND jsonb_array_length(%s) > 0", arrayPath, arrayPath)).
+		Order("seq ASC, created_at ASC, id ASC").
+		Find(&msgs).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to query messages with call info: %w", err)
+	}
+
+	var pending []pendingGeminiCall
+	for i, msg := range msgs {
+		calls, _ := msg.Meta.Data()[model.GeminiCallInfoKey].([]interface{})
+		for _, c := range calls {
+			info, _ := c.(map[string]interface{})
+			id, _ := info["id"].(string)
+			name, _ := info["name"].(string)
+			if id == "" || name == "" {
+				continue
 			}
-			return fmt.Errorf("failed to query message with call info: %w", err)
+			pending = append(pending, pendingGeminiCall{msg: i, ID: id, Name: name})
 		}
+	}
+	return msgs, pending, nil
+}
 
-		// Get current meta
-		meta := msg.Meta.Data()
-		if meta == nil {
-			return fmt.Errorf("message meta is nil")
-		}
+// consumeGeminiCalls removes the calls of the given ids from the pending call
+// info of a session. It fails with ErrGeminiCallNotFound if one of them is no
+// longer pending, e.g. because another message answered it in the meantime.
+func consumeGeminiCalls(tx *gorm.DB, sessionID uuid.UUID, ids []string) error {
+	msgs, pending, err := pendingGeminiCalls(tx, sessionID)
+	if err != nil {
+		return err
+	}
 
-		// Get the call info array (contains {id, name} objects)
-		callsRaw, exists := meta[model.GeminiCallInfoKey]
-		if !exists {
-			return fmt.Errorf("call info key not found in message meta")
+	consumed := map[int]map[string]bool{}
+	for _, id := range ids {
+		k := -1
+		for j, call := range pending {
+			if call.ID == id && !consumed[call.msg][id] {
+				k = j
+				break
+			}
+		}
+		if k < 0 {
+			return fmt.Errorf("%w: call '%s' is no longer pending", ErrGeminiCallNotFound, id)
 		}
+		if consumed[pending[k].msg] == nil {
+			consumed[pending[k].msg] = map[string]bool{}
+		}
+		consumed[pending[k].msg][id] = true
+	}
 
-		// Convert to []interface{} (array of {id, name} objects)
-		callsInterface, ok := callsRaw.([]interface{})
-		if !ok {
-			// Try to unmarshal if it's a JSON string
-			var calls []map[string]interface{}
-			if callsBytes, err := json.Marshal(callsRaw); err == nil {
-				if err := json.Unmarshal(callsBytes, &calls); err == nil {
-					if len(calls) == 0 {
-						return fmt.Errorf("call info array is empty")
-					}
-					// Pop first call
-					firstCall := calls[0]
-					if id, ok := firstCall["id"].(string); ok {
-						poppedID = id
-					} else {
-						return fmt.Errorf("call ID is not a string")
-					}
-					if name, ok := firstCall["name"].(string); ok {
-						poppedName = name
-					} else {
-						return fmt.Errorf("call name is not a string")
-					}
-					calls = calls[1:]
+	for i, done := range consumed {
+		meta := msgs[i].Meta.Data()
+		calls, _ := meta[model.GeminiCallInfoKey].([]interface{})
+		remaining := make([]interface{}, 0, len(calls))
+		for _, c := range calls {
+			info, _ := c.(map[string]interface{})
+			if id, _ := info["id"].(string); !done[id] {
+				remaining = append(remaining, c)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(meta, model.GeminiCallInfoKey)
+		} else {
+			meta[model.GeminiCallInfoKey] = remaining
+		}
+		if err := tx.Model(&msgs[i]).Update("meta", datatypes.NewJSONType(meta)).Error; err != nil {
+			return fmt.Errorf("failed to update call info: %w", err)
+		}
+	}
+	return nil
+}
 
-					// Update or delete the key
-					if len(calls) == 0 {
-						delete(meta, model.GeminiCallInfoKey)
-					} else {
-						meta[model.GeminiCallInfoKey] = calls
-					}
+// matchGeminiCalls returns, for each response, the index of the pending call it answers
+func matchGeminiCalls(pending []pendingGeminiCall, responses []GeminiFunctionResponse) ([]int, error) {
+	matched := make([]int, len(responses))
+	used := make([]bool, len(pending))
 
-					// Update the message
-					return tx.Model(&msg).Update("meta", datatypes.NewJSONType(meta)).Error
-				}
+	// Responses with an id first, so that id-less responses only compete for the rest
+	for i, resp := range responses {
+		if resp.ID == "" {
+			continue
+		}
+		k := -1
+		for j, call := range pending {
+			if !used[j] && call.ID == resp.ID {
+				k = j
+				break
 			}
-			return fmt.Errorf("invalid call info format in message meta")
 		}
-
-		if len(callsInterface) == 0 {
-			return fmt.Errorf("call info array is empty")
+		if k < 0 {
+			return nil, fmt.Errorf("%w: no pending call with id '%s'", ErrGeminiCallNotFound, resp.ID)
 		}
+		if pending[k].Name != resp.Name {
+			return nil, fmt.Errorf("function name mismatch: response name '%s' does not match call name '%s' of call '%s'", resp.Name, pending[k].Name, resp.ID)
+		}
+		used[k] = true
+		matched[i] = k
+	}
 
-		// Pop the first call object
-		firstCallRaw, ok := callsInterface[0].(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("call info is not an object")
+	var names []string
+	byName := map[string][]int{}
+	for i, resp := range responses {
+		if resp.ID != "" {
+			continue
 		}
+		if _, ok := byName[resp.Name]; !ok {
+			names = append(names, resp.Name)
+		}
+		byName[resp.Name] = append(byName[resp.Name], i)
+	}
 
-		// Extract ID and name
-		if id, ok := firstCallRaw["id"].(string); ok {
-			poppedID = id
-		} else {
-			return fmt.Errorf("call ID is not a string")
+	for _, name := range names {
+		var candidates []int
+		for j, call := range pending {
+			if !used[j] && call.Name == name {
+				candidates = append(candidates, j)
+			}
 		}
-		if name, ok := firstCallRaw["name"].(string); ok {
-			poppedName = name
-		} else {
-			return fmt.Errorf("call name is not a string")
+		answers := byName[name]
+		switch {
+		case len(candidates) == 0:
+			return nil, fmt.Errorf("%w: no pending call named '%s'", ErrGeminiCallNotFound, name)
+		case len(answers) > len(candidates):
+			return nil, fmt.Errorf("%w: %d responses named '%s' but %d pending calls", ErrGeminiCallNotFound, len(answers), name, len(candidates))
+		case len(answers) < len(candidates):
+			return nil, fmt.Errorf("%w: %d pending calls named '%s' for %d responses; set the FunctionResponse id", ErrGeminiCallAmbiguous, len(candidates), name, len(answers))
+		}
+		for n, i := range answers {
+			used[candidates[n]] = true
+			matched[i] = candidates[n]
 		}
+	}
 
-		// Remove first element
-		remainingCalls := callsInterface[1:]
+	return matched, nil
+}
 
-		// Update or delete the key
-		if len(remainingCalls) == 0 {
-			delete(meta, model.GeminiCallInfoKey)
+// SetMessageProtected sets or clears the protected flag in a message's metadata.
+// Returns gorm.ErrRecordNotFound if the message does not belong to the session.
+func (r *sessionRepo) SetMessageProtected(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, protected bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var msg model.Message
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND session_id = ?", messageID, sessionID).
+			First(&msg).Error; err != nil {
+			return err
+		}
+
+		meta := msg.Meta.Data()
+		if meta == nil {
+			meta = make(map[string]any)
+		}
+		if protected {
+			meta[model.MessageProtectedKey] = true
 		} else {
-			meta[model.GeminiCallInfoKey] = remainingCalls
+			delete(meta, model.MessageProtectedKey)
 		}
 
-		// Update the message
 		return tx.Model(&msg).Update("meta", datatypes.NewJSONType(meta)).Error
 	})
+}
 
-	if err != nil {
-		return "", "", err
+// GetMessage returns a message of a session without loading its parts.
+// Returns gorm.ErrRecordNotFound if the message does not belong to the session.
+func (r *sessionRepo) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	var msg model.Message
+	if err := r.db.WithContext(ctx).Where("id = ? AND session_id = ?", messageID, sessionID).First(&msg).Error; err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// ListChildren returns the sub-agent sessions of any of the given parent
+// sessions, oldest first
+func (r *sessionRepo) ListChildren(ctx context.Context, projectID uuid.UUID, parentSessionIDs []uuid.UUID) ([]model.Session, error) {
+	var sessions []model.Session
+	if len(parentSessionIDs) == 0 {
+		return sessions, nil
+	}
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND parent_session_id IN ?", projectID, parentSessionIDs).
+		Order("created_at ASC, id ASC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// UpsertCheckpoint creates a checkpoint, or moves the existing checkpoint with
+// the same name in the session to the new message and description
+func (r *sessionRepo) UpsertCheckpoint(ctx context.Context, cp *model.Checkpoint) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"message_id", "description", "updated_at"}),
+	}).Create(cp).Error
+}
+
+// GetCheckpoint returns a checkpoint of a session by name
+func (r *sessionRepo) GetCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) (*model.Checkpoint, error) {
+	var cp model.Checkpoint
+	if err := r.db.WithContext(ctx).Where("session_id = ? AND name = ?", sessionID, name).First(&cp).Error; err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// ListCheckpoints returns the checkpoints of a session, oldest first
+func (r *sessionRepo) ListCheckpoints(ctx context.Context, sessionID uuid.UUID) ([]model.Checkpoint, error) {
+	var checkpoints []model.Checkpoint
+	err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("created_at ASC, name ASC").Find(&checkpoints).Error
+	return checkpoints, err
+}
+
+// DeleteCheckpoint deletes a checkpoint of a session by name.
+// Returns gorm.ErrRecordNotFound if there is no such checkpoint.
+func (r *sessionRepo) DeleteCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) error {
+	res := r.db.WithContext(ctx).Where("session_id = ? AND name = ?", sessionID, name).Delete(&model.Checkpoint{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// CreateTools stores tool definitions as the next version of the session's
+// tools and sets tools.Version. The session row is locked so that concurrent
+// updates get distinct versions.
+func (r *sessionRepo) CreateTools(ctx context.Context, tools *model.SessionTools) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session model.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", tools.SessionID).First(&session).Error; err != nil {
+			return err
+		}
+
+		var latest int
+		if err := tx.Model(&model.SessionTools{}).Where("session_id = ?", tools.SessionID).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+		tools.Version = latest + 1
+
+		return tx.Create(tools).Error
+	})
+}
+
+// GetTools returns a version of the session's tool definitions, or the latest
+// version if version is 0
+func (r *sessionRepo) GetTools(ctx context.Context, sessionID uuid.UUID, version int) (*model.SessionTools, error) {
+	q := r.db.WithContext(ctx).Where("session_id = ?", sessionID)
+	if version > 0 {
+		q = q.Where("version = ?", version)
+	}
+
+	var tools model.SessionTools
+	if err := q.Order("version DESC").First(&tools).Error; err != nil {
+		return nil, err
+	}
+	return &tools, nil
+}
+
+// ListTools returns every version of the session's tool definitions, oldest first
+func (r *sessionRepo) ListTools(ctx context.Context, sessionID uuid.UUID) ([]model.SessionTools, error) {
+	var tools []model.SessionTools
+	err := r.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("version ASC").Find(&tools).Error
+	return tools, err
+}
+
+// FindToolCallIDs returns the subset of ids that are tool call ids of messages
+// already stored in the session
+func (r *sessionRepo) FindToolCallIDs(ctx context.Context, sessionID uuid.UUID, ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var found []string
+	err := r.db.WithContext(ctx).
+		Table("messages, jsonb_array_elements_text(messages.tool_call_ids) AS call_id").
+		Where("messages.session_id = ? AND call_id IN ?", sessionID, ids).
+		Distinct().
+		Pluck("call_id", &found).Error
+	return found, err
+}
+
+// ListMessagesWithoutToolCallIDs returns the messages of a session stored
+// before tool call ids were recorded on insert
+func (r *sessionRepo) ListMessagesWithoutToolCallIDs(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
+	var msgs []model.Message
+	err := r.db.WithContext(ctx).
+		Where("session_id = ? AND tool_call_ids IS NULL", sessionID).
+		Order("seq ASC, created_at ASC, id ASC").
+		Find(&msgs).Error
+	return msgs, err
+}
+
+// SetToolCallIDs records the tool call ids of a message
+func (r *sessionRepo) SetToolCallIDs(ctx context.Context, messageID uuid.UUID, ids []string) error {
+	if ids == nil {
+		ids = []string{}
+	}
+	return r.db.WithContext(ctx).Model(&model.Message{}).
+		Where("id = ?", messageID).
+		Update("tool_call_ids", datatypes.JSONSlice[string](ids)).Error
+}
+
+// ListToolReferences returns the tool references of a project with the given names
+func (r *sessionRepo) ListToolReferences(ctx context.Context, projectID uuid.UUID, names []string) ([]model.ToolReference, error) {
+	if len(names) == 0 {
+		return nil, nil
 	}
 
-	return poppedID, poppedName, nil
+	var refs []model.ToolReference
+	err := r.db.WithContext(ctx).Where("project_id = ? AND name IN ?", projectID, names).Find(&refs).Error
+	return refs, err
 }
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -127,8 +128,100 @@ func TestSessionRepo_GetDisableTaskTracking(t *testing.T) {
 	})
 }
 
-// TestSessionRepo_PopGeminiCallIDAndName tests the PopGeminiCallIDAndName method with various boundary cases
-func TestSessionRepo_PopGeminiCallIDAndName(t *testing.T) {
+// TestMatchGeminiCalls tests matching function responses with pending Gemini calls
+func TestMatchGeminiCalls(t *testing.T) {
+	pending := []pendingGeminiCall{
+		{msg: 0, ID: "call_1", Name: "get_weather"},
+		{msg: 0, ID: "call_2", Name: "get_time"},
+		{msg: 0, ID: "call_3", Name: "get_weather"},
+		{msg: 1, ID: "call_4", Name: "search"},
+	}
+
+	tests := []struct {
+		name      string
+		responses []GeminiFunctionResponse
+		want      []int
+		wantErr   error
+		errMsg    string
+	}{
+		{
+			name:      "unique name in any message",
+			responses: []GeminiFunctionResponse{{Name: "search"}},
+			want:      []int{3},
+		},
+		{
+			name:      "parallel responses out of order",
+			responses: []GeminiFunctionResponse{{Name: "search"}, {Name: "get_time"}},
+			want:      []int{3, 1},
+		},
+		{
+			name:      "same-named calls all answered in call order",
+			responses: []GeminiFunctionResponse{{Name: "get_weather"}, {Name: "get_time"}, {Name: "get_weather"}},
+			want:      []int{0, 1, 2},
+		},
+		{
+			name:      "id disambiguates same-named calls",
+			responses: []GeminiFunctionResponse{{Name: "get_weather", ID: "call_3"}},
+			want:      []int{2},
+		},
+		{
+			name:      "id-less response takes the call not answered by id",
+			responses: []GeminiFunctionResponse{{Name: "get_weather"}, {Name: "get_weather", ID: "call_1"}},
+			want:      []int{2, 0},
+		},
+		{
+			name:      "same-named calls partly answered without id",
+			responses: []GeminiFunctionResponse{{Name: "get_weather"}},
+			wantErr:   ErrGeminiCallAmbiguous,
+			errMsg:    "2 pending calls named 'get_weather' for 1 responses",
+		},
+		{
+			name:      "unknown name",
+			responses: []GeminiFunctionResponse{{Name: "calculate"}},
+			wantErr:   ErrGeminiCallNotFound,
+		},
+		{
+			name:      "more responses than calls",
+			responses: []GeminiFunctionResponse{{Name: "search"}, {Name: "search"}},
+			wantErr:   ErrGeminiCallNotFound,
+		},
+		{
+			name:      "unknown id",
+			responses: []GeminiFunctionResponse{{Name: "search", ID: "call_9"}},
+			wantErr:   ErrGeminiCallNotFound,
+		},
+		{
+			name:      "id answered twice",
+			responses: []GeminiFunctionResponse{{Name: "search", ID: "call_4"}, {Name: "search", ID: "call_4"}},
+			wantErr:   ErrGeminiCallNotFound,
+		},
+		{
+			name:      "id of a call with another name",
+			responses: []GeminiFunctionResponse{{Name: "search", ID: "call_2"}},
+			errMsg:    "function name mismatch",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchGeminiCalls(pending, tt.responses)
+			if tt.wantErr == nil && tt.errMsg == "" {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+				return
+			}
+			require.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+			if tt.errMsg != "" {
+				assert.Contains(t, err.Error(), tt.errMsg)
+			}
+		})
+	}
+}
+
+func TestSessionRepo_ResolveGeminiCalls(t *testing.T) {
 	db := setupSessionTestDB(t)
 	if db == nil {
 		return // Test was skipped
@@ -138,265 +231,366 @@ func TestSessionRepo_PopGeminiCallIDAndName(t *testing.T) {
 	repo := NewSessionRepo(db, nil, nil, logger)
 	ctx := context.Background()
 
-	// Create a project
 	project := &model.Project{
 		ID:               uuid.New(),
-		SecretKeyHMAC:    "test_hmac_pop",
-		SecretKeyHashPHC: "test_hash_pop",
+		SecretKeyHMAC:    "test_hmac_gemini",
+		SecretKeyHashPHC: "test_hash_gemini",
 	}
 	require.NoError(t, db.Create(project).Error)
 	defer cleanupSessionTestDB(t, db, project.ID)
 
-	// Create a session
-	session := &model.Session{
-		ID:        uuid.New(),
-		ProjectID: project.ID,
-	}
-	require.NoError(t, db.Create(session).Error)
-	defer db.Delete(session)
-
-	// Auto migrate Message table
 	require.NoError(t, db.AutoMigrate(&model.Message{}))
 
-	t.Run("successful pop from single message", func(t *testing.T) {
-		// Create a message with call info
-		msg := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{
-					{"id": "call_abc123", "name": "get_weather"},
-				},
-			}),
+	newSession := func(t *testing.T, calls ...[]map[string]interface{}) (*model.Session, []*model.Message) {
+		session := &model.Session{ID: uuid.New(), ProjectID: project.ID}
+		require.NoError(t, db.Create(session).Error)
+		var msgs []*model.Message
+		for _, c := range calls {
+			msg := &model.Message{
+				SessionID:      session.ID,
+				Role:           "assistant",
+				PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
+				Meta:           datatypes.NewJSONType(map[string]interface{}{model.GeminiCallInfoKey: c}),
+			}
+			require.NoError(t, repo.CreateMessageWithAssets(ctx, msg, AppendPrecondition{}))
+			msgs = append(msgs, msg)
 		}
-		require.NoError(t, db.Create(msg).Error)
-		defer db.Delete(msg)
-
-		// Pop the call info
-		id, name, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-		require.NoError(t, err)
-		assert.Equal(t, "call_abc123", id)
-		assert.Equal(t, "get_weather", name)
-
-		// Verify the message was updated (array should be empty or key removed)
-		var updatedMsg model.Message
-		require.NoError(t, db.First(&updatedMsg, msg.ID).Error)
-		meta := updatedMsg.Meta.Data()
-		_, exists := meta[model.GeminiCallInfoKey]
-		assert.False(t, exists, "call info key should be removed when array is empty")
-	})
+		return session, msgs
+	}
+	pendingOf := func(t *testing.T, msg *model.Message) []interface{} {
+		var got model.Message
+		require.NoError(t, db.First(&got, msg.ID).Error)
+		calls, _ := got.Meta.Data()[model.GeminiCallInfoKey].([]interface{})
+		return calls
+	}
 
-	t.Run("pop from multiple call info entries", func(t *testing.T) {
-		// Create a message with multiple call info entries
+	answer := func(t *testing.T, session *model.Session, ids ...string) error {
 		msg := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{
-					{"id": "call_first", "name": "first_func"},
-					{"id": "call_second", "name": "second_func"},
-					{"id": "call_third", "name": "third_func"},
-				},
-			}),
+			SessionID:      session.ID,
+			Role:           "user",
+			PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
 		}
-		require.NoError(t, db.Create(msg).Error)
-		defer db.Delete(msg)
+		return repo.CreateMessageWithAssets(ctx, msg, AppendPrecondition{GeminiCallIDs: ids})
+	}
 
-		// Pop first entry
-		id1, name1, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-		require.NoError(t, err)
-		assert.Equal(t, "call_first", id1)
-		assert.Equal(t, "first_func", name1)
+	t.Run("batched responses across messages", func(t *testing.T) {
+		session, msgs := newSession(t,
+			[]map[string]interface{}{{"id": "call_a", "name": "get_weather"}, {"id": "call_b", "name": "get_time"}},
+			[]map[string]interface{}{{"id": "call_c", "name": "search"}},
+		)
 
-		// Pop second entry
-		id2, name2, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
+		ids, err := repo.ResolveGeminiCalls(ctx, session.ID, []GeminiFunctionResponse{{Name: "search"}, {Name: "get_time"}})
 		require.NoError(t, err)
-		assert.Equal(t, "call_second", id2)
-		assert.Equal(t, "second_func", name2)
-
-		// Verify remaining entry
-		var updatedMsg model.Message
-		require.NoError(t, db.First(&updatedMsg, msg.ID).Error)
-		meta := updatedMsg.Meta.Data()
-		callInfo, exists := meta[model.GeminiCallInfoKey]
-		assert.True(t, exists, "call info key should still exist")
-		callInfoArray := callInfo.([]interface{})
-		assert.Len(t, callInfoArray, 1, "should have one remaining entry")
-		remaining := callInfoArray[0].(map[string]interface{})
-		assert.Equal(t, "call_third", remaining["id"])
-		assert.Equal(t, "third_func", remaining["name"])
+		assert.Equal(t, []string{"call_c", "call_b"}, ids)
+		assert.Len(t, pendingOf(t, msgs[0]), 2, "resolving consumes nothing")
+
+		require.NoError(t, answer(t, session, ids...))
+
+		remaining := pendingOf(t, msgs[0])
+		require.Len(t, remaining, 1)
+		assert.Equal(t, "call_a", remaining[0].(map[string]interface{})["id"])
+
+		var second model.Message
+		require.NoError(t, db.First(&second, msgs[1].ID).Error)
+		_, exists := second.Meta.Data()[model.GeminiCallInfoKey]
+		assert.False(t, exists, "call info key should be removed when every call is answered")
 	})
 
-	t.Run("pop from earliest message when multiple messages exist", func(t *testing.T) {
-		// Create two messages with call info
-		msg1 := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{
-					{"id": "call_earlier", "name": "earlier_func"},
-				},
-			}),
-		}
-		require.NoError(t, db.Create(msg1).Error)
-		defer db.Delete(msg1)
-
-		// Wait a bit to ensure different timestamps
-		time.Sleep(10 * time.Millisecond)
-
-		msg2 := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{
-					{"id": "call_later", "name": "later_func"},
-				},
-			}),
-		}
-		require.NoError(t, db.Create(msg2).Error)
-		defer db.Delete(msg2)
+	t.Run("failed match consumes nothing", func(t *testing.T) {
+		session, msgs := newSession(t,
+			[]map[string]interface{}{{"id": "call_a", "name": "get_weather"}, {"id": "call_b", "name": "get_weather"}},
+		)
 
-		// Pop should get from earliest message (msg1)
-		id, name, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-		require.NoError(t, err)
-		assert.Equal(t, "call_earlier", id)
-		assert.Equal(t, "earlier_func", name)
+		_, err := repo.ResolveGeminiCalls(ctx, session.ID, []GeminiFunctionResponse{{Name: "get_weather"}})
+		assert.ErrorIs(t, err, ErrGeminiCallAmbiguous)
+		assert.Len(t, pendingOf(t, msgs[0]), 2)
+
+		_, err = repo.ResolveGeminiCalls(ctx, session.ID, []GeminiFunctionResponse{{Name: "get_weather", ID: "call_b"}, {Name: "unknown"}})
+		assert.ErrorIs(t, err, ErrGeminiCallNotFound)
+		assert.Len(t, pendingOf(t, msgs[0]), 2)
 	})
 
-	t.Run("error when no call info available", func(t *testing.T) {
-		// Create a session without any messages with call info
-		emptySession := &model.Session{
-			ID:        uuid.New(),
-			ProjectID: project.ID,
-		}
-		require.NoError(t, db.Create(emptySession).Error)
-		defer db.Delete(emptySession)
+	t.Run("no call info", func(t *testing.T) {
+		session, _ := newSession(t)
 
-		// Try to pop from empty session
-		_, _, err := repo.PopGeminiCallIDAndName(ctx, emptySession.ID)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "no available Gemini call info")
+		_, err := repo.ResolveGeminiCalls(ctx, session.ID, []GeminiFunctionResponse{{Name: "get_weather"}})
+		assert.ErrorIs(t, err, ErrGeminiCallNotFound)
 	})
 
-	t.Run("error when call info array is empty", func(t *testing.T) {
-		// Create a message with empty call info array
-		msg := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{},
-			}),
-		}
-		require.NoError(t, db.Create(msg).Error)
-		defer db.Delete(msg)
+	t.Run("a rejected append consumes nothing", func(t *testing.T) {
+		session, msgs := newSession(t,
+			[]map[string]interface{}{{"id": "call_1", "name": "func1"}},
+		)
 
-		// Try to pop from empty array
-		_, _, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "no available Gemini call info")
+		stale := int64(0)
+		msg := &model.Message{SessionID: session.ID, Role: "user", PartsAssetMeta: datatypes.NewJSONType(model.Asset{})}
+		err := repo.CreateMessageWithAssets(ctx, msg, AppendPrecondition{LastSeq: &stale, GeminiCallIDs: []string{"call_1"}})
+		assert.ErrorIs(t, err, ErrAppendConflict)
+		assert.Len(t, pendingOf(t, msgs[0]), 1)
 	})
 
-	t.Run("error when call info has invalid format", func(t *testing.T) {
-		// Create a message with invalid call info format (not an array of objects)
-		// The SQL query will fail because jsonb_array_length fails on non-array
-		// This will cause a query error, not a "no available" error
-		msg := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: "invalid_format",
-			}),
+	t.Run("concurrent stores cannot answer the same call", func(t *testing.T) {
+		session, _ := newSession(t,
+			[]map[string]interface{}{{"id": "call_1", "name": "func1"}},
+		)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = answer(t, session, "call_1")
+			}(i)
 		}
-		require.NoError(t, db.Create(msg).Error)
-		defer db.Delete(msg)
+		wg.Wait()
 
-		// Try to pop - SQL query will fail on jsonb_array_length for scalar value
-		// This will return a query error
-		_, _, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to query message with call info")
+		if errs[0] == nil {
+			assert.ErrorIs(t, errs[1], ErrGeminiCallNotFound)
+		} else {
+			assert.ErrorIs(t, errs[0], ErrGeminiCallNotFound)
+			assert.NoError(t, errs[1])
+		}
 	})
+}
 
-	t.Run("error when call info entry missing id or name", func(t *testing.T) {
-		// Create a message with call info missing id
-		msg := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{
-					{"name": "missing_id"},
-				},
-			}),
+func TestSessionRepo_CreateMessageWithAssets_Seq(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_seq",
+		SecretKeyHashPHC: "test_hash_seq",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	session := &model.Session{
+		ID:        uuid.New(),
+		ProjectID: project.ID,
+	}
+	require.NoError(t, db.Create(session).Error)
+
+	require.NoError(t, db.AutoMigrate(&model.Message{}))
+
+	// Store concurrently; every message must get a distinct, gapless seq
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- repo.CreateMessageWithAssets(ctx, &model.Message{
+				SessionID:      session.ID,
+				Role:           "user",
+				PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
+			}, AppendPrecondition{})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	msgs, err := repo.ListAllMessagesBySession(ctx, session.ID, nil)
+	require.NoError(t, err)
+	require.Len(t, msgs, n)
+	for i, msg := range msgs {
+		assert.Equal(t, int64(i+1), msg.Seq)
+		if i == 0 {
+			assert.Nil(t, msg.ParentID)
+		} else {
+			require.NotNil(t, msg.ParentID)
+			assert.Equal(t, msgs[i-1].ID, *msg.ParentID)
 		}
-		require.NoError(t, db.Create(msg).Error)
-		defer db.Delete(msg)
+	}
 
-		// Try to pop - should return error because ID is missing
-		_, _, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "call ID is not a string")
+	// Pages follow seq order
+	page, err := repo.ListBySessionWithCursor(ctx, session.ID, nil, msgs[4].Seq, msgs[4].CreatedAt, msgs[4].ID, 3, false)
+	require.NoError(t, err)
+	require.Len(t, page, 3)
+	assert.Equal(t, int64(6), page[0].Seq)
+
+	t.Run("unknown session", func(t *testing.T) {
+		err := repo.CreateMessageWithAssets(ctx, &model.Message{
+			SessionID:      uuid.New(),
+			Role:           "user",
+			PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
+		}, AppendPrecondition{})
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
 	})
 
-	t.Run("concurrent pops should be thread-safe", func(t *testing.T) {
-		// Create a message with multiple call info entries
+	t.Run("append preconditions", func(t *testing.T) {
+		last := msgs[n-1]
+		staleID := msgs[n-2].ID
+		staleSeq := last.Seq - 1
+
+		err := repo.CreateMessageWithAssets(ctx, &model.Message{
+			SessionID:      session.ID,
+			Role:           "user",
+			PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
+		}, AppendPrecondition{LastMessageID: &staleID})
+		assert.ErrorIs(t, err, ErrAppendConflict)
+
+		err = repo.CreateMessageWithAssets(ctx, &model.Message{
+			SessionID:      session.ID,
+			Role:           "user",
+			PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
+		}, AppendPrecondition{LastSeq: &staleSeq})
+		assert.ErrorIs(t, err, ErrAppendConflict)
+
+		// A rejected append does not consume a seq
 		msg := &model.Message{
-			ID:        uuid.New(),
-			SessionID: session.ID,
-			Role:      "assistant",
-			Meta: datatypes.NewJSONType(map[string]interface{}{
-				model.GeminiCallInfoKey: []map[string]interface{}{
-					{"id": "call_concurrent1", "name": "func1"},
-					{"id": "call_concurrent2", "name": "func2"},
-				},
-			}),
+			SessionID:      session.ID,
+			Role:           "user",
+			PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
 		}
-		require.NoError(t, db.Create(msg).Error)
-		defer db.Delete(msg)
+		require.NoError(t, repo.CreateMessageWithAssets(ctx, msg, AppendPrecondition{LastMessageID: &last.ID, LastSeq: &last.Seq}))
+		assert.Equal(t, last.Seq+1, msg.Seq)
+	})
+}
 
-		// Use channels to coordinate concurrent pops
-		results := make(chan struct {
-			id   string
-			name string
-			err  error
-		}, 2)
+func TestSessionRepo_CreateTools_Versions(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
 
-		// Pop concurrently
-		go func() {
-			id, name, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-			results <- struct {
-				id   string
-				name string
-				err  error
-			}{id, name, err}
-		}()
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
 
-		go func() {
-			id, name, err := repo.PopGeminiCallIDAndName(ctx, session.ID)
-			results <- struct {
-				id   string
-				name string
-				err  error
-			}{id, name, err}
-		}()
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_tools",
+		SecretKeyHashPHC: "test_hash_tools",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
 
-		// Collect results
-		result1 := <-results
-		result2 := <-results
+	session := &model.Session{
+		ID:        uuid.New(),
+		ProjectID: project.ID,
+	}
+	require.NoError(t, db.Create(session).Error)
 
-		// Both should succeed
-		require.NoError(t, result1.err)
-		require.NoError(t, result2.err)
+	require.NoError(t, db.AutoMigrate(&model.SessionTools{}))
 
-		// Both should get different IDs
-		assert.NotEqual(t, result1.id, result2.id)
-		assert.Contains(t, []string{"call_concurrent1", "call_concurrent2"}, result1.id)
-		assert.Contains(t, []string{"call_concurrent1", "call_concurrent2"}, result2.id)
-	})
+	for _, name := range []string{"search", "fetch"} {
+		require.NoError(t, repo.CreateTools(ctx, &model.SessionTools{
+			SessionID:    session.ID,
+			SourceFormat: model.FormatOpenAI,
+			Tools:        datatypes.NewJSONType([]model.ToolDefinition{{Name: name}}),
+		}))
+	}
+
+	latest, err := repo.GetTools(ctx, session.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, latest.Version)
+	assert.Equal(t, "fetch", latest.Tools.Data()[0].Name)
+
+	first, err := repo.GetTools(ctx, session.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "search", first.Tools.Data()[0].Name)
+
+	all, err := repo.ListTools(ctx, session.ID)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, 1, all[0].Version)
+
+	_, err = repo.GetTools(ctx, session.ID, 3)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	err = repo.CreateTools(ctx, &model.SessionTools{SessionID: uuid.New(), SourceFormat: model.FormatOpenAI})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestSessionRepo_RepairMessages(t *testing.T) {
+	db := setupSessionTestDB(t)
+	if db == nil {
+		return // Test was skipped
+	}
+
+	logger, _ := zap.NewDevelopment()
+	repo := NewSessionRepo(db, nil, nil, logger)
+	ctx := context.Background()
+
+	project := &model.Project{
+		ID:               uuid.New(),
+		SecretKeyHMAC:    "test_hmac_repair",
+		SecretKeyHashPHC: "test_hash_repair",
+	}
+	require.NoError(t, db.Create(project).Error)
+	defer cleanupSessionTestDB(t, db, project.ID)
+
+	session := &model.Session{
+		ID:        uuid.New(),
+		ProjectID: project.ID,
+	}
+	require.NoError(t, db.Create(session).Error)
+
+	require.NoError(t, db.AutoMigrate(&model.Message{}, &model.Checkpoint{}))
+
+	// call -> orphan result -> follow-up
+	var msgs []*model.Message
+	for _, role := range []string{"assistant", "user", "assistant"} {
+		msg := &model.Message{
+			SessionID:      session.ID,
+			Role:           role,
+			PartsAssetMeta: datatypes.NewJSONType(model.Asset{}),
+		}
+		require.NoError(t, repo.CreateMessageWithAssets(ctx, msg, AppendPrecondition{}))
+		msgs = append(msgs, msg)
+	}
+	require.NoError(t, db.Create(&model.Checkpoint{SessionID: session.ID, Name: "after result", MessageID: msgs[1].ID}).Error)
+
+	inserted := model.Message{
+		ID:             uuid.New(),
+		ParentID:       &msgs[0].ID,
+		Role:           "user",
+		PartsAssetMeta: datatypes.NewJSONType(model.Asset{SHA256: "cancelled"}),
+		CreatedAt:      msgs[0].CreatedAt.Add(time.Microsecond),
+	}
+	repair := MessageRepair{
+		Update: []model.Message{{ID: msgs[0].ID, PartsAssetMeta: datatypes.NewJSONType(model.Asset{SHA256: "rewritten"}), ToolCallIDs: []string{"call_1"}}},
+		Insert: []model.Message{inserted},
+		Delete: []uuid.UUID{msgs[1].ID},
+	}
+
+	// A stale seq changes nothing
+	err := repo.RepairMessages(ctx, session.ID, msgs[2].Seq-1, repair)
+	assert.ErrorIs(t, err, ErrAppendConflict)
+
+	require.NoError(t, repo.RepairMessages(ctx, session.ID, msgs[2].Seq, repair))
+
+	got, err := repo.ListAllMessagesBySession(ctx, session.ID, nil)
+	require.NoError(t, err)
+	require.Len(t, got, 3)
+	assert.Equal(t, msgs[0].ID, got[0].ID)
+	assert.Equal(t, "rewritten", got[0].PartsAssetMeta.Data().SHA256)
+	assert.Equal(t, []string{"call_1"}, []string(got[0].ToolCallIDs))
+	assert.Equal(t, inserted.ID, got[1].ID)
+	assert.Equal(t, msgs[0].Seq+1, got[1].Seq)
+	assert.Equal(t, msgs[2].ID, got[2].ID)
+	assert.Equal(t, msgs[2].Seq+1, got[2].Seq)
+	require.NotNil(t, got[2].ParentID)
+	assert.Equal(t, inserted.ID, *got[2].ParentID)
+
+	// The counter covers the shifted seqs, so the next append sorts last
+	updated, err := repo.Get(ctx, &model.Session{ID: session.ID})
+	require.NoError(t, err)
+	assert.Equal(t, msgs[2].Seq+1, updated.LastMessageSeq)
+
+	cp, err := repo.GetCheckpoint(ctx, session.ID, "after result")
+	require.NoError(t, err)
+	assert.Equal(t, msgs[0].ID, cp.MessageID)
 }
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"gorm.io/gorm"
+)
+
+type ShareRepo interface {
+	Create(ctx context.Context, s *model.DiskShare) error
+	DiskExists(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (bool, error)
+	GetByTokenHMAC(ctx context.Context, tokenHMAC string) (*model.DiskShare, error)
+	ListActive(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, now time.Time) ([]*model.DiskShare, error)
+	Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, shareID uuid.UUID) error
+	ConsumeDownload(ctx context.Context, shareID uuid.UUID, now time.Time) (bool, error)
+}
+
+type shareRepo struct{ db *gorm.DB }
+
+func NewShareRepo(db *gorm.DB) ShareRepo {
+	return &shareRepo{db: db}
+}
+
+// Create stores a share after checking that its disk belongs to the project
+func (r *shareRepo) Create(ctx context.Context, s *model.DiskShare) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var disk model.Disk
+		if err := tx.Where("id = ? AND project_id = ?", s.DiskID, s.ProjectID).First(&disk).Error; err != nil {
+			return err
+		}
+		return tx.Create(s).Error
+	})
+}
+
+// DiskExists reports whether the disk belongs to the project
+func (r *shareRepo) DiskExists(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&model.Disk{}).
+		Where("id = ? AND project_id = ?", diskID, projectID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *shareRepo) GetByTokenHMAC(ctx context.Context, tokenHMAC string) (*model.DiskShare, error) {
+	var s model.DiskShare
+	if err := r.db.WithContext(ctx).Where("token_hmac = ?", tokenHMAC).First(&s).Error; err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListActive returns the shares of a disk that are neither expired nor out of downloads
+func (r *shareRepo) ListActive(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, now time.Time) ([]*model.DiskShare, error) {
+	var shares []*model.DiskShare
+	err := r.db.WithContext(ctx).
+		Where("project_id = ? AND disk_id = ? AND expires_at > ?", projectID, diskID, now).
+		Where("max_downloads IS NULL OR download_count < max_downloads").
+		Order("created_at DESC, id DESC").
+		Find(&shares).Error
+	return shares, err
+}
+
+func (r *shareRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, shareID uuid.UUID) error {
+	res := r.db.WithContext(ctx).
+		Where("id = ? AND project_id = ? AND disk_id = ?", shareID, projectID, diskID).
+		Delete(&model.DiskShare{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ConsumeDownload counts one download of a share. It reports false without an
+// error when the share has expired or reached its download limit, so
+// concurrent downloads can never exceed the limit.
+func (r *shareRepo) ConsumeDownload(ctx context.Context, shareID uuid.UUID, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&model.DiskShare{}).
+		Where("id = ? AND expires_at > ?", shareID, now).
+		Where("max_downloads IS NULL OR download_count < max_downloads").
+		UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
@@ -6,36 +6,118 @@ import (
 	"fmt"
 	"io"
 	"mime/multipart"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/memodb-io/Luminox/internal/infra/blob"
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/modules/repo"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/diff"
 	"github.com/memodb-io/Luminox/internal/pkg/utils/fileparser"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/glob"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/mime"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 type ArtifactService interface {
 	Create(ctx context.Context, in CreateArtifactInput) (*model.Artifact, error)
-	DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error
+	DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, cond WriteCondition) error
 	GetByPath(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.Artifact, error)
 	GetPresignedURL(ctx context.Context, artifact *model.Artifact, expire time.Duration) (string, error)
 	GetFileContent(ctx context.Context, artifact *model.Artifact) (*fileparser.FileContent, error)
-	UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}) (*model.Artifact, error)
+	GetFileRange(ctx context.Context, artifact *model.Artifact, offset int64, limit int64) (*FileRange, error)
+	UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}, cond WriteCondition) (*model.Artifact, error)
 	ListByPath(ctx context.Context, diskID uuid.UUID, path string) ([]*model.Artifact, error)
 	GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]string, error)
-	GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error)
+	GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*model.Artifact, error)
+	GrepLines(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*GrepFileResult, error)
 	GlobArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error)
+	ListVersions(ctx context.Context, artifact *model.Artifact) ([]*model.ArtifactVersion, error)
+	GetVersion(ctx context.Context, artifact *model.Artifact, version int) (*model.Artifact, error)
+	DiffVersions(ctx context.Context, artifact *model.Artifact, from int, to int) (string, error)
+	RestoreVersion(ctx context.Context, projectID uuid.UUID, artifact *model.Artifact, version int, cond WriteCondition) (*model.Artifact, error)
+	MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, cond WriteCondition) (*model.Artifact, error)
+	MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error)
+	CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, lockID string) (*model.Artifact, error)
+	CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error)
+	RemoveDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool, lockID string) (int64, error)
+	MakeDirectory(ctx context.Context, diskID uuid.UUID, dir string) error
+	CreateUpload(ctx context.Context, in CreateUploadInput) (*UploadPlan, error)
+	FinalizeUpload(ctx context.Context, in FinalizeUploadInput) (*model.Artifact, error)
+	PruneExpiredUploads(ctx context.Context, before time.Time) (int, error)
+	EditText(ctx context.Context, in EditTextInput) (*model.Artifact, error)
+	AcquireLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string, ttl time.Duration) (*ArtifactLock, error)
+	ReleaseLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string) error
 }
 
+var (
+	// ErrArtifactVersionNotFound is returned when an artifact has no such version
+	ErrArtifactVersionNotFound = errors.New("artifact version not found")
+	// ErrInvalidVersion is returned for version operations that cannot be performed, such as restoring the current version
+	ErrInvalidVersion = errors.New("invalid version")
+	// ErrUnsupportedFileType is returned when text content is requested for a file that cannot be parsed as text
+	ErrUnsupportedFileType = errors.New("unsupported file type")
+	// ErrPathNotFound is returned when the source of a path operation does not exist
+	ErrPathNotFound = errors.New("path not found")
+	// ErrInvalidPathOperation is returned for moves and copies that cannot be performed, such as a directory into itself
+	ErrInvalidPathOperation = errors.New("invalid path operation")
+	// ErrArtifactExists is returned when a move or copy would overwrite an existing artifact
+	ErrArtifactExists = repo.ErrArtifactExists
+	// ErrDirectoryNotEmpty is returned when a non-recursive delete targets a directory with contents
+	ErrDirectoryNotEmpty = repo.ErrDirectoryNotEmpty
+	// ErrInvalidGrepPattern is returned when a grep pattern is not a valid regular expression
+	ErrInvalidGrepPattern = errors.New("invalid grep pattern")
+	// ErrInvalidGlobPattern is returned for malformed glob patterns
+	ErrInvalidGlobPattern = glob.ErrBadPattern
+	// ErrUploadNotFound is returned when a direct upload does not exist or was already finalized
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadExpired is returned when a direct upload is finalized after its URLs expired
+	ErrUploadExpired = errors.New("upload expired")
+	// ErrUploadIncomplete is returned when a direct upload is finalized before its content was uploaded
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+	// ErrUploadChecksumMismatch is returned when uploaded content does not match the declared sha256 and size
+	ErrUploadChecksumMismatch = errors.New("uploaded content does not match sha256 and size")
+	// ErrUploadClaimed is returned when a direct upload is finalized while another finalize of it is running
+	ErrUploadClaimed = repo.ErrUploadClaimed
+	// ErrInvalidEdit is returned for edits that cannot be applied, such as a str_replace without a unique match
+	ErrInvalidEdit = errors.New("invalid edit")
+	// ErrEditConflict is returned when an artifact keeps changing while an edit is being saved
+	ErrEditConflict = errors.New("artifact was changed concurrently")
+	// ErrPreconditionFailed is returned when an artifact's content does not match the If-Match of a write
+	ErrPreconditionFailed = errors.New("artifact does not match If-Match")
+	// ErrArtifactLocked is returned when a path is locked by another holder
+	ErrArtifactLocked = errors.New("artifact is locked")
+	// ErrLockNotHeld is returned when renewing or releasing a lock that has expired or belongs to another holder
+	ErrLockNotHeld = errors.New("lock is not held")
+	// ErrLocksUnavailable is returned when locks are requested but no Redis is configured
+	ErrLocksUnavailable = errors.New("artifact locks are unavailable")
+)
+
 type artifactService struct {
-	r  repo.ArtifactRepo
-	s3 *blob.S3Deps
+	r     repo.ArtifactRepo
+	s3    *blob.S3Deps
+	locks lockStore
+}
+
+func NewArtifactService(r repo.ArtifactRepo, s3 *blob.S3Deps, redis *redis.Client) ArtifactService {
+	return &artifactService{r: r, s3: s3, locks: newLockStore(redis)}
 }
 
-func NewArtifactService(r repo.ArtifactRepo, s3 *blob.S3Deps) ArtifactService {
-	return &artifactService{r: r, s3: s3}
+// WriteCondition guards a write against concurrent writers
+type WriteCondition struct {
+	// IfMatch is the SHA256 or ETag the current content must have, or "*"
+	// for any existing artifact. Empty skips the check.
+	IfMatch string
+	// LockID identifies the caller's lock on the path, if it holds one
+	LockID string
 }
 
 type CreateArtifactInput struct {
@@ -45,18 +127,23 @@ type CreateArtifactInput struct {
 	Filename   string
 	FileHeader *multipart.FileHeader
 	UserMeta   map[string]interface{}
+	Condition  WriteCondition
 }
 
 func (s *artifactService) Create(ctx context.Context, in CreateArtifactInput) (*model.Artifact, error) {
-	// Check if artifact with same path and filename already exists in the same disk
-	exists, err := s.r.ExistsByPathAndFilename(ctx, in.DiskID, in.Path, in.Filename, nil)
+	// Check if artifact with same path and filename already exists in the same disk.
+	// Its current content is kept as a previous version when it is overwritten.
+	existing, err := s.r.GetByPath(ctx, in.DiskID, in.Path, in.Filename)
 	if err != nil {
-		return nil, fmt.Errorf("check artifact existence: %w", err)
-	}
-	if exists {
-		if err := s.r.DeleteByPath(ctx, in.ProjectID, in.DiskID, in.Path, in.Filename); err != nil {
-			return nil, fmt.Errorf("upsert existing artifact: %w", err)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("check artifact existence: %w", err)
 		}
+		existing = nil
+	}
+
+	baseSHA256, err := s.checkWrite(ctx, in.DiskID, in.Path, in.Filename, existing, in.Condition)
+	if err != nil {
+		return nil, err
 	}
 
 	asset, err := s.s3.UploadFormFile(ctx, "disks/"+in.ProjectID.String(), in.FileHeader)
@@ -84,39 +171,83 @@ func (s *artifactService) Create(ctx context.Context, in CreateArtifactInput) (*
 	}
 	asset.Content = textContent
 
+	return s.saveArtifact(ctx, in.ProjectID, in.DiskID, existing, in.Path, in.Filename, asset, in.UserMeta, baseSHA256)
+}
+
+// saveArtifact stores asset as the content of the artifact at path and filename.
+// An existing artifact keeps its current content as a previous version. A
+// non-empty baseSHA256 must still match the existing artifact's content.
+func (s *artifactService) saveArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, existing *model.Artifact, path string, filename string, asset *model.Asset, userMeta map[string]interface{}, baseSHA256 string) (*model.Artifact, error) {
 	// Build artifact metadata
 	meta := map[string]interface{}{
 		model.ArtifactInfoKey: map[string]interface{}{
-			"path":     in.Path,
-			"filename": in.FileHeader.Filename,
+			"path":     path,
+			"filename": filename,
 			"mime":     asset.MIME,
 			"size":     asset.SizeB,
 		},
 	}
-	for k, v := range in.UserMeta {
+	for k, v := range userMeta {
 		meta[k] = v
 	}
 
+	if existing != nil {
+		if err := s.r.ReplaceContent(ctx, projectID, existing, *asset, meta, baseSHA256); err != nil {
+			if errors.Is(err, repo.ErrContentChanged) {
+				return nil, ErrPreconditionFailed
+			}
+			return nil, fmt.Errorf("upsert existing artifact: %w", err)
+		}
+		return existing, nil
+	}
+	if baseSHA256 != "" {
+		// The artifact was deleted since its If-Match was checked
+		return nil, ErrPreconditionFailed
+	}
+
 	artifact := &model.Artifact{
-		DiskID:    in.DiskID,
-		Path:      in.Path,
-		Filename:  in.Filename,
+		DiskID:    diskID,
+		Path:      path,
+		Filename:  filename,
 		Meta:      meta,
 		AssetMeta: datatypes.NewJSONType(*asset),
+		Version:   1,
 	}
 
-	if err := s.r.Create(ctx, in.ProjectID, artifact); err != nil {
+	if err := s.r.Create(ctx, projectID, artifact); err != nil {
 		return nil, fmt.Errorf("create artifact record: %w", err)
 	}
 
 	return artifact, nil
 }
 
-func (s *artifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error {
+func (s *artifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, cond WriteCondition) error {
 	if path == "" || filename == "" {
 		return errors.New("path and filename are required")
 	}
-	return s.r.DeleteByPath(ctx, projectID, diskID, path, filename)
+
+	var current *model.Artifact
+	if cond.IfMatch != "" {
+		var err error
+		if current, err = s.r.GetByPath(ctx, diskID, path, filename); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			current = nil
+		}
+	}
+	baseSHA256, err := s.checkWrite(ctx, diskID, path, filename, current, cond)
+	if err != nil {
+		return err
+	}
+
+	if err := s.r.DeleteByPath(ctx, projectID, diskID, path, filename, baseSHA256); err != nil {
+		if errors.Is(err, repo.ErrContentChanged) {
+			return ErrPreconditionFailed
+		}
+		return err
+	}
+	return nil
 }
 
 func (s *artifactService) GetByPath(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.Artifact, error) {
@@ -152,7 +283,7 @@ func (s *artifactService) GetFileContent(ctx context.Context, artifact *model.Ar
 	// Check if file type is parsable before downloading
 	parser := fileparser.NewFileParser()
 	if !parser.CanParseFile(artifact.Filename, assetData.MIME) {
-		return nil, fmt.Errorf("unsupported file type: %s (mime: %s)", artifact.Filename, assetData.MIME)
+		return nil, fmt.Errorf("%w: %s (mime: %s)", ErrUnsupportedFileType, artifact.Filename, assetData.MIME)
 	}
 
 	// Download file content from S3
@@ -170,12 +301,56 @@ func (s *artifactService) GetFileContent(ctx context.Context, artifact *model.Ar
 	return fileContent, nil
 }
 
-func (s *artifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}) (*model.Artifact, error) {
+// FileRange is a window of an artifact's raw bytes. Data is base64 encoded in JSON.
+type FileRange struct {
+	Offset    int64  `json:"offset"`
+	Length    int64  `json:"length"`
+	TotalSize int64  `json:"total_size"`
+	Data      []byte `json:"data"`
+}
+
+func (s *artifactService) GetFileRange(ctx context.Context, artifact *model.Artifact, offset int64, limit int64) (*FileRange, error) {
+	if artifact == nil {
+		return nil, errors.New("artifact is nil")
+	}
+	if offset < 0 || limit <= 0 {
+		return nil, fmt.Errorf("invalid byte range: offset %d, limit %d", offset, limit)
+	}
+
+	assetData := artifact.AssetMeta.Data()
+	if assetData.S3Key == "" {
+		return nil, errors.New("artifact has no S3 key")
+	}
+
+	rng := &FileRange{Offset: offset, TotalSize: assetData.SizeB, Data: []byte{}}
+	// S3 rejects ranges starting past the end of the object, so answer those without a request
+	if offset >= assetData.SizeB {
+		return rng, nil
+	}
+	if offset+limit > assetData.SizeB {
+		limit = assetData.SizeB - offset
+	}
+
+	data, err := s.s3.DownloadFileRange(ctx, assetData.S3Key, offset, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file range: %w", err)
+	}
+	rng.Data = data
+	rng.Length = int64(len(data))
+
+	return rng, nil
+}
+
+func (s *artifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}, cond WriteCondition) (*model.Artifact, error) {
 	// Get existing artifact
 	artifact, err := s.GetByPath(ctx, diskID, path, filename)
 	if err != nil {
 		return nil, err
 	}
+	baseSHA256, err := s.checkWrite(ctx, diskID, path, filename, artifact, cond)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate that user meta doesn't contain system reserved keys
 	reservedKeys := model.Artifact{}.GetReservedKeys()
@@ -201,7 +376,10 @@ func (s *artifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID u
 	// Update artifact meta
 	artifact.Meta = newMeta
 
-	if err := s.r.Update(ctx, artifact); err != nil {
+	if err := s.r.Update(ctx, artifact, baseSHA256); err != nil {
+		if errors.Is(err, repo.ErrContentChanged) {
+			return nil, ErrPreconditionFailed
+		}
 		return nil, fmt.Errorf("update artifact meta: %w", err)
 	}
 
@@ -216,7 +394,254 @@ func (s *artifactService) GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]
 	return s.r.GetAllPaths(ctx, diskID)
 }
 
-func (s *artifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
+// GrepInput describes a content search over the text artifacts of a disk
+type GrepInput struct {
+	// Pattern is a regular expression, or a literal string when FixedString is set
+	Pattern         string
+	CaseInsensitive bool
+	FixedString     bool
+	// Glob restricts the search to artifacts whose path matches the glob pattern
+	Glob string
+	// Limit caps the number of matching files
+	Limit int
+	// BeforeContext and AfterContext are the number of lines returned around each match
+	BeforeContext int
+	AfterContext  int
+	// MaxMatchesPerFile caps the number of matches returned for a single file
+	MaxMatchesPerFile int
+}
+
+// GrepMatch is a single matching line of an artifact
+type GrepMatch struct {
+	LineNumber int      `json:"line_number"`
+	Line       string   `json:"line"`
+	Before     []string `json:"before,omitempty"`
+	After      []string `json:"after,omitempty"`
+}
+
+// GrepFileResult holds the matching lines of one artifact
+type GrepFileResult struct {
+	Path     string      `json:"path"`
+	Filename string      `json:"filename"`
+	Matches  []GrepMatch `json:"matches"`
+	// Truncated is set when the file has more matches than MaxMatchesPerFile
+	Truncated bool `json:"truncated"`
+}
+
+const defaultGrepMatchesPerFile = 20
+
+// compile returns the regular expression of the search. Go's dialect is the
+// one matches are decided with, so both output modes agree on them.
+func (in GrepInput) compile() (*regexp.Regexp, error) {
+	expr := in.Pattern
+	if in.FixedString {
+		expr = regexp.QuoteMeta(expr)
+	}
+	if in.CaseInsensitive {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidGrepPattern, err)
+	}
+	return re, nil
+}
+
+// grepPrefilter returns the longest literal every match of re contains, which
+// narrows the candidates in the database without depending on its regular
+// expression dialect. It returns an empty literal when there is none.
+func grepPrefilter(re *regexp.Regexp) (literal string, caseInsensitive bool) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	var best *syntax.Regexp
+	var visit func(node *syntax.Regexp)
+	visit = func(node *syntax.Regexp) {
+		switch node.Op {
+		case syntax.OpLiteral:
+			if best == nil || len(node.Rune) > len(best.Rune) {
+				best = node
+			}
+		case syntax.OpCapture:
+			visit(node.Sub[0])
+		case syntax.OpConcat:
+			for _, sub := range node.Sub {
+				visit(sub)
+			}
+		}
+	}
+	visit(parsed)
+	if best == nil {
+		return "", false
+	}
+
+	if best.Flags&syntax.FoldCase == 0 {
+		return string(best.Rune), false
+	}
+	// The database lowers ASCII letters only, so a literal is only pushed
+	// down when none of its letters folds to a non-ASCII one
+	for _, r := range best.Rune {
+		for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+			if f > unicode.MaxASCII {
+				return "", false
+			}
+		}
+	}
+	return strings.ToLower(string(best.Rune)), true
+}
+
+// maxPrefilterClassRanges is the number of ranges past which a character class
+// is widened to any character in a database prefilter
+const maxPrefilterClassRanges = 16
+
+// grepPrefilterRegexp renders re as a PostgreSQL regular expression matching
+// every content that has a line re matches, for searches without a literal to
+// narrow the candidates by. Assertions are dropped and counted repeats are
+// loosened, which only widens it. It returns "" when there is nothing to push
+// down.
+func grepPrefilterRegexp(re *regexp.Regexp) string {
+	if re.MatchString("") {
+		// Every line matches, so the database cannot rule out any content
+		return ""
+	}
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	expr, ok := prefilterRegexp(parsed)
+	if !ok {
+		return ""
+	}
+	return expr
+}
+
+// prefilterRegexp renders node for grepPrefilterRegexp. It reports false for
+// nodes that cannot be rendered.
+func prefilterRegexp(node *syntax.Regexp) (string, bool) {
+	switch node.Op {
+	case syntax.OpLiteral:
+		var b strings.Builder
+		for _, r := range node.Rune {
+			if node.Flags&syntax.FoldCase == 0 {
+				b.WriteString(prefilterRune(r))
+				continue
+			}
+			folds := []rune{r}
+			for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+				folds = append(folds, f)
+			}
+			b.WriteString("[")
+			for _, f := range folds {
+				b.WriteString(prefilterRune(f))
+			}
+			b.WriteString("]")
+		}
+		return b.String(), true
+	case syntax.OpCharClass:
+		return prefilterClass(node.Rune)
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return ".", true
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		// Zero-width assertions consume nothing, so dropping them only widens the expression
+		return "", true
+	case syntax.OpCapture:
+		return prefilterRegexp(node.Sub[0])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		sub, ok := prefilterRegexp(node.Sub[0])
+		if !ok || sub == "" {
+			return sub, ok
+		}
+		switch {
+		case node.Op == syntax.OpQuest:
+			return "(?:" + sub + ")?", true
+		case node.Op == syntax.OpStar || (node.Op == syntax.OpRepeat && node.Min == 0):
+			return "(?:" + sub + ")*", true
+		default:
+			// Counted repeats are loosened to one or more, which keeps the
+			// expression small for the database
+			return "(?:" + sub + ")+", true
+		}
+	case syntax.OpConcat:
+		var b strings.Builder
+		for _, sub := range node.Sub {
+			expr, ok := prefilterRegexp(sub)
+			if !ok {
+				return "", false
+			}
+			b.WriteString(expr)
+		}
+		return b.String(), true
+	case syntax.OpAlternate:
+		var alts []string
+		optional := false
+		for _, sub := range node.Sub {
+			expr, ok := prefilterRegexp(sub)
+			if !ok {
+				return "", false
+			}
+			if expr == "" {
+				optional = true
+				continue
+			}
+			alts = append(alts, expr)
+		}
+		if len(alts) == 0 {
+			return "", true
+		}
+		expr := "(?:" + strings.Join(alts, "|") + ")"
+		if optional {
+			expr += "?"
+		}
+		return expr, true
+	}
+	return "", false
+}
+
+// prefilterClass renders the ranges of a character class as a bracket
+// expression. NUL and surrogates are left out, as text never contains them.
+func prefilterClass(ranges []rune) (string, bool) {
+	if len(ranges) > 2*maxPrefilterClassRanges {
+		return ".", true
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(ranges); i += 2 {
+		lo, hi := max(ranges[i], 1), ranges[i+1]
+		for _, part := range [][2]rune{{lo, min(hi, 0xD7FF)}, {max(lo, 0xE000), hi}} {
+			if part[0] > part[1] {
+				continue
+			}
+			b.WriteString(prefilterRune(part[0]))
+			if part[1] > part[0] {
+				b.WriteString("-" + prefilterRune(part[1]))
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "", false
+	}
+	return "[" + b.String() + "]", true
+}
+
+// prefilterRune renders a character of a PostgreSQL regular expression.
+// Anything but ASCII letters and digits is written as an escape.
+func prefilterRune(r rune) string {
+	switch {
+	case r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+		return string(r)
+	case r <= 0xFFFF:
+		return fmt.Sprintf(`\u%04x`, r)
+	default:
+		return fmt.Sprintf(`\U%08x`, r)
+	}
+}
+
+// grepArtifacts pages through the candidates of the search in path order and
+// returns the first in.Limit artifacts that keep accepts
+func (s *artifactService) grepArtifacts(ctx context.Context, diskID uuid.UUID, in GrepInput, re *regexp.Regexp, keep func(*model.Artifact) bool) ([]*model.Artifact, error) {
+	limit := in.Limit
 	// Set default limit if not provided
 	if limit <= 0 {
 		limit = 100
@@ -226,7 +651,121 @@ func (s *artifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID
 		limit = 1000
 	}
 
-	return s.r.GrepArtifacts(ctx, diskID, pattern, limit)
+	q := repo.GrepQuery{Glob: in.Glob}
+	q.Literal, q.CaseInsensitive = grepPrefilter(re)
+	if q.Literal == "" {
+		// Without a literal the database still narrows the candidates, so
+		// their content is not all read and matched here
+		q.Regexp = grepPrefilterRegexp(re)
+	}
+
+	var artifacts []*model.Artifact
+	for {
+		candidates, err := s.r.GrepArtifacts(ctx, diskID, q, limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range candidates {
+			if !keep(a) {
+				continue
+			}
+			artifacts = append(artifacts, a)
+			if len(artifacts) == limit {
+				return artifacts, nil
+			}
+		}
+		if len(candidates) < limit {
+			return artifacts, nil
+		}
+		q.Offset += len(candidates)
+	}
+}
+
+// GrepArtifacts returns the artifacts with at least one line matching the pattern
+func (s *artifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*model.Artifact, error) {
+	re, err := in.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts, err := s.grepArtifacts(ctx, diskID, in, re, func(a *model.Artifact) bool {
+		matches, _ := grepContent(a.AssetMeta.Data().Content, re, 0, 0, 1)
+		return len(matches) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	if artifacts == nil {
+		artifacts = []*model.Artifact{}
+	}
+	return artifacts, nil
+}
+
+// GrepLines searches artifact content like GrepArtifacts but returns the
+// matching lines of each file with their line numbers and surrounding context
+func (s *artifactService) GrepLines(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*GrepFileResult, error) {
+	re, err := in.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	maxMatches := in.MaxMatchesPerFile
+	if maxMatches <= 0 {
+		maxMatches = defaultGrepMatchesPerFile
+	}
+
+	results := []*GrepFileResult{}
+	_, err = s.grepArtifacts(ctx, diskID, in, re, func(a *model.Artifact) bool {
+		matches, truncated := grepContent(a.AssetMeta.Data().Content, re, in.BeforeContext, in.AfterContext, maxMatches)
+		if len(matches) == 0 {
+			return false
+		}
+		results = append(results, &GrepFileResult{
+			Path:      a.Path,
+			Filename:  a.Filename,
+			Matches:   matches,
+			Truncated: truncated,
+		})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// grepContent returns up to maxMatches lines of content that match re, and
+// whether more matching lines were left out
+func grepContent(content string, re *regexp.Regexp, before int, after int, maxMatches int) ([]GrepMatch, bool) {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	var matches []GrepMatch
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		if len(matches) == maxMatches {
+			return matches, true
+		}
+
+		m := GrepMatch{LineNumber: i + 1, Line: line}
+		if before > 0 {
+			m.Before = lines[max(0, i-before):i]
+		}
+		if after > 0 {
+			m.After = lines[i+1 : min(len(lines), i+1+after)]
+		}
+		matches = append(matches, m)
+	}
+
+	return matches, false
 }
 
 func (s *artifactService) GlobArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
@@ -241,3 +780,797 @@ func (s *artifactService) GlobArtifacts(ctx context.Context, projectID uuid.UUID
 
 	return s.r.GlobArtifacts(ctx, diskID, pattern, limit)
 }
+
+// ListVersions returns every version of the artifact, newest first, starting
+// with the current content
+func (s *artifactService) ListVersions(ctx context.Context, artifact *model.Artifact) ([]*model.ArtifactVersion, error) {
+	if artifact == nil {
+		return nil, errors.New("artifact is nil")
+	}
+
+	previous, err := s.r.ListVersions(ctx, artifact.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list artifact versions: %w", err)
+	}
+
+	versions := make([]*model.ArtifactVersion, 0, len(previous)+1)
+	versions = append(versions, &model.ArtifactVersion{
+		ArtifactID: artifact.ID,
+		Version:    artifact.Version,
+		Meta:       artifact.Meta,
+		AssetMeta:  artifact.AssetMeta,
+		CreatedAt:  artifact.UpdatedAt,
+	})
+	return append(versions, previous...), nil
+}
+
+// GetVersion returns a copy of the artifact holding the content and meta of the
+// given version, so it can be passed to GetFileContent, GetFileRange and
+// GetPresignedURL like the current artifact
+func (s *artifactService) GetVersion(ctx context.Context, artifact *model.Artifact, version int) (*model.Artifact, error) {
+	if artifact == nil {
+		return nil, errors.New("artifact is nil")
+	}
+	if version == artifact.Version {
+		return artifact, nil
+	}
+
+	v, err := s.r.GetVersion(ctx, artifact.ID, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: version %d", ErrArtifactVersionNotFound, version)
+		}
+		return nil, fmt.Errorf("get artifact version: %w", err)
+	}
+
+	versioned := *artifact
+	versioned.Version = v.Version
+	versioned.Meta = v.Meta
+	versioned.AssetMeta = v.AssetMeta
+	versioned.UpdatedAt = v.CreatedAt
+	return &versioned, nil
+}
+
+// DiffVersions returns the unified diff of the parsed text content of two
+// versions of the artifact
+func (s *artifactService) DiffVersions(ctx context.Context, artifact *model.Artifact, from int, to int) (string, error) {
+	texts := make([]string, 2)
+	for i, version := range []int{from, to} {
+		versioned, err := s.GetVersion(ctx, artifact, version)
+		if err != nil {
+			return "", err
+		}
+		content, err := s.GetFileContent(ctx, versioned)
+		if err != nil {
+			return "", fmt.Errorf("version %d: %w", version, err)
+		}
+		texts[i] = content.Raw
+	}
+
+	name := artifact.Path + artifact.Filename
+	return diff.Unified(fmt.Sprintf("%s@v%d", name, from), fmt.Sprintf("%s@v%d", name, to), texts[0], texts[1], 3), nil
+}
+
+// RestoreVersion writes the content and meta of a previous version back as a
+// new version, so the restore itself can be undone
+func (s *artifactService) RestoreVersion(ctx context.Context, projectID uuid.UUID, artifact *model.Artifact, version int, cond WriteCondition) (*model.Artifact, error) {
+	if artifact == nil {
+		return nil, errors.New("artifact is nil")
+	}
+	if version == artifact.Version {
+		return nil, fmt.Errorf("%w: version %d is already the current version", ErrInvalidVersion, version)
+	}
+
+	v, err := s.r.GetVersion(ctx, artifact.ID, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: version %d", ErrArtifactVersionNotFound, version)
+		}
+		return nil, fmt.Errorf("get artifact version: %w", err)
+	}
+
+	baseSHA256, err := s.checkWrite(ctx, artifact.DiskID, artifact.Path, artifact.Filename, artifact, cond)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.r.ReplaceContent(ctx, projectID, artifact, v.AssetMeta.Data(), v.Meta, baseSHA256); err != nil {
+		if errors.Is(err, repo.ErrContentChanged) {
+			return nil, ErrPreconditionFailed
+		}
+		return nil, fmt.Errorf("restore artifact version: %w", err)
+	}
+	return artifact, nil
+}
+
+// pathNotFound maps a missing source to ErrPathNotFound
+func pathNotFound(err error, p string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", ErrPathNotFound, p)
+	}
+	return err
+}
+
+// checkDirectoryTransfer rejects moving or copying a directory onto or into itself
+func checkDirectoryTransfer(srcDir string, dstDir string) error {
+	if strings.HasPrefix(dstDir, srcDir) {
+		return fmt.Errorf("%w: %s is inside %s", ErrInvalidPathOperation, dstDir, srcDir)
+	}
+	return nil
+}
+
+// checkDirectoryLocks checks the locks of the artifacts under srcDir when
+// checkSrc is set and, when dstDir is not empty, of the paths they would take
+// under dstDir
+func (s *artifactService) checkDirectoryLocks(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string, checkSrc bool, lockID string) error {
+	if s.locks == nil {
+		return nil
+	}
+	paths, err := s.r.ListFilePaths(ctx, diskID, srcDir)
+	if err != nil {
+		return fmt.Errorf("list file paths: %w", err)
+	}
+	var checked []string
+	if checkSrc {
+		checked = append(checked, paths...)
+	}
+	if dstDir != "" {
+		for _, p := range paths {
+			checked = append(checked, dstDir+strings.TrimPrefix(p, srcDir))
+		}
+	}
+	return checkLocks(ctx, s.locks, diskID, checked, lockID)
+}
+
+// MoveArtifact moves an artifact to a new path. Both paths must be free of
+// other holders' locks, and cond.IfMatch applies to the source.
+func (s *artifactService) MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, cond WriteCondition) (*model.Artifact, error) {
+	if srcFilename == "" || dstFilename == "" {
+		return nil, fmt.Errorf("%w: source and destination filenames are required", ErrInvalidPathOperation)
+	}
+	if srcPath == dstPath && srcFilename == dstFilename {
+		return nil, fmt.Errorf("%w: source and destination are the same", ErrInvalidPathOperation)
+	}
+	var current *model.Artifact
+	if cond.IfMatch != "" {
+		var err error
+		if current, err = s.r.GetByPath(ctx, diskID, srcPath, srcFilename); err != nil {
+			return nil, pathNotFound(err, srcPath+srcFilename)
+		}
+	}
+	baseSHA256, err := s.checkWrite(ctx, diskID, srcPath, srcFilename, current, cond)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLocks(ctx, s.locks, diskID, []string{dstPath + dstFilename}, cond.LockID); err != nil {
+		return nil, err
+	}
+	a, err := s.r.MoveArtifact(ctx, diskID, srcPath, srcFilename, dstPath, dstFilename, baseSHA256)
+	if err != nil {
+		if errors.Is(err, repo.ErrContentChanged) {
+			return nil, ErrPreconditionFailed
+		}
+		return nil, pathNotFound(err, srcPath+srcFilename)
+	}
+	return a, nil
+}
+
+func (s *artifactService) MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	if err := checkDirectoryTransfer(srcDir, dstDir); err != nil {
+		return 0, err
+	}
+	if err := s.checkDirectoryLocks(ctx, diskID, srcDir, dstDir, true, lockID); err != nil {
+		return 0, err
+	}
+	n, err := s.r.MoveDirectory(ctx, diskID, srcDir, dstDir)
+	if err != nil {
+		return 0, pathNotFound(err, srcDir)
+	}
+	return n, nil
+}
+
+// CopyArtifact copies an artifact to a new path, which must be free of other
+// holders' locks
+func (s *artifactService) CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, lockID string) (*model.Artifact, error) {
+	if srcFilename == "" || dstFilename == "" {
+		return nil, fmt.Errorf("%w: source and destination filenames are required", ErrInvalidPathOperation)
+	}
+	if srcPath == dstPath && srcFilename == dstFilename {
+		return nil, fmt.Errorf("%w: source and destination are the same", ErrInvalidPathOperation)
+	}
+	if err := checkLocks(ctx, s.locks, diskID, []string{dstPath + dstFilename}, lockID); err != nil {
+		return nil, err
+	}
+	a, err := s.r.CopyArtifact(ctx, projectID, diskID, srcPath, srcFilename, dstPath, dstFilename)
+	if err != nil {
+		return nil, pathNotFound(err, srcPath+srcFilename)
+	}
+	return a, nil
+}
+
+func (s *artifactService) CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	if err := checkDirectoryTransfer(srcDir, dstDir); err != nil {
+		return 0, err
+	}
+	if err := s.checkDirectoryLocks(ctx, diskID, srcDir, dstDir, false, lockID); err != nil {
+		return 0, err
+	}
+	n, err := s.r.CopyDirectory(ctx, projectID, diskID, srcDir, dstDir)
+	if err != nil {
+		return 0, pathNotFound(err, srcDir)
+	}
+	return n, nil
+}
+
+func (s *artifactService) RemoveDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool, lockID string) (int64, error) {
+	// A non-recursive delete only removes empty directories
+	if recursive {
+		if err := s.checkDirectoryLocks(ctx, diskID, dir, "", true, lockID); err != nil {
+			return 0, err
+		}
+	}
+	n, err := s.r.DeleteDirectory(ctx, projectID, diskID, dir, recursive)
+	if err != nil {
+		return 0, pathNotFound(err, dir)
+	}
+	return n, nil
+}
+
+func (s *artifactService) MakeDirectory(ctx context.Context, diskID uuid.UUID, dir string) error {
+	if dir == "/" {
+		return nil
+	}
+	return s.r.CreateDirectory(ctx, diskID, dir)
+}
+
+const (
+	// multipartUploadThreshold is the size above which direct uploads are split into parts
+	multipartUploadThreshold = 64 << 20
+	minUploadPartSize        = 16 << 20
+	maxUploadParts           = 10000
+	// maxExtractTextSize caps the size of directly uploaded files whose text is
+	// extracted for grep, matching the default limit of regular uploads
+	maxExtractTextSize = 16 << 20
+)
+
+type CreateUploadInput struct {
+	ProjectID   uuid.UUID
+	DiskID      uuid.UUID
+	Path        string
+	Filename    string
+	SizeB       int64
+	ContentType string
+	UserMeta    map[string]interface{}
+	Expire      time.Duration
+}
+
+// UploadPlan tells the client how to upload a file directly to storage. Method
+// is "PUT" for a single presigned PUT to URL, or "MULTIPART" for one presigned
+// PUT per part, each PartSize bytes except the last.
+type UploadPlan struct {
+	UploadID  uuid.UUID         `json:"upload_id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	PartSize  int64             `json:"part_size,omitempty"`
+	Parts     []UploadPart      `json:"parts,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+type UploadPart struct {
+	PartNumber int32  `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+// uploadPartSize returns the part size for a multipart upload of size bytes,
+// rounded up to whole MiB and large enough to stay within S3's part limit
+func uploadPartSize(size int64) int64 {
+	partSize := int64(minUploadPartSize)
+	if n := (size + maxUploadParts - 1) / maxUploadParts; n > partSize {
+		partSize = (n + (1<<20 - 1)) &^ (1<<20 - 1)
+	}
+	return partSize
+}
+
+// CreateUpload starts a direct-to-storage upload and returns presigned URLs for
+// it. The artifact is created by FinalizeUpload once the content is uploaded.
+func (s *artifactService) CreateUpload(ctx context.Context, in CreateUploadInput) (*UploadPlan, error) {
+	upload := &model.ArtifactUpload{
+		ID:          uuid.New(),
+		ProjectID:   in.ProjectID,
+		DiskID:      in.DiskID,
+		Path:        in.Path,
+		Filename:    in.Filename,
+		SizeB:       in.SizeB,
+		ContentType: in.ContentType,
+		UserMeta:    in.UserMeta,
+		ExpiresAt:   time.Now().Add(in.Expire),
+	}
+	ext := strings.ToLower(filepath.Ext(in.Filename))
+	upload.S3Key = fmt.Sprintf("disks/%s/uploads/%s%s", in.ProjectID, upload.ID, ext)
+
+	plan := &UploadPlan{UploadID: upload.ID, ExpiresAt: upload.ExpiresAt}
+	if in.SizeB <= multipartUploadThreshold {
+		url, err := s.s3.PresignPut(ctx, upload.S3Key, in.ContentType, in.Expire)
+		if err != nil {
+			return nil, fmt.Errorf("presign upload: %w", err)
+		}
+		plan.Method = "PUT"
+		plan.URL = url
+		plan.Headers = map[string]string{"Content-Type": in.ContentType}
+	} else {
+		partSize := uploadPartSize(in.SizeB)
+		partCount := int32((in.SizeB + partSize - 1) / partSize)
+
+		multipartID, err := s.s3.CreateMultipartUpload(ctx, upload.S3Key, in.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		upload.MultipartUploadID = multipartID
+		upload.PartCount = partCount
+
+		plan.Method = "MULTIPART"
+		plan.PartSize = partSize
+		plan.Parts = make([]UploadPart, 0, partCount)
+		for n := int32(1); n <= partCount; n++ {
+			url, err := s.s3.PresignUploadPart(ctx, upload.S3Key, multipartID, n, in.Expire)
+			if err != nil {
+				_ = s.s3.AbortMultipartUpload(ctx, upload.S3Key, multipartID)
+				return nil, fmt.Errorf("presign upload part %d: %w", n, err)
+			}
+			plan.Parts = append(plan.Parts, UploadPart{PartNumber: n, URL: url})
+		}
+	}
+
+	if err := s.r.CreateUpload(ctx, upload); err != nil {
+		if upload.MultipartUploadID != "" {
+			_ = s.s3.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartUploadID)
+		}
+		return nil, fmt.Errorf("create upload record: %w", err)
+	}
+
+	return plan, nil
+}
+
+type FinalizeUploadInput struct {
+	ProjectID uuid.UUID
+	DiskID    uuid.UUID
+	UploadID  uuid.UUID
+	SHA256    string
+	Condition WriteCondition
+}
+
+// FinalizeUpload verifies the content of a direct upload against its declared
+// sha256 and size, then stores it as an artifact like Create does
+func (s *artifactService) FinalizeUpload(ctx context.Context, in FinalizeUploadInput) (*model.Artifact, error) {
+	upload, err := s.r.GetUpload(ctx, in.DiskID, in.UploadID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	if upload.ProjectID != in.ProjectID {
+		return nil, ErrUploadNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		_ = s.discardUpload(ctx, upload)
+		return nil, ErrUploadExpired
+	}
+
+	// Check the write before the upload is claimed, so a rejected finalize can be retried
+	var current *model.Artifact
+	if in.Condition.IfMatch != "" {
+		if current, err = s.r.GetByPath(ctx, upload.DiskID, upload.Path, upload.Filename); err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("check artifact existence: %w", err)
+			}
+			current = nil
+		}
+	}
+	baseSHA256, err := s.checkWrite(ctx, upload.DiskID, upload.Path, upload.Filename, current, in.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claim the upload so a concurrent finalize of the same upload stops here
+	if err := s.r.ClaimUpload(ctx, upload.ID, time.Now().Add(uploadClaimTTL)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+
+	artifact, err := s.finalizeClaimedUpload(ctx, upload, in.SHA256, baseSHA256)
+	if err != nil {
+		// Keep the upload and its staging object so the finalize can be retried
+		_ = s.r.ReleaseUpload(ctx, upload.ID)
+		return nil, err
+	}
+	_ = s.discardUpload(ctx, upload)
+	return artifact, nil
+}
+
+// finalizeClaimedUpload stores the content of a claimed upload as its artifact.
+// The upload record and staging object are left for the caller to remove.
+func (s *artifactService) finalizeClaimedUpload(ctx context.Context, upload *model.ArtifactUpload, wantSHA256 string, baseSHA256 string) (*model.Artifact, error) {
+	if upload.MultipartUploadID != "" {
+		// A finalize retried after the parts were assembled finds the object in place
+		assembled, err := s.s3.ObjectExists(ctx, upload.S3Key)
+		if err != nil {
+			return nil, err
+		}
+		if !assembled {
+			if err := s.s3.CompleteMultipartUpload(ctx, upload.S3Key, upload.MultipartUploadID, upload.PartCount); err != nil {
+				if errors.Is(err, blob.ErrMissingParts) {
+					return nil, fmt.Errorf("%w: %v", ErrUploadIncomplete, err)
+				}
+				return nil, err
+			}
+		}
+	}
+
+	sumHex, size, head, err := s.s3.HashObject(ctx, upload.S3Key, 3072)
+	if err != nil {
+		if errors.Is(err, blob.ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrUploadIncomplete, err)
+		}
+		return nil, err
+	}
+	if size != upload.SizeB || !strings.EqualFold(sumHex, wantSHA256) {
+		_ = s.discardUpload(ctx, upload)
+		return nil, ErrUploadChecksumMismatch
+	}
+
+	ext := strings.ToLower(filepath.Ext(upload.Filename))
+	contentType := mime.DetectMimeType(head, upload.Filename)
+	asset, err := s.s3.PromoteObject(ctx, upload.S3Key, "disks/"+upload.ProjectID.String(), sumHex, contentType, ext, size)
+	if err != nil {
+		return nil, fmt.Errorf("store uploaded file: %w", err)
+	}
+
+	// Extract and store text content for text-searchable files
+	parser := fileparser.NewFileParser()
+	if size <= maxExtractTextSize && parser.CanParseFile(upload.Filename, asset.MIME) {
+		if content, err := s.s3.DownloadFile(ctx, asset.S3Key); err == nil {
+			if fileContent, err := parser.ParseFile(upload.Filename, asset.MIME, content); err == nil && fileContent != nil {
+				asset.Content = fileContent.Raw
+			}
+		}
+	}
+
+	existing, err := s.r.GetByPath(ctx, upload.DiskID, upload.Path, upload.Filename)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("check artifact existence: %w", err)
+		}
+		existing = nil
+	}
+
+	return s.saveArtifact(ctx, upload.ProjectID, upload.DiskID, existing, upload.Path, upload.Filename, asset, upload.UserMeta, baseSHA256)
+}
+
+// discardUpload removes a pending upload and whatever was uploaded for it. Only
+// failing to remove the upload record is reported, storage is cleaned up best effort.
+func (s *artifactService) discardUpload(ctx context.Context, upload *model.ArtifactUpload) error {
+	if upload.MultipartUploadID != "" {
+		_ = s.s3.AbortMultipartUpload(ctx, upload.S3Key, upload.MultipartUploadID)
+	}
+	_ = s.s3.DeleteObject(ctx, upload.S3Key)
+	if err := s.r.DeleteUpload(ctx, upload.ID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
+
+// uploadClaimTTL bounds how long a finalize holds an upload. A claim left by a
+// finalize that never finished can be taken over after it.
+const uploadClaimTTL = 15 * time.Minute
+
+// pruneUploadsBatchSize is the number of expired uploads discarded per query
+const pruneUploadsBatchSize = 100
+
+// PruneExpiredUploads discards the uploads that expired before the given time,
+// with their staging objects and open multipart uploads, and returns how many
+// were discarded
+func (s *artifactService) PruneExpiredUploads(ctx context.Context, before time.Time) (int, error) {
+	pruned := 0
+	for {
+		uploads, err := s.r.ListExpiredUploads(ctx, before, pruneUploadsBatchSize)
+		if err != nil {
+			return pruned, fmt.Errorf("list expired uploads: %w", err)
+		}
+		for _, upload := range uploads {
+			if err := s.discardUpload(ctx, upload); err != nil {
+				return pruned, fmt.Errorf("discard upload %s: %w", upload.ID, err)
+			}
+			pruned++
+		}
+		if len(uploads) < pruneUploadsBatchSize {
+			return pruned, nil
+		}
+	}
+}
+
+// Text edit operations
+const (
+	EditStrReplace       = "str_replace"
+	EditInsertAtLine     = "insert_at_line"
+	EditAppend           = "append"
+	EditDeleteLines      = "delete_lines"
+	EditApplyUnifiedDiff = "apply_unified_diff"
+
+	// maxEditAttempts bounds how often an edit is reapplied to fresh content
+	// when another writer replaces the artifact while it is being edited
+	maxEditAttempts = 3
+)
+
+// TextEdit is one in-place edit of a text artifact. Line numbers are 1-based.
+type TextEdit struct {
+	Op string
+	// OldStr is replaced by NewStr in str_replace and must occur exactly once
+	OldStr string
+	NewStr string
+	// Line is the line insert_at_line inserts after (0 inserts at the top),
+	// and the first line delete_lines removes
+	Line int
+	// EndLine is the last line delete_lines removes, defaulting to Line
+	EndLine int
+	// Text is inserted by insert_at_line or appended by append
+	Text string
+	// Diff is the unified diff applied by apply_unified_diff
+	Diff string
+}
+
+type EditTextInput struct {
+	ProjectID uuid.UUID
+	DiskID    uuid.UUID
+	Path      string
+	Filename  string
+	Edits     []TextEdit
+	Condition WriteCondition
+}
+
+// EditText applies edits in order to a text artifact and stores the result as
+// a new version, with its text refreshed for grep. Either every edit applies
+// or the artifact is left unchanged. When another writer replaces the
+// artifact in the meantime, the edits are reapplied to its new content,
+// unless the edit carries an If-Match.
+func (s *artifactService) EditText(ctx context.Context, in EditTextInput) (*model.Artifact, error) {
+	if len(in.Edits) == 0 {
+		return nil, fmt.Errorf("%w: no operations", ErrInvalidEdit)
+	}
+
+	parser := fileparser.NewFileParser()
+	for attempt := 0; attempt < maxEditAttempts; attempt++ {
+		artifact, err := s.r.GetByPath(ctx, in.DiskID, in.Path, in.Filename)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s%s", ErrPathNotFound, in.Path, in.Filename)
+			}
+			return nil, fmt.Errorf("get artifact: %w", err)
+		}
+
+		if _, err := s.checkWrite(ctx, in.DiskID, in.Path, in.Filename, artifact, in.Condition); err != nil {
+			return nil, err
+		}
+
+		base := artifact.AssetMeta.Data()
+		if !parser.CanParseFile(artifact.Filename, base.MIME) || base.SizeB > maxExtractTextSize {
+			return nil, fmt.Errorf("%w: %s is not an editable text file", ErrInvalidEdit, artifact.Filename)
+		}
+
+		content, err := s.s3.DownloadFile(ctx, base.S3Key)
+		if err != nil {
+			return nil, fmt.Errorf("download file content: %w", err)
+		}
+		if !utf8.Valid(content) {
+			return nil, fmt.Errorf("%w: %s is not valid UTF-8 text", ErrInvalidEdit, artifact.Filename)
+		}
+
+		text, err := applyTextEdits(string(content), in.Edits)
+		if err != nil {
+			return nil, err
+		}
+		if text == string(content) {
+			return artifact, nil
+		}
+
+		asset, err := s.s3.UploadBytes(ctx, "disks/"+in.ProjectID.String(), artifact.Filename, []byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("upload file to S3: %w", err)
+		}
+		if fileContent, err := parser.ParseFile(artifact.Filename, asset.MIME, []byte(text)); err == nil && fileContent != nil {
+			asset.Content = fileContent.Raw
+		}
+
+		err = s.r.ReplaceContent(ctx, in.ProjectID, artifact, *asset, withContentInfo(artifact.Meta, asset), base.SHA256)
+		if errors.Is(err, repo.ErrContentChanged) {
+			if in.Condition.IfMatch != "" {
+				return nil, ErrPreconditionFailed
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("save edited artifact: %w", err)
+		}
+		return artifact, nil
+	}
+
+	return nil, ErrEditConflict
+}
+
+// withContentInfo returns a copy of meta whose artifact info describes asset
+func withContentInfo(meta datatypes.JSONMap, asset *model.Asset) datatypes.JSONMap {
+	out := make(datatypes.JSONMap, len(meta))
+	for k, v := range meta {
+		out[k] = v
+	}
+	info := map[string]interface{}{}
+	if old, ok := meta[model.ArtifactInfoKey].(map[string]interface{}); ok {
+		for k, v := range old {
+			info[k] = v
+		}
+	}
+	info["mime"] = asset.MIME
+	info["size"] = asset.SizeB
+	out[model.ArtifactInfoKey] = info
+	return out
+}
+
+// applyTextEdits applies edits to text in order
+func applyTextEdits(text string, edits []TextEdit) (string, error) {
+	for i, e := range edits {
+		var err error
+		text, err = applyTextEdit(text, e)
+		if err != nil {
+			return "", fmt.Errorf("%w: operation %d (%s): %v", ErrInvalidEdit, i+1, e.Op, err)
+		}
+	}
+	return text, nil
+}
+
+func applyTextEdit(text string, e TextEdit) (string, error) {
+	switch e.Op {
+	case EditStrReplace:
+		if e.OldStr == "" {
+			return "", errors.New("old_str is required")
+		}
+		switch n := strings.Count(text, e.OldStr); n {
+		case 0:
+			return "", errors.New("old_str was not found")
+		case 1:
+			return strings.Replace(text, e.OldStr, e.NewStr, 1), nil
+		default:
+			return "", fmt.Errorf("old_str matches %d times; include more context to make it unique", n)
+		}
+
+	case EditInsertAtLine:
+		if e.Text == "" {
+			return "", errors.New("text is required")
+		}
+		lines := splitTextLines(text)
+		if e.Line < 0 || e.Line > len(lines) {
+			return "", fmt.Errorf("line %d is out of range, the file has %d lines", e.Line, len(lines))
+		}
+		ins := e.Text
+		if e.Line < len(lines) && !strings.HasSuffix(ins, "\n") {
+			ins += "\n"
+		}
+		if e.Line == len(lines) && e.Line > 0 && !strings.HasSuffix(lines[e.Line-1], "\n") {
+			lines[e.Line-1] += "\n"
+		}
+		return strings.Join(lines[:e.Line], "") + ins + strings.Join(lines[e.Line:], ""), nil
+
+	case EditAppend:
+		if e.Text == "" {
+			return "", errors.New("text is required")
+		}
+		return text + e.Text, nil
+
+	case EditDeleteLines:
+		lines := splitTextLines(text)
+		end := e.EndLine
+		if end == 0 {
+			end = e.Line
+		}
+		if e.Line < 1 || end < e.Line || end > len(lines) {
+			return "", fmt.Errorf("lines %d-%d are out of range, the file has %d lines", e.Line, end, len(lines))
+		}
+		return strings.Join(lines[:e.Line-1], "") + strings.Join(lines[end:], ""), nil
+
+	case EditApplyUnifiedDiff:
+		if e.Diff == "" {
+			return "", errors.New("diff is required")
+		}
+		return diff.Apply(text, e.Diff)
+
+	default:
+		return "", fmt.Errorf("unknown operation %q", e.Op)
+	}
+}
+
+// splitTextLines splits text into lines that keep their trailing newline
+func splitTextLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// ArtifactLock is an advisory lease on an artifact path
+type ArtifactLock struct {
+	LockID    string    `json:"lock_id"`
+	FilePath  string    `json:"file_path"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AcquireLock takes a lock on a path for ttl, or renews it when lockID names
+// the caller's current lock. The path does not have to exist yet.
+func (s *artifactService) AcquireLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string, ttl time.Duration) (*ArtifactLock, error) {
+	if s.locks == nil {
+		return nil, ErrLocksUnavailable
+	}
+	key := artifactLockKey(diskID, path, filename)
+
+	if lockID == "" {
+		lockID = uuid.NewString()
+		ok, err := s.locks.acquire(ctx, key, lockID, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("acquire lock: %w", err)
+		}
+		if !ok {
+			return nil, ErrArtifactLocked
+		}
+	} else {
+		renewed, err := s.locks.renew(ctx, key, lockID, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("renew lock: %w", err)
+		}
+		if !renewed {
+			return nil, ErrLockNotHeld
+		}
+	}
+
+	return &ArtifactLock{LockID: lockID, FilePath: path + filename, ExpiresAt: time.Now().Add(ttl)}, nil
+}
+
+func (s *artifactService) ReleaseLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string) error {
+	if s.locks == nil {
+		return ErrLocksUnavailable
+	}
+	released, err := s.locks.release(ctx, artifactLockKey(diskID, path, filename), lockID)
+	if err != nil {
+		return fmt.Errorf("release lock: %w", err)
+	}
+	if !released {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// checkWrite checks a write to a path against its lock and cond. current is
+// the artifact at the path, or nil if there is none; it is only consulted for
+// an If-Match. It returns the SHA256 the content must still have when the
+// write is stored, or "" when any content may be replaced.
+func (s *artifactService) checkWrite(ctx context.Context, diskID uuid.UUID, path string, filename string, current *model.Artifact, cond WriteCondition) (string, error) {
+	if err := checkLocks(ctx, s.locks, diskID, []string{path + filename}, cond.LockID); err != nil {
+		return "", err
+	}
+
+	if cond.IfMatch == "" {
+		return "", nil
+	}
+	if current == nil {
+		return "", ErrPreconditionFailed
+	}
+	asset := current.AssetMeta.Data()
+	if cond.IfMatch != "*" && cond.IfMatch != asset.SHA256 && cond.IfMatch != asset.ETag {
+		return "", ErrPreconditionFailed
+	}
+	return asset.SHA256, nil
+}
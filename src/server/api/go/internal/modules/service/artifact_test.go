@@ -2,17 +2,31 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/infra/blob"
 	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/modules/repo"
 	"github.com/memodb-io/Luminox/internal/pkg/utils/fileparser"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockArtifactRepo is a mock implementation of ArtifactRepo
@@ -25,13 +39,13 @@ func (m *MockArtifactRepo) Create(ctx context.Context, projectID uuid.UUID, f *m
 	return args.Error(0)
 }
 
-func (m *MockArtifactRepo) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error {
-	args := m.Called(ctx, projectID, diskID, path, filename)
+func (m *MockArtifactRepo) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, baseSHA256 string) error {
+	args := m.Called(ctx, projectID, diskID, path, filename, baseSHA256)
 	return args.Error(0)
 }
 
-func (m *MockArtifactRepo) Update(ctx context.Context, f *model.Artifact) error {
-	args := m.Called(ctx, f)
+func (m *MockArtifactRepo) Update(ctx context.Context, f *model.Artifact, baseSHA256 string) error {
+	args := m.Called(ctx, f, baseSHA256)
 	return args.Error(0)
 }
 
@@ -64,8 +78,8 @@ func (m *MockArtifactRepo) ExistsByPathAndFilename(ctx context.Context, diskID u
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockArtifactRepo) GrepArtifacts(ctx context.Context, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
-	args := m.Called(ctx, diskID, pattern, limit)
+func (m *MockArtifactRepo) GrepArtifacts(ctx context.Context, diskID uuid.UUID, q repo.GrepQuery, limit int) ([]*model.Artifact, error) {
+	args := m.Called(ctx, diskID, q, limit)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -80,6 +94,107 @@ func (m *MockArtifactRepo) GlobArtifacts(ctx context.Context, diskID uuid.UUID,
 	return args.Get(0).([]*model.Artifact), args.Error(1)
 }
 
+func (m *MockArtifactRepo) ReplaceContent(ctx context.Context, projectID uuid.UUID, a *model.Artifact, asset model.Asset, meta datatypes.JSONMap, baseSHA256 string) error {
+	args := m.Called(ctx, projectID, a, asset, meta, baseSHA256)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) ListVersions(ctx context.Context, artifactID uuid.UUID) ([]*model.ArtifactVersion, error) {
+	args := m.Called(ctx, artifactID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.ArtifactVersion), args.Error(1)
+}
+
+func (m *MockArtifactRepo) GetVersion(ctx context.Context, artifactID uuid.UUID, version int) (*model.ArtifactVersion, error) {
+	args := m.Called(ctx, artifactID, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ArtifactVersion), args.Error(1)
+}
+
+func (m *MockArtifactRepo) MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, baseSHA256 string) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, srcPath, srcFilename, dstPath, dstFilename, baseSHA256)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactRepo) MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string) (int64, error) {
+	args := m.Called(ctx, diskID, srcDir, dstDir)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactRepo) CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string) (*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, srcPath, srcFilename, dstPath, dstFilename)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockArtifactRepo) CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, srcDir, dstDir)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactRepo) DeleteDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, dir, recursive)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockArtifactRepo) CreateDirectory(ctx context.Context, diskID uuid.UUID, dir string) error {
+	args := m.Called(ctx, diskID, dir)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) ListFilePaths(ctx context.Context, diskID uuid.UUID, dir string) ([]string, error) {
+	args := m.Called(ctx, diskID, dir)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockArtifactRepo) CreateUpload(ctx context.Context, u *model.ArtifactUpload) error {
+	args := m.Called(ctx, u)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) GetUpload(ctx context.Context, diskID uuid.UUID, uploadID uuid.UUID) (*model.ArtifactUpload, error) {
+	args := m.Called(ctx, diskID, uploadID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactRepo) ListExpiredUploads(ctx context.Context, before time.Time, limit int) ([]*model.ArtifactUpload, error) {
+	args := m.Called(ctx, before, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.ArtifactUpload), args.Error(1)
+}
+
+func (m *MockArtifactRepo) ClaimUpload(ctx context.Context, uploadID uuid.UUID, until time.Time) error {
+	args := m.Called(ctx, uploadID, until)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) ReleaseUpload(ctx context.Context, uploadID uuid.UUID) error {
+	args := m.Called(ctx, uploadID)
+	return args.Error(0)
+}
+
+func (m *MockArtifactRepo) DeleteUpload(ctx context.Context, uploadID uuid.UUID) error {
+	args := m.Called(ctx, uploadID)
+	return args.Error(0)
+}
+
 // MockArtifactS3Deps is a mock implementation of blob.S3Deps for file service
 type MockArtifactS3Deps struct {
 	mock.Mock
@@ -217,11 +332,11 @@ func (s *testArtifactService) Create(ctx context.Context, in CreateArtifactInput
 	return file, nil
 }
 
-func (s *testArtifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string) error {
+func (s *testArtifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, cond WriteCondition) error {
 	if path == "" || filename == "" {
 		return errors.New("path and filename are required")
 	}
-	return s.r.DeleteByPath(ctx, projectID, diskID, path, filename)
+	return s.r.DeleteByPath(ctx, projectID, diskID, path, filename, "")
 }
 
 func (s *testArtifactService) GetByPath(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.Artifact, error) {
@@ -252,7 +367,7 @@ func (s *testArtifactService) GetAllPaths(ctx context.Context, diskID uuid.UUID)
 	return s.r.GetAllPaths(ctx, diskID)
 }
 
-func (s *testArtifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}) (*model.Artifact, error) {
+func (s *testArtifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}, cond WriteCondition) (*model.Artifact, error) {
 	// Get existing artifact
 	artifact, err := s.GetByPath(ctx, diskID, path, filename)
 	if err != nil {
@@ -283,7 +398,7 @@ func (s *testArtifactService) UpdateArtifactMetaByPath(ctx context.Context, disk
 	// Update artifact meta
 	artifact.Meta = newMeta
 
-	if err := s.r.Update(ctx, artifact); err != nil {
+	if err := s.r.Update(ctx, artifact, ""); err != nil {
 		return nil, err
 	}
 
@@ -303,11 +418,101 @@ func (s *testArtifactService) GetFileContent(ctx context.Context, artifact *mode
 	}, nil
 }
 
-func (s *testArtifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
+func (s *testArtifactService) GetFileRange(ctx context.Context, artifact *model.Artifact, offset int64, limit int64) (*FileRange, error) {
+	// Test implementation - ranged S3 reads are not exercised here
+	if artifact == nil {
+		return nil, errors.New("artifact is nil")
+	}
+	return &FileRange{Offset: offset, TotalSize: artifact.AssetMeta.Data().SizeB, Data: []byte{}}, nil
+}
+
+func (s *testArtifactService) ListVersions(ctx context.Context, artifact *model.Artifact) ([]*model.ArtifactVersion, error) {
+	return s.r.ListVersions(ctx, artifact.ID)
+}
+
+func (s *testArtifactService) GetVersion(ctx context.Context, artifact *model.Artifact, version int) (*model.Artifact, error) {
+	// Test implementation - versions are exercised through artifactService
+	return artifact, nil
+}
+
+func (s *testArtifactService) DiffVersions(ctx context.Context, artifact *model.Artifact, from int, to int) (string, error) {
+	return "", nil
+}
+
+func (s *testArtifactService) RestoreVersion(ctx context.Context, projectID uuid.UUID, artifact *model.Artifact, version int, cond WriteCondition) (*model.Artifact, error) {
+	return artifact, nil
+}
+
+func (s *testArtifactService) MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, cond WriteCondition) (*model.Artifact, error) {
+	return s.r.MoveArtifact(ctx, diskID, srcPath, srcFilename, dstPath, dstFilename, "")
+}
+
+func (s *testArtifactService) MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	return s.r.MoveDirectory(ctx, diskID, srcDir, dstDir)
+}
+
+func (s *testArtifactService) CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, lockID string) (*model.Artifact, error) {
+	return s.r.CopyArtifact(ctx, projectID, diskID, srcPath, srcFilename, dstPath, dstFilename)
+}
+
+func (s *testArtifactService) CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	return s.r.CopyDirectory(ctx, projectID, diskID, srcDir, dstDir)
+}
+
+func (s *testArtifactService) RemoveDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool, lockID string) (int64, error) {
+	return s.r.DeleteDirectory(ctx, projectID, diskID, dir, recursive)
+}
+
+func (s *testArtifactService) MakeDirectory(ctx context.Context, diskID uuid.UUID, dir string) error {
+	return s.r.CreateDirectory(ctx, diskID, dir)
+}
+
+func (s *testArtifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*model.Artifact, error) {
 	// Test implementation - return empty list for now
 	return []*model.Artifact{}, nil
 }
 
+func (s *testArtifactService) CreateUpload(ctx context.Context, in CreateUploadInput) (*UploadPlan, error) {
+	// Test implementation - presigned uploads are not exercised here
+	upload := &model.ArtifactUpload{ID: uuid.New(), ProjectID: in.ProjectID, DiskID: in.DiskID, Path: in.Path, Filename: in.Filename, SizeB: in.SizeB}
+	if err := s.r.CreateUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+	return &UploadPlan{UploadID: upload.ID, Method: "PUT"}, nil
+}
+
+func (s *testArtifactService) FinalizeUpload(ctx context.Context, in FinalizeUploadInput) (*model.Artifact, error) {
+	// Test implementation - storage verification is not exercised here
+	if _, err := s.r.GetUpload(ctx, in.DiskID, in.UploadID); err != nil {
+		return nil, ErrUploadNotFound
+	}
+	return nil, ErrUploadIncomplete
+}
+
+func (s *testArtifactService) PruneExpiredUploads(ctx context.Context, before time.Time) (int, error) {
+	// Test implementation - pruning is exercised through artifactService
+	return 0, nil
+}
+
+func (s *testArtifactService) EditText(ctx context.Context, in EditTextInput) (*model.Artifact, error) {
+	// Test implementation - edits are exercised through artifactService
+	return s.r.GetByPath(ctx, in.DiskID, in.Path, in.Filename)
+}
+
+func (s *testArtifactService) AcquireLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string, ttl time.Duration) (*ArtifactLock, error) {
+	// Test implementation - locks need Redis and are not exercised here
+	return nil, ErrLocksUnavailable
+}
+
+func (s *testArtifactService) ReleaseLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string) error {
+	return ErrLocksUnavailable
+}
+
+func (s *testArtifactService) GrepLines(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*GrepFileResult, error) {
+	// Test implementation - return empty list for now
+	return []*GrepFileResult{}, nil
+}
+
 func (s *testArtifactService) GlobArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
 	// Test implementation - return empty list for now
 	return []*model.Artifact{}, nil
@@ -447,7 +652,7 @@ func TestArtifactService_UpdateArtifactMetaByPath(t *testing.T) {
 						return false
 					}
 					return true
-				})).Return(nil)
+				}), "").Return(nil)
 			},
 			expectError: false,
 		},
@@ -492,7 +697,7 @@ func TestArtifactService_UpdateArtifactMetaByPath(t *testing.T) {
 				existingArtifact.Filename = filename
 
 				repo.On("GetByPath", mock.Anything, diskID, path, filename).Return(existingArtifact, nil)
-				repo.On("Update", mock.Anything, mock.Anything).Return(errors.New("update error"))
+				repo.On("Update", mock.Anything, mock.Anything, "").Return(errors.New("update error"))
 			},
 			expectError: true,
 			errorMsg:    "update error",
@@ -506,7 +711,7 @@ func TestArtifactService_UpdateArtifactMetaByPath(t *testing.T) {
 
 			service := newTestArtifactService(mockRepo, &MockArtifactS3Deps{})
 
-			artifact, err := service.UpdateArtifactMetaByPath(context.Background(), diskID, path, filename, tt.userMeta)
+			artifact, err := service.UpdateArtifactMetaByPath(context.Background(), diskID, path, filename, tt.userMeta, WriteCondition{})
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -531,51 +736,84 @@ func TestArtifactService_UpdateArtifactMetaByPath(t *testing.T) {
 }
 
 func TestArtifactService_GrepArtifacts(t *testing.T) {
+	textArtifact := func(filename, content string) *model.Artifact {
+		return &model.Artifact{Filename: filename, Path: "/", AssetMeta: datatypes.NewJSONType(model.Asset{Content: content})}
+	}
+
 	tests := []struct {
 		name      string
 		pattern   string
 		limit     int
 		setupMock func(*MockArtifactRepo)
-		wantCount int
-		wantErr   bool
+		wantFiles []string
+		wantErr   error
 	}{
 		{
 			name:    "successful search with default limit",
 			pattern: "TODO",
 			limit:   0, // Should default to 100
-			setupMock: func(repo *MockArtifactRepo) {
-				repo.On("GrepArtifacts", mock.Anything, mock.Anything, "TODO", 100).
-					Return([]*model.Artifact{
-						{Filename: "test.py", Path: "/"},
-					}, nil)
+			setupMock: func(m *MockArtifactRepo) {
+				m.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "TODO"}, 100).
+					Return([]*model.Artifact{textArtifact("test.py", "# TODO: test\n")}, nil)
 			},
-			wantCount: 1,
-			wantErr:   false,
+			wantFiles: []string{"test.py"},
 		},
 		{
 			name:    "limit capped at 1000",
 			pattern: "function",
 			limit:   5000, // Should be capped to 1000
-			setupMock: func(repo *MockArtifactRepo) {
-				repo.On("GrepArtifacts", mock.Anything, mock.Anything, "function", 1000).
+			setupMock: func(m *MockArtifactRepo) {
+				m.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "function"}, 1000).
 					Return([]*model.Artifact{}, nil)
 			},
-			wantCount: 0,
-			wantErr:   false,
+			wantFiles: []string{},
 		},
 		{
-			name:    "custom limit",
-			pattern: "import",
+			name:    "go syntax is matched in go",
+			pattern: `\bimport\b`,
 			limit:   50,
-			setupMock: func(repo *MockArtifactRepo) {
-				repo.On("GrepArtifacts", mock.Anything, mock.Anything, "import", 50).
+			setupMock: func(m *MockArtifactRepo) {
+				m.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "import"}, 50).
 					Return([]*model.Artifact{
-						{Filename: "main.py", Path: "/"},
-						{Filename: "utils.py", Path: "/"},
+						textArtifact("main.py", "import os\n"),
+						textArtifact("utils.py", "reimported = True\n"),
 					}, nil)
 			},
-			wantCount: 2,
-			wantErr:   false,
+			wantFiles: []string{"main.py"},
+		},
+		{
+			name:    "candidates are paged until the limit is reached",
+			pattern: "^import",
+			limit:   2,
+			setupMock: func(m *MockArtifactRepo) {
+				m.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "import"}, 2).
+					Return([]*model.Artifact{
+						textArtifact("a.py", "import os\n"),
+						textArtifact("b.py", "# no import here\n"),
+					}, nil)
+				m.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "import", Offset: 2}, 2).
+					Return([]*model.Artifact{
+						textArtifact("c.py", "import sys\n"),
+						textArtifact("d.py", "import re\n"),
+					}, nil)
+			},
+			wantFiles: []string{"a.py", "c.py"},
+		},
+		{
+			name:    "pattern without a literal is narrowed in the database",
+			pattern: `\d{4}[a-z]`,
+			limit:   10,
+			setupMock: func(m *MockArtifactRepo) {
+				m.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Regexp: `(?:[0-9])+[a-z]`}, 10).
+					Return([]*model.Artifact{textArtifact("dates.txt", "2024a\n")}, nil)
+			},
+			wantFiles: []string{"dates.txt"},
+		},
+		{
+			name:      "invalid pattern",
+			pattern:   "(unclosed",
+			setupMock: func(m *MockArtifactRepo) {},
+			wantErr:   ErrInvalidGrepPattern,
 		},
 	}
 
@@ -590,21 +828,152 @@ func TestArtifactService_GrepArtifacts(t *testing.T) {
 				context.Background(),
 				uuid.New(),
 				uuid.New(),
-				tt.pattern,
-				tt.limit,
+				GrepInput{Pattern: tt.pattern, Limit: tt.limit},
 			)
 
-			if tt.wantErr {
-				assert.Error(t, err)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
 			} else {
 				assert.NoError(t, err)
-				assert.Len(t, results, tt.wantCount)
+				files := []string{}
+				for _, a := range results {
+					files = append(files, a.Filename)
+				}
+				assert.Equal(t, tt.wantFiles, files)
 			}
 			mockRepo.AssertExpectations(t)
 		})
 	}
 }
 
+func TestGrepPrefilter(t *testing.T) {
+	tests := []struct {
+		name            string
+		in              GrepInput
+		literal         string
+		caseInsensitive bool
+	}{
+		{name: "literal", in: GrepInput{Pattern: "TODO"}, literal: "TODO"},
+		{name: "longest required literal", in: GrepInput{Pattern: `\bfunc\s+handleRequest\(`}, literal: "handleRequest("},
+		{name: "fixed string", in: GrepInput{Pattern: "a.b", FixedString: true}, literal: "a.b"},
+		{name: "ascii case insensitive", in: GrepInput{Pattern: "todo", CaseInsensitive: true}, literal: "todo", caseInsensitive: true},
+		{name: "non-ascii case folding", in: GrepInput{Pattern: "task", CaseInsensitive: true}, literal: ""},
+		{name: "alternation", in: GrepInput{Pattern: "foo|bar"}, literal: ""},
+		{name: "optional literal", in: GrepInput{Pattern: "(foo)?bar"}, literal: "bar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := tt.in.compile()
+			require.NoError(t, err)
+
+			literal, caseInsensitive := grepPrefilter(re)
+			assert.Equal(t, tt.literal, literal)
+			assert.Equal(t, tt.caseInsensitive, caseInsensitive)
+		})
+	}
+}
+
+func TestGrepPrefilterRegexp(t *testing.T) {
+	tests := []struct {
+		name string
+		in   GrepInput
+		want string
+	}{
+		{name: "digits", in: GrepInput{Pattern: `\d+`}, want: "(?:[0-9])+"},
+		{name: "counted repeat is loosened", in: GrepInput{Pattern: `x{3,5}y`}, want: "(?:x)+y"},
+		{name: "assertions are dropped", in: GrepInput{Pattern: `^[a-z]+\b$`}, want: "(?:[a-z])+"},
+		{name: "punctuation is escaped", in: GrepInput{Pattern: `a.b|c-d`}, want: `(?:a.b|c\u002dd)`},
+		{name: "optional alternative", in: GrepInput{Pattern: `x(ab|cd|)y`}, want: "x(?:ab|cd)?y"},
+		{name: "case folding", in: GrepInput{Pattern: "k", CaseInsensitive: true}, want: `[Kk\u212a]`},
+		{name: "negated class skips nul and surrogates", in: GrepInput{Pattern: `[^a]`}, want: `[\u0001-\u0060b-\ud7ff\ue000-\U0010ffff]`},
+		{name: "large class is any character", in: GrepInput{Pattern: `\pL`}, want: "."},
+		{name: "matches every line", in: GrepInput{Pattern: `.*`}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, err := tt.in.compile()
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, grepPrefilterRegexp(re))
+		})
+	}
+}
+
+func TestArtifactService_GrepLines(t *testing.T) {
+	content := "package main\n\nimport \"fmt\"\n\n// TODO: handle errors\nfunc main() {\n\tfmt.Println(\"todo\")\n}\n"
+	artifacts := []*model.Artifact{
+		{
+			Path:      "/src/",
+			Filename:  "main.go",
+			AssetMeta: datatypes.NewJSONType(model.Asset{Content: content}),
+		},
+		{
+			// A candidate without any matching line
+			Path:      "/src/",
+			Filename:  "other.go",
+			AssetMeta: datatypes.NewJSONType(model.Asset{Content: "TO\nDO\n"}),
+		},
+	}
+
+	t.Run("case insensitive with context", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "todo", CaseInsensitive: true, Glob: "**/*.go"}, 100).
+			Return(artifacts, nil)
+		svc := &artifactService{r: mockRepo}
+
+		results, err := svc.GrepLines(context.Background(), uuid.New(), uuid.New(), GrepInput{
+			Pattern:         "todo",
+			CaseInsensitive: true,
+			Glob:            "**/*.go",
+			BeforeContext:   1,
+			AfterContext:    1,
+		})
+
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.Equal(t, "main.go", results[0].Filename)
+			assert.False(t, results[0].Truncated)
+			assert.Equal(t, []GrepMatch{
+				{LineNumber: 5, Line: "// TODO: handle errors", Before: []string{""}, After: []string{"func main() {"}},
+				{LineNumber: 7, Line: "\tfmt.Println(\"todo\")", Before: []string{"func main() {"}, After: []string{"}"}},
+			}, results[0].Matches)
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("fixed string is escaped and matches are capped", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GrepArtifacts", mock.Anything, mock.Anything, repo.GrepQuery{Literal: "("}, 100).
+			Return(artifacts[:1], nil)
+		svc := &artifactService{r: mockRepo}
+
+		results, err := svc.GrepLines(context.Background(), uuid.New(), uuid.New(), GrepInput{
+			Pattern:           "(",
+			FixedString:       true,
+			MaxMatchesPerFile: 1,
+		})
+
+		assert.NoError(t, err)
+		if assert.Len(t, results, 1) {
+			assert.True(t, results[0].Truncated)
+			assert.Equal(t, []GrepMatch{{LineNumber: 6, Line: "func main() {"}}, results[0].Matches)
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.GrepLines(context.Background(), uuid.New(), uuid.New(), GrepInput{Pattern: "(unclosed"})
+
+		assert.ErrorIs(t, err, ErrInvalidGrepPattern)
+		mockRepo.AssertNotCalled(t, "GrepArtifacts", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
 func TestArtifactService_GlobArtifacts(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -677,3 +1046,1055 @@ func TestArtifactService_GlobArtifacts(t *testing.T) {
 		})
 	}
 }
+
+func TestArtifactService_GetFileRange(t *testing.T) {
+	artifact := &model.Artifact{
+		Filename:  "image.png",
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/test/image.png", MIME: "image/png", SizeB: 100}),
+	}
+
+	tests := []struct {
+		name     string
+		artifact *model.Artifact
+		offset   int64
+		limit    int64
+		wantErr  bool
+	}{
+		{
+			name:     "nil artifact",
+			artifact: nil,
+			offset:   0,
+			limit:    10,
+			wantErr:  true,
+		},
+		{
+			name:     "negative offset",
+			artifact: artifact,
+			offset:   -1,
+			limit:    10,
+			wantErr:  true,
+		},
+		{
+			name:     "zero limit",
+			artifact: artifact,
+			offset:   0,
+			limit:    0,
+			wantErr:  true,
+		},
+		{
+			name:     "missing S3 key",
+			artifact: &model.Artifact{AssetMeta: datatypes.NewJSONType(model.Asset{SizeB: 100})},
+			offset:   0,
+			limit:    10,
+			wantErr:  true,
+		},
+		{
+			name:     "offset past end returns empty range without S3 request",
+			artifact: artifact,
+			offset:   100,
+			limit:    10,
+			wantErr:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &artifactService{r: new(MockArtifactRepo)}
+
+			rng, err := svc.GetFileRange(context.Background(), tt.artifact, tt.offset, tt.limit)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.offset, rng.Offset)
+			assert.Equal(t, int64(0), rng.Length)
+			assert.Equal(t, int64(100), rng.TotalSize)
+			assert.Empty(t, rng.Data)
+		})
+	}
+}
+
+func TestArtifactService_Versions(t *testing.T) {
+	projectID := uuid.New()
+	now := time.Now()
+	current := &model.Artifact{
+		ID:        uuid.New(),
+		Path:      "/docs/",
+		Filename:  "notes.md",
+		Meta:      map[string]interface{}{"rev": "c"},
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "key-3", SHA256: "sha-3"}),
+		Version:   3,
+		UpdatedAt: now,
+	}
+	previous := &model.ArtifactVersion{
+		ArtifactID: current.ID,
+		Version:    1,
+		Meta:       map[string]interface{}{"rev": "a"},
+		AssetMeta:  datatypes.NewJSONType(model.Asset{S3Key: "key-1", SHA256: "sha-1"}),
+		CreatedAt:  now.Add(-time.Hour),
+	}
+
+	t.Run("list starts with the current version", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("ListVersions", mock.Anything, current.ID).Return([]*model.ArtifactVersion{previous}, nil)
+		svc := &artifactService{r: mockRepo}
+
+		versions, err := svc.ListVersions(context.Background(), current)
+
+		assert.NoError(t, err)
+		if assert.Len(t, versions, 2) {
+			assert.Equal(t, 3, versions[0].Version)
+			assert.Equal(t, "key-3", versions[0].AssetMeta.Data().S3Key)
+			assert.Equal(t, 1, versions[1].Version)
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("get current version does not query versions", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		svc := &artifactService{r: mockRepo}
+
+		got, err := svc.GetVersion(context.Background(), current, 3)
+
+		assert.NoError(t, err)
+		assert.Same(t, current, got)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("get previous version returns a copy with its content", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetVersion", mock.Anything, current.ID, 1).Return(previous, nil)
+		svc := &artifactService{r: mockRepo}
+
+		got, err := svc.GetVersion(context.Background(), current, 1)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Version)
+		assert.Equal(t, "key-1", got.AssetMeta.Data().S3Key)
+		assert.Equal(t, "a", got.Meta["rev"])
+		assert.Equal(t, current.ID, got.ID)
+		assert.Equal(t, 3, current.Version, "current artifact must not be modified")
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("get missing version", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetVersion", mock.Anything, current.ID, 2).Return(nil, gorm.ErrRecordNotFound)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.GetVersion(context.Background(), current, 2)
+
+		assert.ErrorIs(t, err, ErrArtifactVersionNotFound)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("restore writes the version back as new content", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetVersion", mock.Anything, current.ID, 1).Return(previous, nil)
+		mockRepo.On("ReplaceContent", mock.Anything, projectID, current, previous.AssetMeta.Data(), previous.Meta, "").Return(nil)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.RestoreVersion(context.Background(), projectID, current, 1, WriteCondition{})
+
+		assert.NoError(t, err)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("restore current version is rejected", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.RestoreVersion(context.Background(), projectID, current, 3, WriteCondition{})
+
+		assert.ErrorIs(t, err, ErrInvalidVersion)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("restore missing version", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetVersion", mock.Anything, current.ID, 2).Return(nil, gorm.ErrRecordNotFound)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.RestoreVersion(context.Background(), projectID, current, 2, WriteCondition{})
+
+		assert.ErrorIs(t, err, ErrArtifactVersionNotFound)
+		mockRepo.AssertExpectations(t)
+	})
+}
+
+func TestArtifactService_PathOperations(t *testing.T) {
+	projectID := uuid.New()
+	diskID := uuid.New()
+
+	tests := []struct {
+		name      string
+		run       func(*artifactService) error
+		setupMock func(*MockArtifactRepo)
+		wantErr   error
+	}{
+		{
+			name: "move directory into itself",
+			run: func(s *artifactService) error {
+				_, err := s.MoveDirectory(context.Background(), diskID, "/a/", "/a/b/", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+			wantErr:   ErrInvalidPathOperation,
+		},
+		{
+			name: "copy directory onto itself",
+			run: func(s *artifactService) error {
+				_, err := s.CopyDirectory(context.Background(), projectID, diskID, "/a/", "/a/", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+			wantErr:   ErrInvalidPathOperation,
+		},
+		{
+			name: "move directory to parent",
+			run: func(s *artifactService) error {
+				_, err := s.MoveDirectory(context.Background(), diskID, "/a/b/", "/a/", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("MoveDirectory", mock.Anything, diskID, "/a/b/", "/a/").Return(int64(3), nil)
+			},
+		},
+		{
+			name: "move missing directory",
+			run: func(s *artifactService) error {
+				_, err := s.MoveDirectory(context.Background(), diskID, "/missing/", "/b/", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("MoveDirectory", mock.Anything, diskID, "/missing/", "/b/").Return(int64(0), gorm.ErrRecordNotFound)
+			},
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name: "move artifact onto itself",
+			run: func(s *artifactService) error {
+				_, err := s.MoveArtifact(context.Background(), diskID, "/a/", "x.txt", "/a/", "x.txt", WriteCondition{})
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+			wantErr:   ErrInvalidPathOperation,
+		},
+		{
+			name: "copy artifact over existing one",
+			run: func(s *artifactService) error {
+				_, err := s.CopyArtifact(context.Background(), projectID, diskID, "/a/", "x.txt", "/b/", "x.txt", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("CopyArtifact", mock.Anything, projectID, diskID, "/a/", "x.txt", "/b/", "x.txt").Return(nil, ErrArtifactExists)
+			},
+			wantErr: ErrArtifactExists,
+		},
+		{
+			name: "remove missing directory",
+			run: func(s *artifactService) error {
+				_, err := s.RemoveDirectory(context.Background(), projectID, diskID, "/gone/", true, "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("DeleteDirectory", mock.Anything, projectID, diskID, "/gone/", true).Return(int64(0), gorm.ErrRecordNotFound)
+			},
+			wantErr: ErrPathNotFound,
+		},
+		{
+			name: "make root directory is a no-op",
+			run: func(s *artifactService) error {
+				return s.MakeDirectory(context.Background(), diskID, "/")
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockArtifactRepo)
+			tt.setupMock(mockRepo)
+
+			err := tt.run(&artifactService{r: mockRepo})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+// newPresignOnlyS3 returns S3 deps whose presigner works offline; calls that
+// reach the storage service are not expected to succeed
+func newPresignOnlyS3() *blob.S3Deps {
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String("http://127.0.0.1:19000"),
+		UsePathStyle: true,
+	})
+	return &blob.S3Deps{Client: client, Presigner: s3.NewPresignClient(client), Bucket: "test-bucket"}
+}
+
+func TestArtifactService_Uploads(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	diskID := uuid.New()
+
+	t.Run("part size stays within the part limit", func(t *testing.T) {
+		assert.Equal(t, int64(minUploadPartSize), uploadPartSize(100<<20))
+
+		size := int64(500) << 30
+		partSize := uploadPartSize(size)
+		assert.Zero(t, partSize%(1<<20))
+		assert.LessOrEqual(t, (size+partSize-1)/partSize, int64(maxUploadParts))
+	})
+
+	t.Run("small files get a single presigned PUT", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("CreateUpload", mock.Anything, mock.MatchedBy(func(u *model.ArtifactUpload) bool {
+			return u.ProjectID == projectID && u.DiskID == diskID &&
+				u.S3Key == "disks/"+projectID.String()+"/uploads/"+u.ID.String()+".csv" &&
+				u.MultipartUploadID == "" && u.SizeB == 1024
+		})).Return(nil)
+		svc := &artifactService{r: mockRepo, s3: newPresignOnlyS3()}
+
+		plan, err := svc.CreateUpload(ctx, CreateUploadInput{
+			ProjectID:   projectID,
+			DiskID:      diskID,
+			Path:        "/data/",
+			Filename:    "train.CSV",
+			SizeB:       1024,
+			ContentType: "text/csv",
+			Expire:      time.Hour,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "PUT", plan.Method)
+		assert.Contains(t, plan.URL, "/test-bucket/disks/"+projectID.String()+"/uploads/"+plan.UploadID.String()+".csv")
+		assert.Contains(t, plan.URL, "X-Amz-Signature=")
+		assert.Equal(t, "text/csv", plan.Headers["Content-Type"])
+		assert.Empty(t, plan.Parts)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("finalize unknown upload", func(t *testing.T) {
+		uploadID := uuid.New()
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetUpload", mock.Anything, diskID, uploadID).Return(nil, gorm.ErrRecordNotFound)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.FinalizeUpload(ctx, FinalizeUploadInput{ProjectID: projectID, DiskID: diskID, UploadID: uploadID})
+
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+	})
+
+	t.Run("finalize upload of another project", func(t *testing.T) {
+		upload := &model.ArtifactUpload{ID: uuid.New(), ProjectID: uuid.New(), DiskID: diskID, ExpiresAt: time.Now().Add(time.Hour)}
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetUpload", mock.Anything, diskID, upload.ID).Return(upload, nil)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.FinalizeUpload(ctx, FinalizeUploadInput{ProjectID: projectID, DiskID: diskID, UploadID: upload.ID})
+
+		assert.ErrorIs(t, err, ErrUploadNotFound)
+		mockRepo.AssertNotCalled(t, "DeleteUpload", mock.Anything, mock.Anything)
+	})
+
+	t.Run("finalize retried after the parts were assembled", func(t *testing.T) {
+		upload := &model.ArtifactUpload{
+			ID:                uuid.New(),
+			ProjectID:         projectID,
+			DiskID:            diskID,
+			Filename:          "big.bin",
+			S3Key:             "disks/" + projectID.String() + "/uploads/big.bin",
+			MultipartUploadID: "mpu-1",
+			PartCount:         2,
+			SizeB:             5,
+			ExpiresAt:         time.Now().Add(time.Hour),
+		}
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetUpload", mock.Anything, diskID, upload.ID).Return(upload, nil)
+		mockRepo.On("ClaimUpload", mock.Anything, upload.ID, mock.Anything).Return(nil)
+		mockRepo.On("DeleteUpload", mock.Anything, upload.ID).Return(nil)
+		mockRepo.On("ReleaseUpload", mock.Anything, upload.ID).Return(nil)
+		s3Deps, requests := newRecordingS3(t, map[string][]byte{"/test-bucket/" + upload.S3Key: []byte("hello")})
+		svc := &artifactService{r: mockRepo, s3: s3Deps}
+
+		// A mismatching checksum stops the finalize once the object was read
+		_, err := svc.FinalizeUpload(ctx, FinalizeUploadInput{ProjectID: projectID, DiskID: diskID, UploadID: upload.ID, SHA256: "00"})
+
+		assert.ErrorIs(t, err, ErrUploadChecksumMismatch)
+		assert.Contains(t, *requests, "HEAD /test-bucket/"+upload.S3Key)
+		for _, r := range *requests {
+			// Neither ListParts nor CompleteMultipartUpload was called again
+			assert.False(t, strings.HasPrefix(r, "GET") && strings.Contains(r, "uploadId="), r)
+			assert.False(t, strings.HasPrefix(r, "POST"), r)
+		}
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("finalize of a claimed upload", func(t *testing.T) {
+		upload := &model.ArtifactUpload{ID: uuid.New(), ProjectID: projectID, DiskID: diskID, ExpiresAt: time.Now().Add(time.Hour)}
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetUpload", mock.Anything, diskID, upload.ID).Return(upload, nil)
+		mockRepo.On("ClaimUpload", mock.Anything, upload.ID, mock.Anything).Return(repo.ErrUploadClaimed)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.FinalizeUpload(ctx, FinalizeUploadInput{ProjectID: projectID, DiskID: diskID, UploadID: upload.ID})
+
+		assert.ErrorIs(t, err, ErrUploadClaimed)
+		mockRepo.AssertNotCalled(t, "DeleteUpload", mock.Anything, mock.Anything)
+	})
+
+	t.Run("failed finalize keeps the upload for a retry", func(t *testing.T) {
+		upload := &model.ArtifactUpload{
+			ID:        uuid.New(),
+			ProjectID: projectID,
+			DiskID:    diskID,
+			Path:      "/data/",
+			Filename:  "blob.bin",
+			S3Key:     "disks/" + projectID.String() + "/uploads/blob.bin",
+			SizeB:     5,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		sum := sha256.Sum256([]byte("hello"))
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetUpload", mock.Anything, diskID, upload.ID).Return(upload, nil)
+		mockRepo.On("ClaimUpload", mock.Anything, upload.ID, mock.Anything).Return(nil)
+		mockRepo.On("GetByPath", mock.Anything, diskID, "/data/", "blob.bin").Return(nil, gorm.ErrRecordNotFound)
+		mockRepo.On("Create", mock.Anything, projectID, mock.Anything).Return(errors.New("connection reset"))
+		mockRepo.On("ReleaseUpload", mock.Anything, upload.ID).Return(nil)
+		s3Deps, requests := newRecordingS3(t, map[string][]byte{"/test-bucket/" + upload.S3Key: []byte("hello")})
+		svc := &artifactService{r: mockRepo, s3: s3Deps}
+
+		_, err := svc.FinalizeUpload(ctx, FinalizeUploadInput{ProjectID: projectID, DiskID: diskID, UploadID: upload.ID, SHA256: hex.EncodeToString(sum[:])})
+
+		assert.ErrorContains(t, err, "connection reset")
+		assert.NotContains(t, *requests, "DELETE /test-bucket/"+upload.S3Key)
+		mockRepo.AssertNotCalled(t, "DeleteUpload", mock.Anything, mock.Anything)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("prune expired uploads", func(t *testing.T) {
+		before := time.Now()
+		single := &model.ArtifactUpload{ID: uuid.New(), S3Key: "disks/p/uploads/a.txt"}
+		multipart := &model.ArtifactUpload{ID: uuid.New(), S3Key: "disks/p/uploads/b.bin", MultipartUploadID: "mpu-2"}
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("ListExpiredUploads", mock.Anything, before, pruneUploadsBatchSize).Return([]*model.ArtifactUpload{single, multipart}, nil)
+		mockRepo.On("DeleteUpload", mock.Anything, single.ID).Return(nil)
+		// Already removed by a concurrent sweeper
+		mockRepo.On("DeleteUpload", mock.Anything, multipart.ID).Return(gorm.ErrRecordNotFound)
+		s3Deps, requests := newRecordingS3(t, nil)
+		svc := &artifactService{r: mockRepo, s3: s3Deps}
+
+		n, err := svc.PruneExpiredUploads(ctx, before)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+		assert.Contains(t, *requests, "DELETE /test-bucket/disks/p/uploads/a.txt")
+		assert.Contains(t, *requests, "DELETE /test-bucket/disks/p/uploads/b.bin?uploadId=mpu-2")
+		assert.Contains(t, *requests, "DELETE /test-bucket/disks/p/uploads/b.bin")
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("prune stops when an upload cannot be removed", func(t *testing.T) {
+		before := time.Now()
+		upload := &model.ArtifactUpload{ID: uuid.New(), S3Key: "disks/p/uploads/a.txt"}
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("ListExpiredUploads", mock.Anything, before, pruneUploadsBatchSize).Return([]*model.ArtifactUpload{upload}, nil)
+		mockRepo.On("DeleteUpload", mock.Anything, upload.ID).Return(errors.New("connection reset"))
+		s3Deps, _ := newRecordingS3(t, nil)
+		svc := &artifactService{r: mockRepo, s3: s3Deps}
+
+		n, err := svc.PruneExpiredUploads(ctx, before)
+
+		assert.ErrorContains(t, err, "connection reset")
+		assert.Zero(t, n)
+	})
+}
+
+// newRecordingS3 returns S3 deps backed by a test server that serves objects
+// from the given path -> content map, answers copies with a copy result and
+// every other request with an empty success, and records each request as
+// "METHOD path?query"
+func newRecordingS3(t *testing.T, objects map[string][]byte) (*blob.S3Deps, *[]string) {
+	var mu sync.Mutex
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		// Drop the SDK's x-id operation marker to keep the recorded queries short
+		q := r.URL.Query()
+		q.Del("x-id")
+		req := r.Method + " " + r.URL.Path
+		if len(q) > 0 {
+			req += "?" + q.Encode()
+		}
+		requests = append(requests, req)
+
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			body, ok := objects[r.URL.Path]
+			if !ok || len(q) > 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			if r.Method == http.MethodGet {
+				_, _ = w.Write(body)
+			}
+			return
+		}
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			_, _ = w.Write([]byte(`<CopyObjectResult><ETag>"copied"</ETag></CopyObjectResult>`))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+	})
+	return &blob.S3Deps{Client: client, Bucket: "test-bucket"}, &requests
+}
+
+func TestApplyTextEdits(t *testing.T) {
+	const text = "alpha\nbeta\ngamma\n"
+
+	tests := []struct {
+		name     string
+		text     string
+		edits    []TextEdit
+		expected string
+		wantErr  string
+	}{
+		{
+			name:     "str_replace with a unique match",
+			text:     text,
+			edits:    []TextEdit{{Op: EditStrReplace, OldStr: "beta", NewStr: "BETA"}},
+			expected: "alpha\nBETA\ngamma\n",
+		},
+		{
+			name:    "str_replace without a match",
+			text:    text,
+			edits:   []TextEdit{{Op: EditStrReplace, OldStr: "delta", NewStr: "x"}},
+			wantErr: "not found",
+		},
+		{
+			name:    "str_replace with several matches",
+			text:    text,
+			edits:   []TextEdit{{Op: EditStrReplace, OldStr: "a\n", NewStr: "x\n"}},
+			wantErr: "matches 3 times",
+		},
+		{
+			name:     "insert at the top",
+			text:     text,
+			edits:    []TextEdit{{Op: EditInsertAtLine, Line: 0, Text: "# title"}},
+			expected: "# title\nalpha\nbeta\ngamma\n",
+		},
+		{
+			name:     "insert after the last line without a trailing newline",
+			text:     "alpha",
+			edits:    []TextEdit{{Op: EditInsertAtLine, Line: 1, Text: "beta\n"}},
+			expected: "alpha\nbeta\n",
+		},
+		{
+			name:    "insert past the end",
+			text:    text,
+			edits:   []TextEdit{{Op: EditInsertAtLine, Line: 4, Text: "x"}},
+			wantErr: "out of range",
+		},
+		{
+			name:     "append",
+			text:     text,
+			edits:    []TextEdit{{Op: EditAppend, Text: "delta\n"}},
+			expected: "alpha\nbeta\ngamma\ndelta\n",
+		},
+		{
+			name:     "delete one line",
+			text:     text,
+			edits:    []TextEdit{{Op: EditDeleteLines, Line: 2}},
+			expected: "alpha\ngamma\n",
+		},
+		{
+			name:     "delete a range",
+			text:     text,
+			edits:    []TextEdit{{Op: EditDeleteLines, Line: 2, EndLine: 3}},
+			expected: "alpha\n",
+		},
+		{
+			name:    "delete past the end",
+			text:    text,
+			edits:   []TextEdit{{Op: EditDeleteLines, Line: 3, EndLine: 4}},
+			wantErr: "out of range",
+		},
+		{
+			name:     "apply unified diff",
+			text:     text,
+			edits:    []TextEdit{{Op: EditApplyUnifiedDiff, Diff: "@@ -2 +2 @@\n-beta\n+beta2\n"}},
+			expected: "alpha\nbeta2\ngamma\n",
+		},
+		{
+			name: "operations apply in order",
+			text: text,
+			edits: []TextEdit{
+				{Op: EditDeleteLines, Line: 1},
+				{Op: EditInsertAtLine, Line: 1, Text: "middle"},
+				{Op: EditStrReplace, OldStr: "gamma", NewStr: "end"},
+			},
+			expected: "beta\nmiddle\nend\n",
+		},
+		{
+			name: "a failing operation fails the whole edit",
+			text: text,
+			edits: []TextEdit{
+				{Op: EditAppend, Text: "delta\n"},
+				{Op: EditApplyUnifiedDiff, Diff: "@@ -1 +1 @@\n-omega\n+x\n"},
+			},
+			wantErr: "operation 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyTextEdits(tt.text, tt.edits)
+			if tt.wantErr != "" {
+				assert.ErrorIs(t, err, ErrInvalidEdit)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestArtifactService_EditText(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	diskID := uuid.New()
+	edits := []TextEdit{{Op: EditAppend, Text: "x"}}
+
+	t.Run("missing artifact", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(nil, gorm.ErrRecordNotFound)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.EditText(ctx, EditTextInput{ProjectID: projectID, DiskID: diskID, Path: "/notes/", Filename: "todo.md", Edits: edits})
+
+		assert.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("binary artifact", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/img/", "logo.png").Return(&model.Artifact{
+			Filename:  "logo.png",
+			AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/p/logo.png", MIME: "image/png", SizeB: 100}),
+		}, nil)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.EditText(ctx, EditTextInput{ProjectID: projectID, DiskID: diskID, Path: "/img/", Filename: "logo.png", Edits: edits})
+
+		assert.ErrorIs(t, err, ErrInvalidEdit)
+		mockRepo.AssertNotCalled(t, "ReplaceContent", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("no operations", func(t *testing.T) {
+		svc := &artifactService{r: new(MockArtifactRepo)}
+
+		_, err := svc.EditText(ctx, EditTextInput{ProjectID: projectID, DiskID: diskID, Path: "/notes/", Filename: "todo.md"})
+
+		assert.ErrorIs(t, err, ErrInvalidEdit)
+	})
+}
+
+func TestWithContentInfo(t *testing.T) {
+	meta := datatypes.JSONMap{
+		model.ArtifactInfoKey: map[string]interface{}{"path": "/notes/", "filename": "todo.md", "mime": "text/plain", "size": int64(3)},
+		"owner":               "agent",
+	}
+
+	out := withContentInfo(meta, &model.Asset{MIME: "text/markdown", SizeB: 10})
+
+	assert.Equal(t, map[string]interface{}{"path": "/notes/", "filename": "todo.md", "mime": "text/markdown", "size": int64(10)}, out[model.ArtifactInfoKey])
+	assert.Equal(t, "agent", out["owner"])
+	assert.Equal(t, int64(3), meta[model.ArtifactInfoKey].(map[string]interface{})["size"])
+}
+
+func TestArtifactService_WriteConditions(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	diskID := uuid.New()
+	current := &model.Artifact{
+		ID:        uuid.New(),
+		Filename:  "todo.md",
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/p/todo.md", SHA256: "sha-current", ETag: "etag-current", MIME: "text/markdown", SizeB: 3}),
+	}
+
+	t.Run("if-match", func(t *testing.T) {
+		svc := &artifactService{r: new(MockArtifactRepo)}
+
+		tests := []struct {
+			name     string
+			current  *model.Artifact
+			ifMatch  string
+			expected string
+			wantErr  error
+		}{
+			{name: "no condition", current: current, ifMatch: "", expected: ""},
+			{name: "no condition on a new path", current: nil, ifMatch: "", expected: ""},
+			{name: "sha256", current: current, ifMatch: "sha-current", expected: "sha-current"},
+			{name: "etag", current: current, ifMatch: "etag-current", expected: "sha-current"},
+			{name: "any existing artifact", current: current, ifMatch: "*", expected: "sha-current"},
+			{name: "stale", current: current, ifMatch: "sha-old", wantErr: ErrPreconditionFailed},
+			{name: "missing artifact", current: nil, ifMatch: "*", wantErr: ErrPreconditionFailed},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				base, err := svc.checkWrite(ctx, diskID, "/notes/", "todo.md", tt.current, WriteCondition{IfMatch: tt.ifMatch})
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+					return
+				}
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, base)
+			})
+		}
+	})
+
+	t.Run("delete with stale if-match", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(current, nil)
+		svc := &artifactService{r: mockRepo}
+
+		err := svc.DeleteByPath(ctx, projectID, diskID, "/notes/", "todo.md", WriteCondition{IfMatch: "sha-old"})
+
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		mockRepo.AssertNotCalled(t, "DeleteByPath", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("delete overwritten after the if-match check", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(current, nil)
+		mockRepo.On("DeleteByPath", ctx, projectID, diskID, "/notes/", "todo.md", "sha-current").Return(repo.ErrContentChanged)
+		svc := &artifactService{r: mockRepo}
+
+		err := svc.DeleteByPath(ctx, projectID, diskID, "/notes/", "todo.md", WriteCondition{IfMatch: "etag-current"})
+
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("unconditional delete", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("DeleteByPath", ctx, projectID, diskID, "/notes/", "todo.md", "").Return(nil)
+		svc := &artifactService{r: mockRepo}
+
+		assert.NoError(t, svc.DeleteByPath(ctx, projectID, diskID, "/notes/", "todo.md", WriteCondition{}))
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("edit with stale if-match", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(current, nil)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.EditText(ctx, EditTextInput{
+			ProjectID: projectID,
+			DiskID:    diskID,
+			Path:      "/notes/",
+			Filename:  "todo.md",
+			Edits:     []TextEdit{{Op: EditAppend, Text: "x"}},
+			Condition: WriteCondition{IfMatch: "sha-old"},
+		})
+
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+	})
+
+	t.Run("move overwritten after the if-match check", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(current, nil)
+		mockRepo.On("MoveArtifact", ctx, diskID, "/notes/", "todo.md", "/archive/", "todo.md", "sha-current").Return(nil, repo.ErrContentChanged)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.MoveArtifact(ctx, diskID, "/notes/", "todo.md", "/archive/", "todo.md", WriteCondition{IfMatch: "etag-current"})
+
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("meta update overwritten after the if-match check", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(current, nil)
+		mockRepo.On("Update", ctx, current, "sha-current").Return(repo.ErrContentChanged)
+		svc := &artifactService{r: mockRepo}
+
+		_, err := svc.UpdateArtifactMetaByPath(ctx, diskID, "/notes/", "todo.md", map[string]interface{}{"k": "v"}, WriteCondition{IfMatch: "sha-current"})
+
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("locks need redis", func(t *testing.T) {
+		svc := &artifactService{r: new(MockArtifactRepo)}
+
+		_, err := svc.AcquireLock(ctx, diskID, "/notes/", "todo.md", "", time.Minute)
+		assert.ErrorIs(t, err, ErrLocksUnavailable)
+		assert.ErrorIs(t, svc.ReleaseLock(ctx, diskID, "/notes/", "todo.md", "lock"), ErrLocksUnavailable)
+	})
+}
+
+// fakeLockStore keeps locks in memory without expiring them
+type fakeLockStore struct {
+	held map[string]string
+	ttls map[string]time.Duration
+}
+
+func newFakeLockStore() *fakeLockStore {
+	return &fakeLockStore{held: map[string]string{}, ttls: map[string]time.Duration{}}
+}
+
+func (f *fakeLockStore) acquire(ctx context.Context, key string, lockID string, ttl time.Duration) (bool, error) {
+	if _, ok := f.held[key]; ok {
+		return false, nil
+	}
+	f.held[key] = lockID
+	f.ttls[key] = ttl
+	return true, nil
+}
+
+func (f *fakeLockStore) renew(ctx context.Context, key string, lockID string, ttl time.Duration) (bool, error) {
+	if f.held[key] != lockID {
+		return false, nil
+	}
+	f.ttls[key] = ttl
+	return true, nil
+}
+
+func (f *fakeLockStore) release(ctx context.Context, key string, lockID string) (bool, error) {
+	if f.held[key] != lockID {
+		return false, nil
+	}
+	delete(f.held, key)
+	delete(f.ttls, key)
+	return true, nil
+}
+
+func (f *fakeLockStore) holders(ctx context.Context, keys []string) ([]string, error) {
+	holders := make([]string, len(keys))
+	for i, key := range keys {
+		holders[i] = f.held[key]
+	}
+	return holders, nil
+}
+
+func TestArtifactService_Locks(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	diskID := uuid.New()
+	current := &model.Artifact{
+		ID:        uuid.New(),
+		DiskID:    diskID,
+		Path:      "/notes/",
+		Filename:  "todo.md",
+		Version:   2,
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/p/todo.md", SHA256: "sha-current"}),
+	}
+
+	// lockedService returns a service whose lock store has /notes/todo.md
+	// locked by "holder"
+	lockedService := func(r *MockArtifactRepo) (*artifactService, *fakeLockStore) {
+		locks := newFakeLockStore()
+		locks.held[artifactLockKey(diskID, "/notes/", "todo.md")] = "holder"
+		return &artifactService{r: r, locks: locks}, locks
+	}
+
+	t.Run("acquire", func(t *testing.T) {
+		locks := newFakeLockStore()
+		svc := &artifactService{r: new(MockArtifactRepo), locks: locks}
+
+		lock, err := svc.AcquireLock(ctx, diskID, "/notes/", "todo.md", "", time.Minute)
+		require.NoError(t, err)
+		assert.NotEmpty(t, lock.LockID)
+		assert.Equal(t, "/notes/todo.md", lock.FilePath)
+		assert.Equal(t, lock.LockID, locks.held[artifactLockKey(diskID, "/notes/", "todo.md")])
+
+		_, err = svc.AcquireLock(ctx, diskID, "/notes/", "todo.md", "", time.Minute)
+		assert.ErrorIs(t, err, ErrArtifactLocked)
+	})
+
+	t.Run("renew by lock id", func(t *testing.T) {
+		svc, locks := lockedService(new(MockArtifactRepo))
+		key := artifactLockKey(diskID, "/notes/", "todo.md")
+
+		lock, err := svc.AcquireLock(ctx, diskID, "/notes/", "todo.md", "holder", 5*time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, "holder", lock.LockID)
+		assert.Equal(t, 5*time.Minute, locks.ttls[key])
+
+		_, err = svc.AcquireLock(ctx, diskID, "/notes/", "todo.md", "someone-else", time.Minute)
+		assert.ErrorIs(t, err, ErrLockNotHeld)
+		assert.Equal(t, "holder", locks.held[key])
+	})
+
+	t.Run("release with the wrong id", func(t *testing.T) {
+		svc, locks := lockedService(new(MockArtifactRepo))
+		key := artifactLockKey(diskID, "/notes/", "todo.md")
+
+		assert.ErrorIs(t, svc.ReleaseLock(ctx, diskID, "/notes/", "todo.md", "someone-else"), ErrLockNotHeld)
+		assert.Equal(t, "holder", locks.held[key])
+
+		assert.NoError(t, svc.ReleaseLock(ctx, diskID, "/notes/", "todo.md", "holder"))
+		assert.NotContains(t, locks.held, key)
+	})
+
+	t.Run("check write", func(t *testing.T) {
+		svc, _ := lockedService(new(MockArtifactRepo))
+
+		_, err := svc.checkWrite(ctx, diskID, "/notes/", "todo.md", nil, WriteCondition{})
+		assert.ErrorIs(t, err, ErrArtifactLocked)
+		_, err = svc.checkWrite(ctx, diskID, "/notes/", "todo.md", nil, WriteCondition{LockID: "someone-else"})
+		assert.ErrorIs(t, err, ErrArtifactLocked)
+		_, err = svc.checkWrite(ctx, diskID, "/notes/", "todo.md", nil, WriteCondition{LockID: "holder"})
+		assert.NoError(t, err)
+		_, err = svc.checkWrite(ctx, diskID, "/notes/", "other.md", nil, WriteCondition{})
+		assert.NoError(t, err)
+	})
+
+	t.Run("delete by the holder", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("DeleteByPath", ctx, projectID, diskID, "/notes/", "todo.md", "").Return(nil)
+		svc, _ := lockedService(mockRepo)
+
+		assert.NoError(t, svc.DeleteByPath(ctx, projectID, diskID, "/notes/", "todo.md", WriteCondition{LockID: "holder"}))
+		mockRepo.AssertExpectations(t)
+	})
+
+	// Every other write path is rejected before reaching the repo
+	lockedWrites := []struct {
+		name      string
+		run       func(*artifactService) error
+		setupMock func(*MockArtifactRepo)
+	}{
+		{
+			name: "update meta",
+			run: func(s *artifactService) error {
+				_, err := s.UpdateArtifactMetaByPath(ctx, diskID, "/notes/", "todo.md", map[string]interface{}{"k": "v"}, WriteCondition{})
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("GetByPath", ctx, diskID, "/notes/", "todo.md").Return(current, nil)
+			},
+		},
+		{
+			name: "restore version",
+			run: func(s *artifactService) error {
+				_, err := s.RestoreVersion(ctx, projectID, current, 1, WriteCondition{})
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("GetVersion", ctx, current.ID, 1).Return(&model.ArtifactVersion{Version: 1}, nil)
+			},
+		},
+		{
+			name: "move locked artifact",
+			run: func(s *artifactService) error {
+				_, err := s.MoveArtifact(ctx, diskID, "/notes/", "todo.md", "/archive/", "todo.md", WriteCondition{})
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+		},
+		{
+			name: "move onto locked path",
+			run: func(s *artifactService) error {
+				_, err := s.MoveArtifact(ctx, diskID, "/drafts/", "todo.md", "/notes/", "todo.md", WriteCondition{})
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+		},
+		{
+			name: "copy onto locked path",
+			run: func(s *artifactService) error {
+				_, err := s.CopyArtifact(ctx, projectID, diskID, "/drafts/", "todo.md", "/notes/", "todo.md", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {},
+		},
+		{
+			name: "move directory with a locked artifact",
+			run: func(s *artifactService) error {
+				_, err := s.MoveDirectory(ctx, diskID, "/notes/", "/archive/", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("ListFilePaths", ctx, diskID, "/notes/").Return([]string{"/notes/a.md", "/notes/todo.md"}, nil)
+			},
+		},
+		{
+			name: "copy directory onto a locked path",
+			run: func(s *artifactService) error {
+				_, err := s.CopyDirectory(ctx, projectID, diskID, "/drafts/", "/notes/", "")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("ListFilePaths", ctx, diskID, "/drafts/").Return([]string{"/drafts/todo.md"}, nil)
+			},
+		},
+		{
+			name: "recursive directory delete",
+			run: func(s *artifactService) error {
+				_, err := s.RemoveDirectory(ctx, projectID, diskID, "/", true, "someone-else")
+				return err
+			},
+			setupMock: func(r *MockArtifactRepo) {
+				r.On("ListFilePaths", ctx, diskID, "/").Return([]string{"/notes/todo.md"}, nil)
+			},
+		},
+	}
+
+	for _, tt := range lockedWrites {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockArtifactRepo)
+			tt.setupMock(mockRepo)
+			svc, _ := lockedService(mockRepo)
+
+			assert.ErrorIs(t, tt.run(svc), ErrArtifactLocked)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+
+	t.Run("copy directory from a locked path", func(t *testing.T) {
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("ListFilePaths", ctx, diskID, "/notes/").Return([]string{"/notes/todo.md"}, nil)
+		mockRepo.On("CopyDirectory", ctx, projectID, diskID, "/notes/", "/copy/").Return(int64(1), nil)
+		svc, _ := lockedService(mockRepo)
+
+		n, err := svc.CopyDirectory(ctx, projectID, diskID, "/notes/", "/copy/", "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		mockRepo.AssertExpectations(t)
+	})
+
+	t.Run("restore version by the holder keeps the if-match", func(t *testing.T) {
+		previous := &model.ArtifactVersion{Version: 1, AssetMeta: datatypes.NewJSONType(model.Asset{SHA256: "sha-old"})}
+		mockRepo := new(MockArtifactRepo)
+		mockRepo.On("GetVersion", ctx, current.ID, 1).Return(previous, nil)
+		mockRepo.On("ReplaceContent", ctx, projectID, current, previous.AssetMeta.Data(), previous.Meta, "sha-current").Return(repo.ErrContentChanged)
+		svc, _ := lockedService(mockRepo)
+
+		_, err := svc.RestoreVersion(ctx, projectID, current, 1, WriteCondition{IfMatch: "sha-current", LockID: "holder"})
+		assert.ErrorIs(t, err, ErrPreconditionFailed)
+		mockRepo.AssertExpectations(t)
+	})
+}
@@ -10,18 +10,35 @@ import (
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/modules/repo"
 	"github.com/memodb-io/Luminox/internal/pkg/paging"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 )
 
 type DiskService interface {
 	Create(ctx context.Context, projectID uuid.UUID, userID *uuid.UUID) (*model.Disk, error)
 	Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) error
 	List(ctx context.Context, in ListDisksInput) (*ListDisksOutput, error)
+	CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error)
+	ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error)
+	DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error
+	Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error)
+	RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID, lockID string) (int64, error)
 }
 
-type diskService struct{ r repo.DiskRepo }
+var (
+	// ErrDiskNotFound is returned when a disk does not exist in the project
+	ErrDiskNotFound = errors.New("disk not found")
+	// ErrSnapshotNotFound is returned when a snapshot does not exist for the disk
+	ErrSnapshotNotFound = repo.ErrSnapshotNotFound
+)
+
+type diskService struct {
+	r     repo.DiskRepo
+	locks lockStore
+}
 
-func NewDiskService(r repo.DiskRepo) DiskService {
-	return &diskService{r: r}
+func NewDiskService(r repo.DiskRepo, redis *redis.Client) DiskService {
+	return &diskService{r: r, locks: newLockStore(redis)}
 }
 
 func (s *diskService) Create(ctx context.Context, projectID uuid.UUID, userID *uuid.UUID) (*model.Disk, error) {
@@ -89,3 +106,70 @@ func (s *diskService) List(ctx context.Context, in ListDisksInput) (*ListDisksOu
 
 	return out, nil
 }
+
+func (s *diskService) CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error) {
+	snapshot, err := s.r.CreateSnapshot(ctx, projectID, diskID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDiskNotFound
+		}
+		return nil, fmt.Errorf("create snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+func (s *diskService) ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error) {
+	return s.r.ListSnapshots(ctx, projectID, diskID)
+}
+
+func (s *diskService) DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error {
+	if err := s.r.DeleteSnapshot(ctx, projectID, diskID, snapshotID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSnapshotNotFound
+		}
+		return fmt.Errorf("delete snapshot: %w", err)
+	}
+	return nil
+}
+
+// Clone copies a disk, or one of its snapshots when snapshotID is set, into a
+// new disk owned by the same user
+func (s *diskService) Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error) {
+	disk, err := s.r.Clone(ctx, projectID, diskID, snapshotID)
+	if err != nil {
+		if errors.Is(err, ErrSnapshotNotFound) {
+			return nil, err
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDiskNotFound
+		}
+		return nil, fmt.Errorf("clone disk: %w", err)
+	}
+	return disk, nil
+}
+
+func (s *diskService) RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID, lockID string) (int64, error) {
+	// Every path the restore deletes or writes must be free of other
+	// holders' locks
+	if s.locks != nil {
+		paths, err := s.r.RestorePaths(ctx, projectID, diskID, snapshotID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, ErrSnapshotNotFound
+			}
+			return 0, fmt.Errorf("list restore paths: %w", err)
+		}
+		if err := checkLocks(ctx, s.locks, diskID, paths, lockID); err != nil {
+			return 0, err
+		}
+	}
+
+	count, err := s.r.RestoreSnapshot(ctx, projectID, diskID, snapshotID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, ErrSnapshotNotFound
+		}
+		return 0, fmt.Errorf("restore snapshot: %w", err)
+	}
+	return count, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"gorm.io/gorm"
 )
 
 // MockDiskRepo is a mock implementation of DiskRepo
@@ -27,14 +28,56 @@ func (m *MockDiskRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID u
 	return args.Error(0)
 }
 
-func (m *MockDiskRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]*model.Disk, error) {
-	args := m.Called(ctx, projectID, afterCreatedAt, afterID, limit, timeDesc)
+func (m *MockDiskRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]*model.Disk, error) {
+	args := m.Called(ctx, projectID, userIdentifier, afterCreatedAt, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]*model.Disk), args.Error(1)
 }
 
+func (m *MockDiskRepo) CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.DiskSnapshot), args.Error(1)
+}
+
+func (m *MockDiskRepo) ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.DiskSnapshot), args.Error(1)
+}
+
+func (m *MockDiskRepo) DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	return args.Error(0)
+}
+
+func (m *MockDiskRepo) Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Disk), args.Error(1)
+}
+
+func (m *MockDiskRepo) RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDiskRepo) RestorePaths(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) ([]string, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
 // MockS3Deps is a mock implementation of blob.S3Deps
 type MockS3Deps struct {
 	mock.Mock
@@ -85,13 +128,33 @@ func (s *testDiskService) Delete(ctx context.Context, projectID uuid.UUID, diskI
 }
 
 func (s *testDiskService) List(ctx context.Context, in ListDisksInput) (*ListDisksOutput, error) {
-	disks, err := s.r.ListWithCursor(ctx, in.ProjectID, time.Time{}, uuid.UUID{}, in.Limit, in.TimeDesc)
+	disks, err := s.r.ListWithCursor(ctx, in.ProjectID, in.User, time.Time{}, uuid.UUID{}, in.Limit, in.TimeDesc)
 	if err != nil {
 		return nil, err
 	}
 	return &ListDisksOutput{Items: disks, HasMore: false}, nil
 }
 
+func (s *testDiskService) CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error) {
+	return NewDiskService(s.r, nil).CreateSnapshot(ctx, projectID, diskID)
+}
+
+func (s *testDiskService) ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error) {
+	return NewDiskService(s.r, nil).ListSnapshots(ctx, projectID, diskID)
+}
+
+func (s *testDiskService) DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error {
+	return NewDiskService(s.r, nil).DeleteSnapshot(ctx, projectID, diskID, snapshotID)
+}
+
+func (s *testDiskService) Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error) {
+	return NewDiskService(s.r, nil).Clone(ctx, projectID, diskID, snapshotID)
+}
+
+func (s *testDiskService) RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID, lockID string) (int64, error) {
+	return NewDiskService(s.r, nil).RestoreSnapshot(ctx, projectID, diskID, snapshotID, lockID)
+}
+
 func createTestDisk() *model.Disk {
 	projectID := uuid.New()
 	diskID := uuid.New()
@@ -179,7 +242,7 @@ func TestDiskService_List(t *testing.T) {
 				Limit:     10,
 			},
 			setup: func(repo *MockDiskRepo) {
-				repo.On("ListWithCursor", mock.Anything, projectID, time.Time{}, uuid.UUID{}, 10, false).Return([]*model.Disk{disk1, disk2}, nil)
+				repo.On("ListWithCursor", mock.Anything, projectID, "", time.Time{}, uuid.UUID{}, 10, false).Return([]*model.Disk{disk1, disk2}, nil)
 			},
 			expectError: false,
 			expectCount: 2,
@@ -191,7 +254,7 @@ func TestDiskService_List(t *testing.T) {
 				Limit:     10,
 			},
 			setup: func(repo *MockDiskRepo) {
-				repo.On("ListWithCursor", mock.Anything, projectID, time.Time{}, uuid.UUID{}, 10, false).Return([]*model.Disk{}, nil)
+				repo.On("ListWithCursor", mock.Anything, projectID, "", time.Time{}, uuid.UUID{}, 10, false).Return([]*model.Disk{}, nil)
 			},
 			expectError: false,
 			expectCount: 0,
@@ -203,7 +266,7 @@ func TestDiskService_List(t *testing.T) {
 				Limit:     10,
 			},
 			setup: func(repo *MockDiskRepo) {
-				repo.On("ListWithCursor", mock.Anything, projectID, time.Time{}, uuid.UUID{}, 10, false).Return(nil, errors.New("list error"))
+				repo.On("ListWithCursor", mock.Anything, projectID, "", time.Time{}, uuid.UUID{}, 10, false).Return(nil, errors.New("list error"))
 			},
 			expectError: true,
 			errorMsg:    "list error",
@@ -299,3 +362,98 @@ func TestDiskService_Delete(t *testing.T) {
 		})
 	}
 }
+
+func TestDiskService_Snapshots(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	diskID := uuid.New()
+	snapshotID := uuid.New()
+
+	t.Run("create snapshot of missing disk", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("CreateSnapshot", ctx, projectID, diskID).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewDiskService(r, nil).CreateSnapshot(ctx, projectID, diskID)
+		assert.ErrorIs(t, err, ErrDiskNotFound)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("clone from snapshot", func(t *testing.T) {
+		clone := &model.Disk{ID: uuid.New(), ProjectID: projectID}
+		r := &MockDiskRepo{}
+		r.On("Clone", ctx, projectID, diskID, &snapshotID).Return(clone, nil)
+
+		got, err := NewDiskService(r, nil).Clone(ctx, projectID, diskID, &snapshotID)
+		assert.NoError(t, err)
+		assert.Equal(t, clone, got)
+		r.AssertExpectations(t)
+	})
+
+	t.Run("clone from missing snapshot", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("Clone", ctx, projectID, diskID, &snapshotID).Return(nil, ErrSnapshotNotFound)
+
+		_, err := NewDiskService(r, nil).Clone(ctx, projectID, diskID, &snapshotID)
+		assert.ErrorIs(t, err, ErrSnapshotNotFound)
+		assert.NotErrorIs(t, err, ErrDiskNotFound)
+	})
+
+	t.Run("clone missing disk", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("Clone", ctx, projectID, diskID, (*uuid.UUID)(nil)).Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := NewDiskService(r, nil).Clone(ctx, projectID, diskID, nil)
+		assert.ErrorIs(t, err, ErrDiskNotFound)
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("RestoreSnapshot", ctx, projectID, diskID, snapshotID).Return(int64(3), nil)
+
+		count, err := NewDiskService(r, nil).RestoreSnapshot(ctx, projectID, diskID, snapshotID, "")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+	})
+
+	t.Run("restore missing snapshot", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("RestoreSnapshot", ctx, projectID, diskID, snapshotID).Return(int64(0), gorm.ErrRecordNotFound)
+
+		_, err := NewDiskService(r, nil).RestoreSnapshot(ctx, projectID, diskID, snapshotID, "")
+		assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	})
+
+	t.Run("restore over a locked path", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("RestorePaths", ctx, projectID, diskID, snapshotID).Return([]string{"/a.txt", "/notes/todo.md"}, nil)
+		locks := newFakeLockStore()
+		locks.held[artifactLockKey(diskID, "/notes/", "todo.md")] = "holder"
+		svc := &diskService{r: r, locks: locks}
+
+		_, err := svc.RestoreSnapshot(ctx, projectID, diskID, snapshotID, "")
+		assert.ErrorIs(t, err, ErrArtifactLocked)
+		r.AssertNotCalled(t, "RestoreSnapshot", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+		r.On("RestoreSnapshot", ctx, projectID, diskID, snapshotID).Return(int64(2), nil)
+		count, err := svc.RestoreSnapshot(ctx, projectID, diskID, snapshotID, "holder")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+	})
+
+	t.Run("restore missing snapshot with locks", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("RestorePaths", ctx, projectID, diskID, snapshotID).Return(nil, gorm.ErrRecordNotFound)
+		svc := &diskService{r: r, locks: newFakeLockStore()}
+
+		_, err := svc.RestoreSnapshot(ctx, projectID, diskID, snapshotID, "")
+		assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	})
+
+	t.Run("delete missing snapshot", func(t *testing.T) {
+		r := &MockDiskRepo{}
+		r.On("DeleteSnapshot", ctx, projectID, diskID, snapshotID).Return(gorm.ErrRecordNotFound)
+
+		err := NewDiskService(r, nil).DeleteSnapshot(ctx, projectID, diskID, snapshotID)
+		assert.ErrorIs(t, err, ErrSnapshotNotFound)
+	})
+}
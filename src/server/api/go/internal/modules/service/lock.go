@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// lockStore keeps artifact locks, each a key holding the lock ID of its
+// holder until it expires
+type lockStore interface {
+	// acquire sets key to lockID for ttl unless the key is already held
+	acquire(ctx context.Context, key string, lockID string, ttl time.Duration) (bool, error)
+	// renew extends key by ttl if it is still held by lockID
+	renew(ctx context.Context, key string, lockID string, ttl time.Duration) (bool, error)
+	// release deletes key if it is still held by lockID
+	release(ctx context.Context, key string, lockID string) (bool, error)
+	// holders returns the lock ID holding each of keys, or "" for free keys
+	holders(ctx context.Context, keys []string) ([]string, error)
+}
+
+// redisKeyPrefixArtifactLock prefixes the Redis keys of artifact locks, which
+// hold the lock ID of their holder and expire with the lock
+const redisKeyPrefixArtifactLock = "artifact:lock:"
+
+// checkLocksBatchSize bounds the keys looked up at once when checking the
+// locks of many paths
+const checkLocksBatchSize = 1000
+
+var (
+	// renewLockScript extends a lock if it is still held by ARGV[1]
+	renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+	// releaseLockScript deletes a lock if it is still held by ARGV[1]
+	releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+type redisLockStore struct{ rdb *redis.Client }
+
+// newLockStore returns the lock store backed by rdb, or nil without Redis
+func newLockStore(rdb *redis.Client) lockStore {
+	if rdb == nil {
+		return nil
+	}
+	return &redisLockStore{rdb: rdb}
+}
+
+func (s *redisLockStore) acquire(ctx context.Context, key string, lockID string, ttl time.Duration) (bool, error) {
+	return s.rdb.SetNX(ctx, key, lockID, ttl).Result()
+}
+
+func (s *redisLockStore) renew(ctx context.Context, key string, lockID string, ttl time.Duration) (bool, error) {
+	n, err := renewLockScript.Run(ctx, s.rdb, []string{key}, lockID, ttl.Milliseconds()).Int()
+	return n != 0, err
+}
+
+func (s *redisLockStore) release(ctx context.Context, key string, lockID string) (bool, error) {
+	n, err := releaseLockScript.Run(ctx, s.rdb, []string{key}, lockID).Int()
+	return n != 0, err
+}
+
+func (s *redisLockStore) holders(ctx context.Context, keys []string) ([]string, error) {
+	values, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	holders := make([]string, len(values))
+	for i, v := range values {
+		if id, ok := v.(string); ok {
+			holders[i] = id
+		}
+	}
+	return holders, nil
+}
+
+func artifactLockKey(diskID uuid.UUID, path string, filename string) string {
+	return redisKeyPrefixArtifactLock + diskID.String() + ":" + path + filename
+}
+
+// checkLocks returns ErrArtifactLocked when any of the full paths of a disk
+// is locked by a holder other than lockID. Without a lock store nothing is
+// locked.
+func checkLocks(ctx context.Context, locks lockStore, diskID uuid.UUID, filePaths []string, lockID string) error {
+	if locks == nil || len(filePaths) == 0 {
+		return nil
+	}
+	for start := 0; start < len(filePaths); start += checkLocksBatchSize {
+		batch := filePaths[start:min(start+checkLocksBatchSize, len(filePaths))]
+		keys := make([]string, len(batch))
+		for i, p := range batch {
+			keys[i] = artifactLockKey(diskID, "", p)
+		}
+		holders, err := locks.holders(ctx, keys)
+		if err != nil {
+			return fmt.Errorf("check locks: %w", err)
+		}
+		for _, holder := range holders {
+			if holder != "" && holder != lockID {
+				return ErrArtifactLocked
+			}
+		}
+	}
+	return nil
+}
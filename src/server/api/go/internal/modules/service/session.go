@@ -1,11 +1,15 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"mime/multipart"
+	"net/textproto"
+	"net/url"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -18,6 +22,8 @@ import (
 	"github.com/memodb-io/Luminox/internal/modules/repo"
 	"github.com/memodb-io/Luminox/internal/pkg/editor"
 	"github.com/memodb-io/Luminox/internal/pkg/paging"
+	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/jsonschema"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/datatypes"
@@ -30,10 +36,22 @@ type SessionService interface {
 	UpdateByID(ctx context.Context, ss *model.Session) error
 	GetByID(ctx context.Context, ss *model.Session) (*model.Session, error)
 	List(ctx context.Context, in ListSessionsInput) (*ListSessionsOutput, error)
+	ListChildren(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) ([]model.Session, error)
+	GetTree(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, maxDepth int) (*SessionTreeNode, error)
 	StoreMessage(ctx context.Context, in StoreMessageInput) (*model.Message, error)
 	GetMessages(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error)
 	GetAllMessages(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error)
 	GetSessionObservingStatus(ctx context.Context, sessionID string) (*model.MessageObservingStatus, error)
+	SetMessageProtected(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, protected bool) error
+	SetCheckpoint(ctx context.Context, in SetCheckpointInput) (*model.Checkpoint, error)
+	ListCheckpoints(ctx context.Context, sessionID uuid.UUID) ([]model.Checkpoint, error)
+	DeleteCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) error
+	SetTools(ctx context.Context, in SetToolsInput) (*model.SessionTools, error)
+	GetTools(ctx context.Context, sessionID uuid.UUID, version int) (*model.SessionTools, error)
+	ListTools(ctx context.Context, sessionID uuid.UUID) ([]model.SessionTools, error)
+	GetSystemPrompt(ctx context.Context, sessionID uuid.UUID) (string, error)
+	CheckIntegrity(ctx context.Context, sessionID uuid.UUID) (*IntegrityReport, error)
+	RepairIntegrity(ctx context.Context, in RepairIntegrityInput) (*RepairIntegrityOutput, error)
 }
 
 type sessionService struct {
@@ -44,6 +62,8 @@ type sessionService struct {
 	publisher          *mq.Publisher
 	cfg                *config.Config
 	redis              *redis.Client
+	diskSvc            DiskService
+	artifactSvc        ArtifactService
 }
 
 const (
@@ -51,9 +71,13 @@ const (
 	redisKeyPrefixParts = "message:parts:"
 	// Default TTL for message parts cache (1 hour)
 	defaultPartsCacheTTL = time.Hour
+	// Redis key prefix for the remembered prompt-cache pin of a session
+	redisKeyPrefixCachePin = "session:cache_pin:"
+	// TTL of the remembered prompt-cache pin (24 hours)
+	cachePinTTL = 24 * time.Hour
 )
 
-func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.AssetReferenceRepo, log *zap.Logger, s3 *blob.S3Deps, publisher *mq.Publisher, cfg *config.Config, redis *redis.Client) SessionService {
+func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.AssetReferenceRepo, log *zap.Logger, s3 *blob.S3Deps, publisher *mq.Publisher, cfg *config.Config, redis *redis.Client, diskSvc DiskService, artifactSvc ArtifactService) SessionService {
 	return &sessionService{
 		sessionRepo:        sessionRepo,
 		assetReferenceRepo: assetReferenceRepo,
@@ -62,22 +86,90 @@ func NewSessionService(sessionRepo repo.SessionRepo, assetReferenceRepo repo.Ass
 		publisher:          publisher,
 		cfg:                cfg,
 		redis:              redis,
+		diskSvc:            diskSvc,
+		artifactSvc:        artifactSvc,
 	}
 }
 
+// ErrInvalidParent is returned by Create when the parent session, message or
+// tool call of a sub-agent session does not exist
+var ErrInvalidParent = errors.New("invalid parent")
+
 func (s *sessionService) Create(ctx context.Context, ss *model.Session) error {
+	if err := s.validateParent(ctx, ss); err != nil {
+		return err
+	}
 	return s.sessionRepo.Create(ctx, ss)
 }
 
+// validateParent checks that the parent session belongs to the same project,
+// that the parent message belongs to the parent session and that the parent
+// tool call is a tool-call part of the parent message
+func (s *sessionService) validateParent(ctx context.Context, ss *model.Session) error {
+	if ss.ParentSessionID == nil {
+		if ss.ParentMessageID != nil || ss.ParentToolCallID != "" {
+			return fmt.Errorf("%w: parent_message_id and parent_tool_call_id require parent_session_id", ErrInvalidParent)
+		}
+		return nil
+	}
+	if ss.ParentToolCallID != "" && ss.ParentMessageID == nil {
+		return fmt.Errorf("%w: parent_tool_call_id requires parent_message_id", ErrInvalidParent)
+	}
+
+	parent, err := s.sessionRepo.Get(ctx, &model.Session{ID: *ss.ParentSessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: parent session not found", ErrInvalidParent)
+		}
+		return fmt.Errorf("get parent session: %w", err)
+	}
+	if parent.ProjectID != ss.ProjectID {
+		return fmt.Errorf("%w: parent session not found", ErrInvalidParent)
+	}
+	if ss.ParentMessageID == nil {
+		return nil
+	}
+
+	msg, err := s.sessionRepo.GetMessage(ctx, parent.ID, *ss.ParentMessageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: parent message not found", ErrInvalidParent)
+		}
+		return fmt.Errorf("get parent message: %w", err)
+	}
+	if ss.ParentToolCallID == "" {
+		return nil
+	}
+
+	for _, part := range s.loadPartsForMessage(ctx, msg.PartsAssetMeta.Data()) {
+		if part.Type == "tool-call" && part.Meta["id"] == ss.ParentToolCallID {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: tool call %s not found in parent message", ErrInvalidParent, ss.ParentToolCallID)
+}
+
 func (s *sessionService) Delete(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) error {
 	if len(sessionID) == 0 {
 		return errors.New("space id is empty")
 	}
 
+	session, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+
 	if err := s.sessionRepo.Delete(ctx, projectID, sessionID); err != nil {
 		return fmt.Errorf("delete session: %w", err)
 	}
 
+	// The disk holding offloaded tool results belongs to the session alone, so it goes with it
+	if session.DiskID != nil {
+		if err := s.diskSvc.Delete(ctx, projectID, *session.DiskID); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.log.Warn("failed to delete session disk", zap.String("disk_id", session.DiskID.String()), zap.Error(err))
+		}
+	}
+
 	return nil
 }
 
@@ -93,13 +185,14 @@ func (s *sessionService) GetByID(ctx context.Context, ss *model.Session) (*model
 }
 
 type ListSessionsInput struct {
-	ProjectID    uuid.UUID  `json:"project_id"`
-	User         string     `json:"user"`
-	SpaceID      *uuid.UUID `json:"space_id,omitempty"`
-	NotConnected bool       `json:"not_connected"`
-	Limit        int        `json:"limit"`
-	Cursor       string     `json:"cursor"`
-	TimeDesc     bool       `json:"time_desc"`
+	ProjectID       uuid.UUID  `json:"project_id"`
+	User            string     `json:"user"`
+	SpaceID         *uuid.UUID `json:"space_id,omitempty"`
+	NotConnected    bool       `json:"not_connected"`
+	ParentSessionID *uuid.UUID `json:"parent_session_id,omitempty"`
+	Limit           int        `json:"limit"`
+	Cursor          string     `json:"cursor"`
+	TimeDesc        bool       `json:"time_desc"`
 }
 
 type ListSessionsOutput struct {
@@ -121,7 +214,7 @@ func (s *sessionService) List(ctx context.Context, in ListSessionsInput) (*ListS
 	}
 
 	// Query limit+1 is used to determine has_more
-	sessions, err := s.sessionRepo.ListWithCursor(ctx, in.ProjectID, in.User, in.SpaceID, in.NotConnected, afterT, afterID, in.Limit+1, in.TimeDesc)
+	sessions, err := s.sessionRepo.ListWithCursor(ctx, in.ProjectID, in.User, in.SpaceID, in.NotConnected, in.ParentSessionID, afterT, afterID, in.Limit+1, in.TimeDesc)
 	if err != nil {
 		return nil, err
 	}
@@ -140,6 +233,70 @@ func (s *sessionService) List(ctx context.Context, in ListSessionsInput) (*ListS
 	return out, nil
 }
 
+// ListChildren returns the sub-agent sessions spawned directly by a session
+func (s *sessionService) ListChildren(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID) ([]model.Session, error) {
+	children, err := s.sessionRepo.ListChildren(ctx, projectID, []uuid.UUID{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("list child sessions: %w", err)
+	}
+	return children, nil
+}
+
+// SessionTreeNode is a session with its sub-agent sessions
+type SessionTreeNode struct {
+	Session  model.Session      `json:"session"`
+	Children []*SessionTreeNode `json:"children"`
+	// Truncated is set when the session has children deeper than the requested depth
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// GetTree returns a session and its descendants down to maxDepth levels,
+// fetching one level per query
+func (s *sessionService) GetTree(ctx context.Context, projectID uuid.UUID, sessionID uuid.UUID, maxDepth int) (*SessionTreeNode, error) {
+	root, err := s.sessionRepo.Get(ctx, &model.Session{ID: sessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	if root.ProjectID != projectID {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	rootNode := &SessionTreeNode{Session: *root, Children: []*SessionTreeNode{}}
+	nodes := map[uuid.UUID]*SessionTreeNode{root.ID: rootNode}
+	level := []uuid.UUID{root.ID}
+	for depth := 0; len(level) > 0; depth++ {
+		children, err := s.sessionRepo.ListChildren(ctx, projectID, level)
+		if err != nil {
+			return nil, fmt.Errorf("list child sessions: %w", err)
+		}
+
+		var next []uuid.UUID
+		for _, child := range children {
+			if _, seen := nodes[child.ID]; seen || child.ParentSessionID == nil {
+				continue
+			}
+			parent, ok := nodes[*child.ParentSessionID]
+			if !ok {
+				continue
+			}
+			if depth >= maxDepth {
+				parent.Truncated = true
+				continue
+			}
+			node := &SessionTreeNode{Session: child, Children: []*SessionTreeNode{}}
+			parent.Children = append(parent.Children, node)
+			nodes[child.ID] = node
+			next = append(next, child.ID)
+		}
+		level = next
+	}
+
+	return rootNode, nil
+}
+
 type StoreMessageInput struct {
 	ProjectID   uuid.UUID
 	SessionID   uuid.UUID
@@ -148,8 +305,21 @@ type StoreMessageInput struct {
 	Format      model.MessageFormat    // Message format (luminox, openai, anthropic, gemini)
 	MessageMeta map[string]interface{} // Message-level metadata (e.g., name, source_format)
 	Files       map[string]*multipart.FileHeader
+	// OffloadToolResultsAboveTokens moves the text of tool-result parts with more
+	// tokens than this threshold into an artifact on the session disk. 0 disables it.
+	OffloadToolResultsAboveTokens int
+	// ExpectedLastMessageID and ExpectedLastSeq make the store fail with
+	// ErrAppendConflict if the session's latest message is not the expected one
+	ExpectedLastMessageID *uuid.UUID
+	ExpectedLastSeq       *int64
+	// AgentName attributes the message to one participant of a multi-agent session
+	AgentName string
 }
 
+// ErrAppendConflict is returned by StoreMessage when another writer appended
+// to the session after the expected last message
+var ErrAppendConflict = repo.ErrAppendConflict
+
 type StoreMQPublishJSON struct {
 	ProjectID uuid.UUID `json:"project_id"`
 	SessionID uuid.UUID `json:"session_id"`
@@ -210,59 +380,313 @@ func (p *PartIn) Validate() error {
 	return nil
 }
 
-// validateAndResolveGeminiToolResult validates and resolves tool-result parts for Gemini format.
-// Strategy:
-// 1. Pop stored call (id, name) pair
-// 2. Validate function name match
-// 3. If response has ID: validate it matches the popped call ID
-// 4. If response has no ID: copy from popped call
-func (s *sessionService) validateAndResolveGeminiToolResult(ctx context.Context, sessionID uuid.UUID, partIn *PartIn, idx int) error {
-	if partIn.Meta == nil {
-		partIn.Meta = make(map[string]interface{})
+// Tool call validation modes, set under ToolCallValidationConfigKey in project,
+// space or session configs
+const (
+	ToolCallValidationConfigKey = "tool_call_validation"
+	// ToolCallValidationOff stores tool calls and results unchecked (default)
+	ToolCallValidationOff = "off"
+	// ToolCallValidationAnnotate stores the message and records the problems
+	// found in each part's meta under model.PartValidationErrorsKey
+	ToolCallValidationAnnotate = "annotate"
+	// ToolCallValidationReject refuses messages with invalid tool calls or results
+	ToolCallValidationReject = "reject"
+)
+
+// ErrInvalidToolCall is returned by StoreMessage in reject mode when a tool call
+// does not match its registered schema or a tool result has no prior tool call
+var ErrInvalidToolCall = errors.New("invalid tool call")
+
+// ValidateConfigs checks the project, space or session configs interpreted by
+// the API when they are written: default edit strategies and the tool call
+// validation mode
+func ValidateConfigs(configs map[string]interface{}) error {
+	if err := editor.ValidateConfigs(configs); err != nil {
+		return err
+	}
+	_, err := toolCallValidationMode(configs)
+	return err
+}
+
+// toolCallValidationMode resolves the tool call validation mode from configs,
+// most specific first
+func toolCallValidationMode(configs ...map[string]interface{}) (string, error) {
+	for _, c := range configs {
+		raw, ok := c[ToolCallValidationConfigKey]
+		if !ok || raw == nil {
+			continue
+		}
+		switch mode, _ := raw.(string); mode {
+		case ToolCallValidationOff, ToolCallValidationAnnotate, ToolCallValidationReject:
+			return mode, nil
+		default:
+			return "", fmt.Errorf("invalid %s: must be one of off, annotate, reject", ToolCallValidationConfigKey)
+		}
 	}
+	return ToolCallValidationOff, nil
+}
 
-	// Get function name from response
-	responseName, hasName := partIn.Meta["name"]
-	if !hasName {
-		return fmt.Errorf("tool-result part[%d] missing function name", idx)
+// validateToolParts checks tool-call arguments against the schema registered for
+// the tool, and that every tool result answers a tool call already stored in the
+// session. Schemas come from the session's latest tool definitions, then from the
+// project's tool references. Depending on the configured mode, problems reject
+// the message or are recorded in the part meta.
+func (s *sessionService) validateToolParts(ctx context.Context, session *model.Session, parts []PartIn) error {
+	var callNames, resultIDs []string
+	for _, p := range parts {
+		switch p.Type {
+		case "tool-call":
+			if name, ok := p.Meta["name"].(string); ok {
+				callNames = append(callNames, name)
+			}
+		case "tool-result":
+			if id, ok := p.Meta["tool_call_id"].(string); ok {
+				resultIDs = append(resultIDs, id)
+			}
+		}
 	}
-	responseNameStr, ok := responseName.(string)
-	if !ok || responseNameStr == "" {
-		return fmt.Errorf("tool-result part[%d] has invalid function name", idx)
+	if len(callNames) == 0 && len(resultIDs) == 0 {
+		return nil
 	}
 
-	// Pop the next stored call (id, name) pair (always pop to validate and consume call info)
-	poppedID, poppedName, err := s.sessionRepo.PopGeminiCallIDAndName(ctx, sessionID)
+	configs, err := s.sessionConfigs(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	mode, err := toolCallValidationMode(configs...)
 	if err != nil {
-		return fmt.Errorf("failed to resolve FunctionResponse for part[%d]: %w", idx, err)
+		return err
+	}
+	if mode == ToolCallValidationOff {
+		return nil
 	}
 
-	// Validate name match - name must match
-	if poppedName != responseNameStr {
-		return fmt.Errorf("function name mismatch for part[%d]: response name '%s' does not match call name '%s'", idx, responseNameStr, poppedName)
+	var schemas map[string]map[string]any
+	complete := false
+	if len(callNames) > 0 {
+		if schemas, complete, err = s.toolSchemas(ctx, session, callNames); err != nil {
+			return err
+		}
+	}
+	var priorCalls map[string]bool
+	if len(resultIDs) > 0 {
+		if priorCalls, err = s.findPriorToolCalls(ctx, session.ID, resultIDs); err != nil {
+			return err
+		}
 	}
 
-	// Handle ID: if response has ID, validate it matches; if not, copy from call
-	responseID, hasID := partIn.Meta["tool_call_id"]
-	if hasID {
-		// ID exists: validate it matches the popped call ID
-		responseIDStr, ok := responseID.(string)
-		if !ok || responseIDStr == "" {
-			return fmt.Errorf("tool-result part[%d] has invalid tool_call_id", idx)
+	var rejected []string
+	for idx := range parts {
+		var problems []string
+		switch parts[idx].Type {
+		case "tool-call":
+			problems = validateToolCallArguments(parts[idx].Meta, schemas, complete)
+		case "tool-result":
+			id, _ := parts[idx].Meta["tool_call_id"].(string)
+			if !priorCalls[id] {
+				problems = []string{fmt.Sprintf("no prior tool call with id %q in the session", id)}
+			}
 		}
-		if responseIDStr != poppedID {
-			return fmt.Errorf("function ID mismatch for part[%d]: response ID '%s' does not match call ID '%s'", idx, responseIDStr, poppedID)
+		if len(problems) == 0 {
+			continue
+		}
+
+		if mode == ToolCallValidationReject {
+			rejected = append(rejected, fmt.Sprintf("parts[%d]: %s", idx, strings.Join(problems, "; ")))
+		} else {
+			if parts[idx].Meta == nil {
+				parts[idx].Meta = map[string]interface{}{}
+			}
+			parts[idx].Meta[model.PartValidationErrorsKey] = problems
 		}
-		// ID matches, no need to update
-	} else {
-		// ID missing: copy from popped call
-		partIn.Meta["tool_call_id"] = poppedID
 	}
 
+	if len(rejected) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidToolCall, strings.Join(rejected, "; "))
+	}
 	return nil
 }
 
-func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput) (*model.Message, error) {
+// findPriorToolCalls returns which of ids are tool calls already stored in the
+// session. Messages stored before tool call ids were recorded are indexed first
+// when some ids are not found.
+func (s *sessionService) findPriorToolCalls(ctx context.Context, sessionID uuid.UUID, ids []string) (map[string]bool, error) {
+	found, err := s.sessionRepo.FindToolCallIDs(ctx, sessionID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("find tool calls: %w", err)
+	}
+	if len(found) < len(ids) {
+		indexed, err := s.indexToolCallIDs(ctx, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if indexed {
+			if found, err = s.sessionRepo.FindToolCallIDs(ctx, sessionID, ids); err != nil {
+				return nil, fmt.Errorf("find tool calls: %w", err)
+			}
+		}
+	}
+
+	calls := make(map[string]bool, len(found))
+	for _, id := range found {
+		calls[id] = true
+	}
+	return calls, nil
+}
+
+// indexToolCallIDs records the tool call ids of the session messages stored
+// before they were recorded on insert, and reports whether there were any
+func (s *sessionService) indexToolCallIDs(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	msgs, err := s.sessionRepo.ListMessagesWithoutToolCallIDs(ctx, sessionID)
+	if err != nil {
+		return false, fmt.Errorf("list unindexed messages: %w", err)
+	}
+	for i := range msgs {
+		if err := s.loadMessageParts(ctx, &msgs[i]); err != nil {
+			return false, err
+		}
+		if err := s.sessionRepo.SetToolCallIDs(ctx, msgs[i].ID, toolCallIDsOf(msgs[i].Parts)); err != nil {
+			return false, fmt.Errorf("index tool calls of message %s: %w", msgs[i].ID, err)
+		}
+	}
+	return len(msgs) > 0, nil
+}
+
+// toolSchemas returns the argument schemas of the named tools. complete reports
+// whether the session declares its tool definitions, in which case a tool
+// missing from them was never offered to the model.
+func (s *sessionService) toolSchemas(ctx context.Context, session *model.Session, names []string) (map[string]map[string]any, bool, error) {
+	schemas := make(map[string]map[string]any)
+	complete := false
+
+	tools, err := s.sessionRepo.GetTools(ctx, session.ID, 0)
+	switch {
+	case err == nil:
+		complete = true
+		for _, tool := range tools.Tools.Data() {
+			schemas[tool.Name] = tool.Parameters
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, false, fmt.Errorf("get tools: %w", err)
+	}
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := schemas[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if complete || len(missing) == 0 {
+		return schemas, complete, nil
+	}
+
+	refs, err := s.sessionRepo.ListToolReferences(ctx, session.ProjectID, missing)
+	if err != nil {
+		return nil, false, fmt.Errorf("list tool references: %w", err)
+	}
+	for _, ref := range refs {
+		if len(ref.ArgumentsSchema) > 0 {
+			schemas[ref.Name] = ref.ArgumentsSchema
+		}
+	}
+	return schemas, complete, nil
+}
+
+// validateToolCallArguments checks the arguments of a tool-call part against the
+// schema of its tool. Arguments may be a JSON string (OpenAI) or an object.
+func validateToolCallArguments(meta map[string]interface{}, schemas map[string]map[string]any, complete bool) []string {
+	name, _ := meta["name"].(string)
+	schema, ok := schemas[name]
+	if !ok {
+		if complete {
+			return []string{fmt.Sprintf("unknown tool %q", name)}
+		}
+		return nil
+	}
+	if schema == nil {
+		return nil
+	}
+
+	args := meta["arguments"]
+	if raw, isString := args.(string); isString {
+		if strings.TrimSpace(raw) == "" {
+			raw = "{}"
+		}
+		if err := sonic.Unmarshal([]byte(raw), &args); err != nil {
+			return []string{fmt.Sprintf("arguments are not valid JSON: %v", err)}
+		}
+	} else {
+		// Round-trip through JSON so that numbers and nested values have the
+		// decoded types the validator expects
+		data, err := sonic.Marshal(args)
+		if err != nil {
+			return []string{fmt.Sprintf("arguments are not valid JSON: %v", err)}
+		}
+		args = nil
+		if err := sonic.Unmarshal(data, &args); err != nil {
+			return []string{fmt.Sprintf("arguments are not valid JSON: %v", err)}
+		}
+	}
+
+	return jsonschema.Validate(schema, args)
+}
+
+// resolveGeminiToolResults matches the Gemini FunctionResponse parts of a message
+// with the session's pending function calls and returns the answered call ids.
+// The calls are only consumed once the message is stored:
+// 1. Validate that every response has a function name, and a valid id if any
+// 2. Match all responses at once: by id when present, otherwise by name
+// 3. Copy the call id to responses without id
+func (s *sessionService) resolveGeminiToolResults(ctx context.Context, sessionID uuid.UUID, parts []PartIn) ([]string, error) {
+	var indexes []int
+	var responses []repo.GeminiFunctionResponse
+	for idx := range parts {
+		partIn := &parts[idx]
+		if partIn.Type != "tool-result" {
+			continue
+		}
+		if partIn.Meta == nil {
+			partIn.Meta = make(map[string]interface{})
+		}
+
+		// Get function name from response
+		responseName, hasName := partIn.Meta["name"]
+		if !hasName {
+			return nil, fmt.Errorf("tool-result part[%d] missing function name", idx)
+		}
+		responseNameStr, ok := responseName.(string)
+		if !ok || responseNameStr == "" {
+			return nil, fmt.Errorf("tool-result part[%d] has invalid function name", idx)
+		}
+
+		resp := repo.GeminiFunctionResponse{Name: responseNameStr}
+		if responseID, hasID := partIn.Meta["tool_call_id"]; hasID {
+			responseIDStr, ok := responseID.(string)
+			if !ok || responseIDStr == "" {
+				return nil, fmt.Errorf("tool-result part[%d] has invalid tool_call_id", idx)
+			}
+			resp.ID = responseIDStr
+		}
+
+		indexes = append(indexes, idx)
+		responses = append(responses, resp)
+	}
+	if len(responses) == 0 {
+		return nil, nil
+	}
+
+	ids, err := s.sessionRepo.ResolveGeminiCalls(ctx, sessionID, responses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve FunctionResponse: %w", err)
+	}
+	for i, idx := range indexes {
+		parts[idx].Meta["tool_call_id"] = ids[i]
+	}
+
+	return ids, nil
+}
+
+func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput) (_ *model.Message, err error) {
 	// Validate session exists and belongs to project before performing expensive operations
 	session, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
 	if err != nil {
@@ -277,19 +701,40 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 		return nil, fmt.Errorf("session does not belong to project")
 	}
 
+	// Fail fast on a stale precondition before uploading anything; it is
+	// checked again atomically when the message is created
+	if err := s.checkAppendPrecondition(ctx, session, in); err != nil {
+		return nil, err
+	}
+
+	// For Gemini format tool-result parts, always validate against stored call info (before file uploads)
+	// This ensures validation happens before file uploads to avoid orphaned assets
+	var geminiCallIDs []string
+	if in.Format == model.FormatGemini {
+		if geminiCallIDs, err = s.resolveGeminiToolResults(ctx, in.SessionID, in.Parts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate tool calls and results once their ids are resolved, also before file uploads
+	if err := s.validateToolParts(ctx, session, in.Parts); err != nil {
+		return nil, err
+	}
+
+	// Undo the uploads and offloads below if the message ends up not being stored
+	var refs []model.Asset
+	var offloaded []offloadedArtifact
+	defer func() {
+		if err != nil {
+			s.discardStore(context.WithoutCancel(ctx), in.ProjectID, refs, offloaded)
+		}
+	}()
+
 	parts := make([]model.Part, 0, len(in.Parts))
 
 	for idx := range in.Parts {
 		partIn := &in.Parts[idx] // Use pointer to avoid repeated indexing and allow modifications
 
-		// For Gemini format tool-result parts, always validate against stored call info (before file uploads)
-		// This ensures validation happens before file uploads to avoid orphaned assets
-		if in.Format == model.FormatGemini && partIn.Type == "tool-result" {
-			if err := s.validateAndResolveGeminiToolResult(ctx, in.SessionID, partIn, idx); err != nil {
-				return nil, err
-			}
-		}
-
 		part := model.Part{
 			Type: partIn.Type,
 			Meta: partIn.Meta,
@@ -310,6 +755,7 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 			if err := s.assetReferenceRepo.IncrementAssetRef(ctx, in.ProjectID, *asset); err != nil {
 				return nil, fmt.Errorf("increment asset reference: %w", err)
 			}
+			refs = append(refs, *asset)
 
 			part.Asset = asset
 			part.Filename = fh.Filename
@@ -319,6 +765,16 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 			part.Text = partIn.Text
 		}
 
+		if part.Type == "tool-result" && in.OffloadToolResultsAboveTokens > 0 && part.Text != "" {
+			artifact, err := s.offloadToolResult(ctx, session, &part, in.OffloadToolResultsAboveTokens)
+			if err != nil {
+				return nil, fmt.Errorf("parts[%d]: offload tool result: %w", idx, err)
+			}
+			if artifact != nil {
+				offloaded = append(offloaded, *artifact)
+			}
+		}
+
 		parts = append(parts, part)
 	}
 
@@ -331,6 +787,7 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 	if err := s.assetReferenceRepo.IncrementAssetRef(ctx, in.ProjectID, *asset); err != nil {
 		return nil, fmt.Errorf("increment asset reference: %w", err)
 	}
+	refs = append(refs, *asset)
 
 	// Cache parts data in Redis after successful S3 upload
 	if s.redis != nil {
@@ -349,12 +806,19 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 	msg := model.Message{
 		SessionID:      in.SessionID,
 		Role:           in.Role,
+		AgentName:      in.AgentName,
 		Meta:           datatypes.NewJSONType(messageMeta), // Store message-level metadata
 		PartsAssetMeta: datatypes.NewJSONType(*asset),
 		Parts:          parts,
+		ToolCallIDs:    toolCallIDsOf(parts),
 	}
 
-	if err := s.sessionRepo.CreateMessageWithAssets(ctx, &msg); err != nil {
+	// The Gemini calls answered by the message are consumed along with the insert
+	if err := s.sessionRepo.CreateMessageWithAssets(ctx, &msg, repo.AppendPrecondition{
+		LastMessageID: in.ExpectedLastMessageID,
+		LastSeq:       in.ExpectedLastSeq,
+		GeminiCallIDs: geminiCallIDs,
+	}); err != nil {
 		return nil, err
 	}
 
@@ -377,6 +841,208 @@ func (s *sessionService) StoreMessage(ctx context.Context, in StoreMessageInput)
 	return &msg, nil
 }
 
+// checkAppendPrecondition checks the expected last message and seq of a store
+// against the session
+func (s *sessionService) checkAppendPrecondition(ctx context.Context, session *model.Session, in StoreMessageInput) error {
+	if in.ExpectedLastSeq != nil && *in.ExpectedLastSeq != session.LastMessageSeq {
+		return fmt.Errorf("%w: last message seq is %d", ErrAppendConflict, session.LastMessageSeq)
+	}
+	if in.ExpectedLastMessageID == nil {
+		return nil
+	}
+
+	last, err := s.sessionRepo.ListBySessionWithCursor(ctx, session.ID, nil, 0, time.Time{}, uuid.Nil, 1, true)
+	if err != nil {
+		return fmt.Errorf("get last message: %w", err)
+	}
+	lastID := uuid.Nil
+	if len(last) > 0 {
+		lastID = last[0].ID
+	}
+	if *in.ExpectedLastMessageID != lastID {
+		return fmt.Errorf("%w: last message is %s", ErrAppendConflict, lastID)
+	}
+	return nil
+}
+
+// discardStore releases the asset references taken and deletes the artifacts
+// offloaded by a message store that failed before the message was created
+func (s *sessionService) discardStore(ctx context.Context, projectID uuid.UUID, refs []model.Asset, offloaded []offloadedArtifact) {
+	for _, asset := range refs {
+		if err := s.assetReferenceRepo.DecrementAssetRef(ctx, projectID, asset); err != nil {
+			s.log.Warn("failed to release asset of unstored message", zap.String("sha256", asset.SHA256), zap.Error(err))
+		}
+	}
+	for _, a := range offloaded {
+		if err := s.artifactSvc.DeleteByPath(ctx, projectID, a.DiskID, a.Path, a.Filename, WriteCondition{}); err != nil {
+			s.log.Warn("failed to delete artifact of unstored message", zap.String("file_path", a.Path+a.Filename), zap.Error(err))
+		}
+	}
+}
+
+const (
+	// offloadedMetaKey is the tool-result part meta key describing where the
+	// offloaded content is stored
+	offloadedMetaKey = "offloaded"
+	// offloadPreviewRunes is the number of leading characters kept inline as a preview
+	offloadPreviewRunes = 500
+)
+
+// offloadedArtifact locates the artifact holding an offloaded tool result
+type offloadedArtifact struct {
+	DiskID   uuid.UUID
+	Path     string
+	Filename string
+}
+
+// offloadToolResult moves the text of a tool-result part into an artifact on the
+// session disk when it exceeds thresholdTokens, and replaces the text with a short
+// reference (disk ID, path and preview) so that the full content stays retrievable
+// through the artifact endpoints. It returns the artifact it created, or nil when
+// the text is kept inline or an artifact already existed at the path.
+func (s *sessionService) offloadToolResult(ctx context.Context, session *model.Session, part *model.Part, thresholdTokens int) (*offloadedArtifact, error) {
+	tokens, err := tokenizer.CountTokens(part.Text)
+	if err != nil {
+		return nil, err
+	}
+	if tokens <= thresholdTokens {
+		return nil, nil
+	}
+
+	diskID, err := s.getOrCreateSessionDisk(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+
+	toolCallID, _ := part.Meta["tool_call_id"].(string)
+	dir := "/sessions/" + session.ID.String() + "/tool_results/"
+	filename := offloadFilename(toolCallID)
+
+	// An artifact already at the path comes from an earlier store of the same
+	// result; it may be referenced, so it is never deleted if this store fails
+	_, err = s.artifactSvc.GetByPath(ctx, diskID, dir, filename)
+	existed := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	form, err := newTextFileForm(filename, []byte(part.Text))
+	if err != nil {
+		return nil, fmt.Errorf("build artifact file: %w", err)
+	}
+	defer form.RemoveAll()
+
+	if _, err := s.artifactSvc.Create(ctx, CreateArtifactInput{
+		ProjectID:  session.ProjectID,
+		DiskID:     diskID,
+		Path:       dir,
+		Filename:   filename,
+		FileHeader: form.File["file"][0],
+		UserMeta: map[string]interface{}{
+			"session_id":   session.ID.String(),
+			"tool_call_id": toolCallID,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	// Copy meta so that the caller's map is left untouched
+	meta := make(map[string]interface{}, len(part.Meta)+1)
+	for k, v := range part.Meta {
+		meta[k] = v
+	}
+	meta[offloadedMetaKey] = map[string]interface{}{
+		"disk_id":   diskID.String(),
+		"file_path": dir + filename,
+		"tokens":    tokens,
+	}
+	part.Meta = meta
+	part.Text = offloadReference(diskID, dir+filename, tokens, part.Text)
+
+	if existed {
+		return nil, nil
+	}
+	return &offloadedArtifact{DiskID: diskID, Path: dir, Filename: filename}, nil
+}
+
+// getOrCreateSessionDisk returns the disk bound to the session, creating and
+// binding a new one on first use
+func (s *sessionService) getOrCreateSessionDisk(ctx context.Context, session *model.Session) (uuid.UUID, error) {
+	if session.DiskID != nil {
+		return *session.DiskID, nil
+	}
+
+	disk, err := s.diskSvc.Create(ctx, session.ProjectID, session.UserID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	boundID, err := s.sessionRepo.BindDisk(ctx, session.ID, disk.ID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("bind disk to session: %w", err)
+	}
+	if boundID != disk.ID {
+		// Another request bound a disk first, drop the one we just created
+		if err := s.diskSvc.Delete(ctx, session.ProjectID, disk.ID); err != nil {
+			s.log.Warn("failed to delete unused session disk", zap.String("disk_id", disk.ID.String()), zap.Error(err))
+		}
+	}
+
+	session.DiskID = &boundID
+	return boundID, nil
+}
+
+// offloadFilename derives the artifact filename of an offloaded tool result
+// from its tool-call ID, falling back to a random name for unusable IDs
+func offloadFilename(toolCallID string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, toolCallID)
+	if strings.Trim(name, "_") == "" {
+		name = uuid.NewString()
+	}
+	return name + ".txt"
+}
+
+// offloadReference builds the text that replaces an offloaded tool result
+func offloadReference(diskID uuid.UUID, filePath string, tokens int, text string) string {
+	preview := text
+	if runes := []rune(text); len(runes) > offloadPreviewRunes {
+		preview = string(runes[:offloadPreviewRunes]) + "..."
+	}
+	return fmt.Sprintf(
+		"[Tool result offloaded to disk (%d tokens). Full content: disk_id=%s file_path=%s, readable via GET disk/%s/artifact?file_path=%s&with_content=true]\nPreview:\n%s",
+		tokens, diskID, filePath, diskID, url.QueryEscape(filePath), preview,
+	)
+}
+
+// newTextFileForm wraps in-memory text content into a multipart form holding a
+// single "file" entry, so that it can be stored through ArtifactService.Create.
+// Callers must call RemoveAll on the returned form.
+func newTextFileForm(filename string, content []byte) (*multipart.Form, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	fw, err := w.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return multipart.NewReader(&buf, w.Boundary()).ReadForm(int64(len(content)) + 1<<20)
+}
+
 type GetMessagesInput struct {
 	SessionID                     uuid.UUID               `json:"session_id"`
 	Limit                         int                     `json:"limit"`
@@ -386,6 +1052,23 @@ type GetMessagesInput struct {
 	TimeDesc                      bool                    `json:"time_desc"`
 	EditStrategies                []editor.StrategyConfig `json:"edit_strategies,omitempty"`
 	PinEditingStrategiesAtMessage string                  `json:"pin_editing_strategies_at_message,omitempty"`
+	// PinEditingStrategiesAtCheckpoint resolves the edit pin from a named checkpoint
+	PinEditingStrategiesAtCheckpoint string `json:"pin_editing_strategies_at_checkpoint,omitempty"`
+	// UntilMessageID and UntilCheckpoint drop every message after the given
+	// message (inclusive bound); at most one of them may be set
+	UntilMessageID      string               `json:"until_message_id,omitempty"`
+	UntilCheckpoint     string               `json:"until_checkpoint,omitempty"`
+	EditStrategiesOrder editor.StrategyOrder `json:"edit_strategies_order,omitempty"`
+	Explain             bool                 `json:"explain,omitempty"`
+	// UseDefaultEditStrategies resolves EditStrategies from the session, space and
+	// project configs (in that order of precedence) when EditStrategies is nil
+	UseDefaultEditStrategies bool `json:"use_default_edit_strategies,omitempty"`
+	// AutoCacheControl places Anthropic cache_control breakpoints automatically
+	// around a deterministic pin that is remembered per session
+	AutoCacheControl  bool `json:"auto_cache_control,omitempty"`
+	CacheGrowthTokens int  `json:"cache_growth_tokens,omitempty"`
+	// AgentNames keeps only messages attributed to one of the given agents
+	AgentNames []string `json:"agent_names,omitempty"`
 }
 
 type PublicURL struct {
@@ -394,42 +1077,81 @@ type PublicURL struct {
 }
 
 type GetMessagesOutput struct {
-	Items           []model.Message      `json:"items"`
-	NextCursor      string               `json:"next_cursor,omitempty"`
-	HasMore         bool                 `json:"has_more"`
-	PublicURLs      map[string]PublicURL `json:"public_urls,omitempty"` // file_name -> url
-	EditAtMessageID string               `json:"edit_at_message_id,omitempty"`
+	Items           []model.Message             `json:"items"`
+	NextCursor      string                      `json:"next_cursor,omitempty"`
+	HasMore         bool                        `json:"has_more"`
+	PublicURLs      map[string]PublicURL        `json:"public_urls,omitempty"` // file_name -> url
+	EditAtMessageID string                      `json:"edit_at_message_id,omitempty"`
+	EditExplain     []editor.StrategyStepReport `json:"edit_explain,omitempty"`
+	// CachePinMessageID and CacheBreakpointIDs are set when AutoCacheControl is enabled
+	CachePinMessageID  string   `json:"cache_pin_message_id,omitempty"`
+	CacheBreakpointIDs []string `json:"cache_breakpoint_ids,omitempty"`
 }
 
 func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (*GetMessagesOutput, error) {
 	var msgs []model.Message
 	var err error
 
-	// Retrieve messages based on limit
-	if in.Limit <= 0 {
-		// If limit <= 0, retrieve all messages
-		msgs, err = s.sessionRepo.ListAllMessagesBySession(ctx, in.SessionID)
+	if in.EditStrategies == nil && in.UseDefaultEditStrategies {
+		in.EditStrategies, err = s.getDefaultEditStrategies(ctx, in.SessionID)
+		// An unknown session has no defaults and simply lists no messages
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	if in.PinEditingStrategiesAtCheckpoint != "" {
+		if in.PinEditingStrategiesAtMessage != "" {
+			return nil, fmt.Errorf("pin_editing_strategies_at_message and pin_editing_strategies_at_checkpoint are mutually exclusive")
+		}
+		cp, err := s.getCheckpoint(ctx, in.SessionID, in.PinEditingStrategiesAtCheckpoint)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		// Parse cursor (createdAt, id); an empty cursor indicates starting from the latest
-		var afterT time.Time
-		var afterID uuid.UUID
-		if in.Cursor != "" {
-			afterT, afterID, err = paging.DecodeCursor(in.Cursor)
+		in.PinEditingStrategiesAtMessage = cp.MessageID.String()
+	}
+
+	until, err := s.resolveUntilMessage(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	// Retrieve messages based on limit
+	if in.Limit <= 0 {
+		// If limit <= 0, retrieve all messages
+		msgs, err = s.sessionRepo.ListAllMessagesBySession(ctx, in.SessionID, in.AgentNames)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Parse cursor (seq, createdAt, id); an empty cursor indicates starting from the latest
+		var afterSeq int64
+		var afterT time.Time
+		var afterID uuid.UUID
+		if in.Cursor != "" {
+			afterSeq, afterT, afterID, err = paging.DecodeSeqCursor(in.Cursor)
 			if err != nil {
 				return nil, err
 			}
 		}
 
 		// Query limit+1 is used to determine has_more
-		msgs, err = s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, afterT, afterID, in.Limit+1, in.TimeDesc)
+		msgs, err = s.sessionRepo.ListBySessionWithCursor(ctx, in.SessionID, in.AgentNames, afterSeq, afterT, afterID, in.Limit+1, in.TimeDesc)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if until != nil {
+		kept := msgs[:0]
+		for _, m := range msgs {
+			if !until.Before(m) {
+				kept = append(kept, m)
+			}
+		}
+		msgs = kept
+	}
+
 	// Load parts for each message
 	for i, m := range msgs {
 		meta := m.PartsAssetMeta.Data()
@@ -440,13 +1162,10 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 		msgs[i].Parts = parts
 	}
 
-	// Always sort messages from old to new (ascending by created_at)
+	// Always sort messages in insertion order (ascending by seq)
 	// regardless of the in.TimeDesc parameter used for cursor pagination
 	sort.Slice(msgs, func(i, j int) bool {
-		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
-			return msgs[i].ID.String() < msgs[j].ID.String()
-		}
-		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+		return msgs[i].Before(msgs[j])
 	})
 
 	// Build output with pagination info
@@ -458,12 +1177,40 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 		out.HasMore = true
 		out.Items = msgs[:in.Limit]
 		last := out.Items[len(out.Items)-1]
-		out.NextCursor = paging.EncodeCursor(last.CreatedAt, last.ID)
+		out.NextCursor = paging.EncodeSeqCursor(last.Seq, last.CreatedAt, last.ID)
+	}
+
+	// Select the prompt-cache pin on the unedited messages; it also pins the
+	// edit strategies unless the caller chose a pin explicitly
+	if in.AutoCacheControl {
+		pin, err := editor.SelectCachePin(ctx, out.Items, in.CacheGrowthTokens, s.getRememberedCachePin(ctx, in.SessionID))
+		if err != nil {
+			return nil, fmt.Errorf("select cache pin: %w", err)
+		}
+		if pin != "" {
+			s.rememberCachePin(ctx, in.SessionID, pin)
+		}
+		out.CachePinMessageID = pin
+		if in.PinEditingStrategiesAtMessage == "" {
+			in.PinEditingStrategiesAtMessage = pin
+		}
 	}
 
 	// Apply edit strategies if provided (before format conversion)
-	if len(in.EditStrategies) > 0 {
-		result, err := editor.ApplyStrategiesWithPin(out.Items, in.EditStrategies, in.PinEditingStrategiesAtMessage)
+	editOpts := editor.ApplyOptions{
+		PinAtMessageID: in.PinEditingStrategiesAtMessage,
+		Order:          in.EditStrategiesOrder,
+	}
+	if len(in.EditStrategies) > 0 && in.Explain {
+		result, err := editor.ExplainStrategiesWithOptions(ctx, out.Items, in.EditStrategies, editOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply edit strategies: %w", err)
+		}
+		out.Items = result.Messages
+		out.EditAtMessageID = result.EditAtMessageID
+		out.EditExplain = result.Steps
+	} else if len(in.EditStrategies) > 0 {
+		result, err := editor.ApplyStrategiesWithOptions(out.Items, in.EditStrategies, editOpts)
 		if err != nil {
 			return nil, fmt.Errorf("failed to apply edit strategies: %w", err)
 		}
@@ -474,6 +1221,13 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 		out.EditAtMessageID = out.Items[len(out.Items)-1].ID.String()
 	}
 
+	if in.AutoCacheControl {
+		out.CacheBreakpointIDs, err = editor.PlaceCacheBreakpoints(ctx, out.Items, out.CachePinMessageID, in.CacheGrowthTokens)
+		if err != nil {
+			return nil, fmt.Errorf("place cache breakpoints: %w", err)
+		}
+	}
+
 	// Generate presigned URLs for assets if requested
 	if in.WithAssetPublicURL && s.s3 != nil {
 		out.PublicURLs = make(map[string]PublicURL)
@@ -497,6 +1251,71 @@ func (s *sessionService) GetMessages(ctx context.Context, in GetMessagesInput) (
 	return out, nil
 }
 
+// getDefaultEditStrategies resolves the default edit strategies of a session.
+// Session configs override space configs, which override project configs.
+func (s *sessionService) getDefaultEditStrategies(ctx context.Context, sessionID uuid.UUID) ([]editor.StrategyConfig, error) {
+	configs, err := s.sessionConfigs(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	strategies, err := editor.ResolveDefaultStrategies(configs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default edit strategies: %w", err)
+	}
+	return strategies, nil
+}
+
+// sessionConfigs returns the configs that apply to a session, most specific
+// first: session, space (if any), then project. Session and space configs are
+// validated when written through the API; project configs are written outside
+// of it, so they are validated here and ignored when invalid.
+func (s *sessionService) sessionConfigs(ctx context.Context, sessionID uuid.UUID) ([]map[string]interface{}, error) {
+	session, err := s.sessionRepo.GetWithSpaceAndProject(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get session configs: %w", err)
+	}
+
+	configs := []map[string]interface{}{session.Configs}
+	if session.Space != nil {
+		configs = append(configs, session.Space.Configs)
+	}
+	if session.Project != nil {
+		if err := ValidateConfigs(session.Project.Configs); err != nil {
+			s.log.Warn("ignoring invalid project configs", zap.String("project_id", session.Project.ID.String()), zap.Error(err))
+		} else {
+			configs = append(configs, session.Project.Configs)
+		}
+	}
+	return configs, nil
+}
+
+// getRememberedCachePin returns the prompt-cache pin remembered for a session, if any
+func (s *sessionService) getRememberedCachePin(ctx context.Context, sessionID uuid.UUID) string {
+	if s.redis == nil {
+		return ""
+	}
+	pin, err := s.redis.Get(ctx, redisKeyPrefixCachePin+sessionID.String()).Result()
+	if err != nil {
+		if err != redis.Nil {
+			s.log.Warn("failed to get cache pin from Redis", zap.String("session_id", sessionID.String()), zap.Error(err))
+		}
+		return ""
+	}
+	return pin
+}
+
+// rememberCachePin stores the prompt-cache pin of a session so that consecutive
+// calls share the same cached prefix
+func (s *sessionService) rememberCachePin(ctx context.Context, sessionID uuid.UUID, pin string) {
+	if s.redis == nil {
+		return
+	}
+	if err := s.redis.Set(ctx, redisKeyPrefixCachePin+sessionID.String(), pin, cachePinTTL).Err(); err != nil {
+		s.log.Warn("failed to remember cache pin in Redis", zap.String("session_id", sessionID.String()), zap.Error(err))
+	}
+}
+
 // cachePartsInRedis stores message parts in Redis with a fixed TTL
 func (s *sessionService) cachePartsInRedis(ctx context.Context, sha256 string, parts []model.Part) error {
 	if s.redis == nil {
@@ -587,7 +1406,7 @@ func (s *sessionService) loadPartsForMessage(ctx context.Context, meta model.Ass
 // GetAllMessages retrieves all messages for a session and loads their parts
 func (s *sessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
 	// Get all messages from repository
-	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID)
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list messages: %w", err)
 	}
@@ -598,12 +1417,9 @@ func (s *sessionService) GetAllMessages(ctx context.Context, sessionID uuid.UUID
 		msgs[i].Parts = s.loadPartsForMessage(ctx, meta)
 	}
 
-	// Sort messages from old to new (ascending by created_at)
+	// Sort messages in insertion order (ascending by seq)
 	sort.Slice(msgs, func(i, j int) bool {
-		if msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
-			return msgs[i].ID.String() < msgs[j].ID.String()
-		}
-		return msgs[i].CreatedAt.Before(msgs[j].CreatedAt)
+		return msgs[i].Before(msgs[j])
 	})
 
 	return msgs, nil
@@ -634,3 +1450,624 @@ func (s *sessionService) GetSessionObservingStatus(
 
 	return status, nil
 }
+
+// resolveUntilMessage returns the message bounding GetMessages from
+// UntilMessageID or UntilCheckpoint, or nil when neither is set
+func (s *sessionService) resolveUntilMessage(ctx context.Context, in GetMessagesInput) (*model.Message, error) {
+	if in.UntilMessageID == "" && in.UntilCheckpoint == "" {
+		return nil, nil
+	}
+	if in.UntilMessageID != "" && in.UntilCheckpoint != "" {
+		return nil, fmt.Errorf("until_message and until_checkpoint are mutually exclusive")
+	}
+	if in.Limit > 0 && in.TimeDesc {
+		return nil, fmt.Errorf("until_message and until_checkpoint cannot be combined with time_desc pagination")
+	}
+
+	var messageID uuid.UUID
+	if in.UntilCheckpoint != "" {
+		cp, err := s.getCheckpoint(ctx, in.SessionID, in.UntilCheckpoint)
+		if err != nil {
+			return nil, err
+		}
+		messageID = cp.MessageID
+	} else {
+		id, err := uuid.Parse(in.UntilMessageID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid until_message: %w", err)
+		}
+		messageID = id
+	}
+
+	msg, err := s.sessionRepo.GetMessage(ctx, in.SessionID, messageID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("until message not found")
+		}
+		return nil, fmt.Errorf("get until message: %w", err)
+	}
+	return msg, nil
+}
+
+type SetCheckpointInput struct {
+	SessionID   uuid.UUID `json:"session_id"`
+	Name        string    `json:"name"`
+	MessageID   uuid.UUID `json:"message_id"`
+	Description string    `json:"description"`
+}
+
+// SetCheckpoint creates a named checkpoint, or moves an existing one with the
+// same name, pointing at a message of the session
+func (s *sessionService) SetCheckpoint(ctx context.Context, in SetCheckpointInput) (*model.Checkpoint, error) {
+	if _, err := s.sessionRepo.GetMessage(ctx, in.SessionID, in.MessageID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("message not found")
+		}
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+
+	cp := &model.Checkpoint{
+		SessionID:   in.SessionID,
+		Name:        in.Name,
+		MessageID:   in.MessageID,
+		Description: in.Description,
+	}
+	if err := s.sessionRepo.UpsertCheckpoint(ctx, cp); err != nil {
+		return nil, fmt.Errorf("upsert checkpoint: %w", err)
+	}
+
+	// Re-read so an updated checkpoint reports its original ID and created_at
+	return s.getCheckpoint(ctx, in.SessionID, in.Name)
+}
+
+// ListCheckpoints returns the checkpoints of a session, oldest first
+func (s *sessionService) ListCheckpoints(ctx context.Context, sessionID uuid.UUID) ([]model.Checkpoint, error) {
+	checkpoints, err := s.sessionRepo.ListCheckpoints(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// DeleteCheckpoint deletes a checkpoint of a session by name
+func (s *sessionService) DeleteCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) error {
+	if err := s.sessionRepo.DeleteCheckpoint(ctx, sessionID, name); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("checkpoint not found")
+		}
+		return fmt.Errorf("delete checkpoint: %w", err)
+	}
+	return nil
+}
+
+func (s *sessionService) getCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) (*model.Checkpoint, error) {
+	cp, err := s.sessionRepo.GetCheckpoint(ctx, sessionID, name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("checkpoint %q not found", name)
+		}
+		return nil, fmt.Errorf("get checkpoint: %w", err)
+	}
+	return cp, nil
+}
+
+// SystemPromptConfigKey is the key under which the system prompt is stored in
+// project, space and session configs
+const SystemPromptConfigKey = "system_prompt"
+
+// ErrToolsNotFound is returned by GetTools when the session has no such tools version
+var ErrToolsNotFound = errors.New("tools not found")
+
+type SetToolsInput struct {
+	SessionID    uuid.UUID              `json:"session_id"`
+	SourceFormat model.MessageFormat    `json:"source_format"`
+	Tools        []model.ToolDefinition `json:"tools"`
+}
+
+// SetTools stores the tool definitions given to the model as a new version
+func (s *sessionService) SetTools(ctx context.Context, in SetToolsInput) (*model.SessionTools, error) {
+	seen := make(map[string]bool, len(in.Tools))
+	for i, tool := range in.Tools {
+		if tool.Name == "" {
+			return nil, fmt.Errorf("tools[%d]: name is required", i)
+		}
+		if seen[tool.Name] {
+			return nil, fmt.Errorf("tools[%d]: duplicate tool name %q", i, tool.Name)
+		}
+		seen[tool.Name] = true
+	}
+
+	tools := &model.SessionTools{
+		SessionID:    in.SessionID,
+		SourceFormat: in.SourceFormat,
+		Tools:        datatypes.NewJSONType(in.Tools),
+	}
+	if err := s.sessionRepo.CreateTools(ctx, tools); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("create tools: %w", err)
+	}
+	return tools, nil
+}
+
+// GetTools returns a version of the session's tool definitions, or the latest
+// version if version is 0
+func (s *sessionService) GetTools(ctx context.Context, sessionID uuid.UUID, version int) (*model.SessionTools, error) {
+	tools, err := s.sessionRepo.GetTools(ctx, sessionID, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if version > 0 {
+				return nil, fmt.Errorf("%w: version %d", ErrToolsNotFound, version)
+			}
+			return nil, ErrToolsNotFound
+		}
+		return nil, fmt.Errorf("get tools: %w", err)
+	}
+	return tools, nil
+}
+
+// ListTools returns every version of the session's tool definitions, oldest first
+func (s *sessionService) ListTools(ctx context.Context, sessionID uuid.UUID) ([]model.SessionTools, error) {
+	tools, err := s.sessionRepo.ListTools(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("list tools: %w", err)
+	}
+	return tools, nil
+}
+
+// GetSystemPrompt resolves the system prompt of a session. Session configs
+// override space configs, which override project configs.
+func (s *sessionService) GetSystemPrompt(ctx context.Context, sessionID uuid.UUID) (string, error) {
+	configs, err := s.sessionConfigs(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, c := range configs {
+		raw, ok := c[SystemPromptConfigKey]
+		if !ok || raw == nil {
+			continue
+		}
+		prompt, ok := raw.(string)
+		if !ok {
+			return "", fmt.Errorf("invalid %s: must be a string", SystemPromptConfigKey)
+		}
+		return prompt, nil
+	}
+	return "", nil
+}
+
+// SetMessageProtected flags or unflags a message as protected from edit strategies
+func (s *sessionService) SetMessageProtected(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, protected bool) error {
+	if err := s.sessionRepo.SetMessageProtected(ctx, sessionID, messageID, protected); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("message not found")
+		}
+		return fmt.Errorf("set message protected: %w", err)
+	}
+	return nil
+}
+
+// Kinds of session integrity issues
+const (
+	// IntegrityOrphanToolCall is a tool call that no later tool result answers
+	IntegrityOrphanToolCall = "orphan_tool_call"
+	// IntegrityOrphanToolResult is a tool result without an earlier, unanswered tool call
+	IntegrityOrphanToolResult = "orphan_tool_result"
+	// IntegrityDuplicateToolCallID is a tool call reusing the id of an earlier tool call
+	IntegrityDuplicateToolCallID = "duplicate_tool_call_id"
+	// IntegrityPendingGeminiCall is Gemini call info still waiting for its function response
+	IntegrityPendingGeminiCall = "pending_gemini_call"
+)
+
+// IntegrityIssue is a tool call or tool result that breaks call/result pairing
+type IntegrityIssue struct {
+	Kind       string    `json:"kind" example:"orphan_tool_call"`
+	MessageID  uuid.UUID `json:"message_id"`
+	PartIndex  *int      `json:"part_index,omitempty" example:"0"`
+	ToolCallID string    `json:"tool_call_id" example:"call_abc123"`
+	ToolName   string    `json:"tool_name,omitempty" example:"get_weather"`
+}
+
+// IntegrityReport lists the pairing issues of a session, in message order
+type IntegrityReport struct {
+	Healthy bool             `json:"healthy"`
+	Issues  []IntegrityIssue `json:"issues"`
+}
+
+// Ways RepairIntegrity handles orphan tool calls
+const (
+	// RepairCancelOrphanToolCalls answers orphan tool calls with a synthetic error result
+	RepairCancelOrphanToolCalls = "cancel"
+	// RepairDropOrphanToolCalls removes orphan tool calls
+	RepairDropOrphanToolCalls = "drop"
+)
+
+// cancelledToolResultText is the text of the synthetic results answering orphan tool calls
+const cancelledToolResultText = "Tool call was cancelled: no result was recorded."
+
+type RepairIntegrityInput struct {
+	ProjectID uuid.UUID
+	SessionID uuid.UUID
+	// OrphanToolCalls is RepairCancelOrphanToolCalls (default) or RepairDropOrphanToolCalls
+	OrphanToolCalls string
+}
+
+type RepairIntegrityOutput struct {
+	// Fixed lists the issues found before the repair
+	Fixed            []IntegrityIssue `json:"fixed"`
+	UpdatedMessages  []uuid.UUID      `json:"updated_messages"`
+	InsertedMessages []uuid.UUID      `json:"inserted_messages"`
+	DeletedMessages  []uuid.UUID      `json:"deleted_messages"`
+}
+
+// CheckIntegrity reports orphan tool calls and results, duplicate tool call ids
+// and pending Gemini call info in a session
+func (s *sessionService) CheckIntegrity(ctx context.Context, sessionID uuid.UUID) (*IntegrityReport, error) {
+	msgs, err := s.listMessagesWithParts(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	issues := auditToolPairing(msgs)
+	return &IntegrityReport{Healthy: len(issues) == 0, Issues: issues}, nil
+}
+
+// RepairIntegrity fixes the issues reported by CheckIntegrity: duplicate tool
+// calls and orphan tool results are dropped, orphan tool calls are cancelled or
+// dropped, and pending Gemini call info is cleared. Messages left without parts
+// are deleted. The repair is rejected with ErrAppendConflict when a message is
+// appended while it runs.
+func (s *sessionService) RepairIntegrity(ctx context.Context, in RepairIntegrityInput) (*RepairIntegrityOutput, error) {
+	if in.OrphanToolCalls == "" {
+		in.OrphanToolCalls = RepairCancelOrphanToolCalls
+	}
+	if in.OrphanToolCalls != RepairCancelOrphanToolCalls && in.OrphanToolCalls != RepairDropOrphanToolCalls {
+		return nil, fmt.Errorf("invalid orphan_tool_calls: must be one of cancel, drop")
+	}
+
+	session, err := s.sessionRepo.Get(ctx, &model.Session{ID: in.SessionID})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("session not found")
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session.ProjectID != in.ProjectID {
+		return nil, fmt.Errorf("session does not belong to project")
+	}
+
+	msgs, err := s.listMessagesWithParts(ctx, in.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &RepairIntegrityOutput{
+		Fixed:            auditToolPairing(msgs),
+		UpdatedMessages:  []uuid.UUID{},
+		InsertedMessages: []uuid.UUID{},
+		DeletedMessages:  []uuid.UUID{},
+	}
+	if len(out.Fixed) == 0 {
+		return out, nil
+	}
+
+	plan := planIntegrityRepair(msgs, out.Fixed, in.OrphanToolCalls)
+
+	// Upload the new parts first, so that nothing references a missing asset
+	var repair repo.MessageRepair
+	var uploaded, released []model.Asset
+	upload := func(parts []model.Part) (*model.Asset, error) {
+		asset, err := s.s3.UploadJSON(ctx, "parts/"+in.ProjectID.String(), parts)
+		if err != nil {
+			return nil, fmt.Errorf("upload parts to S3 failed: %w", err)
+		}
+		if err := s.assetReferenceRepo.IncrementAssetRef(ctx, in.ProjectID, *asset); err != nil {
+			return nil, fmt.Errorf("increment asset reference: %w", err)
+		}
+		uploaded = append(uploaded, *asset)
+		return asset, nil
+	}
+	rollback := func() {
+		if len(uploaded) == 0 {
+			return
+		}
+		if err := s.assetReferenceRepo.BatchDecrementAssetRefs(ctx, in.ProjectID, uploaded); err != nil {
+			s.log.Warn("failed to release repair parts", zap.String("session_id", in.SessionID.String()), zap.Error(err))
+		}
+	}
+
+	for i, msg := range msgs {
+		if plan.deleted[i] {
+			repair.Delete = append(repair.Delete, msg.ID)
+			released = append(released, msg.PartsAssetMeta.Data())
+			out.DeletedMessages = append(out.DeletedMessages, msg.ID)
+		} else if parts, ok := plan.parts[i]; ok {
+			asset, err := upload(parts)
+			if err != nil {
+				rollback()
+				return nil, err
+			}
+			meta := msg.Meta.Data()
+			if plan.clearGemini[i] {
+				delete(meta, model.GeminiCallInfoKey)
+			}
+			msg.Meta = datatypes.NewJSONType(meta)
+			msg.PartsAssetMeta = datatypes.NewJSONType(*asset)
+			msg.ToolCallIDs = toolCallIDsOf(parts)
+			repair.Update = append(repair.Update, msg)
+			released = append(released, msgs[i].PartsAssetMeta.Data())
+			out.UpdatedMessages = append(out.UpdatedMessages, msg.ID)
+		}
+
+		if results, ok := plan.inserts[i]; ok {
+			asset, err := upload(results)
+			if err != nil {
+				rollback()
+				return nil, err
+			}
+			// Sorts right after the calling message, which is its parent
+			repair.Insert = append(repair.Insert, model.Message{
+				ID:             uuid.New(),
+				ParentID:       &msg.ID,
+				Role:           "user",
+				AgentName:      msg.AgentName,
+				Meta:           datatypes.NewJSONType(map[string]any{}),
+				PartsAssetMeta: datatypes.NewJSONType(*asset),
+				ToolCallIDs:    []string{},
+				CreatedAt:      msg.CreatedAt.Add(time.Microsecond),
+			})
+			out.InsertedMessages = append(out.InsertedMessages, repair.Insert[len(repair.Insert)-1].ID)
+		}
+	}
+
+	if err := s.sessionRepo.RepairMessages(ctx, in.SessionID, session.LastMessageSeq, repair); err != nil {
+		rollback()
+		return nil, err
+	}
+
+	for _, part := range plan.dropped {
+		if part.Asset != nil {
+			released = append(released, *part.Asset)
+		}
+	}
+	assets := make([]model.Asset, 0, len(released))
+	for _, asset := range released {
+		if asset.SHA256 != "" {
+			assets = append(assets, asset)
+		}
+	}
+	if err := s.assetReferenceRepo.BatchDecrementAssetRefs(ctx, in.ProjectID, assets); err != nil {
+		s.log.Warn("failed to release repaired parts", zap.String("session_id", in.SessionID.String()), zap.Error(err))
+	}
+
+	return out, nil
+}
+
+// listMessagesWithParts returns every message of a session with its parts. Unlike
+// GetAllMessages it fails when parts cannot be loaded, as an empty message would
+// be mistaken for one without tool calls.
+func (s *sessionService) listMessagesWithParts(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
+	msgs, err := s.sessionRepo.ListAllMessagesBySession(ctx, sessionID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+
+	for i := range msgs {
+		if err := s.loadMessageParts(ctx, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].Before(msgs[j])
+	})
+	return msgs, nil
+}
+
+// loadMessageParts loads the parts of a message from cache or S3, failing when
+// they cannot be loaded
+func (s *sessionService) loadMessageParts(ctx context.Context, msg *model.Message) error {
+	meta := msg.PartsAssetMeta.Data()
+	if s.redis != nil {
+		if parts, err := s.getPartsFromRedis(ctx, meta.SHA256); err == nil {
+			msg.Parts = parts
+			return nil
+		}
+	}
+	if s.s3 == nil {
+		return fmt.Errorf("load parts of message %s: no blob storage", msg.ID)
+	}
+	parts := []model.Part{}
+	if err := s.s3.DownloadJSON(ctx, meta.S3Key, &parts); err != nil {
+		return fmt.Errorf("load parts of message %s: %w", msg.ID, err)
+	}
+	msg.Parts = parts
+	return nil
+}
+
+// auditToolPairing walks the messages in order and pairs each tool result with
+// the earliest unanswered tool call of the same id
+func auditToolPairing(msgs []model.Message) []IntegrityIssue {
+	type callRef struct {
+		msg, part int
+		name      string
+	}
+
+	issues := []IntegrityIssue{}
+	seen := map[string]bool{}
+	open := map[string]callRef{}
+
+	for i, msg := range msgs {
+		for j, part := range msg.Parts {
+			switch part.Type {
+			case "tool-call":
+				id, _ := part.Meta["id"].(string)
+				name, _ := part.Meta["name"].(string)
+				if seen[id] {
+					issues = append(issues, IntegrityIssue{Kind: IntegrityDuplicateToolCallID, MessageID: msg.ID, PartIndex: intPtr(j), ToolCallID: id, ToolName: name})
+					continue
+				}
+				seen[id] = true
+				open[id] = callRef{msg: i, part: j, name: name}
+			case "tool-result":
+				id, _ := part.Meta["tool_call_id"].(string)
+				if _, ok := open[id]; ok {
+					delete(open, id)
+					continue
+				}
+				name, _ := part.Meta["name"].(string)
+				issues = append(issues, IntegrityIssue{Kind: IntegrityOrphanToolResult, MessageID: msg.ID, PartIndex: intPtr(j), ToolCallID: id, ToolName: name})
+			}
+		}
+
+		for _, call := range pendingGeminiCalls(msg) {
+			issues = append(issues, IntegrityIssue{Kind: IntegrityPendingGeminiCall, MessageID: msg.ID, ToolCallID: call.ID, ToolName: call.Name})
+		}
+	}
+
+	orphans := make([]callRef, 0, len(open))
+	for _, call := range open {
+		orphans = append(orphans, call)
+	}
+	sort.Slice(orphans, func(a, b int) bool {
+		if orphans[a].msg != orphans[b].msg {
+			return orphans[a].msg < orphans[b].msg
+		}
+		return orphans[a].part < orphans[b].part
+	})
+	for _, call := range orphans {
+		id, _ := msgs[call.msg].Parts[call.part].Meta["id"].(string)
+		issues = append(issues, IntegrityIssue{Kind: IntegrityOrphanToolCall, MessageID: msgs[call.msg].ID, PartIndex: intPtr(call.part), ToolCallID: id, ToolName: call.name})
+	}
+
+	return issues
+}
+
+type geminiCallInfo struct {
+	ID   string
+	Name string
+}
+
+// pendingGeminiCalls returns the Gemini call info of a message that no function
+// response has consumed yet
+func pendingGeminiCalls(msg model.Message) []geminiCallInfo {
+	raw, ok := msg.Meta.Data()[model.GeminiCallInfoKey].([]interface{})
+	if !ok {
+		return nil
+	}
+	calls := make([]geminiCallInfo, 0, len(raw))
+	for _, c := range raw {
+		info, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, _ := info["id"].(string)
+		name, _ := info["name"].(string)
+		calls = append(calls, geminiCallInfo{ID: id, Name: name})
+	}
+	return calls
+}
+
+// integrityRepairPlan describes a repair by message index
+type integrityRepairPlan struct {
+	// parts holds the new parts of rewritten messages
+	parts map[int][]model.Part
+	// clearGemini marks messages whose pending Gemini call info is removed
+	clearGemini map[int]bool
+	// deleted marks messages left without parts
+	deleted map[int]bool
+	// inserts holds synthetic tool results to store in a new message after the message
+	inserts map[int][]model.Part
+	// dropped holds the removed parts
+	dropped []model.Part
+}
+
+// planIntegrityRepair computes the changes fixing the given issues of msgs.
+// Synthetic results for orphan tool calls go at the start of the next message
+// when it is a user message, as providers expect, or in a new message otherwise.
+func planIntegrityRepair(msgs []model.Message, issues []IntegrityIssue, orphanToolCalls string) integrityRepairPlan {
+	plan := integrityRepairPlan{
+		parts:       map[int][]model.Part{},
+		clearGemini: map[int]bool{},
+		deleted:     map[int]bool{},
+		inserts:     map[int][]model.Part{},
+	}
+
+	index := make(map[uuid.UUID]int, len(msgs))
+	for i, msg := range msgs {
+		index[msg.ID] = i
+	}
+
+	drop := map[[2]int]bool{}
+	cancelled := map[int][]model.Part{}
+	for _, issue := range issues {
+		i := index[issue.MessageID]
+		switch issue.Kind {
+		case IntegrityPendingGeminiCall:
+			plan.clearGemini[i] = true
+		case IntegrityOrphanToolCall:
+			if orphanToolCalls == RepairDropOrphanToolCalls {
+				drop[[2]int{i, *issue.PartIndex}] = true
+				continue
+			}
+			meta := map[string]any{"tool_call_id": issue.ToolCallID, "is_error": true}
+			if issue.ToolName != "" {
+				meta["name"] = issue.ToolName
+			}
+			cancelled[i] = append(cancelled[i], model.Part{Type: "tool-result", Text: cancelledToolResultText, Meta: meta})
+		default:
+			drop[[2]int{i, *issue.PartIndex}] = true
+		}
+	}
+
+	for i, msg := range msgs {
+		var parts []model.Part
+		changed := plan.clearGemini[i]
+
+		if results, ok := cancelled[i-1]; ok && msg.Role == "user" {
+			parts = append(parts, results...)
+			changed = true
+		}
+		for j, part := range msg.Parts {
+			if drop[[2]int{i, j}] {
+				plan.dropped = append(plan.dropped, part)
+				changed = true
+				continue
+			}
+			parts = append(parts, part)
+		}
+
+		if results, ok := cancelled[i]; ok && (i+1 == len(msgs) || msgs[i+1].Role != "user") {
+			plan.inserts[i] = results
+		}
+
+		switch {
+		case !changed:
+		case len(parts) == 0:
+			plan.deleted[i] = true
+		default:
+			plan.parts[i] = parts
+		}
+	}
+
+	return plan
+}
+
+func toolCallIDsOf(parts []model.Part) []string {
+	ids := []string{}
+	for _, part := range parts {
+		if part.Type != "tool-call" {
+			continue
+		}
+		if id, ok := part.Meta["id"].(string); ok && id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func intPtr(v int) *int {
+	return &v
+}
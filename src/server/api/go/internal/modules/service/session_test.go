@@ -4,15 +4,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/memodb-io/Luminox/internal/config"
+	"github.com/memodb-io/Luminox/internal/infra/blob"
 	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/modules/repo"
+	"github.com/memodb-io/Luminox/internal/pkg/editor"
+	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/fileparser"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // MockSessionRepo is a mock implementation of SessionRepo
@@ -43,34 +60,149 @@ func (m *MockSessionRepo) Get(ctx context.Context, s *model.Session) (*model.Ses
 	return args.Get(0).(*model.Session), args.Error(1)
 }
 
+func (m *MockSessionRepo) GetWithSpaceAndProject(ctx context.Context, sessionID uuid.UUID) (*model.Session, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Session), args.Error(1)
+}
+
+func (m *MockSessionRepo) SetMessageProtected(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID, protected bool) error {
+	args := m.Called(ctx, sessionID, messageID, protected)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) BindDisk(ctx context.Context, sessionID uuid.UUID, diskID uuid.UUID) (uuid.UUID, error) {
+	args := m.Called(ctx, sessionID, diskID)
+	return args.Get(0).(uuid.UUID), args.Error(1)
+}
+
+func (m *MockSessionRepo) GetMessage(ctx context.Context, sessionID uuid.UUID, messageID uuid.UUID) (*model.Message, error) {
+	args := m.Called(ctx, sessionID, messageID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListChildren(ctx context.Context, projectID uuid.UUID, parentSessionIDs []uuid.UUID) ([]model.Session, error) {
+	args := m.Called(ctx, projectID, parentSessionIDs)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Session), args.Error(1)
+}
+
+func (m *MockSessionRepo) UpsertCheckpoint(ctx context.Context, cp *model.Checkpoint) error {
+	args := m.Called(ctx, cp)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) GetCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) (*model.Checkpoint, error) {
+	args := m.Called(ctx, sessionID, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Checkpoint), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListCheckpoints(ctx context.Context, sessionID uuid.UUID) ([]model.Checkpoint, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Checkpoint), args.Error(1)
+}
+
+func (m *MockSessionRepo) DeleteCheckpoint(ctx context.Context, sessionID uuid.UUID, name string) error {
+	args := m.Called(ctx, sessionID, name)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) CreateTools(ctx context.Context, tools *model.SessionTools) error {
+	args := m.Called(ctx, tools)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) GetTools(ctx context.Context, sessionID uuid.UUID, version int) (*model.SessionTools, error) {
+	args := m.Called(ctx, sessionID, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.SessionTools), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListTools(ctx context.Context, sessionID uuid.UUID) ([]model.SessionTools, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.SessionTools), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListMessagesWithoutToolCallIDs(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
+	args := m.Called(ctx, sessionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.Message), args.Error(1)
+}
+
+func (m *MockSessionRepo) SetToolCallIDs(ctx context.Context, messageID uuid.UUID, ids []string) error {
+	args := m.Called(ctx, messageID, ids)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepo) FindToolCallIDs(ctx context.Context, sessionID uuid.UUID, ids []string) ([]string, error) {
+	args := m.Called(ctx, sessionID, ids)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockSessionRepo) ListToolReferences(ctx context.Context, projectID uuid.UUID, names []string) ([]model.ToolReference, error) {
+	args := m.Called(ctx, projectID, names)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]model.ToolReference), args.Error(1)
+}
+
+func (m *MockSessionRepo) RepairMessages(ctx context.Context, sessionID uuid.UUID, lastSeq int64, repair repo.MessageRepair) error {
+	args := m.Called(ctx, sessionID, lastSeq, repair)
+	return args.Error(0)
+}
+
 func (m *MockSessionRepo) GetDisableTaskTracking(ctx context.Context, sessionID uuid.UUID) (bool, error) {
 	args := m.Called(ctx, sessionID)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockSessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message) error {
-	args := m.Called(ctx, msg)
+func (m *MockSessionRepo) CreateMessageWithAssets(ctx context.Context, msg *model.Message, cond repo.AppendPrecondition) error {
+	args := m.Called(ctx, msg, cond)
 	return args.Error(0)
 }
 
-func (m *MockSessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, afterT time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
-	args := m.Called(ctx, sessionID, afterT, afterID, limit, timeDesc)
+func (m *MockSessionRepo) ListBySessionWithCursor(ctx context.Context, sessionID uuid.UUID, agentNames []string, afterSeq int64, afterT time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Message, error) {
+	args := m.Called(ctx, sessionID, agentNames, afterSeq, afterT, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]model.Message), args.Error(1)
 }
 
-func (m *MockSessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, spaceID *uuid.UUID, notConnected bool, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
-	args := m.Called(ctx, projectID, userIdentifier, spaceID, notConnected, afterCreatedAt, afterID, limit, timeDesc)
+func (m *MockSessionRepo) ListWithCursor(ctx context.Context, projectID uuid.UUID, userIdentifier string, spaceID *uuid.UUID, notConnected bool, parentSessionID *uuid.UUID, afterCreatedAt time.Time, afterID uuid.UUID, limit int, timeDesc bool) ([]model.Session, error) {
+	args := m.Called(ctx, projectID, userIdentifier, spaceID, notConnected, parentSessionID, afterCreatedAt, afterID, limit, timeDesc)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).([]model.Session), args.Error(1)
 }
 
-func (m *MockSessionRepo) ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID) ([]model.Message, error) {
-	args := m.Called(ctx, sessionID)
+func (m *MockSessionRepo) ListAllMessagesBySession(ctx context.Context, sessionID uuid.UUID, agentNames []string) ([]model.Message, error) {
+	args := m.Called(ctx, sessionID, agentNames)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -85,9 +217,12 @@ func (m *MockSessionRepo) GetObservingStatus(ctx context.Context, sessionID stri
 	return args.Get(0).(*model.MessageObservingStatus), args.Error(1)
 }
 
-func (m *MockSessionRepo) PopGeminiCallIDAndName(ctx context.Context, sessionID uuid.UUID) (string, string, error) {
-	args := m.Called(ctx, sessionID)
-	return args.String(0), args.String(1), args.Error(2)
+func (m *MockSessionRepo) ResolveGeminiCalls(ctx context.Context, sessionID uuid.UUID, responses []repo.GeminiFunctionResponse) ([]string, error) {
+	args := m.Called(ctx, sessionID, responses)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
 }
 
 // MockAssetReferenceRepo is a mock implementation of AssetReferenceRepo
@@ -156,8 +291,273 @@ func (m *MockPublisher) PublishJSON(ctx context.Context, exchange, routingKey st
 	return args.Error(0)
 }
 
+// MockSessionDiskService is a mock implementation of DiskService
+type MockSessionDiskService struct {
+	mock.Mock
+}
+
+func (m *MockSessionDiskService) Create(ctx context.Context, projectID uuid.UUID, userID *uuid.UUID) (*model.Disk, error) {
+	args := m.Called(ctx, projectID, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Disk), args.Error(1)
+}
+
+func (m *MockSessionDiskService) Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID)
+	return args.Error(0)
+}
+
+func (m *MockSessionDiskService) List(ctx context.Context, in ListDisksInput) (*ListDisksOutput, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ListDisksOutput), args.Error(1)
+}
+
+func (m *MockSessionDiskService) CreateSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (*model.DiskSnapshot, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.DiskSnapshot), args.Error(1)
+}
+
+func (m *MockSessionDiskService) ListSnapshots(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskSnapshot, error) {
+	args := m.Called(ctx, projectID, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.DiskSnapshot), args.Error(1)
+}
+
+func (m *MockSessionDiskService) DeleteSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	return args.Error(0)
+}
+
+func (m *MockSessionDiskService) Clone(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID *uuid.UUID) (*model.Disk, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Disk), args.Error(1)
+}
+
+func (m *MockSessionDiskService) RestoreSnapshot(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, snapshotID uuid.UUID, lockID string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, snapshotID, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MockSessionArtifactService is a mock implementation of ArtifactService
+type MockSessionArtifactService struct {
+	mock.Mock
+}
+
+func (m *MockSessionArtifactService) Create(ctx context.Context, in CreateArtifactInput) (*model.Artifact, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) DeleteByPath(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, path string, filename string, cond WriteCondition) error {
+	args := m.Called(ctx, projectID, diskID, path, filename, cond)
+	return args.Error(0)
+}
+
+func (m *MockSessionArtifactService) GetByPath(ctx context.Context, diskID uuid.UUID, path string, filename string) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, path, filename)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GetPresignedURL(ctx context.Context, artifact *model.Artifact, expire time.Duration) (string, error) {
+	args := m.Called(ctx, artifact, expire)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GetFileContent(ctx context.Context, artifact *model.Artifact) (*fileparser.FileContent, error) {
+	args := m.Called(ctx, artifact)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*fileparser.FileContent), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GetFileRange(ctx context.Context, artifact *model.Artifact, offset int64, limit int64) (*FileRange, error) {
+	args := m.Called(ctx, artifact, offset, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*FileRange), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) UpdateArtifactMetaByPath(ctx context.Context, diskID uuid.UUID, path string, filename string, userMeta map[string]interface{}, cond WriteCondition) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, path, filename, userMeta, cond)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) ListByPath(ctx context.Context, diskID uuid.UUID, path string) ([]*model.Artifact, error) {
+	args := m.Called(ctx, diskID, path)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GetAllPaths(ctx context.Context, diskID uuid.UUID) ([]string, error) {
+	args := m.Called(ctx, diskID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GrepArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) CreateUpload(ctx context.Context, in CreateUploadInput) (*UploadPlan, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*UploadPlan), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) FinalizeUpload(ctx context.Context, in FinalizeUploadInput) (*model.Artifact, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) PruneExpiredUploads(ctx context.Context, before time.Time) (int, error) {
+	args := m.Called(ctx, before)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) EditText(ctx context.Context, in EditTextInput) (*model.Artifact, error) {
+	args := m.Called(ctx, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) AcquireLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string, ttl time.Duration) (*ArtifactLock, error) {
+	args := m.Called(ctx, diskID, path, filename, lockID, ttl)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ArtifactLock), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) ReleaseLock(ctx context.Context, diskID uuid.UUID, path string, filename string, lockID string) error {
+	args := m.Called(ctx, diskID, path, filename, lockID)
+	return args.Error(0)
+}
+
+func (m *MockSessionArtifactService) GrepLines(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, in GrepInput) ([]*GrepFileResult, error) {
+	args := m.Called(ctx, projectID, diskID, in)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*GrepFileResult), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GlobArtifacts(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, pattern string, limit int) ([]*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, pattern, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) ListVersions(ctx context.Context, artifact *model.Artifact) ([]*model.ArtifactVersion, error) {
+	args := m.Called(ctx, artifact)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.ArtifactVersion), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) GetVersion(ctx context.Context, artifact *model.Artifact, version int) (*model.Artifact, error) {
+	args := m.Called(ctx, artifact, version)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) DiffVersions(ctx context.Context, artifact *model.Artifact, from int, to int) (string, error) {
+	args := m.Called(ctx, artifact, from, to)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) RestoreVersion(ctx context.Context, projectID uuid.UUID, artifact *model.Artifact, version int, cond WriteCondition) (*model.Artifact, error) {
+	args := m.Called(ctx, projectID, artifact, version, cond)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) MoveArtifact(ctx context.Context, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, cond WriteCondition) (*model.Artifact, error) {
+	args := m.Called(ctx, diskID, srcPath, srcFilename, dstPath, dstFilename, cond)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) MoveDirectory(ctx context.Context, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	args := m.Called(ctx, diskID, srcDir, dstDir, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) CopyArtifact(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcPath string, srcFilename string, dstPath string, dstFilename string, lockID string) (*model.Artifact, error) {
+	args := m.Called(ctx, projectID, diskID, srcPath, srcFilename, dstPath, dstFilename, lockID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Artifact), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) CopyDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, srcDir string, dstDir string, lockID string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, srcDir, dstDir, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) RemoveDirectory(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, dir string, recursive bool, lockID string) (int64, error) {
+	args := m.Called(ctx, projectID, diskID, dir, recursive, lockID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSessionArtifactService) MakeDirectory(ctx context.Context, diskID uuid.UUID, dir string) error {
+	args := m.Called(ctx, diskID, dir)
+	return args.Error(0)
+}
+
 func TestSessionService_Create(t *testing.T) {
 	ctx := context.Background()
+	parentProjectID := uuid.New()
+	parentSessionID := uuid.New()
+	parentMessageID := uuid.New()
 
 	tests := []struct {
 		name    string
@@ -178,21 +578,91 @@ func TestSessionService_Create(t *testing.T) {
 			wantErr: false,
 		},
 		{
-			name: "creation failure",
+			name: "sub-agent session linked to parent message",
 			session: &model.Session{
-				ID:        uuid.New(),
-				ProjectID: uuid.New(),
+				ProjectID:       parentProjectID,
+				ParentSessionID: &parentSessionID,
+				ParentMessageID: &parentMessageID,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("Create", ctx, mock.AnythingOfType("*model.Session")).Return(errors.New("database error"))
+				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool { return s.ID == parentSessionID })).
+					Return(&model.Session{ID: parentSessionID, ProjectID: parentProjectID}, nil)
+				repo.On("GetMessage", ctx, parentSessionID, parentMessageID).Return(&model.Message{ID: parentMessageID, SessionID: parentSessionID}, nil)
+				repo.On("Create", ctx, mock.AnythingOfType("*model.Session")).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "parent session in another project",
+			session: &model.Session{
+				ProjectID:       uuid.New(),
+				ParentSessionID: &parentSessionID,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool { return s.ID == parentSessionID })).
+					Return(&model.Session{ID: parentSessionID, ProjectID: parentProjectID}, nil)
 			},
 			wantErr: true,
+			errMsg:  "parent session not found",
 		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			repo := &MockSessionRepo{}
+		{
+			name: "parent message not in parent session",
+			session: &model.Session{
+				ProjectID:       parentProjectID,
+				ParentSessionID: &parentSessionID,
+				ParentMessageID: &parentMessageID,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool { return s.ID == parentSessionID })).
+					Return(&model.Session{ID: parentSessionID, ProjectID: parentProjectID}, nil)
+				repo.On("GetMessage", ctx, parentSessionID, parentMessageID).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: true,
+			errMsg:  "parent message not found",
+		},
+		{
+			name: "unknown parent tool call",
+			session: &model.Session{
+				ProjectID:        parentProjectID,
+				ParentSessionID:  &parentSessionID,
+				ParentMessageID:  &parentMessageID,
+				ParentToolCallID: "call_missing",
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool { return s.ID == parentSessionID })).
+					Return(&model.Session{ID: parentSessionID, ProjectID: parentProjectID}, nil)
+				repo.On("GetMessage", ctx, parentSessionID, parentMessageID).Return(&model.Message{ID: parentMessageID, SessionID: parentSessionID}, nil)
+			},
+			wantErr: true,
+			errMsg:  "tool call call_missing not found",
+		},
+		{
+			name: "parent tool call without parent message",
+			session: &model.Session{
+				ProjectID:        parentProjectID,
+				ParentSessionID:  &parentSessionID,
+				ParentToolCallID: "call_1",
+			},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: true,
+			errMsg:  "requires parent_message_id",
+		},
+		{
+			name: "creation failure",
+			session: &model.Session{
+				ID:        uuid.New(),
+				ProjectID: uuid.New(),
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("Create", ctx, mock.AnythingOfType("*model.Session")).Return(errors.New("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
 			tt.setup(repo)
 
 			logger := zap.NewNop()
@@ -207,12 +677,15 @@ func TestSessionService_Create(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			err := service.Create(ctx, tt.session)
 
 			if tt.wantErr {
 				assert.Error(t, err)
+				if tt.session.ParentSessionID != nil && tt.errMsg != "" {
+					assert.ErrorIs(t, err, ErrInvalidParent)
+				}
 				if tt.errMsg != "" {
 					assert.Contains(t, err.Error(), tt.errMsg)
 				}
@@ -229,12 +702,13 @@ func TestSessionService_Delete(t *testing.T) {
 	ctx := context.Background()
 	projectID := uuid.New()
 	sessionID := uuid.New()
+	diskID := uuid.New()
 
 	tests := []struct {
 		name      string
 		projectID uuid.UUID
 		sessionID uuid.UUID
-		setup     func(*MockSessionRepo)
+		setup     func(*MockSessionRepo, *MockSessionDiskService)
 		wantErr   bool
 		errMsg    string
 	}{
@@ -242,7 +716,8 @@ func TestSessionService_Delete(t *testing.T) {
 			name:      "successful session deletion",
 			projectID: projectID,
 			sessionID: sessionID,
-			setup: func(repo *MockSessionRepo) {
+			setup: func(repo *MockSessionRepo, d *MockSessionDiskService) {
+				repo.On("Get", ctx, &model.Session{ID: sessionID}).Return(&model.Session{ID: sessionID}, nil)
 				repo.On("Delete", ctx, projectID, sessionID).Return(nil)
 			},
 			wantErr: false,
@@ -251,27 +726,62 @@ func TestSessionService_Delete(t *testing.T) {
 			name:      "empty session ID",
 			projectID: projectID,
 			sessionID: uuid.UUID{},
-			setup: func(repo *MockSessionRepo) {
+			setup: func(repo *MockSessionRepo, d *MockSessionDiskService) {
 				// Empty UUID will call Delete, because len(uuid.UUID{}) != 0
+				repo.On("Get", ctx, mock.AnythingOfType("*model.Session")).Return(&model.Session{}, nil)
 				repo.On("Delete", ctx, projectID, mock.AnythingOfType("uuid.UUID")).Return(nil)
 			},
 			wantErr: false, // Actually won't error
 		},
+		{
+			name:      "session not found",
+			projectID: projectID,
+			sessionID: sessionID,
+			setup: func(repo *MockSessionRepo, d *MockSessionDiskService) {
+				repo.On("Get", ctx, &model.Session{ID: sessionID}).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: true,
+			errMsg:  "record not found",
+		},
 		{
 			name:      "deletion failed",
 			projectID: projectID,
 			sessionID: sessionID,
-			setup: func(repo *MockSessionRepo) {
+			setup: func(repo *MockSessionRepo, d *MockSessionDiskService) {
+				repo.On("Get", ctx, &model.Session{ID: sessionID}).Return(&model.Session{ID: sessionID, DiskID: &diskID}, nil)
 				repo.On("Delete", ctx, projectID, sessionID).Return(errors.New("deletion failed"))
 			},
 			wantErr: true,
 		},
+		{
+			name:      "session disk is deleted with the session",
+			projectID: projectID,
+			sessionID: sessionID,
+			setup: func(repo *MockSessionRepo, d *MockSessionDiskService) {
+				repo.On("Get", ctx, &model.Session{ID: sessionID}).Return(&model.Session{ID: sessionID, DiskID: &diskID}, nil)
+				repo.On("Delete", ctx, projectID, sessionID).Return(nil)
+				d.On("Delete", ctx, projectID, diskID).Return(nil)
+			},
+			wantErr: false,
+		},
+		{
+			name:      "session disk already gone",
+			projectID: projectID,
+			sessionID: sessionID,
+			setup: func(repo *MockSessionRepo, d *MockSessionDiskService) {
+				repo.On("Get", ctx, &model.Session{ID: sessionID}).Return(&model.Session{ID: sessionID, DiskID: &diskID}, nil)
+				repo.On("Delete", ctx, projectID, sessionID).Return(nil)
+				d.On("Delete", ctx, projectID, diskID).Return(gorm.ErrRecordNotFound)
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			repo := &MockSessionRepo{}
-			tt.setup(repo)
+			diskSvc := &MockSessionDiskService{}
+			tt.setup(repo, diskSvc)
 
 			logger := zap.NewNop()
 			mockAssetRefRepo := &MockAssetReferenceRepo{}
@@ -285,7 +795,7 @@ func TestSessionService_Delete(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, diskSvc, nil)
 
 			err := service.Delete(ctx, tt.projectID, tt.sessionID)
 
@@ -299,6 +809,7 @@ func TestSessionService_Delete(t *testing.T) {
 			}
 
 			repo.AssertExpectations(t)
+			diskSvc.AssertExpectations(t)
 		})
 	}
 }
@@ -370,7 +881,7 @@ func TestSessionService_GetByID(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.GetByID(ctx, tt.session)
 
@@ -442,7 +953,7 @@ func TestSessionService_UpdateByID(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			err := service.UpdateByID(ctx, tt.session)
 
@@ -491,7 +1002,7 @@ func TestSessionService_List(t *testing.T) {
 						ProjectID: projectID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, (*uuid.UUID)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -511,7 +1022,19 @@ func TestSessionService_List(t *testing.T) {
 						SpaceID:   &spaceID,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, "", &spaceID, false, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				repo.On("ListWithCursor", ctx, projectID, "", &spaceID, false, (*uuid.UUID)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "successful sessions retrieval - filter by parent session",
+			input: ListSessionsInput{
+				ProjectID:       projectID,
+				ParentSessionID: &spaceID,
+				Limit:           10,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, &spaceID, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{{ID: uuid.New(), ProjectID: projectID, ParentSessionID: &spaceID}}, nil)
 			},
 			wantErr: false,
 		},
@@ -531,7 +1054,7 @@ func TestSessionService_List(t *testing.T) {
 						SpaceID:   nil,
 					},
 				}
-				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), true, time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
+				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), true, (*uuid.UUID)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(expectedSessions, nil)
 			},
 			wantErr: false,
 		},
@@ -544,7 +1067,7 @@ func TestSessionService_List(t *testing.T) {
 				Limit:        10,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
+				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, (*uuid.UUID)(nil), time.Time{}, uuid.UUID{}, 11, false).Return([]model.Session{}, nil)
 			},
 			wantErr: false,
 		},
@@ -557,7 +1080,7 @@ func TestSessionService_List(t *testing.T) {
 				Limit:        10,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
+				repo.On("ListWithCursor", ctx, projectID, "", (*uuid.UUID)(nil), false, (*uuid.UUID)(nil), time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("database error"))
 			},
 			wantErr: true,
 		},
@@ -580,7 +1103,7 @@ func TestSessionService_List(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.List(ctx, tt.input)
 
@@ -600,6 +1123,217 @@ func TestSessionService_List(t *testing.T) {
 	}
 }
 
+func TestSessionService_GetTree(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	rootID := uuid.New()
+	childA := model.Session{ID: uuid.New(), ProjectID: projectID, ParentSessionID: &rootID}
+	childB := model.Session{ID: uuid.New(), ProjectID: projectID, ParentSessionID: &rootID}
+	grandchild := model.Session{ID: uuid.New(), ProjectID: projectID, ParentSessionID: &childA.ID}
+
+	newRepo := func() *MockSessionRepo {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool { return s.ID == rootID })).
+			Return(&model.Session{ID: rootID, ProjectID: projectID}, nil)
+		repo.On("ListChildren", ctx, projectID, []uuid.UUID{rootID}).Return([]model.Session{childA, childB}, nil)
+		return repo
+	}
+
+	t.Run("full tree", func(t *testing.T) {
+		repo := newRepo()
+		repo.On("ListChildren", ctx, projectID, []uuid.UUID{childA.ID, childB.ID}).Return([]model.Session{grandchild}, nil)
+		repo.On("ListChildren", ctx, projectID, []uuid.UUID{grandchild.ID}).Return([]model.Session{}, nil)
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		tree, err := service.GetTree(ctx, projectID, rootID, 5)
+
+		require.NoError(t, err)
+		assert.Equal(t, rootID, tree.Session.ID)
+		require.Len(t, tree.Children, 2)
+		assert.Equal(t, childA.ID, tree.Children[0].Session.ID)
+		require.Len(t, tree.Children[0].Children, 1)
+		assert.Equal(t, grandchild.ID, tree.Children[0].Children[0].Session.ID)
+		assert.Empty(t, tree.Children[1].Children)
+		assert.False(t, tree.Children[0].Truncated)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("truncated at max depth", func(t *testing.T) {
+		repo := newRepo()
+		repo.On("ListChildren", ctx, projectID, []uuid.UUID{childA.ID, childB.ID}).Return([]model.Session{grandchild}, nil)
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		tree, err := service.GetTree(ctx, projectID, rootID, 1)
+
+		require.NoError(t, err)
+		require.Len(t, tree.Children, 2)
+		assert.Empty(t, tree.Children[0].Children)
+		assert.True(t, tree.Children[0].Truncated)
+		assert.False(t, tree.Children[1].Truncated)
+		repo.AssertExpectations(t)
+	})
+
+	t.Run("session in another project", func(t *testing.T) {
+		repo := &MockSessionRepo{}
+		repo.On("Get", ctx, mock.Anything).Return(&model.Session{ID: rootID, ProjectID: uuid.New()}, nil)
+		service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+		tree, err := service.GetTree(ctx, projectID, rootID, 5)
+
+		assert.EqualError(t, err, "session not found")
+		assert.Nil(t, tree)
+	})
+}
+
+func TestSessionService_SetTools(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	weather := model.ToolDefinition{
+		Name:       "get_weather",
+		Parameters: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+	}
+
+	tests := []struct {
+		name    string
+		tools   []model.ToolDefinition
+		setup   func(*MockSessionRepo)
+		version int
+		errMsg  string
+	}{
+		{
+			name:  "stores a new version",
+			tools: []model.ToolDefinition{weather},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("CreateTools", ctx, mock.MatchedBy(func(ts *model.SessionTools) bool {
+					return ts.SessionID == sessionID && ts.SourceFormat == model.FormatOpenAI && len(ts.Tools.Data()) == 1
+				})).Run(func(args mock.Arguments) {
+					args.Get(1).(*model.SessionTools).Version = 3
+				}).Return(nil)
+			},
+			version: 3,
+		},
+		{
+			name:   "missing name",
+			tools:  []model.ToolDefinition{{Description: "nameless"}},
+			setup:  func(repo *MockSessionRepo) {},
+			errMsg: "tools[0]: name is required",
+		},
+		{
+			name:   "duplicate name",
+			tools:  []model.ToolDefinition{weather, weather},
+			setup:  func(repo *MockSessionRepo) {},
+			errMsg: `tools[1]: duplicate tool name "get_weather"`,
+		},
+		{
+			name:  "session not found",
+			tools: []model.ToolDefinition{weather},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("CreateTools", ctx, mock.Anything).Return(gorm.ErrRecordNotFound)
+			},
+			errMsg: "session not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionRepo := &MockSessionRepo{}
+			tt.setup(sessionRepo)
+			service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			tools, err := service.SetTools(ctx, SetToolsInput{
+				SessionID:    sessionID,
+				SourceFormat: model.FormatOpenAI,
+				Tools:        tt.tools,
+			})
+
+			if tt.errMsg != "" {
+				assert.EqualError(t, err, tt.errMsg)
+				assert.Nil(t, tools)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.version, tools.Version)
+			}
+			sessionRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_GetTools(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("GetTools", ctx, sessionID, 0).Return(&model.SessionTools{SessionID: sessionID, Version: 2}, nil)
+	sessionRepo.On("GetTools", ctx, sessionID, 7).Return(nil, gorm.ErrRecordNotFound)
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	tools, err := service.GetTools(ctx, sessionID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, tools.Version)
+
+	_, err = service.GetTools(ctx, sessionID, 7)
+	assert.ErrorIs(t, err, ErrToolsNotFound)
+	assert.EqualError(t, err, "tools not found: version 7")
+}
+
+func TestSessionService_GetSystemPrompt(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	tests := []struct {
+		name    string
+		session *model.Session
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "session overrides space and project",
+			session: &model.Session{
+				Configs: datatypes.JSONMap{"system_prompt": "You are a session agent."},
+				Space:   &model.Space{Configs: datatypes.JSONMap{"system_prompt": "You are a space agent."}},
+				Project: &model.Project{Configs: datatypes.JSONMap{"system_prompt": "You are a project agent."}},
+			},
+			want: "You are a session agent.",
+		},
+		{
+			name: "falls back to project",
+			session: &model.Session{
+				Project: &model.Project{Configs: datatypes.JSONMap{"system_prompt": "You are a project agent."}},
+			},
+			want: "You are a project agent.",
+		},
+		{
+			name:    "no system prompt",
+			session: &model.Session{},
+			want:    "",
+		},
+		{
+			name: "not a string",
+			session: &model.Session{
+				Configs: datatypes.JSONMap{"system_prompt": []interface{}{"a"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionRepo := &MockSessionRepo{}
+			sessionRepo.On("GetWithSpaceAndProject", ctx, sessionID).Return(tt.session, nil)
+			service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			prompt, err := service.GetSystemPrompt(ctx, sessionID)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, prompt)
+			}
+		})
+	}
+}
+
 func TestPartIn_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -755,22 +1489,21 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// Mock PopGeminiCallIDAndName to return matching name
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "get_weather", nil)
-				repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(nil)
-				repo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather"}}).Return([]string{"call_abc123"}, nil)
+				sessionRepo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message"), mock.Anything).Return(nil)
+				sessionRepo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
 				assetRepo.On("IncrementAssetRef", ctx, projectID, mock.AnythingOfType("model.Asset")).Return(nil).Once() // parts asset
 			},
 			wantErr: false,
-			verify: func(t *testing.T, msg *model.Message, repo *MockSessionRepo) {
+			verify: func(t *testing.T, msg *model.Message, sessionRepo *MockSessionRepo) {
 				assert.NotNil(t, msg)
 				// Verify that tool_call_id was set
 				// Note: parts are stored in S3, so we can't easily verify here
@@ -778,7 +1511,7 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 			},
 		},
 		{
-			name: "tool-result without ID - name mismatch error",
+			name: "tool-result without ID - no pending call with that name",
 			input: StoreMessageInput{
 				ProjectID:   projectID,
 				SessionID:   sessionID,
@@ -787,19 +1520,19 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// Mock PopGeminiCallIDAndName to return different name
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "calculate", nil)
+				// Only calls with other names are pending
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather"}}).Return(nil, fmt.Errorf("%w: no pending call named 'get_weather'", repo.ErrGeminiCallNotFound))
 			},
 			wantErr: true,
-			errMsg:  "function name mismatch",
+			errMsg:  "no pending call named",
 		},
 		{
 			name: "tool-result with ID - name and ID match",
@@ -811,24 +1544,23 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// Mock PopGeminiCallIDAndName to return matching name and ID
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "get_weather", nil)
-				repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(nil)
-				repo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather", ID: "call_abc123"}}).Return([]string{"call_abc123"}, nil)
+				sessionRepo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message"), mock.Anything).Return(nil)
+				sessionRepo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
 				assetRepo.On("IncrementAssetRef", ctx, projectID, mock.AnythingOfType("model.Asset")).Return(nil).Once()
 			},
 			wantErr: false,
 		},
 		{
-			name: "tool-result with ID - name matches but ID mismatch",
+			name: "tool-result with ID - no pending call with that ID",
 			input: StoreMessageInput{
 				ProjectID:   projectID,
 				SessionID:   sessionID,
@@ -837,19 +1569,19 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// Mock PopGeminiCallIDAndName to return matching name but different ID
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "get_weather", nil)
+				// No pending call has the response ID
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather", ID: "call_wrong"}}).Return(nil, fmt.Errorf("%w: no pending call with id 'call_wrong'", repo.ErrGeminiCallNotFound))
 			},
 			wantErr: true,
-			errMsg:  "function ID mismatch",
+			errMsg:  "no pending call with id",
 		},
 		{
 			name: "tool-result with ID - ID matches but name mismatch",
@@ -861,16 +1593,16 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// Mock PopGeminiCallIDAndName to return matching ID but different name
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "calculate", nil)
+				// The call with the response ID has another name
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather", ID: "call_abc123"}}).Return(nil, fmt.Errorf("function name mismatch: response name 'get_weather' does not match call name 'calculate' of call 'call_abc123'"))
 			},
 			wantErr: true,
 			errMsg:  "function name mismatch",
@@ -885,9 +1617,9 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
@@ -907,9 +1639,9 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
@@ -929,22 +1661,22 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// Mock PopGeminiCallIDAndName to return error (no available calls)
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("", "", fmt.Errorf("no available Gemini call info in session"))
+				// No pending calls at all
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, mock.Anything).Return(nil, fmt.Errorf("%w: no pending call named 'get_weather'", repo.ErrGeminiCallNotFound))
 			},
 			wantErr: true,
 			errMsg:  "failed to resolve FunctionResponse",
 		},
 		{
-			name: "multiple tool-results - sequential matching",
+			name: "multiple tool-results - batched matching",
 			input: StoreMessageInput{
 				ProjectID: projectID,
 				SessionID: sessionID,
@@ -956,52 +1688,48 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// First call
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "get_weather", nil).Once()
-				// Second call
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_def456", "calculate", nil).Once()
-				repo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message")).Return(nil)
-				repo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
+				// Both responses are resolved at once
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather"}, {Name: "calculate"}}).Return([]string{"call_abc123", "call_def456"}, nil).Once()
+				sessionRepo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message"), mock.Anything).Return(nil)
+				sessionRepo.On("GetDisableTaskTracking", ctx, sessionID).Return(false, nil)
 				assetRepo.On("IncrementAssetRef", ctx, projectID, mock.AnythingOfType("model.Asset")).Return(nil).Once()
 			},
 			wantErr: false,
 		},
 		{
-			name: "multiple tool-results - second name mismatch",
+			name: "multiple tool-results - same-named calls ambiguous",
 			input: StoreMessageInput{
 				ProjectID: projectID,
 				SessionID: sessionID,
 				Role:      "user",
 				Parts: []PartIn{
 					{Type: "tool-result", Meta: map[string]interface{}{"name": "get_weather"}},
-					{Type: "tool-result", Meta: map[string]interface{}{"name": "calculate"}},
+					{Type: "tool-result", Meta: map[string]interface{}{"name": "get_weather"}},
 				},
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				// First call succeeds
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "get_weather", nil).Once()
-				// Second call has name mismatch
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_def456", "wrong_name", nil).Once()
+				// Three get_weather calls are pending for two responses without ids
+				sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, mock.Anything).Return(nil, fmt.Errorf("%w: 3 pending calls named 'get_weather' for 2 responses; set the FunctionResponse id", repo.ErrGeminiCallAmbiguous))
 			},
 			wantErr: true,
-			errMsg:  "function name mismatch",
+			errMsg:  "set the FunctionResponse id",
 		},
 		{
 			name: "tool-result with non-string name",
@@ -1013,9 +1741,9 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
@@ -1035,15 +1763,14 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				Format:      model.FormatGemini,
 				MessageMeta: map[string]interface{}{"source_format": "gemini"},
 			},
-			setup: func(repo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
+			setup: func(sessionRepo *MockSessionRepo, assetRepo *MockAssetReferenceRepo) {
 				// Mock Get to return valid session
-				repo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+				sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
 					return s.ID == sessionID
 				})).Return(&model.Session{
 					ID:        sessionID,
 					ProjectID: projectID,
 				}, nil)
-				repo.On("PopGeminiCallIDAndName", ctx, sessionID).Return("call_abc123", "get_weather", nil)
 			},
 			wantErr: true,
 			errMsg:  "invalid tool_call_id",
@@ -1052,9 +1779,9 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			repo := &MockSessionRepo{}
+			sessionRepo := &MockSessionRepo{}
 			mockAssetRefRepo := &MockAssetReferenceRepo{}
-			tt.setup(repo, mockAssetRefRepo)
+			tt.setup(sessionRepo, mockAssetRefRepo)
 
 			logger := zap.NewNop()
 			cfg := &config.Config{
@@ -1080,7 +1807,7 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 			var service SessionService
 			if tt.wantErr {
 				// For error cases, we can use nil S3 since errors happen before S3 upload
-				service = NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+				service = NewSessionService(sessionRepo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 			} else {
 				// For success cases, we need to skip this test or use integration test
 				// For now, we'll mark these as skipped or use a workaround
@@ -1100,11 +1827,11 @@ func TestSessionService_StoreMessage_GeminiFunctionResponse(t *testing.T) {
 				assert.NoError(t, err)
 				assert.NotNil(t, result)
 				if tt.verify != nil {
-					tt.verify(t, result, repo)
+					tt.verify(t, result, sessionRepo)
 				}
 			}
 
-			repo.AssertExpectations(t)
+			sessionRepo.AssertExpectations(t)
 			mockAssetRefRepo.AssertExpectations(t)
 		})
 	}
@@ -1129,7 +1856,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				TimeDesc:  false,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("query failure"))
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(nil, errors.New("query failure"))
 			},
 			wantErr: true,
 		},
@@ -1144,7 +1871,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1159,7 +1886,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1189,7 +1916,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 					{ID: uuid.New(), SessionID: sessionID, Role: "assistant"},
 				}
-				repo.On("ListAllMessagesBySession", ctx, sessionID).Return(msgs, nil)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1204,7 +1931,33 @@ func TestSessionService_GetMessages(t *testing.T) {
 				msgs := []model.Message{
 					{ID: uuid.New(), SessionID: sessionID, Role: "user"},
 				}
-				repo.On("ListAllMessagesBySession", ctx, sessionID).Return(msgs, nil)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return(msgs, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "filter by agent names",
+			input: GetMessagesInput{
+				SessionID:  sessionID,
+				Limit:      10,
+				AgentNames: []string{"pro", "con"},
+			},
+			setup: func(repo *MockSessionRepo) {
+				msgs := []model.Message{
+					{ID: uuid.New(), SessionID: sessionID, Role: "assistant", AgentName: "pro"},
+				}
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string{"pro", "con"}, int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "filter all messages by agent name",
+			input: GetMessagesInput{
+				SessionID:  sessionID,
+				AgentNames: []string{"pro"},
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string{"pro"}).Return([]model.Message{}, nil)
 			},
 			wantErr: false,
 		},
@@ -1216,10 +1969,75 @@ func TestSessionService_GetMessages(t *testing.T) {
 				TimeDesc:  false,
 			},
 			setup: func(repo *MockSessionRepo) {
-				repo.On("ListAllMessagesBySession", ctx, sessionID).Return(nil, errors.New("database error"))
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return(nil, errors.New("database error"))
 			},
 			wantErr: true,
 		},
+		{
+			name: "default edit strategies resolved from space configs",
+			input: GetMessagesInput{
+				SessionID:                sessionID,
+				UseDefaultEditStrategies: true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetWithSpaceAndProject", ctx, sessionID).Return(&model.Session{
+					ID: sessionID,
+					Space: &model.Space{Configs: datatypes.JSONMap{
+						"edit_strategies": []interface{}{
+							map[string]interface{}{"type": "remove_tool_result"},
+						},
+					}},
+					Project: &model.Project{Configs: datatypes.JSONMap{
+						"edit_strategies": "not-a-list",
+					}},
+				}, nil)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return([]model.Message{}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid project edit strategies are ignored",
+			input: GetMessagesInput{
+				SessionID:                sessionID,
+				UseDefaultEditStrategies: true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetWithSpaceAndProject", ctx, sessionID).Return(&model.Session{
+					ID: sessionID,
+					Project: &model.Project{Configs: datatypes.JSONMap{
+						"edit_strategies": []interface{}{
+							map[string]interface{}{"type": "unknown_strategy"},
+						},
+					}},
+				}, nil)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return([]model.Message{}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown session without default edit strategies",
+			input: GetMessagesInput{
+				SessionID:                sessionID,
+				UseDefaultEditStrategies: true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetWithSpaceAndProject", ctx, sessionID).Return(nil, gorm.ErrRecordNotFound)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return([]model.Message{}, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "explicit edit strategies skip defaults",
+			input: GetMessagesInput{
+				SessionID:                sessionID,
+				EditStrategies:           []editor.StrategyConfig{},
+				UseDefaultEditStrategies: true,
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return([]model.Message{}, nil)
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1240,7 +2058,7 @@ func TestSessionService_GetMessages(t *testing.T) {
 				},
 			}
 			// Note: blob is nil in test, so GetMessages will skip DownloadJSON and PresignGet
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.GetMessages(ctx, tt.input)
 
@@ -1303,7 +2121,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
 					{ID: msg3ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-1 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1327,7 +2145,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, true).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1351,7 +2169,26 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now},
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+			},
+			wantErr: false,
+		},
+		{
+			name: "seq wins over created_at under clock skew",
+			input: GetMessagesInput{
+				SessionID: sessionID,
+				Limit:     10,
+				TimeDesc:  false,
+			},
+			// The tool-result (seq 2) was stamped earlier than its tool-call (seq 1)
+			// by a replica with a lagging clock
+			expectedOrder: []uuid.UUID{msg3ID, msg1ID},
+			setup: func(repo *MockSessionRepo) {
+				msgs := []model.Message{
+					{ID: msg1ID, SessionID: sessionID, Role: "user", Seq: 2, CreatedAt: now.Add(-time.Second)},
+					{ID: msg3ID, SessionID: sessionID, Role: "assistant", Seq: 1, CreatedAt: now},
+				}
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1377,7 +2214,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
 					{ID: msg3ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-1 * time.Hour)},
 				}
-				repo.On("ListBySessionWithCursor", ctx, sessionID, time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 11, false).Return(msgs, nil)
 			},
 			wantErr: false,
 		},
@@ -1400,7 +2237,7 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 					},
 				},
 			}
-			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil)
+			service := NewSessionService(repo, mockAssetRefRepo, logger, nil, nil, cfg, nil, nil, nil)
 
 			result, err := service.GetMessages(ctx, tt.input)
 
@@ -1420,13 +2257,11 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 						"Message at position %d should be %s but got %s", i, expectedID, result.Items[i].ID)
 				}
 
-				// Additionally verify that messages are in ascending time order
+				// Additionally verify that messages are in ascending (seq, created_at, id) order
 				for i := 1; i < len(result.Items); i++ {
-					prevTime := result.Items[i-1].CreatedAt
-					currTime := result.Items[i].CreatedAt
-					assert.True(t, prevTime.Before(currTime) || prevTime.Equal(currTime),
-						"Messages should be sorted from old to new: message[%d] (%v) should be before or equal to message[%d] (%v)",
-						i-1, prevTime, i, currTime)
+					assert.True(t, result.Items[i-1].Before(result.Items[i]),
+						"Messages should be sorted from old to new: message[%d] (seq %d) should be before message[%d] (seq %d)",
+						i-1, result.Items[i-1].Seq, i, result.Items[i].Seq)
 				}
 			}
 
@@ -1434,3 +2269,942 @@ func TestSessionService_GetMessages_SortOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionService_StoreMessage_ExpectedLastSeq(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	stale := int64(3)
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+		return s.ID == sessionID
+	})).Return(&model.Session{ID: sessionID, ProjectID: projectID, LastMessageSeq: 4}, nil)
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	// Rejected before any upload or insert
+	msg, err := service.StoreMessage(ctx, StoreMessageInput{
+		ProjectID:       projectID,
+		SessionID:       sessionID,
+		Role:            "user",
+		Parts:           []PartIn{{Type: "text", Text: "hello"}},
+		Format:          model.FormatLuminox,
+		ExpectedLastSeq: &stale,
+	})
+
+	assert.Nil(t, msg)
+	assert.ErrorIs(t, err, ErrAppendConflict)
+	assert.ErrorIs(t, err, repo.ErrAppendConflict)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_StoreMessage_ExpectedLastMessageID(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	stale := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+		return s.ID == sessionID
+	})).Return(&model.Session{ID: sessionID, ProjectID: projectID, LastMessageSeq: 4}, nil)
+	sessionRepo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.Nil, 1, true).
+		Return([]model.Message{{ID: uuid.New(), SessionID: sessionID, Seq: 4}}, nil)
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	// Rejected before the Gemini calls are resolved or anything is uploaded
+	msg, err := service.StoreMessage(ctx, StoreMessageInput{
+		ProjectID:             projectID,
+		SessionID:             sessionID,
+		Role:                  "user",
+		Parts:                 []PartIn{{Type: "tool-result", Meta: map[string]interface{}{"name": "get_weather"}}},
+		Format:                model.FormatGemini,
+		ExpectedLastMessageID: &stale,
+	})
+
+	assert.Nil(t, msg)
+	assert.ErrorIs(t, err, ErrAppendConflict)
+	sessionRepo.AssertExpectations(t)
+}
+
+// newFakeS3 returns S3 deps backed by an in-memory server that stores uploaded
+// objects and serves them back; listing is not supported
+func newFakeS3(t *testing.T) *blob.S3Deps {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+			w.Header().Set("ETag", `"fake-etag"`)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+	})
+	return &blob.S3Deps{Client: client, Uploader: manager.NewUploader(client), Bucket: "test-bucket"}
+}
+
+func TestSessionService_StoreMessage_DiscardsOnConflict(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	expected := int64(4)
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+		return s.ID == sessionID
+	})).Return(&model.Session{ID: sessionID, ProjectID: projectID, LastMessageSeq: 4}, nil)
+	sessionRepo.On("GetWithSpaceAndProject", ctx, sessionID).Return(&model.Session{ID: sessionID}, nil)
+	sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{{Name: "get_weather"}}).Return([]string{"call_1"}, nil)
+	// Another writer appended between the early check and the insert
+	sessionRepo.On("CreateMessageWithAssets", ctx, mock.AnythingOfType("*model.Message"), mock.MatchedBy(func(cond repo.AppendPrecondition) bool {
+		return *cond.LastSeq == expected && assert.ObjectsAreEqual([]string{"call_1"}, cond.GeminiCallIDs)
+	})).Return(fmt.Errorf("%w: last message is %s (seq 5)", repo.ErrAppendConflict, uuid.New()))
+
+	var parts model.Asset
+	assetRepo := &MockAssetReferenceRepo{}
+	assetRepo.On("IncrementAssetRef", ctx, projectID, mock.AnythingOfType("model.Asset")).
+		Run(func(args mock.Arguments) { parts = args.Get(2).(model.Asset) }).Return(nil).Once()
+	assetRepo.On("DecrementAssetRef", mock.Anything, projectID, mock.MatchedBy(func(a model.Asset) bool {
+		return a.SHA256 != "" && a == parts
+	})).Return(nil).Once()
+
+	service := NewSessionService(sessionRepo, assetRepo, zap.NewNop(), newFakeS3(t), nil, &config.Config{}, nil, nil, nil)
+
+	msg, err := service.StoreMessage(ctx, StoreMessageInput{
+		ProjectID:       projectID,
+		SessionID:       sessionID,
+		Role:            "user",
+		Parts:           []PartIn{{Type: "tool-result", Meta: map[string]interface{}{"name": "get_weather"}}},
+		Format:          model.FormatGemini,
+		ExpectedLastSeq: &expected,
+	})
+
+	assert.Nil(t, msg)
+	assert.ErrorIs(t, err, ErrAppendConflict)
+	sessionRepo.AssertExpectations(t)
+	assetRepo.AssertExpectations(t)
+}
+
+func TestSessionService_GetMessages_SeqCursor(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now().UTC()
+
+	msgs := []model.Message{
+		{ID: uuid.New(), SessionID: sessionID, Role: "user", Seq: 1, CreatedAt: now},
+		{ID: uuid.New(), SessionID: sessionID, Role: "assistant", Seq: 2, CreatedAt: now.Add(-time.Second)},
+		{ID: uuid.New(), SessionID: sessionID, Role: "user", Seq: 3, CreatedAt: now},
+	}
+
+	repo := &MockSessionRepo{}
+	repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 3, false).Return(append([]model.Message(nil), msgs...), nil)
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	first, err := service.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, Limit: 2})
+	require.NoError(t, err)
+	require.True(t, first.HasMore)
+	assert.Equal(t, msgs[1].ID, first.Items[1].ID)
+
+	// The next page continues after the last returned seq
+	repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(2), msgs[1].CreatedAt, msgs[1].ID, 3, false).Return([]model.Message{msgs[2]}, nil)
+
+	second, err := service.GetMessages(ctx, GetMessagesInput{SessionID: sessionID, Limit: 2, Cursor: first.NextCursor})
+	require.NoError(t, err)
+	assert.False(t, second.HasMore)
+	require.Len(t, second.Items, 1)
+	assert.Equal(t, msgs[2].ID, second.Items[0].ID)
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_GetMessages_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	msg1ID := uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	msg2ID := uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	msg3ID := uuid.MustParse("00000000-0000-0000-0000-000000000003")
+	msgs := []model.Message{
+		{ID: msg1ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: msg2ID, SessionID: sessionID, Role: "assistant", CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: msg3ID, SessionID: sessionID, Role: "user", CreatedAt: now.Add(-1 * time.Hour)},
+	}
+	checkpoint := &model.Checkpoint{SessionID: sessionID, Name: "plan approved", MessageID: msg2ID}
+
+	tests := []struct {
+		name          string
+		input         GetMessagesInput
+		setup         func(*MockSessionRepo)
+		expectedOrder []uuid.UUID
+		expectedPin   string
+		wantErr       string
+	}{
+		{
+			name:  "until message",
+			input: GetMessagesInput{SessionID: sessionID, UntilMessageID: msg2ID.String()},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetMessage", ctx, sessionID, msg2ID).Return(&msgs[1], nil)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return(append([]model.Message(nil), msgs...), nil)
+			},
+			expectedOrder: []uuid.UUID{msg1ID, msg2ID},
+			expectedPin:   msg2ID.String(),
+		},
+		{
+			name:  "until checkpoint with pagination",
+			input: GetMessagesInput{SessionID: sessionID, Limit: 1, UntilCheckpoint: "plan approved"},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetCheckpoint", ctx, sessionID, "plan approved").Return(checkpoint, nil)
+				repo.On("GetMessage", ctx, sessionID, msg2ID).Return(&msgs[1], nil)
+				repo.On("ListBySessionWithCursor", ctx, sessionID, []string(nil), int64(0), time.Time{}, uuid.UUID{}, 2, false).Return(append([]model.Message(nil), msgs[:2]...), nil)
+			},
+			expectedOrder: []uuid.UUID{msg1ID},
+			expectedPin:   msg1ID.String(),
+		},
+		{
+			name: "pin at checkpoint",
+			input: GetMessagesInput{
+				SessionID:                        sessionID,
+				EditStrategies:                   []editor.StrategyConfig{{Type: "remove_tool_result", Params: map[string]interface{}{}}},
+				PinEditingStrategiesAtCheckpoint: "plan approved",
+			},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetCheckpoint", ctx, sessionID, "plan approved").Return(checkpoint, nil)
+				repo.On("ListAllMessagesBySession", ctx, sessionID, []string(nil)).Return(append([]model.Message(nil), msgs...), nil)
+			},
+			expectedOrder: []uuid.UUID{msg1ID, msg2ID, msg3ID},
+			expectedPin:   msg2ID.String(),
+		},
+		{
+			name:  "unknown checkpoint",
+			input: GetMessagesInput{SessionID: sessionID, UntilCheckpoint: "missing"},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetCheckpoint", ctx, sessionID, "missing").Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: `checkpoint "missing" not found`,
+		},
+		{
+			name:  "until message from another session",
+			input: GetMessagesInput{SessionID: sessionID, UntilMessageID: msg3ID.String()},
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetMessage", ctx, sessionID, msg3ID).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: "until message not found",
+		},
+		{
+			name:    "until message and until checkpoint",
+			input:   GetMessagesInput{SessionID: sessionID, UntilMessageID: msg2ID.String(), UntilCheckpoint: "plan approved"},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: "mutually exclusive",
+		},
+		{
+			name:    "until with time_desc pagination",
+			input:   GetMessagesInput{SessionID: sessionID, Limit: 10, TimeDesc: true, UntilMessageID: msg2ID.String()},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: "time_desc",
+		},
+		{
+			name: "pin at message and checkpoint",
+			input: GetMessagesInput{
+				SessionID:                        sessionID,
+				PinEditingStrategiesAtMessage:    msg1ID.String(),
+				PinEditingStrategiesAtCheckpoint: "plan approved",
+			},
+			setup:   func(repo *MockSessionRepo) {},
+			wantErr: "mutually exclusive",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			result, err := service.GetMessages(ctx, tt.input)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Nil(t, result)
+			} else {
+				assert.NoError(t, err)
+				ids := make([]uuid.UUID, len(result.Items))
+				for i, m := range result.Items {
+					ids[i] = m.ID
+				}
+				assert.Equal(t, tt.expectedOrder, ids)
+				assert.Equal(t, tt.expectedPin, result.EditAtMessageID)
+			}
+
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_SetCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	messageID := uuid.New()
+	in := SetCheckpointInput{SessionID: sessionID, Name: "phase 2 start", MessageID: messageID, Description: "Begin rollout"}
+
+	tests := []struct {
+		name    string
+		setup   func(*MockSessionRepo)
+		wantErr string
+	}{
+		{
+			name: "creates or moves checkpoint",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetMessage", ctx, sessionID, messageID).Return(&model.Message{ID: messageID, SessionID: sessionID}, nil)
+				repo.On("UpsertCheckpoint", ctx, mock.MatchedBy(func(cp *model.Checkpoint) bool {
+					return cp.SessionID == sessionID && cp.Name == "phase 2 start" && cp.MessageID == messageID && cp.Description == "Begin rollout"
+				})).Return(nil)
+				repo.On("GetCheckpoint", ctx, sessionID, "phase 2 start").Return(&model.Checkpoint{ID: uuid.New(), SessionID: sessionID, Name: "phase 2 start", MessageID: messageID}, nil)
+			},
+		},
+		{
+			name: "message not in session",
+			setup: func(repo *MockSessionRepo) {
+				repo.On("GetMessage", ctx, sessionID, messageID).Return(nil, gorm.ErrRecordNotFound)
+			},
+			wantErr: "message not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			tt.setup(repo)
+
+			service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+			cp, err := service.SetCheckpoint(ctx, in)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Nil(t, cp)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, messageID, cp.MessageID)
+			}
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_DeleteCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	repo := &MockSessionRepo{}
+	repo.On("DeleteCheckpoint", ctx, sessionID, "kept").Return(nil)
+	repo.On("DeleteCheckpoint", ctx, sessionID, "missing").Return(gorm.ErrRecordNotFound)
+	service := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	assert.NoError(t, service.DeleteCheckpoint(ctx, sessionID, "kept"))
+	assert.EqualError(t, service.DeleteCheckpoint(ctx, sessionID, "missing"), "checkpoint not found")
+	repo.AssertExpectations(t)
+}
+
+func TestSessionService_OffloadToolResult(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, tokenizer.Init(zap.NewNop()))
+
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	longText := strings.Repeat("weather report line with plenty of detail. ", 200)
+	dir := "/sessions/" + sessionID.String() + "/tool_results/"
+
+	newPart := func(text string) model.Part {
+		return model.Part{
+			Type: "tool-result",
+			Text: text,
+			Meta: map[string]interface{}{"tool_call_id": "call_1"},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		session   *model.Session
+		text      string
+		threshold int
+		setup     func(*MockSessionRepo, *MockSessionDiskService, *MockSessionArtifactService, *model.Session)
+		offloaded bool
+		// existed is set when the artifact was already there before the offload
+		existed bool
+		errMsg  string
+	}{
+		{
+			name:      "below threshold is kept inline",
+			session:   &model.Session{ID: sessionID, ProjectID: projectID},
+			text:      "sunny",
+			threshold: 100,
+			setup:     func(*MockSessionRepo, *MockSessionDiskService, *MockSessionArtifactService, *model.Session) {},
+		},
+		{
+			name: "offloads to the bound disk",
+			session: func() *model.Session {
+				diskID := uuid.New()
+				return &model.Session{ID: sessionID, ProjectID: projectID, DiskID: &diskID}
+			}(),
+			text:      longText,
+			threshold: 100,
+			setup: func(r *MockSessionRepo, d *MockSessionDiskService, a *MockSessionArtifactService, ss *model.Session) {
+				a.On("GetByPath", ctx, *ss.DiskID, dir, "call_1.txt").Return(nil, gorm.ErrRecordNotFound)
+				a.On("Create", ctx, mock.MatchedBy(func(in CreateArtifactInput) bool {
+					content, err := in.FileHeader.Open()
+					if err != nil {
+						return false
+					}
+					defer content.Close()
+					data, err := io.ReadAll(content)
+					return err == nil &&
+						in.DiskID == *ss.DiskID &&
+						in.Path == dir &&
+						in.Filename == "call_1.txt" &&
+						string(data) == longText
+				})).Return(&model.Artifact{}, nil)
+			},
+			offloaded: true,
+		},
+		{
+			name:      "creates and binds a disk on first use",
+			session:   &model.Session{ID: sessionID, ProjectID: projectID},
+			text:      longText,
+			threshold: 100,
+			setup: func(r *MockSessionRepo, d *MockSessionDiskService, a *MockSessionArtifactService, ss *model.Session) {
+				disk := &model.Disk{ID: uuid.New(), ProjectID: projectID}
+				d.On("Create", ctx, projectID, (*uuid.UUID)(nil)).Return(disk, nil)
+				r.On("BindDisk", ctx, sessionID, disk.ID).Return(disk.ID, nil)
+				a.On("GetByPath", ctx, disk.ID, dir, "call_1.txt").Return(nil, gorm.ErrRecordNotFound)
+				a.On("Create", ctx, mock.Anything).Return(&model.Artifact{}, nil)
+			},
+			offloaded: true,
+		},
+		{
+			name:      "drops the new disk when another one was bound concurrently",
+			session:   &model.Session{ID: sessionID, ProjectID: projectID},
+			text:      longText,
+			threshold: 100,
+			setup: func(r *MockSessionRepo, d *MockSessionDiskService, a *MockSessionArtifactService, ss *model.Session) {
+				disk := &model.Disk{ID: uuid.New(), ProjectID: projectID}
+				boundID := uuid.New()
+				d.On("Create", ctx, projectID, (*uuid.UUID)(nil)).Return(disk, nil)
+				r.On("BindDisk", ctx, sessionID, disk.ID).Return(boundID, nil)
+				d.On("Delete", ctx, projectID, disk.ID).Return(nil)
+				a.On("GetByPath", ctx, boundID, dir, "call_1.txt").Return(nil, gorm.ErrRecordNotFound)
+				a.On("Create", ctx, mock.MatchedBy(func(in CreateArtifactInput) bool {
+					return in.DiskID == boundID
+				})).Return(&model.Artifact{}, nil)
+			},
+			offloaded: true,
+		},
+		{
+			name: "artifact creation failure",
+			session: func() *model.Session {
+				diskID := uuid.New()
+				return &model.Session{ID: sessionID, ProjectID: projectID, DiskID: &diskID}
+			}(),
+			text:      longText,
+			threshold: 100,
+			setup: func(r *MockSessionRepo, d *MockSessionDiskService, a *MockSessionArtifactService, ss *model.Session) {
+				a.On("GetByPath", ctx, *ss.DiskID, dir, "call_1.txt").Return(nil, gorm.ErrRecordNotFound)
+				a.On("Create", ctx, mock.Anything).Return(nil, errors.New("upload failed"))
+			},
+			errMsg: "upload failed",
+		},
+		{
+			name: "an artifact left by an earlier store is overwritten but not reported",
+			session: func() *model.Session {
+				diskID := uuid.New()
+				return &model.Session{ID: sessionID, ProjectID: projectID, DiskID: &diskID}
+			}(),
+			text:      longText,
+			threshold: 100,
+			setup: func(r *MockSessionRepo, d *MockSessionDiskService, a *MockSessionArtifactService, ss *model.Session) {
+				a.On("GetByPath", ctx, *ss.DiskID, dir, "call_1.txt").Return(&model.Artifact{}, nil)
+				a.On("Create", ctx, mock.Anything).Return(&model.Artifact{}, nil)
+			},
+			offloaded: true,
+			existed:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &MockSessionRepo{}
+			diskSvc := &MockSessionDiskService{}
+			artifactSvc := &MockSessionArtifactService{}
+			tt.setup(repo, diskSvc, artifactSvc, tt.session)
+
+			svc := NewSessionService(repo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, diskSvc, artifactSvc).(*sessionService)
+			part := newPart(tt.text)
+
+			artifact, err := svc.offloadToolResult(ctx, tt.session, &part, tt.threshold)
+
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				require.NoError(t, err)
+				if tt.offloaded {
+					require.NotNil(t, tt.session.DiskID)
+					diskID := tt.session.DiskID.String()
+					filePath := dir + "call_1.txt"
+					assert.Contains(t, part.Text, diskID)
+					assert.Contains(t, part.Text, filePath)
+					assert.Less(t, len(part.Text), len(longText))
+					offloaded, ok := part.Meta[offloadedMetaKey].(map[string]interface{})
+					require.True(t, ok)
+					assert.Equal(t, diskID, offloaded["disk_id"])
+					assert.Equal(t, filePath, offloaded["file_path"])
+					assert.Equal(t, "call_1", part.Meta["tool_call_id"])
+					if tt.existed {
+						assert.Nil(t, artifact)
+					} else {
+						assert.Equal(t, &offloadedArtifact{DiskID: *tt.session.DiskID, Path: dir, Filename: "call_1.txt"}, artifact)
+					}
+				} else {
+					assert.Nil(t, artifact)
+					assert.Equal(t, tt.text, part.Text)
+					assert.NotContains(t, part.Meta, offloadedMetaKey)
+				}
+			}
+
+			repo.AssertExpectations(t)
+			diskSvc.AssertExpectations(t)
+			artifactSvc.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOffloadFilename(t *testing.T) {
+	assert.Equal(t, "call_1.txt", offloadFilename("call_1"))
+	assert.Equal(t, "toolu_01_abc.txt", offloadFilename("toolu_01/abc"))
+
+	name := offloadFilename("")
+	assert.True(t, strings.HasSuffix(name, ".txt"))
+	_, err := uuid.Parse(strings.TrimSuffix(name, ".txt"))
+	assert.NoError(t, err)
+}
+
+func TestOffloadReference(t *testing.T) {
+	diskID := uuid.New()
+	text := offloadReference(diskID, "/tool-results/a b&c.txt", 1200, "result")
+
+	assert.Contains(t, text, "file_path=/tool-results/a b&c.txt,")
+	assert.Contains(t, text, "disk/"+diskID.String()+"/artifact?file_path=%2Ftool-results%2Fa+b%26c.txt&with_content=true")
+	assert.NotContains(t, text, "/api/v1")
+	assert.True(t, strings.HasSuffix(text, "Preview:\nresult"))
+}
+
+func TestSessionService_StoreMessage_RejectsInvalidToolCall(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+		return s.ID == sessionID
+	})).Return(&model.Session{ID: sessionID, ProjectID: projectID}, nil)
+	sessionRepo.On("GetWithSpaceAndProject", ctx, sessionID).Return(&model.Session{
+		ID:      sessionID,
+		Configs: map[string]interface{}{ToolCallValidationConfigKey: ToolCallValidationReject},
+	}, nil)
+	sessionRepo.On("GetTools", ctx, sessionID, 0).Return(&model.SessionTools{
+		Tools: datatypes.NewJSONType([]model.ToolDefinition{{
+			Name: "get_weather",
+			Parameters: map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"city": map[string]any{"type": "string"}},
+				"required":   []any{"city"},
+			},
+		}}),
+	}, nil)
+	service := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	// Rejected before any upload or insert
+	msg, err := service.StoreMessage(ctx, StoreMessageInput{
+		ProjectID: projectID,
+		SessionID: sessionID,
+		Role:      "assistant",
+		Parts: []PartIn{{Type: "tool-call", Meta: map[string]interface{}{
+			"id": "call_1", "name": "get_weather", "arguments": `{"city": 42}`,
+		}}},
+		Format: model.FormatOpenAI,
+	})
+
+	assert.Nil(t, msg)
+	assert.ErrorIs(t, err, ErrInvalidToolCall)
+	assert.Contains(t, err.Error(), "parts[0]: $.city: expected string, got number")
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_validateToolParts(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+	session := &model.Session{ID: sessionID, ProjectID: projectID}
+
+	weatherSchema := map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{"city": map[string]any{"type": "string"}},
+		"required":             []any{"city"},
+		"additionalProperties": false,
+	}
+	sessionTools := &model.SessionTools{
+		Tools: datatypes.NewJSONType([]model.ToolDefinition{{Name: "get_weather", Parameters: weatherSchema}}),
+	}
+	withMode := func(mode string) *model.Session {
+		return &model.Session{ID: sessionID, Configs: map[string]interface{}{ToolCallValidationConfigKey: mode}}
+	}
+	call := func(name string, args any) PartIn {
+		return PartIn{Type: "tool-call", Meta: map[string]interface{}{"id": "call_new", "name": name, "arguments": args}}
+	}
+	result := func(id string) PartIn {
+		return PartIn{Type: "tool-result", Text: "sunny", Meta: map[string]interface{}{"tool_call_id": id}}
+	}
+
+	tests := []struct {
+		name     string
+		parts    []PartIn
+		setup    func(*MockSessionRepo)
+		wantErr  string
+		problems [][]string // expected validation_errors per part, nil when absent
+	}{
+		{
+			name:  "off by default",
+			parts: []PartIn{call("get_weather", `{}`)},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(&model.Session{ID: sessionID}, nil)
+			},
+			problems: [][]string{nil},
+		},
+		{
+			name:  "text only message skips validation",
+			parts: []PartIn{{Type: "text", Text: "hi"}},
+			setup: func(r *MockSessionRepo) {},
+		},
+		{
+			name:  "annotate schema violations",
+			parts: []PartIn{call("get_weather", map[string]interface{}{"town": "Paris"})},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode(ToolCallValidationAnnotate), nil)
+				r.On("GetTools", ctx, sessionID, 0).Return(sessionTools, nil)
+			},
+			problems: [][]string{{`$: missing required property "city"`, `$: unexpected property "town"`}},
+		},
+		{
+			name:  "annotate arguments that are not JSON",
+			parts: []PartIn{call("get_weather", `{"city":`)},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode(ToolCallValidationAnnotate), nil)
+				r.On("GetTools", ctx, sessionID, 0).Return(sessionTools, nil)
+			},
+			problems: [][]string{{"arguments are not valid JSON: unexpected end of JSON input"}},
+		},
+		{
+			name:  "annotate unknown tool when the session declares its tools",
+			parts: []PartIn{call("get_time", `{}`)},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode(ToolCallValidationAnnotate), nil)
+				r.On("GetTools", ctx, sessionID, 0).Return(sessionTools, nil)
+			},
+			problems: [][]string{{`unknown tool "get_time"`}},
+		},
+		{
+			name:  "fall back to tool reference schemas",
+			parts: []PartIn{call("get_weather", `{"city": 1}`), call("get_time", `{}`)},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode(ToolCallValidationAnnotate), nil)
+				r.On("GetTools", ctx, sessionID, 0).Return(nil, gorm.ErrRecordNotFound)
+				r.On("ListToolReferences", ctx, projectID, []string{"get_weather", "get_time"}).Return([]model.ToolReference{
+					{Name: "get_weather", ArgumentsSchema: weatherSchema},
+				}, nil)
+			},
+			problems: [][]string{{"$.city: expected string, got number"}, nil},
+		},
+		{
+			name:  "annotate tool result without a prior call",
+			parts: []PartIn{result("call_1"), result("call_missing")},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode(ToolCallValidationAnnotate), nil)
+				r.On("FindToolCallIDs", ctx, sessionID, []string{"call_1", "call_missing"}).Return([]string{"call_1"}, nil)
+				r.On("ListMessagesWithoutToolCallIDs", ctx, sessionID).Return([]model.Message{}, nil)
+			},
+			problems: [][]string{nil, {`no prior tool call with id "call_missing" in the session`}},
+		},
+		{
+			name:  "reject lists every invalid part",
+			parts: []PartIn{call("get_weather", `{"city": "Paris"}`), result("call_missing")},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode(ToolCallValidationReject), nil)
+				r.On("GetTools", ctx, sessionID, 0).Return(sessionTools, nil)
+				r.On("FindToolCallIDs", ctx, sessionID, []string{"call_missing"}).Return([]string{}, nil)
+				r.On("ListMessagesWithoutToolCallIDs", ctx, sessionID).Return([]model.Message{}, nil)
+			},
+			wantErr: `invalid tool call: parts[1]: no prior tool call with id "call_missing" in the session`,
+		},
+		{
+			name:  "invalid mode",
+			parts: []PartIn{call("get_weather", `{}`)},
+			setup: func(r *MockSessionRepo) {
+				r.On("GetWithSpaceAndProject", ctx, sessionID).Return(withMode("strict"), nil)
+			},
+			wantErr: "invalid tool_call_validation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionRepo := &MockSessionRepo{}
+			tt.setup(sessionRepo)
+			s := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil).(*sessionService)
+
+			err := s.validateToolParts(ctx, session, tt.parts)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				for i, want := range tt.problems {
+					got, ok := tt.parts[i].Meta[model.PartValidationErrorsKey]
+					if want == nil {
+						assert.False(t, ok, "part %d", i)
+					} else {
+						assert.Equal(t, want, got, "part %d", i)
+					}
+				}
+			}
+			sessionRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestSessionService_findPriorToolCalls(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	s3 := newFakeS3(t)
+
+	// A message stored before tool call ids were recorded
+	legacyParts, err := s3.UploadJSON(ctx, "parts/legacy", []model.Part{
+		{Type: "tool-call", Meta: map[string]interface{}{"id": "call_old", "name": "search", "arguments": "{}"}},
+	})
+	require.NoError(t, err)
+	legacy := model.Message{ID: uuid.New(), SessionID: sessionID, PartsAssetMeta: datatypes.NewJSONType(*legacyParts)}
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("FindToolCallIDs", ctx, sessionID, []string{"call_old", "call_new"}).Return([]string{"call_new"}, nil).Once()
+	sessionRepo.On("ListMessagesWithoutToolCallIDs", ctx, sessionID).Return([]model.Message{legacy}, nil).Once()
+	sessionRepo.On("SetToolCallIDs", ctx, legacy.ID, []string{"call_old"}).Return(nil).Once()
+	sessionRepo.On("FindToolCallIDs", ctx, sessionID, []string{"call_old", "call_new"}).Return([]string{"call_old", "call_new"}, nil).Once()
+	svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), s3, nil, &config.Config{}, nil, nil, nil).(*sessionService)
+
+	calls, err := svc.findPriorToolCalls(ctx, sessionID, []string{"call_old", "call_new"})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"call_old": true, "call_new": true}, calls)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionService_sessionConfigs(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	load := func(project datatypes.JSONMap) []map[string]interface{} {
+		sessionRepo := &MockSessionRepo{}
+		sessionRepo.On("GetWithSpaceAndProject", ctx, sessionID).Return(&model.Session{
+			ID:      sessionID,
+			Configs: datatypes.JSONMap{ToolCallValidationConfigKey: ToolCallValidationAnnotate},
+			Space:   &model.Space{Configs: datatypes.JSONMap{}},
+			Project: &model.Project{ID: uuid.New(), Configs: project},
+		}, nil)
+		svc := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil).(*sessionService)
+
+		configs, err := svc.sessionConfigs(ctx, sessionID)
+		require.NoError(t, err)
+		return configs
+	}
+
+	valid := datatypes.JSONMap{ToolCallValidationConfigKey: ToolCallValidationReject}
+	assert.Len(t, load(valid), 3)
+
+	// Project configs are not validated on write, invalid ones are ignored
+	configs := load(datatypes.JSONMap{"edit_strategies": []interface{}{map[string]interface{}{"type": "nope"}}})
+	require.Len(t, configs, 2)
+	mode, err := toolCallValidationMode(configs...)
+	require.NoError(t, err)
+	assert.Equal(t, ToolCallValidationAnnotate, mode)
+}
+
+func TestValidateConfigs(t *testing.T) {
+	assert.NoError(t, ValidateConfigs(nil))
+	assert.NoError(t, ValidateConfigs(map[string]interface{}{ToolCallValidationConfigKey: ToolCallValidationReject}))
+	assert.ErrorContains(t, ValidateConfigs(map[string]interface{}{ToolCallValidationConfigKey: "strict"}), "invalid tool_call_validation")
+	assert.Error(t, ValidateConfigs(map[string]interface{}{"edit_strategies": "none"}))
+}
+
+func TestAuditToolPairing(t *testing.T) {
+	call := func(id, name string) model.Part {
+		return model.Part{Type: "tool-call", Meta: map[string]any{"id": id, "name": name, "arguments": "{}"}}
+	}
+	result := func(id string) model.Part {
+		return model.Part{Type: "tool-result", Text: "ok", Meta: map[string]any{"tool_call_id": id}}
+	}
+	msgs := []model.Message{
+		{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_1", "search"), call("call_2", "fetch")}},
+		{ID: uuid.New(), Role: "user", Parts: []model.Part{result("call_1"), result("call_9")}},
+		{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_1", "search")},
+			Meta: datatypes.NewJSONType(map[string]any{model.GeminiCallInfoKey: []interface{}{map[string]interface{}{"id": "call_3", "name": "lookup"}}})},
+	}
+
+	issues := auditToolPairing(msgs)
+
+	require.Len(t, issues, 4)
+	assert.Equal(t, IntegrityIssue{Kind: IntegrityOrphanToolResult, MessageID: msgs[1].ID, PartIndex: intPtr(1), ToolCallID: "call_9"}, issues[0])
+	assert.Equal(t, IntegrityIssue{Kind: IntegrityDuplicateToolCallID, MessageID: msgs[2].ID, PartIndex: intPtr(0), ToolCallID: "call_1", ToolName: "search"}, issues[1])
+	assert.Equal(t, IntegrityIssue{Kind: IntegrityPendingGeminiCall, MessageID: msgs[2].ID, ToolCallID: "call_3", ToolName: "lookup"}, issues[2])
+	assert.Equal(t, IntegrityIssue{Kind: IntegrityOrphanToolCall, MessageID: msgs[0].ID, PartIndex: intPtr(1), ToolCallID: "call_2", ToolName: "fetch"}, issues[3])
+
+	assert.Empty(t, auditToolPairing(nil))
+}
+
+func TestPlanIntegrityRepair(t *testing.T) {
+	call := func(id string) model.Part {
+		return model.Part{Type: "tool-call", Meta: map[string]any{"id": id, "name": "search", "arguments": "{}"}}
+	}
+	result := func(id string) model.Part {
+		return model.Part{Type: "tool-result", Text: "ok", Meta: map[string]any{"tool_call_id": id}}
+	}
+	text := model.Part{Type: "text", Text: "next question"}
+
+	t.Run("cancel prepends results to the next user message", func(t *testing.T) {
+		msgs := []model.Message{
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_1")}},
+			{ID: uuid.New(), Role: "user", Parts: []model.Part{text}},
+		}
+
+		plan := planIntegrityRepair(msgs, auditToolPairing(msgs), RepairCancelOrphanToolCalls)
+
+		assert.Empty(t, plan.inserts)
+		assert.Empty(t, plan.deleted)
+		require.Contains(t, plan.parts, 1)
+		require.Len(t, plan.parts[1], 2)
+		assert.Equal(t, "tool-result", plan.parts[1][0].Type)
+		assert.Equal(t, "call_1", plan.parts[1][0].Meta["tool_call_id"])
+		assert.Equal(t, true, plan.parts[1][0].Meta["is_error"])
+		assert.Equal(t, text, plan.parts[1][1])
+		assert.Empty(t, auditToolPairing([]model.Message{msgs[0], {Role: "user", Parts: plan.parts[1]}}))
+	})
+
+	t.Run("cancel inserts a message before an assistant message or at the end", func(t *testing.T) {
+		msgs := []model.Message{
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_1")}},
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_2")}},
+		}
+
+		plan := planIntegrityRepair(msgs, auditToolPairing(msgs), RepairCancelOrphanToolCalls)
+
+		assert.Empty(t, plan.parts)
+		require.Len(t, plan.inserts, 2)
+		assert.Equal(t, "call_1", plan.inserts[0][0].Meta["tool_call_id"])
+		assert.Equal(t, "call_2", plan.inserts[1][0].Meta["tool_call_id"])
+	})
+
+	t.Run("drop removes orphans and deletes emptied messages", func(t *testing.T) {
+		msgs := []model.Message{
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{text, call("call_1")}},
+			{ID: uuid.New(), Role: "user", Parts: []model.Part{result("call_9")}},
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_2")},
+				Meta: datatypes.NewJSONType(map[string]any{model.GeminiCallInfoKey: []interface{}{map[string]interface{}{"id": "call_2", "name": "search"}}})},
+		}
+
+		plan := planIntegrityRepair(msgs, auditToolPairing(msgs), RepairDropOrphanToolCalls)
+
+		assert.Equal(t, map[int][]model.Part{0: {text}}, plan.parts)
+		assert.Equal(t, map[int]bool{1: true, 2: true}, plan.deleted)
+		assert.True(t, plan.clearGemini[2])
+		assert.Empty(t, plan.inserts)
+		assert.Len(t, plan.dropped, 3)
+	})
+
+	t.Run("duplicate tool call dropped and its extra result orphaned", func(t *testing.T) {
+		msgs := []model.Message{
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{call("call_1")}},
+			{ID: uuid.New(), Role: "user", Parts: []model.Part{result("call_1")}},
+			{ID: uuid.New(), Role: "assistant", Parts: []model.Part{text, call("call_1")}},
+			{ID: uuid.New(), Role: "user", Parts: []model.Part{result("call_1"), text}},
+		}
+
+		plan := planIntegrityRepair(msgs, auditToolPairing(msgs), RepairCancelOrphanToolCalls)
+
+		assert.Equal(t, map[int][]model.Part{2: {text}, 3: {text}}, plan.parts)
+		assert.Empty(t, plan.deleted)
+	})
+}
+
+func TestSessionService_RepairIntegrity_Validation(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("Get", ctx, mock.MatchedBy(func(s *model.Session) bool {
+		return s.ID == sessionID
+	})).Return(&model.Session{ID: sessionID, ProjectID: uuid.New()}, nil)
+	s := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil)
+
+	_, err := s.RepairIntegrity(ctx, RepairIntegrityInput{ProjectID: projectID, SessionID: sessionID, OrphanToolCalls: "ignore"})
+	assert.ErrorContains(t, err, "invalid orphan_tool_calls")
+
+	_, err = s.RepairIntegrity(ctx, RepairIntegrityInput{ProjectID: projectID, SessionID: sessionID})
+	assert.ErrorContains(t, err, "session does not belong to project")
+
+	sessionRepo.AssertNotCalled(t, "RepairMessages", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSessionService_resolveGeminiToolResults(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+
+	sessionRepo := &MockSessionRepo{}
+	sessionRepo.On("ResolveGeminiCalls", ctx, sessionID, []repo.GeminiFunctionResponse{
+		{Name: "get_time"},
+		{Name: "get_weather", ID: "call_b"},
+	}).Return([]string{"call_a", "call_b"}, nil)
+	s := NewSessionService(sessionRepo, &MockAssetReferenceRepo{}, zap.NewNop(), nil, nil, &config.Config{}, nil, nil, nil).(*sessionService)
+
+	// Responses to parallel calls, batched in one message in another order
+	parts := []PartIn{
+		{Type: "text", Text: "results"},
+		{Type: "tool-result", Meta: map[string]interface{}{"name": "get_time"}},
+		{Type: "tool-result", Meta: map[string]interface{}{"name": "get_weather", "tool_call_id": "call_b"}},
+	}
+	ids, err := s.resolveGeminiToolResults(ctx, sessionID, parts)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"call_a", "call_b"}, ids)
+	assert.Nil(t, parts[0].Meta)
+	assert.Equal(t, "call_a", parts[1].Meta["tool_call_id"])
+	assert.Equal(t, "call_b", parts[2].Meta["tool_call_id"])
+	sessionRepo.AssertExpectations(t)
+}
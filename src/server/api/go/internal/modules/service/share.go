@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/config"
+	"github.com/memodb-io/Luminox/internal/infra/blob"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/modules/repo"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/path"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/secrets"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/tokens"
+	"gorm.io/gorm"
+)
+
+type ShareService interface {
+	Create(ctx context.Context, in CreateShareInput) (*CreateShareOutput, error)
+	List(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskShare, error)
+	Revoke(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, shareID uuid.UUID) error
+	Open(ctx context.Context, token string, password string) (*model.DiskShare, error)
+	ListFiles(ctx context.Context, share *model.DiskShare, dir string) (*SharedListing, error)
+	Download(ctx context.Context, share *model.DiskShare, dir string, filename string) (string, error)
+}
+
+const (
+	// shareTokenPrefix marks share tokens, like the project bearer token prefix
+	shareTokenPrefix = "shr_"
+	// shareDownloadURLExpiry is how long the presigned URL of a counted download stays valid
+	shareDownloadURLExpiry = 5 * time.Minute
+)
+
+var (
+	// ErrShareNotFound is returned for unknown or revoked share tokens
+	ErrShareNotFound = errors.New("share not found")
+	// ErrShareExpired is returned when a share has expired or used up its downloads
+	ErrShareExpired = errors.New("share has expired")
+	// ErrSharePassword is returned when a password protected share is opened without the right password
+	ErrSharePassword = errors.New("share password is missing or wrong")
+)
+
+type shareService struct {
+	r   repo.ShareRepo
+	ar  repo.ArtifactRepo
+	s3  *blob.S3Deps
+	cfg *config.Config
+}
+
+func NewShareService(r repo.ShareRepo, ar repo.ArtifactRepo, s3 *blob.S3Deps, cfg *config.Config) ShareService {
+	return &shareService{r: r, ar: ar, s3: s3, cfg: cfg}
+}
+
+type CreateShareInput struct {
+	ProjectID uuid.UUID
+	DiskID    uuid.UUID
+	// Path is the shared directory, or the directory of the shared artifact
+	Path string
+	// Filename is empty when the whole directory is shared
+	Filename     string
+	Password     string
+	MaxDownloads *int
+	TTL          time.Duration
+}
+
+type CreateShareOutput struct {
+	Share *model.DiskShare `json:"share"`
+	// Token is only returned once; it cannot be recovered later
+	Token string `json:"token"`
+}
+
+// SharedFile is the public view of an artifact reachable through a share
+type SharedFile struct {
+	Path      string    `json:"path"`
+	Filename  string    `json:"filename"`
+	MIME      string    `json:"mime"`
+	SizeB     int64     `json:"size_b"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SharedListing struct {
+	Path        string       `json:"path"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	Files       []SharedFile `json:"files"`
+	Directories []string     `json:"directories"`
+}
+
+func (s *shareService) Create(ctx context.Context, in CreateShareInput) (*CreateShareOutput, error) {
+	if in.TTL <= 0 {
+		return nil, errors.New("share ttl must be positive")
+	}
+
+	// Check the disk before resolving the artifact, so paths on the disks of
+	// other projects cannot be probed
+	exists, err := s.r.DiskExists(ctx, in.ProjectID, in.DiskID)
+	if err != nil {
+		return nil, fmt.Errorf("get disk: %w", err)
+	}
+	if !exists {
+		return nil, ErrDiskNotFound
+	}
+
+	if in.Filename != "" {
+		if _, err := s.ar.GetByPath(ctx, in.DiskID, in.Path, in.Filename); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, fmt.Errorf("%w: %s%s", ErrPathNotFound, in.Path, in.Filename)
+			}
+			return nil, fmt.Errorf("get artifact: %w", err)
+		}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("generate share token: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+
+	share := &model.DiskShare{
+		ProjectID:    in.ProjectID,
+		DiskID:       in.DiskID,
+		TokenHMAC:    tokens.HMAC256Hex(s.cfg.Root.SecretPepper, secret),
+		Path:         in.Path,
+		Filename:     in.Filename,
+		MaxDownloads: in.MaxDownloads,
+		ExpiresAt:    time.Now().Add(in.TTL),
+	}
+	if in.Password != "" {
+		phc, err := secrets.HashSecret(in.Password, s.cfg.Root.SecretPepper)
+		if err != nil {
+			return nil, fmt.Errorf("hash share password: %w", err)
+		}
+		share.PasswordHashPHC = phc
+		share.HasPassword = true
+	}
+
+	if err := s.r.Create(ctx, share); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDiskNotFound
+		}
+		return nil, fmt.Errorf("create share: %w", err)
+	}
+
+	return &CreateShareOutput{Share: share, Token: shareTokenPrefix + secret}, nil
+}
+
+func (s *shareService) List(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) ([]*model.DiskShare, error) {
+	return s.r.ListActive(ctx, projectID, diskID, time.Now())
+}
+
+func (s *shareService) Revoke(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, shareID uuid.UUID) error {
+	if err := s.r.Delete(ctx, projectID, diskID, shareID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShareNotFound
+		}
+		return fmt.Errorf("delete share: %w", err)
+	}
+	return nil
+}
+
+// Open resolves a share token and checks that the share is still usable
+func (s *shareService) Open(ctx context.Context, token string, password string) (*model.DiskShare, error) {
+	secret, ok := tokens.ParseToken(token, shareTokenPrefix)
+	if !ok || secret == "" {
+		return nil, ErrShareNotFound
+	}
+
+	share, err := s.r.GetByTokenHMAC(ctx, tokens.HMAC256Hex(s.cfg.Root.SecretPepper, secret))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareNotFound
+		}
+		return nil, fmt.Errorf("get share: %w", err)
+	}
+
+	if !time.Now().Before(share.ExpiresAt) {
+		return nil, ErrShareExpired
+	}
+	if share.MaxDownloads != nil && share.DownloadCount >= *share.MaxDownloads {
+		return nil, fmt.Errorf("%w: download limit reached", ErrShareExpired)
+	}
+
+	if share.HasPassword {
+		if password == "" {
+			return nil, ErrSharePassword
+		}
+		if pass, err := secrets.VerifySecret(password, s.cfg.Root.SecretPepper, share.PasswordHashPHC); err != nil || !pass {
+			return nil, ErrSharePassword
+		}
+	}
+
+	return share, nil
+}
+
+// ListFiles lists the artifacts and subdirectories of dir within a share. A
+// file share always lists just its artifact.
+func (s *shareService) ListFiles(ctx context.Context, share *model.DiskShare, dir string) (*SharedListing, error) {
+	out := &SharedListing{Path: share.Path, ExpiresAt: share.ExpiresAt, Files: []SharedFile{}, Directories: []string{}}
+
+	if share.IsFile() {
+		artifact, err := s.sharedArtifact(ctx, share, share.Path, share.Filename)
+		if err != nil {
+			return nil, err
+		}
+		out.Files = append(out.Files, toSharedFile(artifact))
+		return out, nil
+	}
+
+	if dir == "" {
+		dir = share.Path
+	}
+	if !strings.HasPrefix(dir, share.Path) {
+		return nil, fmt.Errorf("%w: %s", ErrPathNotFound, dir)
+	}
+	out.Path = dir
+
+	artifacts, err := s.ar.ListByPath(ctx, share.DiskID, dir)
+	if err != nil {
+		return nil, fmt.Errorf("list artifacts: %w", err)
+	}
+	for _, a := range artifacts {
+		out.Files = append(out.Files, toSharedFile(a))
+	}
+
+	allPaths, err := s.ar.GetAllPaths(ctx, share.DiskID)
+	if err != nil {
+		return nil, fmt.Errorf("list directories: %w", err)
+	}
+	out.Directories = append(out.Directories, path.GetDirectoriesFromPaths(dir, allPaths)...)
+
+	return out, nil
+}
+
+// Download counts a download of an artifact within a share and returns a
+// short-lived URL for its content
+func (s *shareService) Download(ctx context.Context, share *model.DiskShare, dir string, filename string) (string, error) {
+	if share.IsFile() && filename == "" {
+		dir, filename = share.Path, share.Filename
+	}
+
+	artifact, err := s.sharedArtifact(ctx, share, dir, filename)
+	if err != nil {
+		return "", err
+	}
+
+	ok, err := s.r.ConsumeDownload(ctx, share.ID, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("count download: %w", err)
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: download limit reached", ErrShareExpired)
+	}
+
+	return s.s3.PresignDownload(ctx, artifact.AssetMeta.Data().S3Key, artifact.Filename, shareDownloadURLExpiry)
+}
+
+// sharedArtifact returns an artifact if it lies within the scope of a share
+func (s *shareService) sharedArtifact(ctx context.Context, share *model.DiskShare, dir string, filename string) (*model.Artifact, error) {
+	inScope := strings.HasPrefix(dir, share.Path)
+	if share.IsFile() {
+		inScope = dir == share.Path && filename == share.Filename
+	}
+	if !inScope || filename == "" {
+		return nil, fmt.Errorf("%w: %s%s", ErrPathNotFound, dir, filename)
+	}
+
+	artifact, err := s.ar.GetByPath(ctx, share.DiskID, dir, filename)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s%s", ErrPathNotFound, dir, filename)
+		}
+		return nil, fmt.Errorf("get artifact: %w", err)
+	}
+	return artifact, nil
+}
+
+func toSharedFile(a *model.Artifact) SharedFile {
+	asset := a.AssetMeta.Data()
+	return SharedFile{
+		Path:      a.Path,
+		Filename:  a.Filename,
+		MIME:      asset.MIME,
+		SizeB:     asset.SizeB,
+		UpdatedAt: a.UpdatedAt,
+	}
+}
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/config"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/secrets"
+	"github.com/memodb-io/Luminox/internal/pkg/utils/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// MockShareRepo is a mock implementation of ShareRepo
+type MockShareRepo struct {
+	mock.Mock
+}
+
+func (m *MockShareRepo) Create(ctx context.Context, s *model.DiskShare) error {
+	args := m.Called(ctx, s)
+	return args.Error(0)
+}
+
+func (m *MockShareRepo) DiskExists(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, projectID, diskID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockShareRepo) GetByTokenHMAC(ctx context.Context, tokenHMAC string) (*model.DiskShare, error) {
+	args := m.Called(ctx, tokenHMAC)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.DiskShare), args.Error(1)
+}
+
+func (m *MockShareRepo) ListActive(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, now time.Time) ([]*model.DiskShare, error) {
+	args := m.Called(ctx, projectID, diskID, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*model.DiskShare), args.Error(1)
+}
+
+func (m *MockShareRepo) Delete(ctx context.Context, projectID uuid.UUID, diskID uuid.UUID, shareID uuid.UUID) error {
+	args := m.Called(ctx, projectID, diskID, shareID)
+	return args.Error(0)
+}
+
+func (m *MockShareRepo) ConsumeDownload(ctx context.Context, shareID uuid.UUID, now time.Time) (bool, error) {
+	args := m.Called(ctx, shareID, now)
+	return args.Bool(0), args.Error(1)
+}
+
+const testPepper = "test-pepper"
+
+func newTestShareService(r *MockShareRepo, ar *MockArtifactRepo) ShareService {
+	return NewShareService(r, ar, newPresignOnlyS3(), &config.Config{Root: config.RootCfg{SecretPepper: testPepper}})
+}
+
+func TestShareService_Create(t *testing.T) {
+	ctx := context.Background()
+	projectID := uuid.New()
+	diskID := uuid.New()
+
+	t.Run("file share with password", func(t *testing.T) {
+		r := &MockShareRepo{}
+		r.On("DiskExists", ctx, projectID, diskID).Return(true, nil)
+		ar := &MockArtifactRepo{}
+		ar.On("GetByPath", ctx, diskID, "/reports/", "q3.pdf").Return(&model.Artifact{}, nil)
+		r.On("Create", ctx, mock.Anything).Return(nil)
+
+		out, err := newTestShareService(r, ar).Create(ctx, CreateShareInput{
+			ProjectID: projectID,
+			DiskID:    diskID,
+			Path:      "/reports/",
+			Filename:  "q3.pdf",
+			Password:  "hunter2",
+			TTL:       time.Hour,
+		})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(out.Token, shareTokenPrefix))
+
+		secret := strings.TrimPrefix(out.Token, shareTokenPrefix)
+		assert.Equal(t, tokens.HMAC256Hex(testPepper, secret), out.Share.TokenHMAC)
+		assert.True(t, out.Share.HasPassword)
+		pass, err := secrets.VerifySecret("hunter2", testPepper, out.Share.PasswordHashPHC)
+		require.NoError(t, err)
+		assert.True(t, pass)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), out.Share.ExpiresAt, time.Minute)
+	})
+
+	t.Run("missing artifact", func(t *testing.T) {
+		r := &MockShareRepo{}
+		r.On("DiskExists", ctx, projectID, diskID).Return(true, nil)
+		ar := &MockArtifactRepo{}
+		ar.On("GetByPath", ctx, diskID, "/reports/", "nope.pdf").Return(nil, gorm.ErrRecordNotFound)
+
+		_, err := newTestShareService(r, ar).Create(ctx, CreateShareInput{
+			ProjectID: projectID, DiskID: diskID, Path: "/reports/", Filename: "nope.pdf", TTL: time.Hour,
+		})
+		assert.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("file share on a foreign disk", func(t *testing.T) {
+		r := &MockShareRepo{}
+		r.On("DiskExists", ctx, projectID, diskID).Return(false, nil)
+		ar := &MockArtifactRepo{}
+
+		_, err := newTestShareService(r, ar).Create(ctx, CreateShareInput{
+			ProjectID: projectID, DiskID: diskID, Path: "/reports/", Filename: "q3.pdf", TTL: time.Hour,
+		})
+		assert.ErrorIs(t, err, ErrDiskNotFound)
+		ar.AssertNotCalled(t, "GetByPath", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("directory share on a disk deleted meanwhile", func(t *testing.T) {
+		r := &MockShareRepo{}
+		r.On("DiskExists", ctx, projectID, diskID).Return(true, nil)
+		r.On("Create", ctx, mock.Anything).Return(gorm.ErrRecordNotFound)
+
+		_, err := newTestShareService(r, &MockArtifactRepo{}).Create(ctx, CreateShareInput{
+			ProjectID: projectID, DiskID: diskID, Path: "/reports/", TTL: time.Hour,
+		})
+		assert.ErrorIs(t, err, ErrDiskNotFound)
+	})
+}
+
+func TestShareService_Open(t *testing.T) {
+	ctx := context.Background()
+	phc, err := secrets.HashSecret("hunter2", testPepper)
+	require.NoError(t, err)
+	limit := 2
+
+	tests := []struct {
+		name     string
+		token    string
+		share    *model.DiskShare
+		password string
+		wantErr  error
+	}{
+		{
+			name:    "wrong prefix",
+			token:   "sk_abc",
+			wantErr: ErrShareNotFound,
+		},
+		{
+			name:    "unknown token",
+			token:   "shr_abc",
+			wantErr: ErrShareNotFound,
+		},
+		{
+			name:  "active share",
+			token: "shr_abc",
+			share: &model.DiskShare{ExpiresAt: time.Now().Add(time.Hour)},
+		},
+		{
+			name:    "expired",
+			token:   "shr_abc",
+			share:   &model.DiskShare{ExpiresAt: time.Now().Add(-time.Second)},
+			wantErr: ErrShareExpired,
+		},
+		{
+			name:    "download limit reached",
+			token:   "shr_abc",
+			share:   &model.DiskShare{ExpiresAt: time.Now().Add(time.Hour), MaxDownloads: &limit, DownloadCount: 2},
+			wantErr: ErrShareExpired,
+		},
+		{
+			name:    "password missing",
+			token:   "shr_abc",
+			share:   &model.DiskShare{ExpiresAt: time.Now().Add(time.Hour), HasPassword: true, PasswordHashPHC: phc},
+			wantErr: ErrSharePassword,
+		},
+		{
+			name:     "password wrong",
+			token:    "shr_abc",
+			share:    &model.DiskShare{ExpiresAt: time.Now().Add(time.Hour), HasPassword: true, PasswordHashPHC: phc},
+			password: "letmein",
+			wantErr:  ErrSharePassword,
+		},
+		{
+			name:     "password right",
+			token:    "shr_abc",
+			share:    &model.DiskShare{ExpiresAt: time.Now().Add(time.Hour), HasPassword: true, PasswordHashPHC: phc},
+			password: "hunter2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &MockShareRepo{}
+			if tt.share != nil {
+				r.On("GetByTokenHMAC", ctx, tokens.HMAC256Hex(testPepper, "abc")).Return(tt.share, nil)
+			} else {
+				r.On("GetByTokenHMAC", ctx, mock.Anything).Return(nil, gorm.ErrRecordNotFound)
+			}
+
+			share, err := newTestShareService(r, &MockArtifactRepo{}).Open(ctx, tt.token, tt.password)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.share, share)
+		})
+	}
+}
+
+func TestShareService_Scope(t *testing.T) {
+	ctx := context.Background()
+	diskID := uuid.New()
+	dirShare := &model.DiskShare{ID: uuid.New(), DiskID: diskID, Path: "/reports/", ExpiresAt: time.Now().Add(time.Hour)}
+	fileShare := &model.DiskShare{ID: uuid.New(), DiskID: diskID, Path: "/reports/", Filename: "q3.pdf", ExpiresAt: time.Now().Add(time.Hour)}
+	report := &model.Artifact{
+		DiskID:    diskID,
+		Path:      "/reports/2024/",
+		Filename:  "q3.pdf",
+		AssetMeta: datatypes.NewJSONType(model.Asset{S3Key: "disks/p/ab/abc.pdf", MIME: "application/pdf", SizeB: 42}),
+	}
+
+	t.Run("list subdirectory", func(t *testing.T) {
+		ar := &MockArtifactRepo{}
+		ar.On("ListByPath", ctx, diskID, "/reports/2024/").Return([]*model.Artifact{report}, nil)
+		ar.On("GetAllPaths", ctx, diskID).Return([]string{"/reports/2024/", "/reports/2024/drafts/", "/private/"}, nil)
+
+		out, err := newTestShareService(&MockShareRepo{}, ar).ListFiles(ctx, dirShare, "/reports/2024/")
+		require.NoError(t, err)
+		require.Len(t, out.Files, 1)
+		assert.Equal(t, int64(42), out.Files[0].SizeB)
+		assert.Equal(t, []string{"drafts"}, out.Directories)
+	})
+
+	t.Run("list outside the share", func(t *testing.T) {
+		_, err := newTestShareService(&MockShareRepo{}, &MockArtifactRepo{}).ListFiles(ctx, dirShare, "/private/")
+		assert.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("download outside the share", func(t *testing.T) {
+		_, err := newTestShareService(&MockShareRepo{}, &MockArtifactRepo{}).Download(ctx, fileShare, "/reports/", "other.pdf")
+		assert.ErrorIs(t, err, ErrPathNotFound)
+	})
+
+	t.Run("download counts and presigns with the filename", func(t *testing.T) {
+		r := &MockShareRepo{}
+		ar := &MockArtifactRepo{}
+		ar.On("GetByPath", ctx, diskID, "/reports/2024/", "q3.pdf").Return(report, nil)
+		r.On("ConsumeDownload", ctx, dirShare.ID, mock.Anything).Return(true, nil)
+
+		url, err := newTestShareService(r, ar).Download(ctx, dirShare, "/reports/2024/", "q3.pdf")
+		require.NoError(t, err)
+		assert.Contains(t, url, "abc.pdf")
+		assert.Contains(t, url, "response-content-disposition=attachment")
+		r.AssertExpectations(t)
+	})
+
+	t.Run("download after the limit was reached concurrently", func(t *testing.T) {
+		r := &MockShareRepo{}
+		ar := &MockArtifactRepo{}
+		ar.On("GetByPath", ctx, diskID, "/reports/", "q3.pdf").Return(report, nil)
+		r.On("ConsumeDownload", ctx, fileShare.ID, mock.Anything).Return(false, nil)
+
+		_, err := newTestShareService(r, ar).Download(ctx, fileShare, "", "")
+		assert.ErrorIs(t, err, ErrShareExpired)
+	})
+}
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/pkg/editor"
+)
+
+// RenderAgentView rewrites a multi-agent conversation as seen by a single agent.
+// Messages from agentName, and messages without an agent, are kept as they are.
+// Turns of every other agent become user messages whose text is prefixed with
+// the speaking agent's name; their tool calls, and the tool results answering
+// them, are rendered as text so the view never holds tool calls agentName did
+// not make. Parts rendered as text keep their cache_control, so breakpoints
+// placed before rendering survive. The input messages are not modified.
+func RenderAgentView(messages []model.Message, agentName string) []model.Message {
+	if agentName == "" {
+		return messages
+	}
+
+	// tool call id -> agent that made the call, for calls rendered as text
+	foreignCalls := map[string]string{}
+
+	result := make([]model.Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg.AgentName == "" || msg.AgentName == agentName {
+			if parts, ok := renderForeignToolResults(msg.Parts, foreignCalls); ok {
+				msg.Parts = parts
+			}
+			result = append(result, msg)
+			continue
+		}
+
+		prefix := fmt.Sprintf("[%s]: ", msg.AgentName)
+		parts := make([]model.Part, 0, len(msg.Parts)+1)
+		prefixed := false
+		for _, part := range msg.Parts {
+			switch part.Type {
+			case "text":
+				if !prefixed {
+					part.Text = prefix + part.Text
+					prefixed = true
+				}
+				parts = append(parts, part)
+			case "tool-call":
+				id, _ := part.Meta["id"].(string)
+				name, _ := part.Meta["name"].(string)
+				if id != "" {
+					foreignCalls[id] = msg.AgentName
+				}
+				parts = append(parts, model.Part{
+					Type: "text",
+					Text: fmt.Sprintf("[%s called tool %s with arguments %s]", msg.AgentName, name, formatToolArguments(part.Meta["arguments"])),
+					Meta: cacheControlMeta(part),
+				})
+			case "tool-result":
+				id, _ := part.Meta["tool_call_id"].(string)
+				parts = append(parts, model.Part{
+					Type: "text",
+					Text: fmt.Sprintf("[%s received tool result %s]: %s", msg.AgentName, id, part.Text),
+					Meta: cacheControlMeta(part),
+				})
+			default:
+				parts = append(parts, part)
+			}
+		}
+		if !prefixed {
+			parts = append([]model.Part{{Type: "text", Text: prefix}}, parts...)
+		}
+
+		msg.Role = "user"
+		msg.Parts = parts
+		result = append(result, msg)
+	}
+
+	return result
+}
+
+// renderForeignToolResults turns tool results answering another agent's tool
+// calls into text. It reports false when no part had to be rendered.
+func renderForeignToolResults(parts []model.Part, foreignCalls map[string]string) ([]model.Part, bool) {
+	changed := false
+	var out []model.Part
+	for i, part := range parts {
+		if part.Type != "tool-result" {
+			continue
+		}
+		id, _ := part.Meta["tool_call_id"].(string)
+		agent, ok := foreignCalls[id]
+		if !ok {
+			continue
+		}
+		if !changed {
+			out = append([]model.Part(nil), parts...)
+			changed = true
+		}
+		out[i] = model.Part{
+			Type: "text",
+			Text: fmt.Sprintf("[tool result for %s's call %s]: %s", agent, id, part.Text),
+			Meta: cacheControlMeta(part),
+		}
+	}
+	return out, changed
+}
+
+// cacheControlMeta returns the meta of a text part rendered from part, which
+// only carries over its cache_control, or nil when it has none
+func cacheControlMeta(part model.Part) map[string]any {
+	cacheControl, ok := part.Meta[editor.CacheControlMetaKey]
+	if !ok {
+		return nil
+	}
+	return map[string]any{editor.CacheControlMetaKey: cacheControl}
+}
+
+func formatToolArguments(args any) string {
+	switch v := args.(type) {
+	case nil:
+		return "{}"
+	case string:
+		return v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	}
+}
@@ -0,0 +1,121 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/pkg/editor"
+	openai "github.com/openai/openai-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func agentMessage(role, agent string, parts []model.Part) model.Message {
+	msg := createTestMessage(role, parts, nil)
+	msg.AgentName = agent
+	return msg
+}
+
+func TestRenderAgentView(t *testing.T) {
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{{Type: "text", Text: "Debate: tabs or spaces?"}}, nil),
+		agentMessage("assistant", "pro", []model.Part{{Type: "text", Text: "Tabs."}}),
+		agentMessage("assistant", "con", []model.Part{
+			{Type: "text", Text: "Let me check."},
+			{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "search", "arguments": `{"q":"tabs"}`}},
+		}),
+		createTestMessage("user", []model.Part{
+			{Type: "tool-result", Text: "spaces win", Meta: map[string]any{"tool_call_id": "call_1"}},
+		}, nil),
+		agentMessage("assistant", "pro", []model.Part{
+			{Type: "tool-call", Meta: map[string]any{"id": "call_2", "name": "search", "arguments": map[string]any{"q": "spaces"}}},
+		}),
+		createTestMessage("user", []model.Part{
+			{Type: "tool-result", Text: "tabs win", Meta: map[string]any{"tool_call_id": "call_2"}},
+		}, nil),
+	}
+
+	view := RenderAgentView(messages, "pro")
+	require.Len(t, view, len(messages))
+
+	// Own turns and unattributed turns are kept
+	assert.Equal(t, messages[0], view[0])
+	assert.Equal(t, messages[1], view[1])
+	assert.Equal(t, messages[4], view[4])
+	assert.Equal(t, messages[5], view[5])
+
+	// Other agents speak as named users; their tool calls become text
+	assert.Equal(t, "user", view[2].Role)
+	require.Len(t, view[2].Parts, 2)
+	assert.Equal(t, "[con]: Let me check.", view[2].Parts[0].Text)
+	assert.Equal(t, model.Part{Type: "text", Text: `[con called tool search with arguments {"q":"tabs"}]`}, view[2].Parts[1])
+
+	// The result of a foreign tool call is rendered as text too
+	require.Len(t, view[3].Parts, 1)
+	assert.Equal(t, model.Part{Type: "text", Text: "[tool result for con's call call_1]: spaces win"}, view[3].Parts[0])
+
+	// The input is left untouched
+	assert.Equal(t, "assistant", messages[2].Role)
+	assert.Equal(t, "Let me check.", messages[2].Parts[0].Text)
+	assert.Equal(t, "tool-result", messages[3].Parts[0].Type)
+
+	// The view converts to a valid OpenAI conversation
+	result, err := (&OpenAIConverter{}).Convert(view, nil)
+	require.NoError(t, err)
+	items := result.([]openai.ChatCompletionMessageParamUnion)
+	assert.NotNil(t, items[2].OfUser)
+	assert.NotNil(t, items[3].OfUser)
+	assert.NotNil(t, items[5].OfTool)
+}
+
+func TestRenderAgentView_PrefixWithoutText(t *testing.T) {
+	messages := []model.Message{
+		agentMessage("assistant", "con", []model.Part{
+			{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "noop"}},
+		}),
+	}
+
+	view := RenderAgentView(messages, "pro")
+
+	require.Len(t, view[0].Parts, 2)
+	assert.Equal(t, "[con]: ", view[0].Parts[0].Text)
+	assert.Equal(t, "[con called tool noop with arguments {}]", view[0].Parts[1].Text)
+}
+
+func TestRenderAgentView_KeepsCacheControl(t *testing.T) {
+	// Breakpoints are placed by auto_cache_control before the view is rendered
+	cacheControl := map[string]any{"type": "ephemeral"}
+	messages := []model.Message{
+		agentMessage("assistant", "con", []model.Part{
+			{Type: "text", Text: "Let me check."},
+			{Type: "tool-call", Meta: map[string]any{"id": "call_1", "name": "search", "arguments": `{"q":"tabs"}`, editor.CacheControlMetaKey: cacheControl}},
+		}),
+		createTestMessage("user", []model.Part{
+			{Type: "tool-result", Text: "spaces win", Meta: map[string]any{"tool_call_id": "call_1", editor.CacheControlMetaKey: cacheControl}},
+		}, nil),
+	}
+
+	view := RenderAgentView(messages, "pro")
+
+	assert.Equal(t, map[string]any{editor.CacheControlMetaKey: cacheControl}, view[0].Parts[1].Meta)
+	assert.Equal(t, map[string]any{editor.CacheControlMetaKey: cacheControl}, view[1].Parts[0].Meta)
+	assert.Nil(t, view[0].Parts[0].Meta)
+
+	result, err := (&AnthropicConverter{}).Convert(view, nil)
+	require.NoError(t, err)
+	params := result.([]anthropic.MessageParam)
+	require.Len(t, params, 2)
+	require.NotNil(t, params[0].Content[1].OfText)
+	assert.Equal(t, "ephemeral", string(params[0].Content[1].OfText.CacheControl.Type))
+	require.NotNil(t, params[1].Content[0].OfText)
+	assert.Equal(t, "ephemeral", string(params[1].Content[0].OfText.CacheControl.Type))
+}
+
+func TestRenderAgentView_NoAgent(t *testing.T) {
+	messages := []model.Message{
+		agentMessage("assistant", "con", []model.Part{{Type: "text", Text: "hi"}}),
+	}
+
+	assert.Equal(t, messages, RenderAgentView(messages, ""))
+}
@@ -77,6 +77,7 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 		case "image":
 			imageBlock := c.convertImagePart(part, publicURLs)
 			if imageBlock != nil {
+				c.applyCacheControl(imageBlock, part.Meta)
 				contentBlocks = append(contentBlocks, *imageBlock)
 			}
 
@@ -85,6 +86,7 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 			if part.Meta != nil {
 				toolUseBlock := c.convertToolCallPart(part)
 				if toolUseBlock != nil {
+					c.applyCacheControl(toolUseBlock, part.Meta)
 					contentBlocks = append(contentBlocks, *toolUseBlock)
 				}
 			}
@@ -92,6 +94,7 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 		case "tool-result":
 			toolResultBlock := c.convertToolResultPart(part)
 			if toolResultBlock != nil {
+				c.applyCacheControl(toolResultBlock, part.Meta)
 				contentBlocks = append(contentBlocks, *toolResultBlock)
 			}
 
@@ -100,6 +103,7 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 			if part.Meta != nil {
 				docBlock := c.convertDocumentPart(part, publicURLs)
 				if docBlock != nil {
+					c.applyCacheControl(docBlock, part.Meta)
 					contentBlocks = append(contentBlocks, *docBlock)
 				}
 			}
@@ -109,6 +113,17 @@ func (c *AnthropicConverter) convertParts(parts []model.Part, publicURLs map[str
 	return contentBlocks
 }
 
+// applyCacheControl copies a cache_control found in part meta onto a converted content block
+func (c *AnthropicConverter) applyCacheControl(block *anthropic.ContentBlockParamUnion, meta map[string]interface{}) {
+	cacheControl := normalizer.BuildAnthropicCacheControl(meta)
+	if cacheControl == nil {
+		return
+	}
+	if target := block.GetCacheControl(); target != nil {
+		*target = *cacheControl
+	}
+}
+
 func (c *AnthropicConverter) convertImagePart(part model.Part, publicURLs map[string]service.PublicURL) *anthropic.ContentBlockParamUnion {
 	// Try to get image URL from asset
 	imageURL := c.getAssetURL(part.Asset, publicURLs)
@@ -3,6 +3,7 @@ package converter
 import (
 	"testing"
 
+	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/modules/service"
 	"github.com/stretchr/testify/assert"
@@ -48,6 +49,46 @@ func TestAnthropicConverter_Convert_WithCacheControl(t *testing.T) {
 	assert.NotNil(t, result)
 }
 
+func TestAnthropicConverter_Convert_ToolBlocksWithCacheControl(t *testing.T) {
+	converter := &AnthropicConverter{}
+	cacheControl := map[string]interface{}{"type": "ephemeral"}
+
+	messages := []model.Message{
+		createTestMessage("assistant", []model.Part{
+			{
+				Type: "tool-call",
+				Meta: map[string]any{
+					"id":            "toolu_123",
+					"name":          "get_weather",
+					"arguments":     "{\"city\":\"Boston\"}",
+					"cache_control": cacheControl,
+				},
+			},
+		}, nil),
+		createTestMessage("user", []model.Part{
+			{
+				Type: "tool-result",
+				Text: "Weather: 72°F",
+				Meta: map[string]any{
+					"tool_call_id":  "toolu_123",
+					"cache_control": cacheControl,
+				},
+			},
+		}, nil),
+	}
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+
+	params, ok := result.([]anthropic.MessageParam)
+	require.True(t, ok)
+	require.Len(t, params, 2)
+	require.NotNil(t, params[0].Content[0].OfToolUse)
+	assert.Equal(t, "ephemeral", string(params[0].Content[0].OfToolUse.CacheControl.Type))
+	require.NotNil(t, params[1].Content[0].OfToolResult)
+	assert.Equal(t, "ephemeral", string(params[1].Content[0].OfToolResult.CacheControl.Type))
+}
+
 func TestAnthropicConverter_Convert_ToolCall(t *testing.T) {
 	converter := &AnthropicConverter{}
 
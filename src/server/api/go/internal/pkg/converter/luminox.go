@@ -16,6 +16,7 @@ type LuminoxMessage struct {
 	SessionID                string         `json:"session_id"`
 	ParentID                 *string        `json:"parent_id"` // Nullable for message threading
 	Role                     string         `json:"role"`
+	AgentName                string         `json:"agent_name,omitempty"`
 	Parts                    []model.Part   `json:"parts"`
 	SessionTaskProcessStatus string         `json:"session_task_process_status"` // Task processing state
 	Meta                     map[string]any `json:"meta,omitempty"`
@@ -33,6 +34,7 @@ func (c *LuminoxConverter) Convert(messages []model.Message, publicURLs map[stri
 			ID:                       msg.ID.String(),
 			SessionID:                msg.SessionID.String(),
 			Role:                     msg.Role,
+			AgentName:                msg.AgentName,
 			Parts:                    msg.Parts,
 			SessionTaskProcessStatus: msg.SessionTaskProcessStatus,
 			CreatedAt:                msg.CreatedAt.Format("2006-01-02T15:04:05.999999Z07:00"), // ISO 8601 / RFC3339
@@ -52,11 +52,8 @@ func (c *OpenAIConverter) convertToUserMessage(msg model.Message, publicURLs map
 			},
 		}
 
-		// Add name field from message meta if present
-		if metaData := msg.Meta.Data(); len(metaData) > 0 {
-			if name, ok := metaData["name"].(string); ok && name != "" {
-				userParam.Name = param.NewOpt(name)
-			}
+		if name := c.messageName(msg); name != "" {
+			userParam.Name = param.NewOpt(name)
 		}
 
 		return openai.ChatCompletionMessageParamUnion{
@@ -137,11 +134,8 @@ func (c *OpenAIConverter) convertToUserMessage(msg model.Message, publicURLs map
 		},
 	}
 
-	// Add name field from message meta if present
-	if metaData := msg.Meta.Data(); len(metaData) > 0 {
-		if name, ok := metaData["name"].(string); ok && name != "" {
-			userParam.Name = param.NewOpt(name)
-		}
+	if name := c.messageName(msg); name != "" {
+		userParam.Name = param.NewOpt(name)
 	}
 
 	return openai.ChatCompletionMessageParamUnion{
@@ -181,11 +175,8 @@ func (c *OpenAIConverter) convertToAssistantMessage(msg model.Message) openai.Ch
 		assistantParam.ToolCalls = toolCalls
 	}
 
-	// Add name field from message meta if present
-	if metaData := msg.Meta.Data(); len(metaData) > 0 {
-		if name, ok := metaData["name"].(string); ok && name != "" {
-			assistantParam.Name = param.NewOpt(name)
-		}
+	if name := c.messageName(msg); name != "" {
+		assistantParam.Name = param.NewOpt(name)
 	}
 
 	return openai.ChatCompletionMessageParamUnion{
@@ -269,6 +260,15 @@ func (c *OpenAIConverter) extractToolCallID(parts []model.Part) string {
 	return ""
 }
 
+// messageName returns the OpenAI name of a message: the name field it was stored
+// with, falling back to the agent the message is attributed to
+func (c *OpenAIConverter) messageName(msg model.Message) string {
+	if name, ok := msg.Meta.Data()["name"].(string); ok && name != "" {
+		return name
+	}
+	return msg.AgentName
+}
+
 func (c *OpenAIConverter) extractToolResultContent(parts []model.Part) string {
 	content := ""
 	for _, part := range parts {
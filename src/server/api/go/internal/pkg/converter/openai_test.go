@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/memodb-io/Luminox/internal/modules/model"
+	openai "github.com/openai/openai-go/v3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -67,3 +68,20 @@ func TestOpenAIConverter_Convert_ToolResult(t *testing.T) {
 	require.NoError(t, err)
 	assert.NotNil(t, result)
 }
+
+func TestOpenAIConverter_Convert_AgentNameAsName(t *testing.T) {
+	converter := &OpenAIConverter{}
+
+	messages := []model.Message{
+		agentMessage("assistant", "critic", []model.Part{{Type: "text", Text: "No."}}),
+		agentMessage("user", "host", []model.Part{{Type: "text", Text: "Why?"}}),
+	}
+	messages[1].Meta = createTestMessage("user", nil, map[string]any{"name": "moderator"}).Meta
+
+	result, err := converter.Convert(messages, nil)
+	require.NoError(t, err)
+	items := result.([]openai.ChatCompletionMessageParamUnion)
+	assert.Equal(t, "critic", items[0].OfAssistant.Name.Value)
+	// The stored OpenAI name takes precedence over the agent name
+	assert.Equal(t, "moderator", items[1].OfUser.Name.Value)
+}
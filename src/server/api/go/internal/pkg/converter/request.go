@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"fmt"
+
+	openai "github.com/openai/openai-go/v3"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/modules/service"
+)
+
+// ConvertTools renders provider-neutral tool definitions as the tools array of
+// a provider request
+func ConvertTools(tools []model.ToolDefinition, format model.MessageFormat) ([]map[string]any, error) {
+	result := make([]map[string]any, 0, len(tools))
+	switch format {
+	case model.FormatOpenAI:
+		for _, tool := range tools {
+			function := map[string]any{"name": tool.Name}
+			if tool.Description != "" {
+				function["description"] = tool.Description
+			}
+			if tool.Parameters != nil {
+				function["parameters"] = tool.Parameters
+			}
+			result = append(result, map[string]any{"type": "function", "function": function})
+		}
+	case model.FormatAnthropic:
+		for _, tool := range tools {
+			// Anthropic requires an input schema even for tools without arguments
+			schema := tool.Parameters
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			t := map[string]any{"name": tool.Name, "input_schema": schema}
+			if tool.Description != "" {
+				t["description"] = tool.Description
+			}
+			result = append(result, t)
+		}
+	case model.FormatGemini:
+		if len(tools) == 0 {
+			return result, nil
+		}
+		decls := make([]map[string]any, 0, len(tools))
+		for _, tool := range tools {
+			decl := map[string]any{"name": tool.Name}
+			if tool.Description != "" {
+				decl["description"] = tool.Description
+			}
+			if tool.Parameters != nil {
+				decl["parametersJsonSchema"] = tool.Parameters
+			}
+			decls = append(decls, decl)
+		}
+		result = append(result, map[string]any{"functionDeclarations": decls})
+	default:
+		return nil, fmt.Errorf("unsupported tools format: %s (must be one of: openai, anthropic, gemini)", format)
+	}
+	return result, nil
+}
+
+// BuildRequestInput holds everything needed to assemble a provider request body
+type BuildRequestInput struct {
+	Messages     []model.Message
+	Format       model.MessageFormat
+	PublicURLs   map[string]service.PublicURL
+	SystemPrompt string
+	Tools        []model.ToolDefinition
+	// Model and MaxTokens are copied into the body when set
+	Model     string
+	MaxTokens int
+}
+
+// BuildRequestBody assembles the system prompt, tools and messages into the
+// body of an OpenAI Chat Completions, Anthropic Messages or Gemini
+// generateContent request
+func BuildRequestBody(in BuildRequestInput) (map[string]any, error) {
+	if in.Format != model.FormatOpenAI && in.Format != model.FormatAnthropic && in.Format != model.FormatGemini {
+		return nil, fmt.Errorf("unsupported request format: %s (must be one of: openai, anthropic, gemini)", in.Format)
+	}
+
+	messages, err := ConvertMessages(ConvertMessagesInput{
+		Messages:   in.Messages,
+		Format:     in.Format,
+		PublicURLs: in.PublicURLs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tools, err := ConvertTools(in.Tools, in.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]any{}
+	switch in.Format {
+	case model.FormatOpenAI:
+		if in.SystemPrompt != "" {
+			openaiMessages, ok := messages.([]openai.ChatCompletionMessageParamUnion)
+			if !ok {
+				return nil, fmt.Errorf("unexpected openai messages type: %T", messages)
+			}
+			messages = append([]openai.ChatCompletionMessageParamUnion{openai.SystemMessage(in.SystemPrompt)}, openaiMessages...)
+		}
+		body["messages"] = messages
+		if in.Model != "" {
+			body["model"] = in.Model
+		}
+		if in.MaxTokens > 0 {
+			body["max_completion_tokens"] = in.MaxTokens
+		}
+	case model.FormatAnthropic:
+		if in.SystemPrompt != "" {
+			body["system"] = in.SystemPrompt
+		}
+		body["messages"] = messages
+		if in.Model != "" {
+			body["model"] = in.Model
+		}
+		if in.MaxTokens > 0 {
+			body["max_tokens"] = in.MaxTokens
+		}
+	case model.FormatGemini:
+		if in.SystemPrompt != "" {
+			body["systemInstruction"] = map[string]any{
+				"parts": []map[string]any{{"text": in.SystemPrompt}},
+			}
+		}
+		body["contents"] = messages
+		if in.MaxTokens > 0 {
+			body["generationConfig"] = map[string]any{"maxOutputTokens": in.MaxTokens}
+		}
+	}
+
+	if len(tools) > 0 {
+		body["tools"] = tools
+	}
+	return body, nil
+}
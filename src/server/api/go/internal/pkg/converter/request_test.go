@@ -0,0 +1,102 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	openai "github.com/openai/openai-go/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTools = []model.ToolDefinition{
+	{Name: "get_weather", Description: "Get the weather of a city", Parameters: map[string]any{"type": "object"}},
+	{Name: "now"},
+}
+
+func TestConvertTools(t *testing.T) {
+	openaiTools, err := ConvertTools(testTools, model.FormatOpenAI)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{"type": "function", "function": map[string]any{"name": "get_weather", "description": "Get the weather of a city", "parameters": map[string]any{"type": "object"}}},
+		{"type": "function", "function": map[string]any{"name": "now"}},
+	}, openaiTools)
+
+	anthropicTools, err := ConvertTools(testTools, model.FormatAnthropic)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{
+		{"name": "get_weather", "description": "Get the weather of a city", "input_schema": map[string]any{"type": "object"}},
+		{"name": "now", "input_schema": map[string]any{"type": "object", "properties": map[string]any{}}},
+	}, anthropicTools)
+
+	geminiTools, err := ConvertTools(testTools, model.FormatGemini)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"functionDeclarations": []map[string]any{
+		{"name": "get_weather", "description": "Get the weather of a city", "parametersJsonSchema": map[string]any{"type": "object"}},
+		{"name": "now"},
+	}}}, geminiTools)
+
+	_, err = ConvertTools(testTools, model.FormatLuminox)
+	assert.Error(t, err)
+}
+
+func TestBuildRequestBody(t *testing.T) {
+	messages := []model.Message{
+		createTestMessage("user", []model.Part{{Type: "text", Text: "Weather in Paris?"}}, nil),
+	}
+
+	t.Run("openai", func(t *testing.T) {
+		body, err := BuildRequestBody(BuildRequestInput{
+			Messages:     messages,
+			Format:       model.FormatOpenAI,
+			SystemPrompt: "You are a weather bot.",
+			Tools:        testTools,
+			Model:        "gpt-4.1",
+		})
+		require.NoError(t, err)
+		items := body["messages"].([]openai.ChatCompletionMessageParamUnion)
+		require.Len(t, items, 2)
+		require.NotNil(t, items[0].OfSystem)
+		assert.Equal(t, "You are a weather bot.", items[0].OfSystem.Content.OfString.Value)
+		assert.NotNil(t, items[1].OfUser)
+		assert.Equal(t, "gpt-4.1", body["model"])
+		assert.Len(t, body["tools"], 2)
+		assert.NotContains(t, body, "max_completion_tokens")
+	})
+
+	t.Run("anthropic", func(t *testing.T) {
+		body, err := BuildRequestBody(BuildRequestInput{
+			Messages:     messages,
+			Format:       model.FormatAnthropic,
+			SystemPrompt: "You are a weather bot.",
+			MaxTokens:    1024,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "You are a weather bot.", body["system"])
+		assert.Equal(t, 1024, body["max_tokens"])
+		assert.NotContains(t, body, "tools")
+		assert.NotContains(t, body, "model")
+	})
+
+	t.Run("gemini", func(t *testing.T) {
+		body, err := BuildRequestBody(BuildRequestInput{
+			Messages:     messages,
+			Format:       model.FormatGemini,
+			SystemPrompt: "You are a weather bot.",
+			Tools:        testTools,
+			Model:        "gemini-2.5-pro",
+			MaxTokens:    1024,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"parts": []map[string]any{{"text": "You are a weather bot."}}}, body["systemInstruction"])
+		assert.Equal(t, map[string]any{"maxOutputTokens": 1024}, body["generationConfig"])
+		assert.NotNil(t, body["contents"])
+		assert.Len(t, body["tools"], 1)
+		assert.NotContains(t, body, "model")
+	})
+
+	t.Run("luminox", func(t *testing.T) {
+		_, err := BuildRequestBody(BuildRequestInput{Messages: messages, Format: model.FormatLuminox})
+		assert.ErrorContains(t, err, "unsupported request format")
+	})
+}
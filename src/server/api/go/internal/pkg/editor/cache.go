@@ -0,0 +1,180 @@
+package editor
+
+import (
+	"context"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+)
+
+const (
+	// MaxCacheBreakpoints is the maximum number of cache_control breakpoints
+	// Anthropic accepts in a single request
+	MaxCacheBreakpoints = 4
+	// DefaultCacheGrowthTokens is the default number of tokens the conversation
+	// may grow past the cache pin before the pin moves forward
+	DefaultCacheGrowthTokens = 4096
+	// CacheControlMetaKey is the part meta key holding Anthropic cache_control
+	CacheControlMetaKey = "cache_control"
+)
+
+// SelectCachePin deterministically picks the message to pin the prompt cache at.
+//
+// The remembered pin is kept as long as it is still present and the messages
+// after it do not exceed growthTokens. Otherwise the pin moves to the last
+// message whose cumulative token count does not exceed the highest multiple of
+// growthTokens reached by the conversation, so every caller computes the same
+// pin for the same history. An empty string means the conversation is still
+// too short to be pinned.
+func SelectCachePin(ctx context.Context, messages []model.Message, growthTokens int, rememberedPin string) (string, error) {
+	if growthTokens <= 0 {
+		growthTokens = DefaultCacheGrowthTokens
+	}
+
+	cumulative, err := cumulativeTokens(ctx, messages)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", nil
+	}
+	total := cumulative[len(cumulative)-1]
+
+	if rememberedPin != "" {
+		for i, msg := range messages {
+			if msg.ID.String() == rememberedPin {
+				if total-cumulative[i] <= growthTokens {
+					return rememberedPin, nil
+				}
+				break
+			}
+		}
+	}
+
+	boundary := (total / growthTokens) * growthTokens
+	if idx := lastIndexAtOrBelow(cumulative, boundary); idx >= 0 {
+		return messages[idx].ID.String(), nil
+	}
+	return "", nil
+}
+
+// PlaceCacheBreakpoints marks up to MaxCacheBreakpoints messages with an
+// ephemeral cache_control on their last cacheable part: the last message, the
+// pin message and the most recent growthTokens boundaries before the pin.
+// Existing cache_control markers are removed first so the limit always holds.
+// It returns the IDs of the marked messages, oldest first.
+func PlaceCacheBreakpoints(ctx context.Context, messages []model.Message, pinMessageID string, growthTokens int) ([]string, error) {
+	if growthTokens <= 0 {
+		growthTokens = DefaultCacheGrowthTokens
+	}
+
+	for i := range messages {
+		for j := range messages[i].Parts {
+			if _, ok := messages[i].Parts[j].Meta[CacheControlMetaKey]; ok {
+				meta := copyMeta(messages[i].Parts[j].Meta)
+				delete(meta, CacheControlMetaKey)
+				messages[i].Parts[j].Meta = meta
+			}
+		}
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	cumulative, err := cumulativeTokens(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[int]bool{len(messages) - 1: true}
+	pinIdx := -1
+	for i, msg := range messages {
+		if msg.ID.String() == pinMessageID {
+			pinIdx = i
+			selected[i] = true
+			break
+		}
+	}
+
+	// Fill the remaining slots with earlier boundaries, most recent first
+	if pinIdx >= 0 {
+		boundary := (cumulative[pinIdx] / growthTokens) * growthTokens
+		for boundary > 0 && len(selected) < MaxCacheBreakpoints {
+			idx := lastIndexAtOrBelow(cumulative[:pinIdx], boundary)
+			if idx < 0 {
+				break
+			}
+			selected[idx] = true
+			boundary = ((cumulative[idx] - 1) / growthTokens) * growthTokens
+		}
+	}
+
+	var ids []string
+	for i := range messages {
+		if !selected[i] {
+			continue
+		}
+		if markLastCacheablePart(&messages[i]) {
+			ids = append(ids, messages[i].ID.String())
+		}
+	}
+	return ids, nil
+}
+
+// cumulativeTokens returns the running token count after each message
+func cumulativeTokens(ctx context.Context, messages []model.Message) ([]int, error) {
+	cumulative, _, err := countMessageTokens(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(cumulative); i++ {
+		cumulative[i] += cumulative[i-1]
+	}
+	return cumulative, nil
+}
+
+// lastIndexAtOrBelow returns the last index whose cumulative count is within
+// (0, limit], or -1 if there is none
+func lastIndexAtOrBelow(cumulative []int, limit int) int {
+	idx := -1
+	for i, c := range cumulative {
+		if c > limit {
+			break
+		}
+		if c > 0 {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// markLastCacheablePart sets an ephemeral cache_control on the last part of the
+// message that converts to an Anthropic content block supporting it
+func markLastCacheablePart(msg *model.Message) bool {
+	for j := len(msg.Parts) - 1; j >= 0; j-- {
+		part := &msg.Parts[j]
+		switch part.Type {
+		case "text":
+			if part.Text == "" {
+				continue
+			}
+		case "image", "tool-call", "tool-result", "file":
+		default:
+			continue
+		}
+
+		meta := copyMeta(part.Meta)
+		meta[CacheControlMetaKey] = map[string]interface{}{"type": "ephemeral"}
+		part.Meta = meta
+		return true
+	}
+	return false
+}
+
+// copyMeta returns a shallow copy of a part meta map, never nil
+func copyMeta(meta map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		copied[k] = v
+	}
+	return copied
+}
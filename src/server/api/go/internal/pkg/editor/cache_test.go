@@ -0,0 +1,168 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheTestMessages(n int) []model.Message {
+	messages := make([]model.Message, n)
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = model.Message{
+			ID:   uuid.New(),
+			Role: role,
+			Parts: []model.Part{
+				{Type: "text", Text: fmt.Sprintf("message number %d talks about the quarterly billing migration plan", i)},
+			},
+		}
+	}
+	return messages
+}
+
+func TestSelectCachePin(t *testing.T) {
+	initTokenizer(t)
+	ctx := context.Background()
+
+	messages := newCacheTestMessages(10)
+	cumulative, err := cumulativeTokens(ctx, messages)
+	require.NoError(t, err)
+	total := cumulative[len(cumulative)-1]
+	growth := cumulative[2] + 1 // roughly three messages per bucket
+
+	t.Run("too short to pin", func(t *testing.T) {
+		pin, err := SelectCachePin(ctx, messages[:1], total, "")
+
+		require.NoError(t, err)
+		assert.Empty(t, pin)
+	})
+
+	t.Run("pins at the last full bucket", func(t *testing.T) {
+		pin, err := SelectCachePin(ctx, messages, growth, "")
+		require.NoError(t, err)
+
+		boundary := (total / growth) * growth
+		expected := lastIndexAtOrBelow(cumulative, boundary)
+		require.GreaterOrEqual(t, expected, 0)
+		assert.Equal(t, messages[expected].ID.String(), pin)
+	})
+
+	t.Run("deterministic across calls", func(t *testing.T) {
+		first, err := SelectCachePin(ctx, messages, growth, "")
+		require.NoError(t, err)
+		second, err := SelectCachePin(ctx, messages, growth, "")
+		require.NoError(t, err)
+
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("keeps remembered pin within growth", func(t *testing.T) {
+		remembered := messages[8].ID.String()
+
+		pin, err := SelectCachePin(ctx, messages, growth, remembered)
+
+		require.NoError(t, err)
+		assert.Equal(t, remembered, pin)
+	})
+
+	t.Run("moves remembered pin once growth is exceeded", func(t *testing.T) {
+		remembered := messages[0].ID.String()
+
+		pin, err := SelectCachePin(ctx, messages, growth, remembered)
+
+		require.NoError(t, err)
+		assert.NotEqual(t, remembered, pin)
+		assert.NotEmpty(t, pin)
+	})
+
+	t.Run("ignores unknown remembered pin", func(t *testing.T) {
+		expected, err := SelectCachePin(ctx, messages, growth, "")
+		require.NoError(t, err)
+
+		pin, err := SelectCachePin(ctx, messages, growth, uuid.New().String())
+
+		require.NoError(t, err)
+		assert.Equal(t, expected, pin)
+	})
+}
+
+func TestPlaceCacheBreakpoints(t *testing.T) {
+	initTokenizer(t)
+	ctx := context.Background()
+
+	t.Run("marks pin, last message and earlier boundaries", func(t *testing.T) {
+		messages := newCacheTestMessages(12)
+		cumulative, err := cumulativeTokens(ctx, messages)
+		require.NoError(t, err)
+		growth := cumulative[1] + 1
+
+		pin, err := SelectCachePin(ctx, messages, growth, "")
+		require.NoError(t, err)
+
+		ids, err := PlaceCacheBreakpoints(ctx, messages, pin, growth)
+
+		require.NoError(t, err)
+		assert.Len(t, ids, MaxCacheBreakpoints)
+		assert.Contains(t, ids, pin)
+		assert.Equal(t, messages[len(messages)-1].ID.String(), ids[len(ids)-1])
+
+		marked := 0
+		for _, msg := range messages {
+			for _, part := range msg.Parts {
+				if _, ok := part.Meta[CacheControlMetaKey]; ok {
+					marked++
+				}
+			}
+		}
+		assert.Equal(t, len(ids), marked)
+	})
+
+	t.Run("replaces stored cache_control", func(t *testing.T) {
+		messages := newCacheTestMessages(3)
+		messages[0].Parts[0].Meta = map[string]interface{}{CacheControlMetaKey: map[string]interface{}{"type": "ephemeral"}}
+
+		ids, err := PlaceCacheBreakpoints(ctx, messages, "", DefaultCacheGrowthTokens)
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{messages[2].ID.String()}, ids)
+		assert.NotContains(t, messages[0].Parts[0].Meta, CacheControlMetaKey)
+		assert.Equal(t, map[string]interface{}{"type": "ephemeral"}, messages[2].Parts[0].Meta[CacheControlMetaKey])
+	})
+
+	t.Run("marks the last cacheable part", func(t *testing.T) {
+		messages := []model.Message{
+			{
+				ID:   uuid.New(),
+				Role: "user",
+				Parts: []model.Part{
+					{Type: "tool-result", Text: "42", Meta: map[string]interface{}{"tool_call_id": "call_1"}},
+					{Type: "text", Text: ""},
+				},
+			},
+		}
+
+		ids, err := PlaceCacheBreakpoints(ctx, messages, "", DefaultCacheGrowthTokens)
+
+		require.NoError(t, err)
+		assert.Len(t, ids, 1)
+		assert.Contains(t, messages[0].Parts[0].Meta, CacheControlMetaKey)
+		assert.Equal(t, "call_1", messages[0].Parts[0].Meta["tool_call_id"])
+		assert.Nil(t, messages[0].Parts[1].Meta)
+	})
+
+	t.Run("no messages", func(t *testing.T) {
+		ids, err := PlaceCacheBreakpoints(ctx, nil, "", DefaultCacheGrowthTokens)
+
+		require.NoError(t, err)
+		assert.Empty(t, ids)
+	})
+}
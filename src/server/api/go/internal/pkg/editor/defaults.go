@@ -0,0 +1,64 @@
+package editor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EditStrategiesConfigKey is the key under which default edit strategies
+// are stored in project, space and session configs
+const EditStrategiesConfigKey = "edit_strategies"
+
+// StrategiesFromConfigs extracts the default edit strategies from a configs map.
+// The boolean result is false when the configs do not define edit strategies.
+// Every strategy is validated with CreateStrategy.
+func StrategiesFromConfigs(configs map[string]interface{}) ([]StrategyConfig, bool, error) {
+	raw, ok := configs[EditStrategiesConfigKey]
+	if !ok || raw == nil {
+		return nil, false, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid %s: %w", EditStrategiesConfigKey, err)
+	}
+
+	strategies := []StrategyConfig{}
+	if err := json.Unmarshal(data, &strategies); err != nil {
+		return nil, false, fmt.Errorf("%s must be an array of {type, params} objects: %w", EditStrategiesConfigKey, err)
+	}
+
+	for i, config := range strategies {
+		if config.Params == nil {
+			strategies[i].Params = map[string]interface{}{}
+		}
+		if _, err := CreateStrategy(strategies[i]); err != nil {
+			return nil, false, fmt.Errorf("invalid %s[%d]: %w", EditStrategiesConfigKey, i, err)
+		}
+	}
+
+	return strategies, true, nil
+}
+
+// ValidateConfigs checks that the edit strategies defined in configs, if any, are valid
+func ValidateConfigs(configs map[string]interface{}) error {
+	_, _, err := StrategiesFromConfigs(configs)
+	return err
+}
+
+// ResolveDefaultStrategies returns the edit strategies of the first configs
+// that define them. Configs must be passed from highest to lowest precedence,
+// e.g. session, space, project. An explicitly empty list disables strategies
+// and stops the lookup.
+func ResolveDefaultStrategies(configs ...map[string]interface{}) ([]StrategyConfig, error) {
+	for _, c := range configs {
+		strategies, ok, err := StrategiesFromConfigs(c)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return strategies, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+package editor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrategiesFromConfigs(t *testing.T) {
+	t.Run("no edit strategies defined", func(t *testing.T) {
+		strategies, ok, err := StrategiesFromConfigs(map[string]interface{}{"model": "gpt-4"})
+
+		require.NoError(t, err)
+		assert.False(t, ok)
+		assert.Nil(t, strategies)
+	})
+
+	t.Run("nil configs", func(t *testing.T) {
+		_, ok, err := StrategiesFromConfigs(nil)
+
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("valid edit strategies", func(t *testing.T) {
+		configs := map[string]interface{}{
+			"edit_strategies": []interface{}{
+				map[string]interface{}{"type": "remove_tool_result"},
+				map[string]interface{}{"type": "token_limit", "params": map[string]interface{}{"limit_tokens": float64(1000)}},
+			},
+		}
+
+		strategies, ok, err := StrategiesFromConfigs(configs)
+
+		require.NoError(t, err)
+		assert.True(t, ok)
+		require.Len(t, strategies, 2)
+		assert.Equal(t, "remove_tool_result", strategies[0].Type)
+		assert.NotNil(t, strategies[0].Params)
+		assert.Equal(t, float64(1000), strategies[1].Params["limit_tokens"])
+	})
+
+	t.Run("empty list disables strategies", func(t *testing.T) {
+		strategies, ok, err := StrategiesFromConfigs(map[string]interface{}{"edit_strategies": []interface{}{}})
+
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Empty(t, strategies)
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		_, _, err := StrategiesFromConfigs(map[string]interface{}{"edit_strategies": "token_limit"})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must be an array")
+	})
+
+	t.Run("invalid strategy params", func(t *testing.T) {
+		configs := map[string]interface{}{
+			"edit_strategies": []interface{}{
+				map[string]interface{}{"type": "token_limit", "params": map[string]interface{}{}},
+			},
+		}
+
+		err := ValidateConfigs(configs)
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "edit_strategies[0]")
+		assert.Contains(t, err.Error(), "limit_tokens")
+	})
+}
+
+func TestResolveDefaultStrategies(t *testing.T) {
+	session := map[string]interface{}{}
+	space := map[string]interface{}{
+		"edit_strategies": []interface{}{
+			map[string]interface{}{"type": "middle_out", "params": map[string]interface{}{"token_reduce_to": float64(500)}},
+		},
+	}
+	project := map[string]interface{}{
+		"edit_strategies": []interface{}{
+			map[string]interface{}{"type": "token_limit", "params": map[string]interface{}{"limit_tokens": float64(1000)}},
+		},
+	}
+
+	t.Run("space overrides project", func(t *testing.T) {
+		strategies, err := ResolveDefaultStrategies(session, space, project)
+
+		require.NoError(t, err)
+		require.Len(t, strategies, 1)
+		assert.Equal(t, "middle_out", strategies[0].Type)
+	})
+
+	t.Run("session overrides space", func(t *testing.T) {
+		override := map[string]interface{}{"edit_strategies": []interface{}{}}
+
+		strategies, err := ResolveDefaultStrategies(override, space, project)
+
+		require.NoError(t, err)
+		assert.NotNil(t, strategies)
+		assert.Empty(t, strategies)
+	})
+
+	t.Run("falls back to project", func(t *testing.T) {
+		strategies, err := ResolveDefaultStrategies(session, nil, project)
+
+		require.NoError(t, err)
+		require.Len(t, strategies, 1)
+		assert.Equal(t, "token_limit", strategies[0].Type)
+	})
+
+	t.Run("nothing defined", func(t *testing.T) {
+		strategies, err := ResolveDefaultStrategies(session, nil, nil)
+
+		require.NoError(t, err)
+		assert.Nil(t, strategies)
+	})
+}
@@ -19,36 +19,37 @@ type StrategyConfig struct {
 	Params map[string]interface{} `json:"params"`
 }
 
-// CreateStrategy creates a strategy from a config
+// StrategyOrder controls the order in which strategies are applied
+type StrategyOrder string
+
+const (
+	// OrderPriority sorts strategies by their registered priority (default)
+	OrderPriority StrategyOrder = "priority"
+	// OrderAsGiven applies strategies exactly in the order they were given
+	OrderAsGiven StrategyOrder = "as_given"
+)
+
+// CreateStrategy creates a strategy from a config using the strategy registry
 func CreateStrategy(config StrategyConfig) (EditStrategy, error) {
-	switch config.Type {
-	case "remove_tool_result":
-		return createRemoveToolResultStrategy(config.Params)
-	case "remove_tool_call_params":
-		return createRemoveToolCallParamsStrategy(config.Params)
-	case "token_limit":
-		return createTokenLimitStrategy(config.Params)
-	case "middle_out":
-		return createMiddleOutStrategy(config.Params)
-	default:
+	def, ok := LookupStrategy(config.Type)
+	if !ok {
 		return nil, fmt.Errorf("unknown strategy type: %s", config.Type)
 	}
+	params := config.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return def.Factory(params)
 }
 
 // getStrategyPriority returns the priority of a strategy type.
 // Lower numbers are applied first, higher numbers are applied last.
 // This ensures strategies are executed in an optimal order.
 func getStrategyPriority(strategyType string) int {
-	switch strategyType {
-	case "remove_tool_result":
-		return 1 // Content reduction strategies go first
-	case "remove_tool_call_params":
-		return 2
-	case "token_limit":
-		return 100 // Token limit always goes last
-	default:
-		return 50 // unmarked strategies go in the middle
+	if def, ok := LookupStrategy(strategyType); ok {
+		return def.Priority
 	}
+	return DefaultStrategyPriority // unmarked strategies go in the middle
 }
 
 // sortStrategies sorts strategy configs by their priority.
@@ -69,6 +70,22 @@ func sortStrategies(configs []StrategyConfig) []StrategyConfig {
 	return sorted
 }
 
+// orderStrategies returns the configs in the order they must be applied
+func orderStrategies(configs []StrategyConfig, order StrategyOrder) []StrategyConfig {
+	if order == OrderAsGiven {
+		return configs
+	}
+	return sortStrategies(configs)
+}
+
+// ApplyOptions controls how strategies are applied
+type ApplyOptions struct {
+	// PinAtMessageID limits editing to messages up to and including this message ID
+	PinAtMessageID string
+	// Order is the strategy order, OrderPriority when empty
+	Order StrategyOrder
+}
+
 // ApplyStrategiesResult contains the result of applying strategies
 type ApplyStrategiesResult struct {
 	// Messages is the list of messages after applying strategies
@@ -97,6 +114,12 @@ func ApplyStrategies(messages []model.Message, configs []StrategyConfig) ([]mode
 // up to and including that message, leaving subsequent messages unchanged.
 // This helps maintain prompt cache stability by keeping a stable prefix.
 func ApplyStrategiesWithPin(messages []model.Message, configs []StrategyConfig, pinAtMessageID string) (*ApplyStrategiesResult, error) {
+	return ApplyStrategiesWithOptions(messages, configs, ApplyOptions{PinAtMessageID: pinAtMessageID})
+}
+
+// ApplyStrategiesWithOptions applies multiple editing strategies in sequence,
+// pinned and ordered according to opts.
+func ApplyStrategiesWithOptions(messages []model.Message, configs []StrategyConfig, opts ApplyOptions) (*ApplyStrategiesResult, error) {
 	if len(configs) == 0 {
 		// No strategies to apply, return the last message ID
 		editAtID := ""
@@ -109,49 +132,14 @@ func ApplyStrategiesWithPin(messages []model.Message, configs []StrategyConfig,
 		}, nil
 	}
 
-	// Determine the edit boundary
-	var editableMessages []model.Message
-	var preservedMessages []model.Message
-	editAtMessageID := ""
-
-	if pinAtMessageID == "" {
-		// No pin: apply strategies to all messages
-		editableMessages = messages
-		if len(messages) > 0 {
-			editAtMessageID = messages[len(messages)-1].ID.String()
-		}
-	} else {
-		// Find the pin message and split
-		pinIndex := -1
-		for i, msg := range messages {
-			if msg.ID.String() == pinAtMessageID {
-				pinIndex = i
-				break
-			}
-		}
-
-		if pinIndex == -1 {
-			// Pin message not found, apply to all messages
-			editableMessages = messages
-			if len(messages) > 0 {
-				editAtMessageID = messages[len(messages)-1].ID.String()
-			}
-		} else {
-			// Split messages at pin point (inclusive)
-			editableMessages = messages[:pinIndex+1]
-			if pinIndex+1 < len(messages) {
-				preservedMessages = messages[pinIndex+1:]
-			}
-			editAtMessageID = pinAtMessageID
-		}
-	}
+	editableMessages, preservedMessages, editAtMessageID := splitAtPin(messages, opts.PinAtMessageID)
 
-	// Sort strategies to ensure optimal execution order
-	sortedConfigs := sortStrategies(configs)
+	// Sort strategies to ensure optimal execution order, unless asked to keep it
+	orderedConfigs := orderStrategies(configs, opts.Order)
 
 	// Apply strategies only to editable messages
 	result := editableMessages
-	for _, config := range sortedConfigs {
+	for _, config := range orderedConfigs {
 		strategy, err := CreateStrategy(config)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create strategy: %w", err)
@@ -173,3 +161,33 @@ func ApplyStrategiesWithPin(messages []model.Message, configs []StrategyConfig,
 		EditAtMessageID: editAtMessageID,
 	}, nil
 }
+
+// splitAtPin splits messages into the editable prefix (up to and including
+// pinAtMessageID) and the preserved suffix. If pinAtMessageID is empty or not
+// found, all messages are editable. It also returns the resulting edit boundary.
+func splitAtPin(messages []model.Message, pinAtMessageID string) ([]model.Message, []model.Message, string) {
+	lastID := ""
+	if len(messages) > 0 {
+		lastID = messages[len(messages)-1].ID.String()
+	}
+
+	if pinAtMessageID == "" {
+		// No pin: apply strategies to all messages
+		return messages, nil, lastID
+	}
+
+	// Find the pin message and split
+	for i, msg := range messages {
+		if msg.ID.String() == pinAtMessageID {
+			// Split messages at pin point (inclusive)
+			var preserved []model.Message
+			if i+1 < len(messages) {
+				preserved = messages[i+1:]
+			}
+			return messages[:i+1], preserved, pinAtMessageID
+		}
+	}
+
+	// Pin message not found, apply to all messages
+	return messages, nil, lastID
+}
@@ -0,0 +1,170 @@
+package editor
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
+)
+
+// ModifiedPart identifies a message part whose content was changed by a strategy
+type ModifiedPart struct {
+	MessageID string `json:"message_id"`
+	PartIndex int    `json:"part_index"`
+	PartType  string `json:"part_type"`
+}
+
+// StrategyStepReport describes the effect of a single strategy in the pipeline
+type StrategyStepReport struct {
+	Type              string                 `json:"type"`
+	Params            map[string]interface{} `json:"params,omitempty"`
+	TokensBefore      int                    `json:"tokens_before"`
+	TokensAfter       int                    `json:"tokens_after"`
+	TokensSaved       int                    `json:"tokens_saved"`
+	RemovedMessageIDs []string               `json:"removed_message_ids"`
+	ModifiedParts     []ModifiedPart         `json:"modified_parts"`
+}
+
+// ExplainStrategiesResult contains the result of applying strategies together
+// with a per-strategy report of what each step changed
+type ExplainStrategiesResult struct {
+	ApplyStrategiesResult
+	// TokensBefore is the token count of all input messages
+	TokensBefore int
+	// TokensAfter is the token count of all output messages
+	TokensAfter int
+	// Steps holds one report per strategy, in the order they were applied
+	Steps []StrategyStepReport
+}
+
+// ExplainStrategiesWithPin behaves like ApplyStrategiesWithPin but also reports,
+// for every strategy in its sorted order, the tokens before and after the step,
+// the message IDs it removed and the parts it modified.
+// The input messages are never mutated, so the same slice can be explained
+// against several candidate strategy sets.
+func ExplainStrategiesWithPin(ctx context.Context, messages []model.Message, configs []StrategyConfig, pinAtMessageID string) (*ExplainStrategiesResult, error) {
+	return ExplainStrategiesWithOptions(ctx, messages, configs, ApplyOptions{PinAtMessageID: pinAtMessageID})
+}
+
+// ExplainStrategiesWithOptions is like ExplainStrategiesWithPin with explicit
+// pinning and ordering options
+func ExplainStrategiesWithOptions(ctx context.Context, messages []model.Message, configs []StrategyConfig, opts ApplyOptions) (*ExplainStrategiesResult, error) {
+	editableMessages, preservedMessages, editAtMessageID := splitAtPin(cloneMessages(messages), opts.PinAtMessageID)
+
+	editableTokens, err := tokenizer.CountMessagePartsTokens(ctx, editableMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	preservedTokens, err := tokenizer.CountMessagePartsTokens(ctx, preservedMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+
+	out := &ExplainStrategiesResult{
+		TokensBefore: editableTokens + preservedTokens,
+		Steps:        make([]StrategyStepReport, 0, len(configs)),
+	}
+
+	result := editableMessages
+	for _, config := range orderStrategies(configs, opts.Order) {
+		strategy, err := CreateStrategy(config)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create strategy: %w", err)
+		}
+
+		// Strategies may edit parts in place, so keep an untouched copy to diff against
+		before := cloneMessages(result)
+		result, err = strategy.Apply(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply strategy %s: %w", strategy.Name(), err)
+		}
+
+		afterTokens, err := tokenizer.CountMessagePartsTokens(ctx, result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count tokens: %w", err)
+		}
+
+		step := diffMessages(before, result)
+		step.Type = config.Type
+		step.Params = config.Params
+		step.TokensBefore = editableTokens + preservedTokens
+		step.TokensAfter = afterTokens + preservedTokens
+		step.TokensSaved = step.TokensBefore - step.TokensAfter
+		out.Steps = append(out.Steps, step)
+
+		editableTokens = afterTokens
+	}
+
+	if len(preservedMessages) > 0 {
+		result = append(result, preservedMessages...)
+	}
+
+	out.Messages = result
+	out.EditAtMessageID = editAtMessageID
+	out.TokensAfter = editableTokens + preservedTokens
+
+	return out, nil
+}
+
+// diffMessages reports which messages were removed and which parts were modified
+// between two versions of the same message list
+func diffMessages(before, after []model.Message) StrategyStepReport {
+	report := StrategyStepReport{
+		RemovedMessageIDs: []string{},
+		ModifiedParts:     []ModifiedPart{},
+	}
+
+	afterByID := make(map[string]model.Message, len(after))
+	for _, msg := range after {
+		afterByID[msg.ID.String()] = msg
+	}
+
+	for _, msg := range before {
+		id := msg.ID.String()
+		edited, ok := afterByID[id]
+		if !ok {
+			report.RemovedMessageIDs = append(report.RemovedMessageIDs, id)
+			continue
+		}
+		for i, part := range msg.Parts {
+			if i >= len(edited.Parts) || !reflect.DeepEqual(part, edited.Parts[i]) {
+				report.ModifiedParts = append(report.ModifiedParts, ModifiedPart{
+					MessageID: id,
+					PartIndex: i,
+					PartType:  part.Type,
+				})
+			}
+		}
+	}
+
+	return report
+}
+
+// cloneMessages copies messages deeply enough that strategies editing part text
+// or part meta in place do not affect the original slice
+func cloneMessages(messages []model.Message) []model.Message {
+	if messages == nil {
+		return nil
+	}
+	cloned := make([]model.Message, len(messages))
+	for i, msg := range messages {
+		cloned[i] = msg
+		if msg.Parts == nil {
+			continue
+		}
+		cloned[i].Parts = make([]model.Part, len(msg.Parts))
+		for j, part := range msg.Parts {
+			cloned[i].Parts[j] = part
+			if part.Meta != nil {
+				meta := make(map[string]any, len(part.Meta))
+				for k, v := range part.Meta {
+					meta[k] = v
+				}
+				cloned[i].Parts[j].Meta = meta
+			}
+		}
+	}
+	return cloned
+}
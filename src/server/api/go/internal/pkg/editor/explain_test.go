@@ -0,0 +1,122 @@
+package editor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplainStrategiesWithPin(t *testing.T) {
+	initTokenizer(t)
+
+	newMessages := func() []model.Message {
+		return []model.Message{
+			{
+				ID:   uuid.New(),
+				Role: "user",
+				Parts: []model.Part{
+					{Type: "text", Text: "Please look up the weather in several cities for me."},
+				},
+			},
+			{
+				ID:   uuid.New(),
+				Role: "assistant",
+				Parts: []model.Part{
+					{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "weather", "arguments": `{"city":"Paris"}`}},
+				},
+			},
+			{
+				ID:   uuid.New(),
+				Role: "user",
+				Parts: []model.Part{
+					{Type: "tool-result", Text: "Paris is cloudy with light rain and 12 degrees.", Meta: map[string]interface{}{"tool_call_id": "call_1"}},
+				},
+			},
+			{
+				ID:   uuid.New(),
+				Role: "assistant",
+				Parts: []model.Part{
+					{Type: "text", Text: "Paris is rainy."},
+				},
+			},
+		}
+	}
+
+	t.Run("reports each step in sorted order", func(t *testing.T) {
+		messages := newMessages()
+		configs := []StrategyConfig{
+			{Type: "token_limit", Params: map[string]interface{}{"limit_tokens": float64(10)}},
+			{Type: "remove_tool_result", Params: map[string]interface{}{"keep_recent_n_tool_results": float64(0)}},
+		}
+
+		result, err := ExplainStrategiesWithPin(context.Background(), messages, configs, "")
+
+		require.NoError(t, err)
+		require.Len(t, result.Steps, 2)
+
+		first := result.Steps[0]
+		assert.Equal(t, "remove_tool_result", first.Type)
+		assert.Empty(t, first.RemovedMessageIDs)
+		require.Len(t, first.ModifiedParts, 1)
+		assert.Equal(t, messages[2].ID.String(), first.ModifiedParts[0].MessageID)
+		assert.Equal(t, 0, first.ModifiedParts[0].PartIndex)
+		assert.Equal(t, "tool-result", first.ModifiedParts[0].PartType)
+		assert.Greater(t, first.TokensSaved, 0)
+		assert.Equal(t, result.TokensBefore, first.TokensBefore)
+
+		second := result.Steps[1]
+		assert.Equal(t, "token_limit", second.Type)
+		assert.Equal(t, first.TokensAfter, second.TokensBefore)
+		assert.NotEmpty(t, second.RemovedMessageIDs)
+		assert.Equal(t, result.TokensAfter, second.TokensAfter)
+		assert.LessOrEqual(t, result.TokensAfter, 10)
+
+		// Explaining must not mutate the caller's messages
+		assert.Equal(t, "Paris is cloudy with light rain and 12 degrees.", messages[2].Parts[0].Text)
+		assert.Len(t, messages, 4)
+	})
+
+	t.Run("matches ApplyStrategiesWithPin output", func(t *testing.T) {
+		messages := newMessages()
+		pin := messages[2].ID.String()
+		configs := []StrategyConfig{
+			{Type: "remove_tool_call_params", Params: map[string]interface{}{"keep_recent_n_tool_calls": float64(0)}},
+		}
+
+		explained, err := ExplainStrategiesWithPin(context.Background(), messages, configs, pin)
+		require.NoError(t, err)
+
+		applied, err := ApplyStrategiesWithPin(newMessages(), configs, pin)
+		require.NoError(t, err)
+
+		require.Len(t, explained.Messages, len(applied.Messages))
+		assert.Equal(t, pin, explained.EditAtMessageID)
+		assert.Equal(t, "{}", explained.Messages[1].Parts[0].Meta["arguments"])
+		assert.Equal(t, `{"city":"Paris"}`, messages[1].Parts[0].Meta["arguments"])
+		require.Len(t, explained.Steps, 1)
+		require.Len(t, explained.Steps[0].ModifiedParts, 1)
+		assert.Equal(t, messages[1].ID.String(), explained.Steps[0].ModifiedParts[0].MessageID)
+	})
+
+	t.Run("no strategies", func(t *testing.T) {
+		messages := newMessages()
+
+		result, err := ExplainStrategiesWithPin(context.Background(), messages, nil, "")
+
+		require.NoError(t, err)
+		assert.Empty(t, result.Steps)
+		assert.Equal(t, result.TokensBefore, result.TokensAfter)
+		assert.Equal(t, messages[3].ID.String(), result.EditAtMessageID)
+	})
+
+	t.Run("invalid strategy", func(t *testing.T) {
+		_, err := ExplainStrategiesWithPin(context.Background(), newMessages(), []StrategyConfig{{Type: "unknown"}}, "")
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown strategy type")
+	})
+}
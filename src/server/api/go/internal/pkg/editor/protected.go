@@ -0,0 +1,66 @@
+package editor
+
+import "github.com/memodb-io/Luminox/internal/modules/model"
+
+// protectedIndices returns the indices of messages that strategies must not
+// drop or edit. It includes every protected message plus, transitively, the
+// messages holding the tool-calls or tool-results paired with them, so that
+// removing the remaining messages never breaks tool-call/tool-result pairing.
+func protectedIndices(messages []model.Message) map[int]bool {
+	protected := make(map[int]bool)
+	var queue []int
+	for i, msg := range messages {
+		if msg.IsProtected() {
+			protected[i] = true
+			queue = append(queue, i)
+		}
+	}
+	if len(queue) == 0 {
+		return protected
+	}
+
+	// Index messages by the tool-call IDs they reference
+	toolCallIDToIndices := make(map[string][]int)
+	for i, msg := range messages {
+		for _, id := range toolCallIDsOf(msg) {
+			toolCallIDToIndices[id] = append(toolCallIDToIndices[id], i)
+		}
+	}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, id := range toolCallIDsOf(messages[current]) {
+			for _, idx := range toolCallIDToIndices[id] {
+				if !protected[idx] {
+					protected[idx] = true
+					queue = append(queue, idx)
+				}
+			}
+		}
+	}
+
+	return protected
+}
+
+// toolCallIDsOf returns the tool-call IDs referenced by the tool-call and
+// tool-result parts of a message
+func toolCallIDsOf(msg model.Message) []string {
+	var ids []string
+	for _, part := range msg.Parts {
+		if part.Meta == nil {
+			continue
+		}
+		switch part.Type {
+		case "tool-call":
+			if id, ok := part.Meta["id"].(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		case "tool-result":
+			if id, ok := part.Meta["tool_call_id"].(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
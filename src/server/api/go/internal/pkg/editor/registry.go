@@ -0,0 +1,154 @@
+package editor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultStrategyPriority is the priority of strategies that do not declare one
+const DefaultStrategyPriority = 50
+
+// StrategyFactory builds a strategy from its config params
+type StrategyFactory func(params map[string]interface{}) (EditStrategy, error)
+
+// ParamSchema describes one parameter accepted by a strategy
+type ParamSchema struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type" enums:"integer,number,string,boolean,array,object"`
+	Description string      `json:"description"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Minimum     *int        `json:"minimum,omitempty"`
+	Items       string      `json:"items,omitempty"` // Element type for array parameters
+}
+
+// StrategyDefinition describes a registered edit strategy
+type StrategyDefinition struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	// Priority orders strategies when they are sorted automatically.
+	// Lower numbers are applied first.
+	Priority int           `json:"priority"`
+	Params   []ParamSchema `json:"params"`
+
+	Factory StrategyFactory `json:"-"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]StrategyDefinition{}
+)
+
+// RegisterStrategy adds a strategy to the registry so that it can be referenced
+// by type in StrategyConfig. It fails if the type is empty, already registered
+// or has no factory.
+func RegisterStrategy(def StrategyDefinition) error {
+	if def.Type == "" {
+		return fmt.Errorf("strategy type is required")
+	}
+	if def.Factory == nil {
+		return fmt.Errorf("strategy %s has no factory", def.Type)
+	}
+	if def.Params == nil {
+		def.Params = []ParamSchema{}
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[def.Type]; exists {
+		return fmt.Errorf("strategy %s is already registered", def.Type)
+	}
+	registry[def.Type] = def
+	return nil
+}
+
+// MustRegisterStrategy is like RegisterStrategy but panics on error.
+// It is meant to be called from init functions.
+func MustRegisterStrategy(def StrategyDefinition) {
+	if err := RegisterStrategy(def); err != nil {
+		panic(err)
+	}
+}
+
+// LookupStrategy returns the definition of a registered strategy type
+func LookupStrategy(strategyType string) (StrategyDefinition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	def, ok := registry[strategyType]
+	return def, ok
+}
+
+// ListStrategies returns all registered strategies in their default execution order
+func ListStrategies() []StrategyDefinition {
+	registryMu.RLock()
+	defs := make([]StrategyDefinition, 0, len(registry))
+	for _, def := range registry {
+		defs = append(defs, def)
+	}
+	registryMu.RUnlock()
+
+	sort.Slice(defs, func(i, j int) bool {
+		if defs[i].Priority != defs[j].Priority {
+			return defs[i].Priority < defs[j].Priority
+		}
+		return defs[i].Type < defs[j].Type
+	})
+	return defs
+}
+
+func intPtr(v int) *int { return &v }
+
+func init() {
+	MustRegisterStrategy(StrategyDefinition{
+		Type:        "remove_tool_result",
+		Description: "Replaces the text of old tool results with a placeholder, keeping the most recent ones",
+		Priority:    1, // Content reduction strategies go first
+		Params: []ParamSchema{
+			{Name: "keep_recent_n_tool_results", Type: "integer", Description: "Number of most recent tool results to keep", Default: 3, Minimum: intPtr(0)},
+			{Name: "tool_result_placeholder", Type: "string", Description: "Text that replaces removed tool results", Default: "Done"},
+			{Name: "keep_tools", Type: "array", Items: "string", Description: "Tool names whose results are never removed"},
+		},
+		Factory: createRemoveToolResultStrategy,
+	})
+	MustRegisterStrategy(StrategyDefinition{
+		Type:        "remove_tool_call_params",
+		Description: "Replaces the arguments of old tool calls with {}, keeping the most recent ones",
+		Priority:    2,
+		Params: []ParamSchema{
+			{Name: "keep_recent_n_tool_calls", Type: "integer", Description: "Number of most recent tool calls to keep", Default: 3, Minimum: intPtr(0)},
+			{Name: "keep_tools", Type: "array", Items: "string", Description: "Tool names whose arguments are never removed"},
+		},
+		Factory: createRemoveToolCallParamsStrategy,
+	})
+	MustRegisterStrategy(StrategyDefinition{
+		Type:        "middle_out",
+		Description: "Removes messages from the middle of the conversation until it fits the token budget",
+		Priority:    DefaultStrategyPriority,
+		Params: []ParamSchema{
+			{Name: "token_reduce_to", Type: "integer", Description: "Token budget to reduce the messages to", Required: true, Minimum: intPtr(1)},
+		},
+		Factory: createMiddleOutStrategy,
+	})
+	MustRegisterStrategy(StrategyDefinition{
+		Type:        "conditional",
+		Description: "Applies nested strategies, in the given order, only when the messages exceed a token threshold",
+		Priority:    DefaultStrategyPriority,
+		Params: []ParamSchema{
+			{Name: "if_tokens_over", Type: "integer", Description: "Nested strategies only run when the messages have more tokens than this", Required: true, Minimum: intPtr(0)},
+			{Name: "strategies", Type: "array", Items: "object", Description: "Nested {type, params} strategies, applied in the given order", Required: true},
+		},
+		Factory: createConditionalStrategy,
+	})
+	MustRegisterStrategy(StrategyDefinition{
+		Type:        "token_limit",
+		Description: "Removes the oldest messages until the conversation fits the token limit",
+		Priority:    100, // Token limit always goes last
+		Params: []ParamSchema{
+			{Name: "limit_tokens", Type: "integer", Description: "Maximum number of tokens to keep", Required: true, Minimum: intPtr(1)},
+		},
+		Factory: createTokenLimitStrategy,
+	})
+}
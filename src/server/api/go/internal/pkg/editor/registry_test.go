@@ -0,0 +1,118 @@
+package editor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// markerStrategy appends its marker to the text of the last message
+type markerStrategy struct{ marker string }
+
+func (s *markerStrategy) Name() string { return "marker_" + s.marker }
+
+func (s *markerStrategy) Apply(messages []model.Message) ([]model.Message, error) {
+	last := &messages[len(messages)-1]
+	last.Parts[0].Text += s.marker
+	return messages, nil
+}
+
+var registerTestStrategiesOnce sync.Once
+
+func registerTestStrategies(t *testing.T) {
+	t.Helper()
+	registerTestStrategiesOnce.Do(func() {
+		for _, def := range []struct {
+			marker   string
+			priority int
+		}{{"a", 10}, {"b", 20}} {
+			marker := def.marker
+			require.NoError(t, RegisterStrategy(StrategyDefinition{
+				Type:     "test_marker_" + marker,
+				Priority: def.priority,
+				Factory: func(params map[string]interface{}) (EditStrategy, error) {
+					return &markerStrategy{marker: marker}, nil
+				},
+			}))
+		}
+	})
+}
+
+func TestRegisterStrategy(t *testing.T) {
+	registerTestStrategies(t)
+
+	t.Run("registered strategy can be created", func(t *testing.T) {
+		strategy, err := CreateStrategy(StrategyConfig{Type: "test_marker_a"})
+
+		require.NoError(t, err)
+		assert.Equal(t, "marker_a", strategy.Name())
+	})
+
+	t.Run("duplicate type", func(t *testing.T) {
+		err := RegisterStrategy(StrategyDefinition{
+			Type:    "token_limit",
+			Factory: createTokenLimitStrategy,
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "already registered")
+	})
+
+	t.Run("missing type or factory", func(t *testing.T) {
+		assert.Error(t, RegisterStrategy(StrategyDefinition{Factory: createTokenLimitStrategy}))
+		assert.Error(t, RegisterStrategy(StrategyDefinition{Type: "test_no_factory"}))
+	})
+}
+
+func TestListStrategies(t *testing.T) {
+	defs := ListStrategies()
+
+	types := make([]string, 0, len(defs))
+	for i, def := range defs {
+		types = append(types, def.Type)
+		assert.NotNil(t, def.Params, def.Type)
+		if i > 0 {
+			assert.LessOrEqual(t, defs[i-1].Priority, def.Priority)
+		}
+	}
+	for _, builtin := range []string{"remove_tool_result", "remove_tool_call_params", "middle_out", "conditional", "token_limit"} {
+		assert.Contains(t, types, builtin)
+	}
+	assert.Equal(t, "token_limit", types[len(types)-1])
+}
+
+func TestApplyStrategiesWithOptions_Order(t *testing.T) {
+	registerTestStrategies(t)
+
+	newMessages := func() []model.Message {
+		return []model.Message{
+			{Role: "user", Parts: []model.Part{{Type: "text", Text: ""}}},
+		}
+	}
+	configs := []StrategyConfig{
+		{Type: "test_marker_b"},
+		{Type: "test_marker_a"},
+	}
+
+	tests := []struct {
+		order    StrategyOrder
+		expected string
+	}{
+		{order: "", expected: "ab"},
+		{order: OrderPriority, expected: "ab"},
+		{order: OrderAsGiven, expected: "ba"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("order %q", tt.order), func(t *testing.T) {
+			result, err := ApplyStrategiesWithOptions(newMessages(), configs, ApplyOptions{Order: tt.order})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result.Messages[0].Parts[0].Text)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package editor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
+)
+
+// ConditionalStrategy applies nested strategies, in the given order, only when
+// the messages have more than IfTokensOver tokens
+type ConditionalStrategy struct {
+	IfTokensOver int
+	Strategies   []EditStrategy
+}
+
+// Name returns the strategy name
+func (s *ConditionalStrategy) Name() string {
+	return "conditional"
+}
+
+// Apply runs the nested strategies when the token threshold is exceeded,
+// otherwise it returns the messages unchanged
+func (s *ConditionalStrategy) Apply(messages []model.Message) ([]model.Message, error) {
+	total, err := tokenizer.CountMessagePartsTokens(context.Background(), messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count tokens: %w", err)
+	}
+	if total <= s.IfTokensOver {
+		return messages, nil
+	}
+
+	result := messages
+	for _, strategy := range s.Strategies {
+		result, err = strategy.Apply(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply nested strategy %s: %w", strategy.Name(), err)
+		}
+	}
+	return result, nil
+}
+
+// createConditionalStrategy creates a ConditionalStrategy from config params
+func createConditionalStrategy(params map[string]interface{}) (EditStrategy, error) {
+	rawThreshold, ok := params["if_tokens_over"]
+	if !ok {
+		return nil, fmt.Errorf("conditional strategy requires 'if_tokens_over' parameter")
+	}
+	var threshold int
+	switch v := rawThreshold.(type) {
+	case float64:
+		threshold = int(v)
+	case int:
+		threshold = v
+	default:
+		return nil, fmt.Errorf("if_tokens_over must be an integer, got %T", rawThreshold)
+	}
+	if threshold < 0 {
+		return nil, fmt.Errorf("if_tokens_over must be >= 0, got %d", threshold)
+	}
+
+	rawStrategies, ok := params["strategies"]
+	if !ok {
+		return nil, fmt.Errorf("conditional strategy requires 'strategies' parameter")
+	}
+	data, err := json.Marshal(rawStrategies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid strategies: %w", err)
+	}
+	var configs []StrategyConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("strategies must be an array of {type, params} objects: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("strategies must not be empty")
+	}
+
+	strategies := make([]EditStrategy, 0, len(configs))
+	for i, config := range configs {
+		strategy, err := CreateStrategy(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid strategies[%d]: %w", i, err)
+		}
+		strategies = append(strategies, strategy)
+	}
+
+	return &ConditionalStrategy{
+		IfTokensOver: threshold,
+		Strategies:   strategies,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package editor
+
+import (
+	"testing"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateConditionalStrategy(t *testing.T) {
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		errMsg string
+	}{
+		{
+			name: "valid params",
+			params: map[string]interface{}{
+				"if_tokens_over": float64(100),
+				"strategies": []interface{}{
+					map[string]interface{}{"type": "remove_tool_result", "params": map[string]interface{}{}},
+				},
+			},
+		},
+		{
+			name:   "missing if_tokens_over",
+			params: map[string]interface{}{"strategies": []interface{}{}},
+			errMsg: "if_tokens_over",
+		},
+		{
+			name:   "negative if_tokens_over",
+			params: map[string]interface{}{"if_tokens_over": float64(-1), "strategies": []interface{}{}},
+			errMsg: "must be >= 0",
+		},
+		{
+			name:   "empty strategies",
+			params: map[string]interface{}{"if_tokens_over": float64(1), "strategies": []interface{}{}},
+			errMsg: "must not be empty",
+		},
+		{
+			name: "invalid nested strategy",
+			params: map[string]interface{}{
+				"if_tokens_over": float64(1),
+				"strategies": []interface{}{
+					map[string]interface{}{"type": "token_limit", "params": map[string]interface{}{}},
+				},
+			},
+			errMsg: "strategies[0]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			strategy, err := createConditionalStrategy(tt.params)
+
+			if tt.errMsg != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "conditional", strategy.Name())
+		})
+	}
+}
+
+func TestConditionalStrategy_Apply(t *testing.T) {
+	initTokenizer(t)
+
+	newMessages := func() []model.Message {
+		return []model.Message{
+			{Role: "user", Parts: []model.Part{{Type: "tool-result", Text: "first result with some content", Meta: map[string]interface{}{"tool_call_id": "call_1"}}}},
+			{Role: "user", Parts: []model.Part{{Type: "tool-result", Text: "second result with some content", Meta: map[string]interface{}{"tool_call_id": "call_2"}}}},
+		}
+	}
+	config := func(threshold int) StrategyConfig {
+		return StrategyConfig{
+			Type: "conditional",
+			Params: map[string]interface{}{
+				"if_tokens_over": float64(threshold),
+				"strategies": []interface{}{
+					map[string]interface{}{"type": "remove_tool_result", "params": map[string]interface{}{"keep_recent_n_tool_results": float64(1)}},
+				},
+			},
+		}
+	}
+
+	t.Run("below threshold leaves messages unchanged", func(t *testing.T) {
+		result, err := ApplyStrategies(newMessages(), []StrategyConfig{config(100000)})
+
+		require.NoError(t, err)
+		assert.Equal(t, "first result with some content", result[0].Parts[0].Text)
+	})
+
+	t.Run("over threshold applies nested strategies", func(t *testing.T) {
+		result, err := ApplyStrategies(newMessages(), []StrategyConfig{config(1)})
+
+		require.NoError(t, err)
+		assert.Equal(t, "Done", result[0].Parts[0].Text)
+		assert.Equal(t, "second result with some content", result[1].Parts[0].Text)
+	})
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
 )
 
+// MiddleOutStrategy removes messages from the middle until the token count is
+// within TokenReduceTo, keeping tool-call/tool-result pairing and protected messages
 type MiddleOutStrategy struct{ TokenReduceTo int }
 
 func (s *MiddleOutStrategy) Name() string { return "middle_out" }
@@ -31,12 +33,23 @@ func (s *MiddleOutStrategy) Apply(messages []model.Message) ([]model.Message, er
 	result := messages
 	resultTokens := messageTokens
 	for totalTokens > s.TokenReduceTo && len(result) > 0 {
+		// Only unprotected messages are candidates for removal
+		protected := protectedIndices(result)
+		candidates := make([]int, 0, len(result))
+		for i := range result {
+			if !protected[i] {
+				candidates = append(candidates, i)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
 		// Prefer removing from the middle to preserve both the head and the tail.
 		// Once we have <= 2 messages left, switch to "keep tail" and drop from the
 		// front to preserve recency.
-		removeIdx := len(result) / 2
-		if len(result) <= 2 {
-			removeIdx = 0
+		removeIdx := candidates[len(candidates)/2]
+		if len(candidates) <= 2 {
+			removeIdx = candidates[0]
 		}
 		var removedTokens int
 		result, resultTokens, removedTokens = removeWithToolPairing(
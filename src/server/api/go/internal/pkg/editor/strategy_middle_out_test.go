@@ -7,6 +7,7 @@ import (
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/pkg/tokenizer"
 	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
 )
 
 func TestCreateMiddleOutStrategy(t *testing.T) {
@@ -119,3 +120,31 @@ func TestMiddleOutStrategy_Apply(t *testing.T) {
 	require.Len(t, res4, 2)
 	require.Equal(t, []string{"s", "e"}, []string{res4[0].Parts[0].Text, res4[1].Parts[0].Text})
 }
+
+func TestMiddleOutStrategy_Apply_Protected(t *testing.T) {
+	initTokenizer(t)
+	protectedMeta := datatypes.NewJSONType(map[string]any{model.MessageProtectedKey: true})
+	messages := []model.Message{
+		{Role: "user", Parts: []model.Part{{Type: "text", Text: "a"}}},
+		{Role: "assistant", Parts: []model.Part{{Type: "text", Text: "b"}}},
+		{Role: "user", Meta: protectedMeta, Parts: []model.Part{{Type: "text", Text: "brief"}}},
+		{Role: "assistant", Parts: []model.Part{{Type: "text", Text: "d"}}},
+		{Role: "user", Parts: []model.Part{{Type: "text", Text: "e"}}},
+	}
+
+	res, err := (&MiddleOutStrategy{TokenReduceTo: 1}).Apply(messages)
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	require.Equal(t, "brief", res[0].Parts[0].Text)
+
+	paired := []model.Message{
+		{Role: "assistant", Parts: []model.Part{{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "a", "arguments": "{}"}}}},
+		{Role: "user", Parts: []model.Part{{Type: "text", Text: "x"}}},
+		{Role: "user", Meta: protectedMeta, Parts: []model.Part{{Type: "tool-result", Text: "r", Meta: map[string]interface{}{"tool_call_id": "call_1"}}}},
+	}
+	res2, err := (&MiddleOutStrategy{TokenReduceTo: 1}).Apply(paired)
+	require.NoError(t, err)
+	require.Len(t, res2, 2)
+	require.Equal(t, "tool-call", res2[0].Parts[0].Type)
+	require.Equal(t, "tool-result", res2[1].Parts[0].Type)
+}
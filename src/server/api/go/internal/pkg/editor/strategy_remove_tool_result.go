@@ -21,7 +21,7 @@ func (s *RemoveToolResultStrategy) Name() string {
 
 // Apply replaces old tool-result parts' text with a placeholder
 // Keeps the most recent N tool-result parts with their original content
-// Also keeps tool results for tools listed in KeepTools
+// Also keeps tool results for tools listed in KeepTools and in protected messages
 func (s *RemoveToolResultStrategy) Apply(messages []model.Message) ([]model.Message, error) {
 	if s.KeepRecentN < 0 {
 		return nil, fmt.Errorf("keep_recent_n_tool_results must be >= 0, got %d", s.KeepRecentN)
@@ -47,6 +47,9 @@ func (s *RemoveToolResultStrategy) Apply(messages []model.Message) ([]model.Mess
 		}
 	}
 
+	// Tool results of protected messages are always kept
+	protected := protectedIndices(messages)
+
 	// Collect all tool-result parts with their positions, excluding those in KeepTools
 	type toolResultPosition struct {
 		messageIdx int
@@ -55,6 +58,9 @@ func (s *RemoveToolResultStrategy) Apply(messages []model.Message) ([]model.Mess
 	var toolResultPositions []toolResultPosition
 
 	for msgIdx, msg := range messages {
+		if protected[msgIdx] {
+			continue
+		}
 		for partIdx, part := range msg.Parts {
 			if part.Type == "tool-result" {
 				// Check if this tool result should be kept based on KeepTools
@@ -6,6 +6,7 @@ import (
 	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
 )
 
 func TestRemoveToolResultStrategy_Apply(t *testing.T) {
@@ -571,3 +572,41 @@ func TestCreateRemoveToolResultStrategy(t *testing.T) {
 		assert.Empty(t, rtr.KeepTools)
 	})
 }
+
+func TestRemoveToolResultStrategy_ProtectedMessages(t *testing.T) {
+	messages := []model.Message{
+		{
+			Role: "assistant",
+			Parts: []model.Part{
+				{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "read_spec"}},
+			},
+		},
+		{
+			Role: "user",
+			Meta: datatypes.NewJSONType(map[string]any{model.MessageProtectedKey: true}),
+			Parts: []model.Part{
+				{Type: "tool-result", Text: "The spec", Meta: map[string]interface{}{"tool_call_id": "call_1"}},
+			},
+		},
+		{
+			Role: "user",
+			Parts: []model.Part{
+				{Type: "tool-result", Text: "Old result", Meta: map[string]interface{}{"tool_call_id": "call_2"}},
+			},
+		},
+		{
+			Role: "user",
+			Parts: []model.Part{
+				{Type: "tool-result", Text: "Recent result", Meta: map[string]interface{}{"tool_call_id": "call_3"}},
+			},
+		},
+	}
+
+	strategy := &RemoveToolResultStrategy{KeepRecentN: 1, Placeholder: "Done"}
+	result, err := strategy.Apply(messages)
+
+	require.NoError(t, err)
+	assert.Equal(t, "The spec", result[1].Parts[0].Text)
+	assert.Equal(t, "Done", result[2].Parts[0].Text)
+	assert.Equal(t, "Recent result", result[3].Parts[0].Text)
+}
@@ -19,7 +19,7 @@ func (s *TokenLimitStrategy) Name() string {
 }
 
 // Apply removes oldest messages until total token count is within the limit
-// Maintains tool-call/tool-result pairing
+// Maintains tool-call/tool-result pairing and never removes protected messages
 func (s *TokenLimitStrategy) Apply(messages []model.Message) ([]model.Message, error) {
 	if s.LimitTokens <= 0 {
 		return nil, fmt.Errorf("limit_tokens must be > 0, got %d", s.LimitTokens)
@@ -55,13 +55,16 @@ func (s *TokenLimitStrategy) Apply(messages []model.Message) ([]model.Message, e
 		}
 	}
 
+	// Protected messages (and their tool pairs) are never removed
+	protected := protectedIndices(messages)
+
 	// Mark messages to remove, starting from the oldest
 	toRemove := make(map[int]bool)
 
 	// Remove messages one by one until we're within the limit
 	for i := 0; i < len(messages) && totalTokens > s.LimitTokens; i++ {
-		if toRemove[i] {
-			continue // Already marked for removal
+		if toRemove[i] || protected[i] {
+			continue // Already marked for removal or protected
 		}
 
 		// Count tokens for this message
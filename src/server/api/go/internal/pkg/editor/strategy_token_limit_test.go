@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
+	"gorm.io/datatypes"
 )
 
 // initTokenizer is a helper to initialize the tokenizer for tests
@@ -589,3 +590,57 @@ func TestTokenLimitStrategy_ToolCallPairing(t *testing.T) {
 		assert.Less(t, len(result), len(messages), "some messages should be removed")
 	})
 }
+
+func TestTokenLimitStrategy_ProtectedMessages(t *testing.T) {
+	initTokenizer(t)
+
+	protectedMeta := datatypes.NewJSONType(map[string]any{model.MessageProtectedKey: true})
+
+	t.Run("protected task brief is never removed", func(t *testing.T) {
+		messages := []model.Message{
+			{Role: "user", Meta: protectedMeta, Parts: []model.Part{{Type: "text", Text: "Task: refactor the billing module"}}},
+			{Role: "assistant", Parts: []model.Part{{Type: "text", Text: "Starting with the invoice service."}}},
+			{Role: "user", Parts: []model.Part{{Type: "text", Text: "Sounds good."}}},
+			{Role: "assistant", Parts: []model.Part{{Type: "text", Text: "Done."}}},
+		}
+
+		strategy := &TokenLimitStrategy{LimitTokens: 1}
+		result, err := strategy.Apply(messages)
+
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+		assert.Equal(t, "Task: refactor the billing module", result[0].Parts[0].Text)
+	})
+
+	t.Run("tool pair of a protected message is kept", func(t *testing.T) {
+		messages := []model.Message{
+			{Role: "assistant", Meta: protectedMeta, Parts: []model.Part{
+				{Type: "tool-call", Meta: map[string]interface{}{"id": "call_1", "name": "read_spec"}},
+			}},
+			{Role: "user", Parts: []model.Part{
+				{Type: "tool-result", Text: "The spec says...", Meta: map[string]interface{}{"tool_call_id": "call_1"}},
+			}},
+			{Role: "assistant", Parts: []model.Part{
+				{Type: "tool-call", Meta: map[string]interface{}{"id": "call_2", "name": "search"}},
+			}},
+			{Role: "user", Parts: []model.Part{
+				{Type: "tool-result", Text: "Nothing found", Meta: map[string]interface{}{"tool_call_id": "call_2"}},
+			}},
+			{Role: "assistant", Parts: []model.Part{{Type: "text", Text: "Latest answer"}}},
+		}
+
+		lastTokens, err := tokenizer.CountSingleMessageTokens(context.Background(), messages[4])
+		require.NoError(t, err)
+		pairTokens, err := tokenizer.CountMessagePartsTokens(context.Background(), messages[:2])
+		require.NoError(t, err)
+
+		strategy := &TokenLimitStrategy{LimitTokens: pairTokens + lastTokens}
+		result, err := strategy.Apply(messages)
+
+		require.NoError(t, err)
+		require.Len(t, result, 3)
+		assert.Equal(t, "call_1", result[0].Parts[0].Meta["id"])
+		assert.Equal(t, "call_1", result[1].Parts[0].Meta["tool_call_id"])
+		assert.Equal(t, "Latest answer", result[2].Parts[0].Text)
+	})
+}
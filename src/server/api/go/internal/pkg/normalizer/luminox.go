@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/modules/service"
 )
 
@@ -43,6 +44,13 @@ func (n *LuminoxNormalizer) NormalizeFromLuminoxMessage(messageJSON json.RawMess
 		messageMeta = make(map[string]interface{})
 	}
 
+	// The agent name is stored on the message itself and must be a string
+	if agentName, ok := messageMeta[model.MessageAgentNameKey]; ok {
+		if _, isString := agentName.(string); !isString {
+			return "", nil, nil, fmt.Errorf("invalid meta.%s: must be a string", model.MessageAgentNameKey)
+		}
+	}
+
 	// Ensure source_format is set
 	if _, hasSourceFormat := messageMeta["source_format"]; !hasSourceFormat {
 		messageMeta["source_format"] = "luminox"
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -221,3 +222,22 @@ func TestLuminoxNormalizer_MessageWithMeta(t *testing.T) {
 	assert.Equal(t, "Alice", messageMeta["name"])
 	assert.Equal(t, "custom_value", messageMeta["custom_field"])
 }
+
+func TestLuminoxNormalizer_AgentName(t *testing.T) {
+	normalizer := &LuminoxNormalizer{}
+
+	_, _, messageMeta, err := normalizer.NormalizeFromLuminoxMessage(json.RawMessage(`{
+		"role": "assistant",
+		"meta": {"agent_name": "critic"},
+		"parts": [{"type": "text", "text": "I disagree"}]
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "critic", messageMeta[model.MessageAgentNameKey])
+
+	_, _, _, err = normalizer.NormalizeFromLuminoxMessage(json.RawMessage(`{
+		"role": "assistant",
+		"meta": {"agent_name": 42},
+		"parts": [{"type": "text", "text": "I disagree"}]
+	}`))
+	assert.ErrorContains(t, err, "agent_name")
+}
@@ -7,6 +7,7 @@ import (
 	openai "github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/packages/param"
 
+	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/memodb-io/Luminox/internal/modules/service"
 )
 
@@ -69,6 +70,7 @@ func normalizeOpenAIUserMessage(msg openai.ChatCompletionUserMessageParam) (stri
 	// Extract name field if present
 	if !param.IsOmitted(msg.Name) {
 		messageMeta["name"] = msg.Name.Value
+		messageMeta[model.MessageAgentNameKey] = msg.Name.Value
 	}
 
 	return "user", parts, messageMeta, nil
@@ -130,6 +132,7 @@ func normalizeOpenAIAssistantMessage(msg openai.ChatCompletionAssistantMessagePa
 	// Extract name field if present
 	if !param.IsOmitted(msg.Name) {
 		messageMeta["name"] = msg.Name.Value
+		messageMeta[model.MessageAgentNameKey] = msg.Name.Value
 	}
 
 	return "assistant", parts, messageMeta, nil
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/memodb-io/Luminox/internal/modules/model"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -406,3 +407,18 @@ func TestOpenAINormalizer_MessageWithName(t *testing.T) {
 	assert.Equal(t, "openai", messageMeta["source_format"])
 	assert.Equal(t, "Alice", messageMeta["name"])
 }
+
+func TestOpenAINormalizer_NameIsAgentName(t *testing.T) {
+	normalizer := &OpenAINormalizer{}
+
+	role, _, messageMeta, err := normalizer.NormalizeFromOpenAIMessage(json.RawMessage(`{
+		"role": "assistant",
+		"name": "proponent",
+		"content": "Tabs are better"
+	}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "assistant", role)
+	assert.Equal(t, "proponent", messageMeta["name"])
+	assert.Equal(t, "proponent", messageMeta[model.MessageAgentNameKey])
+}
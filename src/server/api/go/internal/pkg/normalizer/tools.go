@@ -0,0 +1,167 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+)
+
+// NormalizeTools converts a provider tools array to provider-neutral tool definitions.
+// Tool parameters are kept as JSON Schema; Gemini's upper-case schema types are lowered.
+func NormalizeTools(format model.MessageFormat, toolsJSON json.RawMessage) ([]model.ToolDefinition, error) {
+	switch format {
+	case model.FormatOpenAI:
+		return normalizeOpenAITools(toolsJSON)
+	case model.FormatAnthropic:
+		return normalizeAnthropicTools(toolsJSON)
+	case model.FormatGemini:
+		return normalizeGeminiTools(toolsJSON)
+	default:
+		return nil, fmt.Errorf("unsupported tools format: %s (must be one of: openai, anthropic, gemini)", format)
+	}
+}
+
+func normalizeOpenAITools(toolsJSON json.RawMessage) ([]model.ToolDefinition, error) {
+	var tools []struct {
+		Type     string `json:"type"`
+		Function *struct {
+			Name        string         `json:"name"`
+			Description string         `json:"description"`
+			Parameters  map[string]any `json:"parameters"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(toolsJSON, &tools); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal OpenAI tools: %w", err)
+	}
+
+	defs := make([]model.ToolDefinition, 0, len(tools))
+	for i, tool := range tools {
+		if tool.Type != "" && tool.Type != "function" {
+			return nil, fmt.Errorf("tools[%d]: unsupported OpenAI tool type %q (only function tools are supported)", i, tool.Type)
+		}
+		if tool.Function == nil {
+			return nil, fmt.Errorf("tools[%d]: function is required", i)
+		}
+		defs = append(defs, model.ToolDefinition{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	return defs, nil
+}
+
+func normalizeAnthropicTools(toolsJSON json.RawMessage) ([]model.ToolDefinition, error) {
+	var tools []struct {
+		Type        string         `json:"type"`
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		InputSchema map[string]any `json:"input_schema"`
+	}
+	if err := json.Unmarshal(toolsJSON, &tools); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Anthropic tools: %w", err)
+	}
+
+	defs := make([]model.ToolDefinition, 0, len(tools))
+	for i, tool := range tools {
+		// Server tools (bash, web_search, ...) have a versioned type and no input schema
+		if tool.Type != "" && tool.Type != "custom" {
+			return nil, fmt.Errorf("tools[%d]: unsupported Anthropic tool type %q (only custom tools are supported)", i, tool.Type)
+		}
+		if tool.InputSchema == nil {
+			return nil, fmt.Errorf("tools[%d]: input_schema is required", i)
+		}
+		defs = append(defs, model.ToolDefinition{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.InputSchema,
+		})
+	}
+	return defs, nil
+}
+
+type geminiFunctionDeclaration struct {
+	Name                 string         `json:"name"`
+	Description          string         `json:"description"`
+	Parameters           map[string]any `json:"parameters"`
+	ParametersJSONSchema map[string]any `json:"parametersJsonSchema"`
+}
+
+// normalizeGeminiTools accepts an array of Gemini Tool objects holding
+// functionDeclarations, or a bare array of function declarations
+func normalizeGeminiTools(toolsJSON json.RawMessage) ([]model.ToolDefinition, error) {
+	var tools []struct {
+		FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+		geminiFunctionDeclaration
+	}
+	if err := json.Unmarshal(toolsJSON, &tools); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Gemini tools: %w", err)
+	}
+
+	defs := []model.ToolDefinition{}
+	for i, tool := range tools {
+		decls := tool.FunctionDeclarations
+		if len(decls) == 0 {
+			if tool.Name == "" {
+				return nil, fmt.Errorf("tools[%d]: functionDeclarations is required (only function tools are supported)", i)
+			}
+			decls = []geminiFunctionDeclaration{tool.geminiFunctionDeclaration}
+		}
+		for _, decl := range decls {
+			params := decl.ParametersJSONSchema
+			if params == nil && decl.Parameters != nil {
+				params = lowerGeminiSchemaTypes(decl.Parameters)
+			}
+			defs = append(defs, model.ToolDefinition{
+				Name:        decl.Name,
+				Description: decl.Description,
+				Parameters:  params,
+			})
+		}
+	}
+	return defs, nil
+}
+
+// lowerGeminiSchemaTypes turns a Gemini OpenAPI schema ("type": "OBJECT") into
+// JSON Schema ("type": "object")
+func lowerGeminiSchemaTypes(schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		switch val := v.(type) {
+		case string:
+			if k == "type" {
+				val = strings.ToLower(val)
+			}
+			out[k] = val
+		case map[string]any:
+			if k == "properties" {
+				props := make(map[string]any, len(val))
+				for name, prop := range val {
+					if p, ok := prop.(map[string]any); ok {
+						props[name] = lowerGeminiSchemaTypes(p)
+					} else {
+						props[name] = prop
+					}
+				}
+				out[k] = props
+			} else {
+				out[k] = lowerGeminiSchemaTypes(val)
+			}
+		case []any:
+			items := make([]any, len(val))
+			for i, item := range val {
+				if m, ok := item.(map[string]any); ok {
+					items[i] = lowerGeminiSchemaTypes(m)
+				} else {
+					items[i] = item
+				}
+			}
+			out[k] = items
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
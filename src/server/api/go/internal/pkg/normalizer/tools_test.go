@@ -0,0 +1,101 @@
+package normalizer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/memodb-io/Luminox/internal/modules/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTools(t *testing.T) {
+	weather := model.ToolDefinition{
+		Name:        "get_weather",
+		Description: "Get the weather of a city",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"city": map[string]any{"type": "string"}},
+			"required":   []any{"city"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		format      model.MessageFormat
+		input       string
+		want        []model.ToolDefinition
+		errContains string
+	}{
+		{
+			name:   "openai function tools",
+			format: model.FormatOpenAI,
+			input: `[{"type": "function", "function": {"name": "get_weather", "description": "Get the weather of a city",
+				"parameters": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}}]`,
+			want: []model.ToolDefinition{weather},
+		},
+		{
+			name:        "openai custom tool",
+			format:      model.FormatOpenAI,
+			input:       `[{"type": "custom", "custom": {"name": "grammar"}}]`,
+			errContains: "only function tools are supported",
+		},
+		{
+			name:   "anthropic custom tools",
+			format: model.FormatAnthropic,
+			input: `[{"name": "get_weather", "description": "Get the weather of a city",
+				"input_schema": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}]`,
+			want: []model.ToolDefinition{weather},
+		},
+		{
+			name:        "anthropic tool without schema",
+			format:      model.FormatAnthropic,
+			input:       `[{"name": "get_weather"}]`,
+			errContains: "input_schema is required",
+		},
+		{
+			name:   "gemini tool with OpenAPI schema",
+			format: model.FormatGemini,
+			input: `[{"functionDeclarations": [{"name": "get_weather", "description": "Get the weather of a city",
+				"parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING"}}, "required": ["city"]}}]}]`,
+			want: []model.ToolDefinition{weather},
+		},
+		{
+			name:   "gemini bare declarations with JSON schema",
+			format: model.FormatGemini,
+			input: `[{"name": "get_weather", "description": "Get the weather of a city",
+				"parametersJsonSchema": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}]`,
+			want: []model.ToolDefinition{weather},
+		},
+		{
+			name:        "gemini non-function tool",
+			format:      model.FormatGemini,
+			input:       `[{"googleSearch": {}}]`,
+			errContains: "functionDeclarations is required",
+		},
+		{
+			name:        "luminox format",
+			format:      model.FormatLuminox,
+			input:       `[]`,
+			errContains: "unsupported tools format",
+		},
+		{
+			name:        "not an array",
+			format:      model.FormatOpenAI,
+			input:       `{"type": "function"}`,
+			errContains: "failed to unmarshal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTools(tt.format, json.RawMessage(tt.input))
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
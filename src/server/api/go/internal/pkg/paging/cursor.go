@@ -38,3 +38,50 @@ func DecodeCursor(s string) (time.Time, uuid.UUID, error) {
 	}
 	return time.Unix(0, ns).UTC(), id, nil
 }
+
+// EncodeSeqCursor encodes a cursor for rows ordered by (seq, created_at, id)
+func EncodeSeqCursor(seq int64, t time.Time, id uuid.UUID) string {
+	raw := fmt.Sprintf("%d|%d|%s", seq, t.UTC().UnixNano(), id.String())
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// LegacySeq is the seq DecodeSeqCursor returns for a (created_at, id) cursor
+// issued by EncodeCursor before rows had a seq. Callers page such cursors by
+// (created_at, id) instead.
+const LegacySeq int64 = -1
+
+// DecodeSeqCursor decodes a cursor from EncodeSeqCursor, or an older cursor
+// from EncodeCursor with seq LegacySeq
+func DecodeSeqCursor(s string) (int64, time.Time, uuid.UUID, error) {
+	if s == "" {
+		return 0, time.Time{}, uuid.Nil, errors.New("empty cursor")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) == 2 {
+		t, id, err := DecodeCursor(s)
+		if err != nil {
+			return 0, time.Time{}, uuid.Nil, err
+		}
+		return LegacySeq, t, id, nil
+	}
+	if len(parts) != 3 {
+		return 0, time.Time{}, uuid.Nil, errors.New("bad cursor")
+	}
+	seq, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+	ns, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+	id, err := uuid.Parse(parts[2])
+	if err != nil {
+		return 0, time.Time{}, uuid.Nil, err
+	}
+	return seq, time.Unix(0, ns).UTC(), id, nil
+}
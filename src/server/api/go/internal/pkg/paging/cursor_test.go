@@ -236,3 +236,42 @@ func TestCursor_URLSafe(t *testing.T) {
 		assert.NotContains(t, cursor, "=") // RawURLEncoding does not include padding characters
 	})
 }
+
+func TestSeqCursor(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		ts := time.Date(2024, 3, 15, 10, 30, 45, 123456789, time.UTC)
+		id := uuid.MustParse("f47ac10b-58cc-4372-a567-0e02b2c3d479")
+
+		cursor := EncodeSeqCursor(42, ts, id)
+		seq, decodedTime, decodedID, err := DecodeSeqCursor(cursor)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(42), seq)
+		assert.Equal(t, ts.UnixNano(), decodedTime.UnixNano())
+		assert.Equal(t, id, decodedID)
+	})
+
+	t.Run("accepts legacy time cursor", func(t *testing.T) {
+		ts := time.Date(2024, 3, 15, 10, 30, 45, 123456789, time.UTC)
+		id := uuid.New()
+
+		seq, decodedTime, decodedID, err := DecodeSeqCursor(EncodeCursor(ts, id))
+
+		assert.NoError(t, err)
+		assert.Equal(t, LegacySeq, seq)
+		assert.Equal(t, ts.UnixNano(), decodedTime.UnixNano())
+		assert.Equal(t, id, decodedID)
+	})
+
+	t.Run("malformed cursor", func(t *testing.T) {
+		_, _, _, err := DecodeSeqCursor("MTcwNDE3NjQwMDAwMDAwMDAwMHNvbWV0aGluZw")
+
+		assert.ErrorContains(t, err, "bad cursor")
+	})
+
+	t.Run("empty cursor", func(t *testing.T) {
+		_, _, _, err := DecodeSeqCursor("")
+
+		assert.ErrorContains(t, err, "empty cursor")
+	})
+}
@@ -0,0 +1,174 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrBadPatch is returned when a patch is not a well-formed unified diff
+	ErrBadPatch = errors.New("malformed patch")
+	// ErrPatchMismatch is returned when a hunk does not match the text it is applied to
+	ErrPatchMismatch = errors.New("patch does not apply")
+)
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+
+// patchHunk is one hunk of a unified diff. old holds the context and removed
+// lines, new the context and added lines, both with their trailing newline.
+type patchHunk struct {
+	pos      int
+	old, new []string
+}
+
+// Apply applies a unified diff, as produced by Unified or `diff -u`, to text.
+// File headers are optional. Each hunk is matched at the position its header
+// states first and otherwise at the nearest position where its context and
+// removed lines appear, so patches written against a slightly different
+// revision still apply.
+func Apply(text, patch string) (string, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+
+	lines := splitLines(text)
+	var out []string
+	done, shift := 0, 0
+	for i, h := range hunks {
+		at := findHunk(lines, h.old, h.pos+shift, done)
+		if at < 0 {
+			return "", fmt.Errorf("%w: hunk %d does not match", ErrPatchMismatch, i+1)
+		}
+		out = append(out, lines[done:at]...)
+		out = append(out, h.new...)
+		shift = at - h.pos
+		done = at + len(h.old)
+	}
+	out = append(out, lines[done:]...)
+	return strings.Join(out, ""), nil
+}
+
+func parsePatch(patch string) ([]patchHunk, error) {
+	var hunks []patchHunk
+	var cur *patchHunk
+	// lastOld and lastNew note whether the previous body line went to old or new,
+	// for the "\ No newline at end of file" marker
+	lastOld, lastNew := false, false
+
+	lines := splitLines(patch)
+	for i, line := range lines {
+		if m := hunkHeader.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			length := 1
+			if m[2] != "" {
+				length, _ = strconv.Atoi(m[2])
+			}
+			// An empty range counts the lines before it, otherwise the first line
+			pos := start - 1
+			if length == 0 {
+				pos = start
+			}
+			if pos < 0 {
+				pos = 0
+			}
+			hunks = append(hunks, patchHunk{pos: pos})
+			cur = &hunks[len(hunks)-1]
+			lastOld, lastNew = false, false
+			continue
+		}
+
+		if cur == nil || isFileHeader(lines, i) {
+			// File headers and anything else before the first hunk
+			cur = nil
+			continue
+		}
+
+		body := strings.TrimSuffix(line, "\n")
+		if body == "" {
+			// Editors often strip the leading space of empty context lines
+			body = " "
+		}
+		content := body[1:] + "\n"
+		switch body[0] {
+		case ' ':
+			cur.old = append(cur.old, content)
+			cur.new = append(cur.new, content)
+			lastOld, lastNew = true, true
+		case '-':
+			cur.old = append(cur.old, content)
+			lastOld, lastNew = true, false
+		case '+':
+			cur.new = append(cur.new, content)
+			lastOld, lastNew = false, true
+		case '\\':
+			if lastOld {
+				trimLastNewline(cur.old)
+			}
+			if lastNew {
+				trimLastNewline(cur.new)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unexpected line %d: %q", ErrBadPatch, i+1, body)
+		}
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("%w: no hunks", ErrBadPatch)
+	}
+	return hunks, nil
+}
+
+// isFileHeader reports whether lines[i] starts a "--- a\n+++ b" file header
+// rather than a removed line beginning with "--"
+func isFileHeader(lines []string, i int) bool {
+	if strings.HasPrefix(lines[i], "diff ") || strings.HasPrefix(lines[i], "index ") {
+		return true
+	}
+	if strings.HasPrefix(lines[i], "--- ") {
+		return i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+	}
+	if strings.HasPrefix(lines[i], "+++ ") {
+		return i > 0 && strings.HasPrefix(lines[i-1], "--- ")
+	}
+	return false
+}
+
+func trimLastNewline(lines []string) {
+	if n := len(lines); n > 0 {
+		lines[n-1] = strings.TrimSuffix(lines[n-1], "\n")
+	}
+}
+
+// findHunk returns the position nearest to want, but not before from, at which
+// old matches lines, or -1
+func findHunk(lines, old []string, want, from int) int {
+	last := len(lines) - len(old)
+	if want < from {
+		want = from
+	}
+	if want > last {
+		want = last
+	}
+	for d := 0; want-d >= from || want+d <= last; d++ {
+		if at := want - d; at >= from && at <= last && matchAt(lines, old, at) {
+			return at
+		}
+		if at := want + d; d > 0 && at >= from && at <= last && matchAt(lines, old, at) {
+			return at
+		}
+	}
+	return -1
+}
+
+func matchAt(lines, old []string, at int) bool {
+	for i, l := range old {
+		if lines[at+i] != l {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply_RoundTrip(t *testing.T) {
+	pairs := [][2]string{
+		{"a\nb\nc\nd\ne\n", "a\nb\nC\nd\ne\n"},
+		{"", "x\ny\n"},
+		{"x\n", ""},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "one\n2\n3\n4\n5\n6\n7\neight\n"},
+		{"a\nb", "a\nb\n"},
+		{"a\nb\n", "a\nb\nc"},
+	}
+
+	for _, p := range pairs {
+		patch := Unified("v1", "v2", p[0], p[1], 1)
+		got, err := Apply(p[0], patch)
+		require.NoError(t, err, patch)
+		assert.Equal(t, p[1], got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		patch    string
+		expected string
+		wantErr  error
+	}{
+		{
+			name:     "without file headers",
+			text:     "a\nb\nc\n",
+			patch:    "@@ -2 +2 @@\n-b\n+B\n",
+			expected: "a\nB\nc\n",
+		},
+		{
+			name:     "hunk found at an offset",
+			text:     "new\nlines\na\nb\nc\n",
+			patch:    "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			expected: "new\nlines\na\nB\nc\n",
+		},
+		{
+			name:     "later hunks follow the offset of earlier ones",
+			text:     "x\n1\n2\n3\n1\n2\n3\n",
+			patch:    "@@ -1,2 +1,2 @@\n 1\n-2\n+two\n@@ -4,2 +4,2 @@\n 1\n-2\n+TWO\n",
+			expected: "x\n1\ntwo\n3\n1\nTWO\n3\n",
+		},
+		{
+			name:     "empty context line without leading space",
+			text:     "a\n\nb\n",
+			patch:    "@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			expected: "a\n\nc\n",
+		},
+		{
+			name:     "removed line starting with dashes",
+			text:     "---\ntitle\n",
+			patch:    "@@ -1,2 +1,2 @@\n----\n+===\n title\n",
+			expected: "===\ntitle\n",
+		},
+		{
+			name:    "context does not match",
+			text:    "a\nb\nc\n",
+			patch:   "@@ -1,2 +1,2 @@\n a\n-x\n+y\n",
+			wantErr: ErrPatchMismatch,
+		},
+		{
+			name:    "no hunks",
+			text:    "a\n",
+			patch:   "--- a/f\n+++ b/f\n",
+			wantErr: ErrBadPatch,
+		},
+		{
+			name:    "garbage in hunk",
+			text:    "a\n",
+			patch:   "@@ -1 +1 @@\n-a\n+b\n*c\n",
+			wantErr: ErrBadPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.text, tt.patch)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// edit is one step of a line edit script. a indexes the old lines for equal
+// and delete steps, b indexes the new lines for equal and insert steps.
+type edit struct {
+	kind opKind
+	a, b int
+}
+
+// Unified returns the unified diff between two texts with the given number of
+// context lines, in the format produced by `diff -u`. It returns an empty string
+// when the texts are equal.
+func Unified(fromName, toName, from, to string, context int) string {
+	if from == to {
+		return ""
+	}
+	if context < 0 {
+		context = 0
+	}
+
+	a, b := splitLines(from), splitLines(to)
+	edits := lineEdits(a, b)
+
+	// posA[i] and posB[i] count the old and new lines consumed before edits[i]
+	posA := make([]int, len(edits)+1)
+	posB := make([]int, len(edits)+1)
+	for i, e := range edits {
+		posA[i+1], posB[i+1] = posA[i], posB[i]
+		if e.kind != opInsert {
+			posA[i+1]++
+		}
+		if e.kind != opDelete {
+			posB[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks(edits, context) {
+		start, end := h[0], h[1]
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(posA[start], posA[end]-posA[start]),
+			hunkRange(posB[start], posB[end]-posB[start]))
+		for _, e := range edits[start:end] {
+			switch e.kind {
+			case opEqual:
+				writeLine(&out, ' ', a[e.a])
+			case opDelete:
+				writeLine(&out, '-', a[e.a])
+			case opInsert:
+				writeLine(&out, '+', b[e.b])
+			}
+		}
+	}
+	return out.String()
+}
+
+// splitLines splits s into lines that keep their trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineEdits computes a shortest edit script from a to b with the linear space
+// refinement of Myers' algorithm: the middle snake of an optimal path splits
+// the problem in two halves, which are solved in turn. Only the two frontiers
+// of the current round are kept, so memory stays linear in the input size.
+func lineEdits(a, b []string) []edit {
+	size := (len(a)+len(b)+1)/2 + 1
+	d := &differ{
+		a:     a,
+		b:     b,
+		fwd:   make([]int, 2*size+1),
+		bwd:   make([]int, 2*size+1),
+		off:   size,
+		edits: make([]edit, 0, len(a)+len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return d.edits
+}
+
+// differ holds the state of lineEdits. fwd and bwd hold the furthest x per
+// diagonal of the forward and backward searches, indexed by diagonal + off.
+type differ struct {
+	a, b     []string
+	fwd, bwd []int
+	off      int
+	edits    []edit
+}
+
+// compare appends the edits turning a[a0:a1] into b[b0:b1]
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.edits = append(d.edits, edit{kind: opEqual, a: a0, b: b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a1-suffix > a0 && b1-suffix > b0 && d.a[a1-suffix-1] == d.b[b1-suffix-1] {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+
+	switch {
+	case a0 == a1:
+		for y := b0; y < b1; y++ {
+			d.edits = append(d.edits, edit{kind: opInsert, a: a0, b: y})
+		}
+	case b0 == b1:
+		for x := a0; x < a1; x++ {
+			d.edits = append(d.edits, edit{kind: opDelete, a: x, b: b0})
+		}
+	default:
+		// Both ends differ, so each half is at least one edit shorter
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.edits = append(d.edits, edit{kind: opEqual, a: x, b: y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for i := 0; i < suffix; i++ {
+		d.edits = append(d.edits, edit{kind: opEqual, a: a1 + i, b: b1 + i})
+	}
+}
+
+// middleSnake runs the forward and backward searches over a[a0:a1] and
+// b[b0:b1] until they overlap, and returns the snake where they met as the
+// range from (x, y) to (u, v)
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	d.fwd[d.off+1], d.bwd[d.off+1] = 0, 0
+
+	for depth := 0; depth <= (n+m+1)/2; depth++ {
+		for k := -depth; k <= depth; k += 2 {
+			var px int
+			if k == -depth || (k != depth && d.fwd[d.off+k-1] < d.fwd[d.off+k+1]) {
+				px = d.fwd[d.off+k+1]
+			} else {
+				px = d.fwd[d.off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.a[a0+px] == d.b[b0+py] {
+				px++
+				py++
+			}
+			d.fwd[d.off+k] = px
+			// The backward search of the previous round covers diagonals within depth-1
+			if kb := delta - k; odd && kb >= -(depth-1) && kb <= depth-1 && px+d.bwd[d.off+kb] >= n {
+				return a0 + sx, b0 + sy, a0 + px, b0 + py
+			}
+		}
+
+		// The backward search walks the reversed texts, where diagonal k maps to delta-k
+		for k := -depth; k <= depth; k += 2 {
+			var px int
+			if k == -depth || (k != depth && d.bwd[d.off+k-1] < d.bwd[d.off+k+1]) {
+				px = d.bwd[d.off+k+1]
+			} else {
+				px = d.bwd[d.off+k-1] + 1
+			}
+			py := px - k
+			sx, sy := px, py
+			for px < n && py < m && d.a[a1-1-px] == d.b[b1-1-py] {
+				px++
+				py++
+			}
+			d.bwd[d.off+k] = px
+			if kf := delta - k; !odd && kf >= -depth && kf <= depth && px+d.fwd[d.off+kf] >= n {
+				return a1 - px, b1 - py, a1 - sx, b1 - sy
+			}
+		}
+	}
+	panic("diff: searches did not meet")
+}
+
+// hunks groups changes into [start, end) ranges of edits, each padded with up
+// to context equal lines. Changes separated by at most 2*context equal lines
+// share a hunk.
+func hunks(edits []edit, context int) [][2]int {
+	var result [][2]int
+	i := 0
+	for i < len(edits) {
+		if edits[i].kind == opEqual {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		j := i
+		end := len(edits)
+		for {
+			for j < len(edits) && edits[j].kind != opEqual {
+				j++
+			}
+			e := j
+			for e < len(edits) && edits[e].kind == opEqual {
+				e++
+			}
+			if e == len(edits) || e-j > 2*context {
+				if j+context < end {
+					end = j + context
+				}
+				break
+			}
+			j = e
+		}
+
+		result = append(result, [2]int{start, end})
+		i = end
+	}
+	return result
+}
+
+// hunkRange formats a hunk line range, where start counts the lines before it
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
+
+func writeLine(out *strings.Builder, prefix byte, line string) {
+	out.WriteByte(prefix)
+	out.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		out.WriteString("\n\\ No newline at end of file\n")
+	}
+}
@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		context  int
+		expected string
+	}{
+		{
+			name:     "equal texts",
+			from:     "a\nb\n",
+			to:       "a\nb\n",
+			context:  3,
+			expected: "",
+		},
+		{
+			name:    "changed line with context",
+			from:    "a\nb\nc\nd\ne\n",
+			to:      "a\nb\nC\nd\ne\n",
+			context: 1,
+			expected: "--- v1\n+++ v2\n" +
+				"@@ -2,3 +2,3 @@\n" +
+				" b\n-c\n+C\n d\n",
+		},
+		{
+			name:    "insert into empty file",
+			from:    "",
+			to:      "x\ny\n",
+			context: 3,
+			expected: "--- v1\n+++ v2\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+x\n+y\n",
+		},
+		{
+			name:    "delete everything",
+			from:    "x\n",
+			to:      "",
+			context: 3,
+			expected: "--- v1\n+++ v2\n" +
+				"@@ -1 +0,0 @@\n" +
+				"-x\n",
+		},
+		{
+			name:    "distant changes make separate hunks",
+			from:    "1\n2\n3\n4\n5\n6\n7\n8\n",
+			to:      "one\n2\n3\n4\n5\n6\n7\neight\n",
+			context: 1,
+			expected: "--- v1\n+++ v2\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				"-1\n+one\n 2\n" +
+				"@@ -7,2 +7,2 @@\n" +
+				" 7\n-8\n+eight\n",
+		},
+		{
+			name:    "close changes share a hunk",
+			from:    "1\n2\n3\n4\n",
+			to:      "one\n2\n3\nfour\n",
+			context: 1,
+			expected: "--- v1\n+++ v2\n" +
+				"@@ -1,4 +1,4 @@\n" +
+				"-1\n+one\n 2\n 3\n-4\n+four\n",
+		},
+		{
+			name:    "missing newline at end of file",
+			from:    "a\nb",
+			to:      "a\nb\n",
+			context: 3,
+			expected: "--- v1\n+++ v2\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Unified("v1", "v2", tt.from, tt.to, tt.context))
+		})
+	}
+}
+
+func TestLineEdits(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(3)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		edits := lineEdits(a, b)
+
+		// Replaying the script consumes a in order, yields b, and keeps as many
+		// lines as a longest common subsequence
+		got := []string{}
+		next, kept := 0, 0
+		for _, e := range edits {
+			switch e.kind {
+			case opEqual:
+				assert.Equal(t, next, e.a)
+				assert.Equal(t, a[e.a], b[e.b])
+				got = append(got, a[e.a])
+				next++
+				kept++
+			case opDelete:
+				assert.Equal(t, next, e.a)
+				next++
+			case opInsert:
+				got = append(got, b[e.b])
+			}
+		}
+		assert.Equal(t, len(a), next)
+		assert.Equal(t, b, got, "a=%q b=%q", a, b)
+		assert.Equal(t, lcsLength(a, b), kept, "a=%q b=%q", a, b)
+		assert.Len(t, edits, len(a)+len(b)-kept)
+	}
+}
+
+func lcsLength(a, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else {
+				dp[i][j] = max(dp[i+1][j], dp[i][j+1])
+			}
+		}
+	}
+	return dp[0][0]
+}
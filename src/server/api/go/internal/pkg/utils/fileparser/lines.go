@@ -0,0 +1,44 @@
+package fileparser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SliceLines returns the lines of raw that follow the first offset lines, at
+// most limit of them (0 means no limit), together with the total number of
+// lines in raw. Line endings are kept, so the slice is an exact substring of
+// raw unless withNumbers is set, in which case every line is prefixed with
+// its 1-based line number and a tab.
+func SliceLines(raw string, offset, limit int, withNumbers bool) (string, int) {
+	if raw == "" {
+		return "", 0
+	}
+
+	lines := strings.SplitAfter(raw, "\n")
+	// A trailing newline terminates the last line rather than starting a new one
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	total := len(lines)
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		return "", total
+	}
+	end := total
+	if limit > 0 && offset+limit < total {
+		end = offset + limit
+	}
+
+	var b strings.Builder
+	for i, line := range lines[offset:end] {
+		if withNumbers {
+			fmt.Fprintf(&b, "%6d\t", offset+i+1)
+		}
+		b.WriteString(line)
+	}
+	return b.String(), total
+}
@@ -0,0 +1,81 @@
+package fileparser
+
+import (
+	"testing"
+)
+
+func TestSliceLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		offset      int
+		limit       int
+		withNumbers bool
+		expected    string
+		total       int
+	}{
+		{
+			name:     "empty content",
+			raw:      "",
+			expected: "",
+			total:    0,
+		},
+		{
+			name:     "whole file without limit",
+			raw:      "a\nb\nc\n",
+			expected: "a\nb\nc\n",
+			total:    3,
+		},
+		{
+			name:     "last line without newline",
+			raw:      "a\nb\nc",
+			offset:   1,
+			expected: "b\nc",
+			total:    3,
+		},
+		{
+			name:     "offset and limit",
+			raw:      "a\nb\nc\nd\n",
+			offset:   1,
+			limit:    2,
+			expected: "b\nc\n",
+			total:    4,
+		},
+		{
+			name:     "offset past end",
+			raw:      "a\nb\n",
+			offset:   5,
+			expected: "",
+			total:    2,
+		},
+		{
+			name:        "with line numbers",
+			raw:         "a\nb\nc\n",
+			offset:      1,
+			limit:       1,
+			withNumbers: true,
+			expected:    "     2\tb\n",
+			total:       3,
+		},
+		{
+			name:     "blank lines are counted",
+			raw:      "a\n\n\nb",
+			offset:   2,
+			limit:    1,
+			expected: "\n",
+			total:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := SliceLines(tt.raw, tt.offset, tt.limit, tt.withNumbers)
+			if got != tt.expected {
+				t.Errorf("SliceLines() = %q, want %q", got, tt.expected)
+			}
+			if total != tt.total {
+				t.Errorf("SliceLines() total = %d, want %d", total, tt.total)
+			}
+		})
+	}
+}
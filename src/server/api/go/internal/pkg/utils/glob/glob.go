@@ -0,0 +1,211 @@
+package glob
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrBadPattern is returned for malformed glob patterns
+var ErrBadPattern = errors.New("syntax error in glob pattern")
+
+// ToRegexp translates a glob pattern over slash-separated paths into an
+// anchored regular expression. The result only uses syntax shared by Go's
+// regexp package and PostgreSQL's advanced regular expressions, so it can be
+// evaluated by either.
+//
+// A '*' matches any run of characters within one path segment, and a '**'
+// that makes up a whole segment matches any number of directories. A '?'
+// matches any single character except '/'. Character classes such as [abc],
+// [a-z] and negated [!abc] or [^abc] never match '/'. Braces {a,b} match
+// either alternative; alternatives may contain glob syntax and nest. A
+// backslash matches the following character literally.
+func ToRegexp(pattern string) (string, error) {
+	t := translator{p: pattern}
+	re, err := t.sequence(0, true)
+	if err != nil {
+		return "", err
+	}
+	return "^" + re + "$", nil
+}
+
+// Base returns the leading directories of pattern that contain no glob syntax,
+// ending with '/', and whether every match lies directly inside them rather
+// than in a subdirectory. It returns "" when the first segment has glob syntax.
+func Base(pattern string) (dir string, exact bool) {
+	meta := strings.IndexAny(pattern, `*?[{\`)
+	if meta < 0 {
+		meta = len(pattern)
+	}
+	i := strings.LastIndex(pattern[:meta], "/")
+	rest := pattern[i+1:]
+	return pattern[:i+1], !strings.Contains(rest, "/") && !strings.Contains(rest, "**")
+}
+
+type translator struct {
+	p string
+	i int
+}
+
+// sequence translates the pattern up to its end or, inside braces, up to the
+// ',' or '}' that ends the current alternative. segStart reports whether the
+// translation starts at the beginning of a path segment.
+func (t *translator) sequence(depth int, segStart bool) (string, error) {
+	var b strings.Builder
+	for t.i < len(t.p) {
+		c := t.p[t.i]
+		switch {
+		case depth > 0 && (c == ',' || c == '}'):
+			return b.String(), nil
+		case c == '*' && segStart && t.isSegmentWildcard(depth):
+			if t.i+2 < len(t.p) && t.p[t.i+2] == '/' {
+				b.WriteString("(?:[^/]*/)*")
+				t.i += 3
+				continue
+			}
+			b.WriteString(".*")
+			t.i += 2
+		case c == '*':
+			for t.i < len(t.p) && t.p[t.i] == '*' {
+				t.i++
+			}
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+			t.i++
+		case c == '[':
+			class, err := t.class()
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(class)
+		case c == '{':
+			alts, err := t.braces(depth, segStart)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(alts)
+		case c == '\\':
+			if t.i+1 == len(t.p) {
+				return "", fmt.Errorf("%w: trailing backslash", ErrBadPattern)
+			}
+			t.i++
+			b.WriteString(regexp.QuoteMeta(t.nextRune()))
+		default:
+			b.WriteString(regexp.QuoteMeta(t.nextRune()))
+		}
+		segStart = c == '/'
+	}
+	if depth > 0 {
+		return "", fmt.Errorf("%w: missing '}'", ErrBadPattern)
+	}
+	return b.String(), nil
+}
+
+// isSegmentWildcard reports whether the pattern at t.i is a "**" that makes up
+// a whole path segment
+func (t *translator) isSegmentWildcard(depth int) bool {
+	if !strings.HasPrefix(t.p[t.i:], "**") {
+		return false
+	}
+	if t.i+2 == len(t.p) {
+		return true
+	}
+	next := t.p[t.i+2]
+	return next == '/' || (depth > 0 && (next == ',' || next == '}'))
+}
+
+// class translates a bracket expression. Classes never match '/', so the
+// pattern stays within one path segment.
+func (t *translator) class() (string, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+	t.i++
+	if t.i < len(t.p) && (t.p[t.i] == '!' || t.p[t.i] == '^') {
+		b.WriteString("^/")
+		t.i++
+	}
+
+	for first := true; ; first = false {
+		if t.i >= len(t.p) {
+			return "", fmt.Errorf("%w: missing ']'", ErrBadPattern)
+		}
+		if t.p[t.i] == ']' && !first {
+			t.i++
+			break
+		}
+
+		lo, err := t.classChar()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(quoteClassChar(lo))
+
+		if t.i+1 < len(t.p) && t.p[t.i] == '-' && t.p[t.i+1] != ']' {
+			t.i++
+			hi, err := t.classChar()
+			if err != nil {
+				return "", err
+			}
+			if hi < lo {
+				return "", fmt.Errorf("%w: invalid range %c-%c", ErrBadPattern, lo, hi)
+			}
+			b.WriteByte('-')
+			b.WriteString(quoteClassChar(hi))
+		}
+	}
+
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+// classChar reads one possibly escaped character of a bracket expression
+func (t *translator) classChar() (rune, error) {
+	if t.p[t.i] == '\\' {
+		t.i++
+		if t.i == len(t.p) {
+			return 0, fmt.Errorf("%w: missing ']'", ErrBadPattern)
+		}
+	}
+	r, size := utf8.DecodeRuneInString(t.p[t.i:])
+	if r == '/' {
+		return 0, fmt.Errorf("%w: '/' in character class", ErrBadPattern)
+	}
+	t.i += size
+	return r, nil
+}
+
+// braces translates a {a,b} alternation starting at t.i
+func (t *translator) braces(depth int, segStart bool) (string, error) {
+	var alts []string
+	for {
+		t.i++ // skip the '{' or ','
+		alt, err := t.sequence(depth+1, segStart)
+		if err != nil {
+			return "", err
+		}
+		alts = append(alts, alt)
+		if t.p[t.i] == '}' {
+			t.i++
+			return "(?:" + strings.Join(alts, "|") + ")", nil
+		}
+	}
+}
+
+func (t *translator) nextRune() string {
+	_, size := utf8.DecodeRuneInString(t.p[t.i:])
+	s := t.p[t.i : t.i+size]
+	t.i += size
+	return s
+}
+
+// quoteClassChar escapes the characters that are special inside a bracket
+// expression in either regex dialect
+func quoteClassChar(r rune) string {
+	if strings.ContainsRune(`\]^-[`, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
@@ -0,0 +1,127 @@
+package glob
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToRegexp_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		// * stays within one segment
+		{"/*.py", "/main.py", true},
+		{"/*.py", "/src/main.py", false},
+		{"/src/*.py", "/src/main.py", true},
+		{"/src/*.py", "/src/pkg/main.py", false},
+
+		// ** crosses directories, including none
+		{"/**/*.py", "/main.py", true},
+		{"/**/*.py", "/a/b/c/main.py", true},
+		{"/**/*.py", "/a/b/c/main.go", false},
+		{"/src/**", "/src/a/b.txt", true},
+		{"/src/**", "/srcx/a.txt", false},
+		{"/src/**/test/*.go", "/src/test/a.go", true},
+		{"/src/**/test/*.go", "/src/x/y/test/a.go", true},
+		{"/**", "/anything/at/all", true},
+
+		// ** inside a segment behaves like *
+		{"/a**.txt", "/abc.txt", true},
+		{"/a**.txt", "/a/b.txt", false},
+
+		// ? matches one character except '/'
+		{"/file?.txt", "/file1.txt", true},
+		{"/file?.txt", "/file10.txt", false},
+		{"/a?b", "/a/b", false},
+
+		// Character classes
+		{"/[ab].txt", "/a.txt", true},
+		{"/[ab].txt", "/c.txt", false},
+		{"/[!ab].txt", "/c.txt", true},
+		{"/[^ab].txt", "/a.txt", false},
+		{"/v[0-9].md", "/v7.md", true},
+		{"/v[0-9].md", "/vx.md", false},
+		{"/[]x].txt", "/].txt", true},
+		{"/[a-].txt", "/-.txt", true},
+		{`/[\]].txt`, "/].txt", true},
+
+		// Braces
+		{"/*.{py,go}", "/main.go", true},
+		{"/*.{py,go}", "/main.rs", false},
+		{"/{src,lib}/**/*.ts", "/lib/x/y.ts", true},
+		{"/{src,lib}/**/*.ts", "/test/y.ts", false},
+		{"/{a,b{c,d}}.txt", "/bd.txt", true},
+		{"/{a,b{c,d}}.txt", "/b.txt", false},
+		{"/x{,.bak}", "/x.bak", true},
+		{"/x{,.bak}", "/x", true},
+		{"/{**,docs}/README.md", "/a/b/README.md", true},
+
+		// Literal characters that are special to SQL LIKE or regex
+		{"/100%_done.txt", "/100%_done.txt", true},
+		{"/100%_done.txt", "/100x_done.txt", false},
+		{"/a_b.txt", "/axb.txt", false},
+		{"/a+b(1).txt", "/a+b(1).txt", true},
+		{"/a,b}.txt", "/a,b}.txt", true},
+
+		// Escapes
+		{`/\*.txt`, "/*.txt", true},
+		{`/\*.txt`, "/a.txt", false},
+		{`/\{a,b\}`, "/{a,b}", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.name, func(t *testing.T) {
+			expr, err := ToRegexp(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.match, regexp.MustCompile(expr).MatchString(tt.name), expr)
+		})
+	}
+}
+
+func TestToRegexp_Errors(t *testing.T) {
+	for _, pattern := range []string{
+		"/[abc",
+		"/{a,b",
+		"/{a,{b}",
+		`/foo\`,
+		"/[z-a]",
+		"/[a/b]",
+		"/[",
+	} {
+		t.Run(pattern, func(t *testing.T) {
+			_, err := ToRegexp(pattern)
+			assert.ErrorIs(t, err, ErrBadPattern)
+		})
+	}
+}
+
+func TestBase(t *testing.T) {
+	tests := []struct {
+		pattern string
+		dir     string
+		exact   bool
+	}{
+		{"/*.py", "/", true},
+		{"/**/*.py", "/", false},
+		{"/src/*.py", "/src/", true},
+		{"/src/pkg/**", "/src/pkg/", false},
+		{"/src/*/main.go", "/src/", false},
+		{"/src/{a,b/c}.go", "/src/", false},
+		{"/src/main.go", "/src/", true},
+		{`/src/\*.go`, "/src/", true},
+		{"*.py", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			dir, exact := Base(tt.pattern)
+			assert.Equal(t, tt.dir, dir)
+			assert.Equal(t, tt.exact, exact)
+		})
+	}
+}
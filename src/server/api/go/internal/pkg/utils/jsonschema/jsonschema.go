@@ -0,0 +1,281 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validate checks a decoded JSON value (as produced by encoding/json) against a
+// JSON Schema and returns one message per violation, prefixed with the JSON
+// path of the offending value. It supports the keywords tool argument schemas
+// use in practice: type, enum, const, properties, required,
+// additionalProperties, items, min/maxItems, min/maxLength, pattern,
+// minimum/maximum (and their exclusive forms), multipleOf, allOf, anyOf,
+// oneOf and not. Unknown keywords are ignored.
+func Validate(schema map[string]any, value any) []string {
+	var errs []string
+	validate(schema, value, "$", &errs)
+	return errs
+}
+
+func validate(schema map[string]any, value any, path string, errs *[]string) {
+	if schema == nil {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+": "+fmt.Sprintf(format, args...))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("expected %s, got %s", typeNames(t), jsonType(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value %s is not one of the allowed values", compact(value))
+		}
+	}
+	if c, ok := schema["const"]; ok && !jsonEqual(c, value) {
+		fail("value %s must be %s", compact(value), compact(c))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		validateObject(schema, v, path, errs)
+	case []any:
+		validateArray(schema, v, path, errs)
+	case string:
+		length := len([]rune(v))
+		if n, ok := number(schema["minLength"]); ok && float64(length) < n {
+			fail("length %d is shorter than %v", length, n)
+		}
+		if n, ok := number(schema["maxLength"]); ok && float64(length) > n {
+			fail("length %d is longer than %v", length, n)
+		}
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(v) {
+				fail("value %q does not match pattern %q", v, p)
+			}
+		}
+	case float64:
+		if n, ok := number(schema["minimum"]); ok && v < n {
+			fail("%v is less than the minimum %v", v, n)
+		}
+		if n, ok := number(schema["maximum"]); ok && v > n {
+			fail("%v is greater than the maximum %v", v, n)
+		}
+		if n, ok := number(schema["exclusiveMinimum"]); ok && v <= n {
+			fail("%v must be greater than %v", v, n)
+		}
+		if n, ok := number(schema["exclusiveMaximum"]); ok && v >= n {
+			fail("%v must be less than %v", v, n)
+		}
+		if n, ok := number(schema["multipleOf"]); ok && n > 0 {
+			if q := v / n; math.Abs(q-math.Round(q)) > 1e-9 {
+				fail("%v is not a multiple of %v", v, n)
+			}
+		}
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			if s, ok := sub.(map[string]any); ok {
+				validate(s, value, path, errs)
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && countMatches(anyOf, value, path) == 0 {
+		fail("value does not match any of the allowed schemas")
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		if n := countMatches(oneOf, value, path); n != 1 {
+			fail("value must match exactly one schema, matched %d", n)
+		}
+	}
+	if not, ok := schema["not"].(map[string]any); ok && len(Validate(not, value)) == 0 {
+		fail("value must not match the schema")
+	}
+}
+
+func validateObject(schema map[string]any, obj map[string]any, path string, errs *[]string) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := obj[name]; !present {
+					*errs = append(*errs, fmt.Sprintf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		childPath := path + "." + k
+		if prop, ok := properties[k]; ok {
+			if s, ok := prop.(map[string]any); ok {
+				validate(s, obj[k], childPath, errs)
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				*errs = append(*errs, fmt.Sprintf("%s: unexpected property %q", path, k))
+			}
+		case map[string]any:
+			validate(additional, obj[k], childPath, errs)
+		}
+	}
+}
+
+func validateArray(schema map[string]any, arr []any, path string, errs *[]string) {
+	if n, ok := number(schema["minItems"]); ok && float64(len(arr)) < n {
+		*errs = append(*errs, fmt.Sprintf("%s: %d items is fewer than %v", path, len(arr), n))
+	}
+	if n, ok := number(schema["maxItems"]); ok && float64(len(arr)) > n {
+		*errs = append(*errs, fmt.Sprintf("%s: %d items is more than %v", path, len(arr), n))
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range arr {
+			validate(items, item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+func countMatches(schemas []any, value any, path string) int {
+	n := 0
+	for _, sub := range schemas {
+		s, ok := sub.(map[string]any)
+		if !ok {
+			continue
+		}
+		var errs []string
+		validate(s, value, path, &errs)
+		if len(errs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func matchesType(t any, value any) bool {
+	switch tt := t.(type) {
+	case string:
+		return matchesTypeName(tt, value)
+	case []any:
+		for _, name := range tt {
+			if s, ok := name.(string); ok && matchesTypeName(s, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+func matchesTypeName(name string, value any) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	default:
+		return true
+	}
+}
+
+func typeNames(t any) string {
+	if list, ok := t.([]any); ok {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers by value
+func jsonEqual(a, b any) bool {
+	if fa, ok := number(a); ok {
+		fb, ok := number(b)
+		return ok && fa == fb
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compact(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,100 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	require.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	schema := decode(t, `{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "minLength": 2},
+			"unit": {"type": "string", "enum": ["celsius", "fahrenheit"]},
+			"days": {"type": "integer", "minimum": 1, "maximum": 14},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"at": {"anyOf": [{"type": "string"}, {"type": "null"}]}
+		},
+		"required": ["city"],
+		"additionalProperties": false
+	}`).(map[string]any)
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{
+			name:  "valid",
+			value: `{"city": "Paris", "unit": "celsius", "days": 3, "tags": ["a"], "at": null}`,
+			want:  nil,
+		},
+		{
+			name:  "missing required",
+			value: `{"unit": "celsius"}`,
+			want:  []string{`$: missing required property "city"`},
+		},
+		{
+			name:  "wrong types",
+			value: `{"city": 42, "days": 1.5}`,
+			want:  []string{"$.city: expected string, got number", "$.days: expected integer, got number"},
+		},
+		{
+			name:  "enum, range and length",
+			value: `{"city": "P", "unit": "kelvin", "days": 30}`,
+			want: []string{
+				"$.city: length 1 is shorter than 2",
+				"$.days: 30 is greater than the maximum 14",
+				`$.unit: value "kelvin" is not one of the allowed values`,
+			},
+		},
+		{
+			name:  "unexpected property and array items",
+			value: `{"city": "Paris", "country": "FR", "tags": ["a", 1, "c"]}`,
+			want: []string{
+				`$: unexpected property "country"`,
+				"$.tags: 3 items is more than 2",
+				"$.tags[1]: expected string, got number",
+			},
+		},
+		{
+			name:  "anyOf",
+			value: `{"city": "Paris", "at": 5}`,
+			want:  []string{"$.at: value does not match any of the allowed schemas"},
+		},
+		{
+			name:  "not an object",
+			value: `"Paris"`,
+			want:  []string{"$: expected object, got string"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Validate(schema, decode(t, tt.value)))
+		})
+	}
+}
+
+func TestValidate_Combinators(t *testing.T) {
+	schema := decode(t, `{
+		"oneOf": [{"type": "integer"}, {"type": "number", "multipleOf": 0.5}],
+		"not": {"const": 7}
+	}`).(map[string]any)
+
+	assert.Empty(t, Validate(schema, decode(t, `1.5`)))
+	assert.Equal(t, []string{"$: value must match exactly one schema, matched 2"}, Validate(schema, decode(t, `2`)))
+	assert.Equal(t, []string{"$: value must match exactly one schema, matched 0"}, Validate(schema, decode(t, `1.2`)))
+	assert.Contains(t, Validate(schema, decode(t, `7`)), "$: value must not match the schema")
+	assert.Empty(t, Validate(nil, decode(t, `{"anything": true}`)))
+}
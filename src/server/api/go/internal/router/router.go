@@ -25,6 +25,7 @@ type RouterDeps struct {
 	SessionHandler     *handler.SessionHandler
 	DiskHandler        *handler.DiskHandler
 	ArtifactHandler    *handler.ArtifactHandler
+	ShareHandler       *handler.ShareHandler
 	TaskHandler        *handler.TaskHandler
 	ToolHandler        *handler.ToolHandler
 	AgentSkillsHandler *handler.AgentSkillsHandler
@@ -56,6 +57,13 @@ func NewRouter(d RouterDeps) *gin.Engine {
 	})
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// public share links, authenticated by the share token instead of a project key
+	public := r.Group("/api/v1/public")
+	{
+		public.GET("/share/:token", d.ShareHandler.GetSharedFiles)
+		public.GET("/share/:token/download", d.ShareHandler.DownloadSharedFile)
+	}
+
 	v1 := r.Group("/api/v1")
 	{
 		v1.Use(middleware.ProjectAuth(d.Config, d.DB))
@@ -93,12 +101,17 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			}
 		}
 
+		v1.GET("/edit_strategies", d.SessionHandler.ListEditStrategies)
+
 		session := v1.Group("/session")
 		{
 			session.GET("", d.SessionHandler.GetSessions)
 			session.POST("", d.SessionHandler.CreateSession)
 			session.DELETE("/:session_id", d.SessionHandler.DeleteSession)
 
+			session.GET("/:session_id/children", d.SessionHandler.GetSessionChildren)
+			session.GET("/:session_id/tree", d.SessionHandler.GetSessionTree)
+
 			session.PUT("/:session_id/configs", d.SessionHandler.UpdateConfigs)
 			session.GET("/:session_id/configs", d.SessionHandler.GetConfigs)
 
@@ -106,6 +119,18 @@ func NewRouter(d RouterDeps) *gin.Engine {
 
 			session.POST("/:session_id/messages", d.SessionHandler.StoreMessage)
 			session.GET("/:session_id/messages", d.SessionHandler.GetMessages)
+			session.GET("/:session_id/messages/edit_preview", d.SessionHandler.GetEditPreview)
+			session.PUT("/:session_id/messages/:message_id/protected", d.SessionHandler.SetMessageProtected)
+
+			session.POST("/:session_id/checkpoints", d.SessionHandler.SetCheckpoint)
+			session.GET("/:session_id/checkpoints", d.SessionHandler.ListCheckpoints)
+			session.DELETE("/:session_id/checkpoints/:name", d.SessionHandler.DeleteCheckpoint)
+			session.POST("/:session_id/tools", d.SessionHandler.SetTools)
+			session.GET("/:session_id/tools", d.SessionHandler.GetTools)
+			session.GET("/:session_id/tools/versions", d.SessionHandler.ListTools)
+			session.GET("/:session_id/request", d.SessionHandler.GetRequest)
+			session.GET("/:session_id/integrity", d.SessionHandler.CheckIntegrity)
+			session.POST("/:session_id/integrity", d.SessionHandler.RepairIntegrity)
 
 			session.POST("/:session_id/flush", d.SessionHandler.SessionFlush)
 			session.GET("/:session_id/get_learning_status", d.SessionHandler.GetLearningStatus)
@@ -125,17 +150,42 @@ func NewRouter(d RouterDeps) *gin.Engine {
 			disk.GET("", d.DiskHandler.ListDisks)
 			disk.POST("", d.DiskHandler.CreateDisk)
 			disk.DELETE("/:disk_id", d.DiskHandler.DeleteDisk)
+			disk.POST("/:disk_id/snapshot", d.DiskHandler.CreateDiskSnapshot)
+			disk.GET("/:disk_id/snapshot", d.DiskHandler.ListDiskSnapshots)
+			disk.DELETE("/:disk_id/snapshot/:snapshot_id", d.DiskHandler.DeleteDiskSnapshot)
+			disk.POST("/:disk_id/clone", d.DiskHandler.CloneDisk)
+			disk.POST("/:disk_id/restore", d.DiskHandler.RestoreDiskSnapshot)
+
+			disk.POST("/:disk_id/share", d.ShareHandler.CreateShare)
+			disk.GET("/:disk_id/share", d.ShareHandler.ListShares)
+			disk.DELETE("/:disk_id/share/:share_id", d.ShareHandler.RevokeShare)
 
 			artifact := disk.Group("/:disk_id/artifact")
 			{
 				artifact.POST("", d.ArtifactHandler.UpsertArtifact)
 				artifact.GET("", d.ArtifactHandler.GetArtifact)
 				artifact.PUT("", d.ArtifactHandler.UpdateArtifact)
+				artifact.PATCH("", d.ArtifactHandler.EditArtifact)
 				artifact.DELETE("", d.ArtifactHandler.DeleteArtifact)
 				artifact.GET("/ls", d.ArtifactHandler.ListArtifacts)
 
 				artifact.GET("/grep", d.ArtifactHandler.GrepArtifacts)
 				artifact.GET("/glob", d.ArtifactHandler.GlobArtifacts)
+
+				artifact.GET("/versions", d.ArtifactHandler.ListArtifactVersions)
+				artifact.GET("/diff", d.ArtifactHandler.DiffArtifactVersions)
+				artifact.POST("/restore", d.ArtifactHandler.RestoreArtifactVersion)
+
+				artifact.POST("/mv", d.ArtifactHandler.MoveArtifacts)
+				artifact.POST("/cp", d.ArtifactHandler.CopyArtifacts)
+				artifact.POST("/mkdir", d.ArtifactHandler.MakeDirectory)
+				artifact.DELETE("/dir", d.ArtifactHandler.RemoveDirectory)
+
+				artifact.POST("/upload_url", d.ArtifactHandler.CreateUploadURL)
+				artifact.POST("/finalize", d.ArtifactHandler.FinalizeUpload)
+
+				artifact.POST("/lock", d.ArtifactHandler.LockArtifact)
+				artifact.DELETE("/lock", d.ArtifactHandler.UnlockArtifact)
 			}
 		}
 
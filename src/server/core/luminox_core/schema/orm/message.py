@@ -1,5 +1,5 @@
 from dataclasses import dataclass, field
-from sqlalchemy import String, ForeignKey, Index, CheckConstraint, Column
+from sqlalchemy import String, ForeignKey, Index, CheckConstraint, Column, BigInteger
 from sqlalchemy.orm import relationship
 from sqlalchemy.dialects.postgresql import JSONB, UUID
 from pydantic import BaseModel
@@ -68,6 +68,7 @@ class Message(CommonMixin):
         Index("ix_message_session_id", "session_id"),
         Index("ix_message_parent_id", "parent_id"),
         Index("idx_session_created", "session_id", "created_at"),
+        Index("idx_session_seq", "session_id", "seq"),
     )
 
     session_id: asUUID = field(
@@ -117,6 +118,12 @@ class Message(CommonMixin):
         metadata={"db": Column(String, nullable=False, server_default="pending")},
     )
 
+    # Insertion order of the message in its session, assigned by the API on store
+    seq: int = field(
+        default=0,
+        metadata={"db": Column(BigInteger, nullable=False, server_default="0")},
+    )
+
     # Relationships
     session: "Session" = field(
         init=False, metadata={"db": relationship("Session", back_populates="messages")}
@@ -52,10 +52,10 @@ async def process_session_pending_message(
             if eil:
                 return r
 
-            r = await MD.fetch_previous_messages_by_datetime(
+            r = await MD.fetch_previous_messages(
                 session,
                 session_id,
-                messages[0].created_at,
+                messages[0],
                 limit=project_config.project_session_message_use_previous_messages_turns,
             )
             messages_data = [
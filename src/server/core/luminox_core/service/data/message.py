@@ -1,10 +1,9 @@
 import asyncio
 import json
 from typing import List
-from sqlalchemy import select, func
+from sqlalchemy import select, func, tuple_
 from sqlalchemy.ext.asyncio import AsyncSession
 from pydantic import ValidationError
-from datetime import datetime
 from sqlalchemy import update
 from ...schema.session.task import TaskStatus
 from ...schema.orm import Message, Part, Asset
@@ -146,7 +145,7 @@ async def fetch_session_messages(
             Message.session_id == session_id,
             Message.session_task_process_status == status,
         )
-        .order_by(Message.created_at.asc())
+        .order_by(Message.seq.asc(), Message.created_at.asc(), Message.id.asc())
     )
 
     result = await db_session.execute(query)
@@ -172,7 +171,12 @@ async def get_message_ids(
             Message.session_id == session_id,
             Message.session_task_process_status == status,
         )
-        .order_by(Message.created_at.asc() if asc else Message.created_at.desc())
+        .order_by(
+            *(
+                c.asc() if asc else c.desc()
+                for c in (Message.seq, Message.created_at, Message.id)
+            )
+        )
         .limit(limit)
     )
 
@@ -191,10 +195,12 @@ async def unpending_session_messages_to_running(
             Message.session_task_process_status == TaskStatus.PENDING.value,
         )
         .values(session_task_process_status=TaskStatus.RUNNING.value)
-        .returning(Message.id, Message.created_at)
+        .returning(Message.id, Message.seq, Message.created_at)
     )
     result = await db_session.execute(query)
-    rdp = sorted(result.mappings().all(), key=lambda x: x["created_at"])
+    rdp = sorted(
+        result.mappings().all(), key=lambda x: (x["seq"], x["created_at"], x["id"])
+    )
     message_ids = [rdp["id"] for rdp in rdp]
     await db_session.flush()
     return Result.resolve(message_ids)
@@ -217,18 +223,24 @@ async def check_session_message_status(
     return Result.resolve(status)
 
 
-async def fetch_previous_messages_by_datetime(
-    db_session: AsyncSession, session_id: asUUID, date_time: datetime, limit: int = 10
+async def fetch_previous_messages(
+    db_session: AsyncSession, session_id: asUUID, before: Message, limit: int = 10
 ) -> Result[List[Message]]:
+    """
+    Fetch the messages stored right before `before` in its session, in insertion order.
+    """
+    position = tuple_(Message.seq, Message.created_at, Message.id)
     query = (
-        select(Message.id, Message.created_at)
-        .where(Message.created_at < date_time, Message.session_id == session_id)
-        .order_by(Message.created_at.desc())
+        select(Message.id)
+        .where(
+            Message.session_id == session_id,
+            position < tuple_(before.seq, before.created_at, before.id),
+        )
+        .order_by(Message.seq.desc(), Message.created_at.desc(), Message.id.desc())
         .limit(limit)
     )
     result = await db_session.execute(query)
-    _dp = sorted(result.all(), key=lambda x: x[1])
-    message_ids = [dp[0] for dp in _dp]
+    message_ids = list(reversed(result.scalars().all()))
 
     return await fetch_messages_data_by_ids(db_session, message_ids)
 
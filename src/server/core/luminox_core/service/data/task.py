@@ -10,6 +10,11 @@ from ...schema.utils import asUUID
 from ...schema.session.task import TaskSchema
 
 
+def _raw_message_ids(messages: List[Message]) -> List[asUUID]:
+    """Ids of the task messages in their session insertion order."""
+    return [m.id for m in sorted(messages, key=lambda m: (m.seq, m.created_at))]
+
+
 async def fetch_planning_task(
     db_session: AsyncSession, session_id: asUUID
 ) -> Result[TaskSchema | None]:
@@ -31,9 +36,7 @@ async def fetch_planning_task(
             status=planning.status,
             data=planning.data,
             space_digested=planning.space_digested,
-            raw_message_ids=[
-                msg.id for msg in sorted(planning.messages, key=lambda m: m.created_at)
-            ],
+            raw_message_ids=_raw_message_ids(planning.messages),
         )
     )
 
@@ -52,9 +55,7 @@ async def fetch_task(db_session: AsyncSession, task_id: asUUID) -> Result[TaskSc
             status=task.status,
             data=task.data,
             space_digested=task.space_digested,
-            raw_message_ids=[
-                msg.id for msg in sorted(task.messages, key=lambda m: m.created_at)
-            ],
+            raw_message_ids=_raw_message_ids(task.messages),
         )
     )
 
@@ -81,9 +82,7 @@ async def fetch_current_tasks(
             status=t.status,
             data=t.data,
             space_digested=t.space_digested,
-            raw_message_ids=[
-                msg.id for msg in sorted(t.messages, key=lambda m: m.created_at)
-            ],
+            raw_message_ids=_raw_message_ids(t.messages),
         )
         for t in tasks
     ]